@@ -0,0 +1,196 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/crypt"
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// archiveFilename is the file that transactions removed from filename by
+// archiving are kept in. It's encrypted the same way as the file itself.
+func archiveFilename(filename string) string {
+	return filename + ".archive"
+}
+
+// archive moves changes older than the given number of months that no
+// longer affect any entry out of the file and into its archive file.
+func (u *uiContext) archive(months int) error {
+	if months <= 0 {
+		errColor.Println("months must be at least 1")
+		return nil
+	}
+
+	cutoff := time.Now().AddDate(0, -months, 0)
+	removed, err := u.store.Compact(cutoff.UnixNano())
+	if err != nil {
+		return err
+	}
+
+	if len(removed) == 0 {
+		infoColor.Println("nothing to archive from before", cutoff.Format("2006-01-02"))
+		return nil
+	}
+
+	if err = u.appendArchive(removed); err != nil {
+		return err
+	}
+
+	infoColor.Printf("archived %d changes from before %s to %s\n",
+		len(removed), cutoff.Format("2006-01-02"), shortPath(archiveFilename(u.filename)))
+	return nil
+}
+
+// unarchive moves everything in the archive file back into the file and
+// removes the archive. It saves the file itself so the archive is only
+// removed once its contents are safe.
+func (u *uiContext) unarchive() error {
+	archived, err := u.loadArchive()
+	if err != nil {
+		return err
+	}
+	if archived == nil {
+		infoColor.Println("there is no archive for", u.shortFilename)
+		return nil
+	}
+
+	u.store.ResetSnapshot()
+	u.store.Log = txlogs.Union(archived, u.store.Log)
+	u.store.Archived = 0
+	u.store.Rechain()
+	if err = u.store.UpdateSnapshot(); err != nil {
+		return err
+	}
+
+	if err = u.saveBlob(); err != nil {
+		return err
+	}
+	if err = os.Remove(archiveFilename(u.filename)); err != nil {
+		return err
+	}
+
+	infoColor.Printf("moved %d archived changes back into %s\n", len(archived), u.shortFilename)
+	return nil
+}
+
+// loadArchive returns the archived transactions, nil if there's no archive
+func (u *uiContext) loadArchive() ([]txlogs.Tx, error) {
+	filename := archiveFilename(u.filename)
+	ct, err := ioutil.ReadFile(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	_, _, pt, err := decryptBlob(u, shortPath(filename), ct)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt archive: %w", err)
+	} else if pt == nil {
+		return nil, fmt.Errorf("failed to decrypt archive")
+	}
+
+	return txlogs.NewLog(pt)
+}
+
+// appendArchive adds transactions to the archive file, creating it if
+// necessary.
+func (u *uiContext) appendArchive(txs []txlogs.Tx) error {
+	archived, err := u.loadArchive()
+	if err != nil {
+		return err
+	}
+
+	return u.writeArchive(txlogs.Union(archived, txs))
+}
+
+// writeArchive replaces the contents of the archive file
+func (u *uiContext) writeArchive(txs []txlogs.Tx) error {
+	db := txlogs.DB{Log: txs}
+	pt, err := db.Save()
+	if err != nil {
+		return err
+	}
+
+	params, err := u.makeParams()
+	if err != nil {
+		return err
+	}
+	_, err = crypt.Save(archiveFilename(u.filename), u.version, params, pt)
+	return err
+}
+
+// history shows every snapshot of an entry newest first along with what
+// changed in it, optionally including the changes that have been archived.
+// Secret values are masked unless reveal is set.
+func (u *uiContext) history(search string, withArchive, reveal bool) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	fieldMeta, err := blob.AllFieldMeta()
+	if err != nil {
+		return err
+	}
+
+	store := u.store
+	if withArchive {
+		archived, err := u.loadArchive()
+		if err != nil {
+			return err
+		}
+		if archived == nil {
+			infoColor.Println("there is no archive for", u.shortFilename)
+		}
+		store = blobformat.Blobs{DB: &txlogs.DB{Log: txlogs.Union(archived, u.store.Log)}}
+	} else if u.store.Archived != 0 {
+		infoColor.Printf("changes before %s are archived, use --archive to see them\n",
+			time.Unix(0, u.store.Archived).Format("2006-01-02"))
+	}
+
+	versions := store.NVersions(uuid)
+	for i := 0; i < versions; i++ {
+		info, err := store.SnapshotInfo(uuid, i)
+		if err != nil {
+			return err
+		}
+		d, err := store.DiffSnapshot(uuid, i+1, i)
+		if err != nil {
+			return err
+		}
+
+		lines := diffLines(fieldMeta, d, reveal)
+		created := i == versions-1
+		if len(lines) == 0 && !created {
+			// Only updated or accessed changed
+			continue
+		}
+
+		header := fmt.Sprintf("%s snapshot %d", infoColor.Sprint(info.Time.Format(time.RFC3339)), i)
+		if created {
+			header += " created"
+		}
+		if len(info.Reason) != 0 {
+			header += infoColor.Sprintf(" (%s)", info.Reason)
+		}
+		fmt.Fprintln(u.out, header)
+		for _, l := range lines {
+			fmt.Fprintf(u.out, "  %s\n", l)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,267 @@
+package main
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/chunkstore"
+	"github.com/aarondl/bpass/crypt"
+)
+
+// backupDir is the directory the backups of filename are kept in
+func backupDir(filename string) string {
+	return filename + ".backups"
+}
+
+// openBackups opens the backup store for the file. The key for the store is
+// random and kept in the directory encrypted the same way as the file itself,
+// it's re-encrypted each time so it follows password changes.
+func (u *uiContext) openBackups(create bool) (*chunkstore.Store, error) {
+	key, err := u.backupKey(create)
+	if err != nil || key == nil {
+		return nil, err
+	}
+
+	if err = u.writeBackupKey(key); err != nil {
+		return nil, err
+	}
+
+	return chunkstore.Open(backupDir(u.filename), key)
+}
+
+// backupKey decrypts the key of the backup store, if there's no store it's
+// nil unless create is set in which case a new one is made.
+func (u *uiContext) backupKey(create bool) ([]byte, error) {
+	dir := backupDir(u.filename)
+	keyFile := filepath.Join(dir, "key")
+
+	ct, err := ioutil.ReadFile(keyFile)
+	switch {
+	case err == nil:
+		_, _, key, err := decryptBlob(u, shortPath(keyFile), ct)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decrypt backup key: %w", err)
+		} else if key == nil {
+			return nil, errors.New("failed to decrypt backup key")
+		}
+		return key, nil
+	case os.IsNotExist(err):
+		if !create {
+			return nil, nil
+		}
+		key := make([]byte, chunkstore.KeySize)
+		if _, err = rand.Read(key); err != nil {
+			return nil, err
+		}
+		if err = os.MkdirAll(dir, 0700); err != nil {
+			return nil, err
+		}
+		return key, nil
+	default:
+		return nil, err
+	}
+}
+
+// writeBackupKey encrypts the key of the backup store with the current key
+func (u *uiContext) writeBackupKey(key []byte) error {
+	params, err := u.makeParams()
+	if err != nil {
+		return err
+	}
+
+	_, err = crypt.Save(filepath.Join(backupDir(u.filename), "key"), u.version, params, key)
+	return err
+}
+
+// backup stores the current contents of the file as a backup and deletes all
+// but the newest keep backups.
+func (u *uiContext) backup(data []byte, keep int) error {
+	store, err := u.openBackups(true)
+	if err != nil {
+		return err
+	}
+
+	if _, _, err = store.Put(data); err != nil {
+		return err
+	}
+
+	_, _, err = store.Prune(keep)
+	return err
+}
+
+// listBackups shows all the backups of the file oldest first
+func (u *uiContext) listBackups() error {
+	store, err := u.openBackups(false)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		infoColor.Println("no backups, use --backups to keep them")
+		return nil
+	}
+
+	snaps, err := store.List()
+	if err != nil {
+		return err
+	}
+	if len(snaps) == 0 {
+		infoColor.Println("no backups")
+		return nil
+	}
+
+	for _, s := range snaps {
+		fmt.Printf("%s %s %s\n", keyColor.Sprint(s.ID), s.Time.Format(historyLayout),
+			hideColor.Sprintf("(%d bytes)", s.Size))
+	}
+	return nil
+}
+
+// restoreBackup writes a backup to a new file encrypted the same way as the
+// current file. It never overwrites the file so the restored version can be
+// looked at (or synced) without losing anything.
+func (u *uiContext) restoreBackup(id, to string) error {
+	if _, err := os.Stat(to); err == nil {
+		errColor.Printf("%s already exists, refusing to overwrite it\n", to)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+
+	store, err := u.openBackups(false)
+	if err != nil {
+		return err
+	}
+	if store == nil {
+		errColor.Println("there are no backups")
+		return nil
+	}
+
+	data, err := store.Get(id)
+	if err == chunkstore.ErrNotFound {
+		errColor.Printf("backup %q not found\n", id)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	params, err := u.makeParams()
+	if err != nil {
+		return err
+	}
+	data, err = crypt.Encrypt(u.version, params, data)
+	if err != nil {
+		return err
+	}
+
+	if err = ioutil.WriteFile(to, data, 0600); err != nil {
+		return err
+	}
+
+	infoColor.Printf("restored backup %s to %s\n", id, to)
+	return nil
+}
+
+// copyLayout is the time in the names of copies, it's fixed width so the
+// names sort by time
+const copyLayout = "20060102-150405.000000000"
+
+// keepCopy copies the file as it is on disk to filename.<time>.bak before a
+// save replaces it and removes all but the newest keep copies. Unlike backups
+// they're the encrypted file as it was so they open on their own (with -f)
+// using the passphrase it had then.
+func keepCopy(filename string, keep int) error {
+	b, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	name := fmt.Sprintf("%s.%s.bak", filename, time.Now().UTC().Format(copyLayout))
+	f, err := os.OpenFile(name, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	copies, err := listCopies(filename)
+	if err != nil {
+		return err
+	}
+	for len(copies) > keep {
+		if err = os.Remove(copies[0]); err != nil {
+			return err
+		}
+		copies = copies[1:]
+	}
+
+	return nil
+}
+
+// listCopies returns the copies kept of filename oldest first
+func listCopies(filename string) ([]string, error) {
+	dir, base := filepath.Split(filename)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var copies []string
+	for _, info := range infos {
+		name := info.Name()
+		if !strings.HasPrefix(name, base+".") || !strings.HasSuffix(name, ".bak") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, base+"."), ".bak")
+		if _, err := time.Parse(copyLayout, stamp); err != nil {
+			continue
+		}
+		copies = append(copies, filepath.Join(dir, name))
+	}
+
+	sort.Strings(copies)
+	return copies, nil
+}
+
+// shredCopies offers to destroy the copies kept of the file (see keepCopy),
+// they're whole files so they still have everything the file had when they
+// were made and open with the key it had then. why says what's in them.
+func (u *uiContext) shredCopies(why string) error {
+	copies, err := listCopies(u.filename)
+	if err != nil || len(copies) == 0 {
+		return err
+	}
+
+	errColor.Printf("%d copies of the file kept by --copies %s\n", len(copies), why)
+	if ok, err := u.getYesNo("destroy them?"); err != nil || !ok {
+		return err
+	}
+	for _, c := range copies {
+		if err = shredFile(c); err != nil {
+			return err
+		}
+	}
+
+	infoColor.Printf("destroyed %d copies\n", len(copies))
+	return nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestKeepCopy(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "file.blob")
+
+	// Nothing to copy yet
+	if err = keepCopy(filename, 2); err != nil {
+		t.Fatal(err)
+	}
+
+	// Files that only look like copies are left alone
+	for _, name := range []string{"file.blob.old.bak", "other.blob.20200101-000000.000000000.bak"} {
+		if err = ioutil.WriteFile(filepath.Join(dir, name), nil, 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for i := 0; i < 4; i++ {
+		if err = ioutil.WriteFile(filename, []byte(strconv.Itoa(i)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err = keepCopy(filename, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	copies, err := listCopies(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(copies) != 2 {
+		t.Fatal("expected the newest two copies to be kept:", copies)
+	}
+	for i, c := range copies {
+		b, err := ioutil.ReadFile(c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []byte(strconv.Itoa(i + 2)); !bytes.Equal(b, want) {
+			t.Errorf("%d) copy was %q, want %q", i, b, want)
+		}
+	}
+
+	if err = keepCopy(filename, 0); err != nil {
+		t.Fatal(err)
+	}
+	if copies, err = listCopies(filename); err != nil {
+		t.Fatal(err)
+	} else if len(copies) != 0 {
+		t.Error("expected no copies to be kept:", copies)
+	}
+
+	for _, name := range []string{"file.blob.old.bak", "other.blob.20200101-000000.000000000.bak"} {
+		if _, err = os.Stat(filepath.Join(dir, name)); err != nil {
+			t.Error("a file that isn't a copy was removed:", err)
+		}
+	}
+}
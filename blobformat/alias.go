@@ -0,0 +1,101 @@
+package blobformat
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Alias errors
+var (
+	ErrAliasCycle  = errors.New("alias would create a cycle")
+	ErrAliasBroken = errors.New("alias points to an entry that does not exist")
+)
+
+// Alias returns the uuid of the entry this entry is an alias of, empty if
+// it's not an alias.
+func (b Blob) Alias() string {
+	return b[KeyAlias]
+}
+
+// SetAlias makes the entry uuid an alias of target so that looking up either
+// resolves to target. Aliases may point at other aliases but not in a cycle.
+// An empty target removes the alias.
+func (b Blobs) SetAlias(uuid, target string) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	if len(target) == 0 {
+		if len(blob.Alias()) == 0 {
+			return nil
+		}
+
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeyAlias)
+		return nil
+	}
+
+	chain, err := b.aliasChain(target)
+	if err != nil {
+		return err
+	}
+	for _, c := range chain {
+		if c == uuid {
+			return ErrAliasCycle
+		}
+	}
+
+	_, err = b.setKey(uuid, KeyAlias, target)
+	return err
+}
+
+// Resolve follows aliases starting at uuid and returns the uuid of the entry
+// that is not an alias. If uuid is not an alias it is returned as is.
+func (b Blobs) Resolve(uuid string) (string, error) {
+	chain, err := b.aliasChain(uuid)
+	if err != nil {
+		return "", err
+	}
+
+	return chain[len(chain)-1], nil
+}
+
+// aliasChain returns every uuid visited while resolving uuid, the last
+// element is the resolved entry.
+func (b Blobs) aliasChain(uuid string) ([]string, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	chain := []string{}
+	for {
+		entry, ok := b.DB.Snapshot[uuid]
+		if !ok {
+			if len(chain) == 0 {
+				return nil, ErrNotFound
+			}
+			return nil, fmt.Errorf("%w: %s", ErrAliasBroken, Blob(b.DB.Snapshot[chain[len(chain)-1]]).Name())
+		}
+		if _, ok := seen[uuid]; ok {
+			return nil, ErrAliasCycle
+		}
+
+		seen[uuid] = struct{}{}
+		chain = append(chain, uuid)
+
+		next := Blob(entry).Alias()
+		if len(next) == 0 {
+			return chain, nil
+		}
+		uuid = next
+	}
+}
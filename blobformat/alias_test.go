@@ -0,0 +1,54 @@
+package blobformat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestAlias(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	personal, err := b.New("personal/github")
+	must(t, err)
+	work, err := b.New("work/github")
+	must(t, err)
+	other, err := b.New("other/github")
+	must(t, err)
+
+	if err = b.Set(work, KeyAlias, personal); !IsKeyNotAllowed(err) {
+		t.Error("alias should not be settable directly:", err)
+	}
+
+	must(t, b.SetAlias(work, personal))
+	must(t, b.SetAlias(other, work))
+
+	resolved, err := b.Resolve(other)
+	must(t, err)
+	if resolved != personal {
+		t.Error("should have resolved to personal:", resolved)
+	}
+	if resolved, err = b.Resolve(personal); err != nil || resolved != personal {
+		t.Error("non-alias should resolve to itself:", resolved, err)
+	}
+
+	if err = b.SetAlias(personal, other); err != ErrAliasCycle {
+		t.Error("expected a cycle error:", err)
+	}
+	if err = b.SetAlias(personal, personal); err != ErrAliasCycle {
+		t.Error("expected a cycle error:", err)
+	}
+	if err = b.SetAlias(personal, "nope"); err != ErrNotFound {
+		t.Error("expected not found:", err)
+	}
+
+	must(t, b.Delete(personal))
+	if _, err = b.Resolve(other); !errors.Is(err, ErrAliasBroken) {
+		t.Error("expected broken alias:", err)
+	}
+
+	must(t, b.SetAlias(work, ""))
+	if resolved, err = b.Resolve(other); err != nil || resolved != work {
+		t.Error("should resolve to work now:", resolved, err)
+	}
+}
@@ -0,0 +1,58 @@
+package blobformat
+
+import (
+	"strconv"
+	"time"
+)
+
+// Tx is a set of changes being made by Blobs.Batch. It has all the methods of
+// Blobs, changes made through it are only kept if the batch succeeds.
+type Tx struct {
+	Blobs
+}
+
+// batch tracks the entries changed during a Batch so each has its updated
+// key set once at the end instead of once per change.
+type batch struct {
+	touched map[string]struct{}
+	order   []string
+}
+
+// Batch runs fn and commits all the changes it made through tx at once. If fn
+// returns an error (or one of the changes fails) none of them are kept.
+// Every entry that was changed gets a single updated timestamp no matter how
+// many changes were made to it.
+//
+// Batch must not be called inside of DB.Do or another Batch.
+func (b Blobs) Batch(fn func(tx *Tx) error) error {
+	tx := &Tx{Blobs: b}
+	tx.batch = &batch{touched: make(map[string]struct{})}
+
+	return b.DB.Do(func() error {
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		if err := b.UpdateSnapshot(); err != nil {
+			return err
+		}
+
+		now := strconv.FormatInt(time.Now().UnixNano(), 10)
+		for _, uuid := range tx.batch.order {
+			// Deleted entries got their final updated already
+			if _, ok := b.DB.Snapshot[uuid]; ok {
+				b.DB.Set(uuid, KeyUpdated, now)
+			}
+		}
+		return nil
+	})
+}
+
+func (bt *batch) touch(uuid string) {
+	if _, ok := bt.touched[uuid]; ok {
+		return
+	}
+
+	bt.touched[uuid] = struct{}{}
+	bt.order = append(bt.order, uuid)
+}
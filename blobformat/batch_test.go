@@ -0,0 +1,101 @@
+package blobformat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestBatch(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("entry")
+	must(t, err)
+	gone, err := b.New("gone")
+	must(t, err)
+
+	before := len(b.DB.KeyHistory(uuid, KeyUpdated))
+	err = b.Batch(func(tx *Tx) error {
+		if err := tx.Set(uuid, KeyUser, "user"); err != nil {
+			return err
+		}
+		if err := tx.Set(uuid, KeyPass, "pass"); err != nil {
+			return err
+		}
+		if err := tx.SetNotes(uuid, []Note{{Text: "one"}, {Text: "two"}}); err != nil {
+			return err
+		}
+		return tx.Delete(gone)
+	})
+	must(t, err)
+
+	if n := len(b.DB.KeyHistory(uuid, KeyUpdated)) - before; n != 1 {
+		t.Error("expected a single updated change, got:", n)
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyUser] != "user" || blob[KeyPass] != "pass" || len(blob.Notes()) != 2 {
+		t.Error("changes were not kept:", blob)
+	}
+	if blob, err := b.Find(gone); err != nil || blob != nil {
+		t.Error("entry should be deleted:", blob, err)
+	}
+
+	// Blobs outside the batch go back to updating on every change
+	before = len(b.DB.KeyHistory(uuid, KeyUpdated))
+	must(t, b.Set(uuid, KeyUser, "other"))
+	if n := len(b.DB.KeyHistory(uuid, KeyUpdated)) - before; n != 1 {
+		t.Error("expected updated to change after the batch, got:", n)
+	}
+}
+
+func TestBatchRollback(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("entry")
+	must(t, err)
+	must(t, b.Set(uuid, KeyUser, "user"))
+
+	logLen := len(b.DB.Log)
+	errBail := errors.New("bail")
+	err = b.Batch(func(tx *Tx) error {
+		if err := tx.Set(uuid, KeyUser, "changed"); err != nil {
+			return err
+		}
+		if _, err := tx.New("new"); err != nil {
+			return err
+		}
+		return errBail
+	})
+	if err != errBail {
+		t.Fatal("expected the error from the batch, got:", err)
+	}
+
+	if len(b.DB.Log) != logLen {
+		t.Error("log should be unchanged", logLen, len(b.DB.Log))
+	}
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyUser] != "user" {
+		t.Error("change should be rolled back:", blob[KeyUser])
+	}
+	if _, blob, err := b.FindByName("new"); err != nil || blob != nil {
+		t.Error("new entry should be rolled back:", blob, err)
+	}
+
+	// A failing change rolls back everything before it
+	err = b.Batch(func(tx *Tx) error {
+		if err := tx.Set(uuid, KeyUser, "changed"); err != nil {
+			return err
+		}
+		return tx.Set(uuid, KeyCreated, "0")
+	})
+	if !IsKeyNotAllowed(err) {
+		t.Error("expected key not allowed:", err)
+	}
+	if len(b.DB.Log) != logLen {
+		t.Error("log should be unchanged", logLen, len(b.DB.Log))
+	}
+}
@@ -36,10 +36,8 @@ func (b Blob) Name() string {
 // Get a specific value. Panics if name is not found. Special keys require the
 // use of specific getters: labels, notes, twofactor, updated etc.
 func (b Blob) Get(key string) string {
-	for _, p := range protectedKeys {
-		if strings.EqualFold(key, p) {
-			panic(fmt.Sprintf("key %s cannot be retrieved with Get()", p))
-		}
+	if isProtected(key) {
+		panic(fmt.Sprintf("key %s cannot be retrieved with Get()", key))
 	}
 
 	return b[key]
@@ -50,13 +48,45 @@ func (b Blob) Get(key string) string {
 // be empty but err will also be nil. If the otp library returns an error
 // it will be propagated here.
 //
-// This uses the TOTP algorithm (Google-Authenticator like).
+// This uses the TOTP algorithm (Google-Authenticator like) with the digits,
+// period and algorithm given in the uri, or Steam Guard's variant of it for
+// uris with encoder=steam. For HOTP keys ErrHOTP is returned (see
+// Blobs.NextTwoFactor). Keys kept on a YubiKey have their codes generated by
+// the device, see YubiKeyCode.
 func (b Blob) TwoFactor() (string, error) {
-	twoFactorURI := b[KeyTwoFactor]
+	return b.twoFactorAt(b[KeyTwoFactor], time.Now())
+}
+
+// TwoFactorWithExpiry is TwoFactor but also returns how long the code is valid
+// for before the next one takes over.
+func (b Blob) TwoFactorWithExpiry() (code string, remaining time.Duration, err error) {
+	return b.twoFactorWithExpiry(b[KeyTwoFactor])
+}
 
+func (b Blob) twoFactorWithExpiry(twoFactorURI string) (code string, remaining time.Duration, err error) {
+	now := time.Now()
+	code, err = b.twoFactorAt(twoFactorURI, now)
+	if err != nil || len(code) == 0 {
+		return code, 0, err
+	}
+
+	opts, err := parseOTPOptions(twoFactorURI)
+	if err != nil {
+		return "", 0, err
+	}
+	period := int64(time.Duration(opts.Period) * time.Second)
+	return code, time.Duration(period - now.UnixNano()%period), nil
+}
+
+// twoFactorAt returns the TOTP code of twoFactorURI at time t, YubiKeys only
+// give out the current code so t is ignored for keys kept on one.
+func (b Blob) twoFactorAt(twoFactorURI string, t time.Time) (string, error) {
 	if len(twoFactorURI) == 0 {
 		return "", nil
 	}
+	if account, ok := yubiKeyAccount(twoFactorURI); ok {
+		return yubiKeyCode(account)
+	}
 
 	key, err := otp.NewKeyFromURL(twoFactorURI)
 	if err != nil {
@@ -64,11 +94,28 @@ func (b Blob) TwoFactor() (string, error) {
 	}
 
 	// There's no constant for totp here
-	if key.Type() != "totp" {
-		return "", fmt.Errorf("two factor key for %s was not a totp key", b.Name())
+	switch key.Type() {
+	case "totp":
+	case "hotp":
+		return "", ErrHOTP
+	default:
+		return "", fmt.Errorf("two factor key for %s was not a totp or hotp key", b.Name())
+	}
+
+	opts, err := parseOTPOptions(twoFactorURI)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse two factor uri for %s: %w", b.Name(), err)
+	}
+
+	if opts.Steam {
+		return steamCode(key.Secret(), uint64(t.Unix())/uint64(opts.Period))
 	}
 
-	code, err := totp.GenerateCode(key.Secret(), time.Now().UTC())
+	code, err := totp.GenerateCodeCustom(key.Secret(), t.UTC(), totp.ValidateOpts{
+		Period:    opts.Period,
+		Digits:    opts.Digits,
+		Algorithm: opts.Algorithm,
+	})
 	if err != nil {
 		return "", err
 	}
@@ -92,6 +139,52 @@ func (b Blob) Updated() (time.Time, error) {
 	return b.getTimestamp(KeyUpdated)
 }
 
+// Created timestamp, if not set it will be time's zero value, returns an error
+// if the underlying type was wrong. Entries made before this was recorded
+// don't have one.
+func (b Blob) Created() (time.Time, error) {
+	return b.getTimestamp(KeyCreated)
+}
+
+// Accessed timestamp, only set when access tracking is turned on. If not set
+// it will be time's zero value, returns an error if the underlying type was
+// wrong.
+func (b Blob) Accessed() (time.Time, error) {
+	return b.getTimestamp(KeyAccessed)
+}
+
+// LastTouched returns the latest of the created, updated and accessed
+// timestamps.
+func (b Blob) LastTouched() (last time.Time, err error) {
+	for _, k := range []string{KeyCreated, KeyUpdated, KeyAccessed} {
+		t, err := b.getTimestamp(k)
+		if err != nil {
+			return last, err
+		}
+		if t.After(last) {
+			last = t
+		}
+	}
+
+	return last, nil
+}
+
+// Expires timestamp, if not set it will be time's zero value, returns an error
+// if the underlying type was wrong.
+func (b Blob) Expires() (time.Time, error) {
+	return b.getTimestamp(KeyExpires)
+}
+
+// IsExpired returns true if the entry has an expiry that is not after now.
+func (b Blob) IsExpired(now time.Time) (bool, error) {
+	expires, err := b.Expires()
+	if err != nil || expires.IsZero() {
+		return false, err
+	}
+
+	return !expires.After(now), nil
+}
+
 func (b Blob) getTimestamp(key string) (time.Time, error) {
 	timestamp, ok := txlogs.Entry(b)[key]
 	if !ok {
@@ -105,3 +198,13 @@ func (b Blob) getTimestamp(key string) (time.Time, error) {
 
 	return time.Unix(0, ts), nil
 }
+
+// isProtected checks if key is one of the protected keys
+func isProtected(key string) bool {
+	for _, p := range protectedKeys {
+		if strings.EqualFold(key, p) {
+			return true
+		}
+	}
+	return false
+}
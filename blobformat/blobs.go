@@ -4,11 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"net/url"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/aarondl/bpass/fuzzy"
 	"github.com/aarondl/bpass/txlogs"
 
 	"github.com/pquerna/otp"
@@ -18,12 +18,13 @@ import (
 var (
 	ErrNameNotUnique = errors.New("name is not unique")
 	ErrKeyNotAllowed = errors.New("key is not allowed")
+	ErrNotFound      = errors.New("entry not found")
 )
 
 type keyNotAllowed string
 
 func (k keyNotAllowed) Error() string {
-	return fmt.Sprintf("%q may not be set", k)
+	return fmt.Sprintf("%q may not be set", string(k))
 }
 
 // IsKeyNotAllowed checks if the error is a key error (some keys cannot
@@ -38,6 +39,26 @@ func IsKeyNotAllowed(err error) bool {
 // updated and snapshots will probably be mishandled.
 type Blobs struct {
 	*txlogs.DB
+
+	// Validators are run before New, Rename, Set, SetTwofactor and DeleteKey
+	// change an entry, see Validator.
+	Validators []Validator
+
+	// FoldNames makes names that only differ by case or unicode normalization
+	// ("GitHub" and "github") the same name. Finding and searching ignores
+	// the difference, New and Rename refuse to create such duplicates and
+	// store names with their accents composed (NFC).
+	FoldNames bool
+	// NameRules are applied to names of new and renamed entries, see
+	// NormalizeNames for bringing existing names in line.
+	NameRules NameRules
+	// Index makes Search faster for large files, nil searches every entry
+	Index *SearchIndex
+
+	// batch is set while changes are being made by Batch
+	batch *batch
+	// force allows changing protected entries, see Force
+	force bool
 }
 
 // SearchResults have helpers to get uuids/names easily
@@ -78,14 +99,87 @@ func (b Blobs) RenameDuplicates() (map[string]string, error) {
 	return renames, nil
 }
 
+// Check the structure of the underlying log (see txlogs.DB.Check) and that
+// every entry has a unique name and timestamps that parse. All problems found
+// are returned, nil means there were none.
+func (b Blobs) Check() (problems []error) {
+	problems = b.DB.Check()
+	if len(problems) != 0 {
+		// The snapshot can't be trusted to be built correctly
+		return problems
+	}
+
+	snapshot, err := b.DB.SnapshotAt(0)
+	if err != nil {
+		return append(problems, err)
+	}
+
+	names := make(map[string]string)
+	for uuid, entry := range snapshot {
+		blob := Blob(entry)
+
+		name, ok := blob[KeyName]
+		if !ok || len(name) == 0 {
+			problems = append(problems, fmt.Errorf("%s: has no name", uuid))
+		} else if other, ok := names[name]; ok {
+			problems = append(problems, fmt.Errorf("%s: name %q is also used by %s", uuid, name, other))
+		} else {
+			names[name] = uuid
+		}
+
+		for _, k := range []string{KeyCreated, KeyUpdated, KeyAccessed, KeyExpires, KeyCheckoutTime, KeyImported} {
+			if _, err := blob.getTimestamp(k); err != nil {
+				problems = append(problems, fmt.Errorf("%s: %s: %w", uuid, k, err))
+			}
+		}
+	}
+
+	return problems
+}
+
+// Scope is which entries a search looks through
+type Scope int
+
+// Scopes for SearchScoped
+const (
+	// ScopeActive is every entry that's not in the trash
+	ScopeActive Scope = iota
+	// ScopeTrash is only the entries in the trash
+	ScopeTrash
+	// ScopeAll is every entry
+	ScopeAll
+)
+
+// includes checks if an entry with the given name is in the scope
+func (s Scope) includes(name string) bool {
+	switch s {
+	case ScopeActive:
+		return !IsTrashEntry(name)
+	case ScopeTrash:
+		return IsTrashEntry(name)
+	}
+	return true
+}
+
 // Search names of entries using fuzzy search and breaks on /
 // to help organization. The returned list of names is not sorted.
 //
-// If search is empty, all results names returned.
+// If search is empty, all results names returned. Entries in the trash are
+// only returned when the search starts with trash/, use SearchScoped to
+// choose which entries are searched.
 //
 // Most other commands will require a fully qualified name of an entry to
 // manipulate.
 func (b Blobs) Search(search string) (entries SearchResults, err error) {
+	scope := ScopeActive
+	if IsTrashEntry(search) {
+		scope = ScopeTrash
+	}
+	return b.SearchScoped(search, scope)
+}
+
+// SearchScoped is Search but only looks through the entries in scope
+func (b Blobs) SearchScoped(search string, scope Scope) (entries SearchResults, err error) {
 	if err := b.UpdateSnapshot(); err != nil {
 		return nil, err
 	}
@@ -94,20 +188,34 @@ func (b Blobs) Search(search string) (entries SearchResults, err error) {
 		return nil, nil
 	}
 	if len(search) == 0 {
-		return b.allEntries(), nil
+		return b.allEntries(scope), nil
 	}
 
 	entries = make(map[string]string)
 	fragments := strings.Split(search, "/")
 	nFrags := len(fragments)
 
+	var uuids []string
+	if b.Index != nil {
+		b.Index.update(b.DB)
+		uuids = b.Index.candidates(search, b.FoldNames)
+	} else {
+		uuids = make([]string, 0, len(b.DB.Snapshot))
+		for uuid := range b.DB.Snapshot {
+			uuids = append(uuids, uuid)
+		}
+	}
+
 AllKeys:
-	for uuid, entry := range b.DB.Snapshot {
-		blob := Blob(entry)
+	for _, uuid := range uuids {
+		blob := Blob(b.DB.Snapshot[uuid])
 		name := blob.Name()
+		if !scope.includes(name) {
+			continue
+		}
 
 		if len(fragments) == 1 {
-			if !fuzzy.Match(name, fragments[0]) {
+			if !b.matchName(name, fragments[0]) {
 				continue AllKeys
 			}
 		} else {
@@ -117,7 +225,7 @@ AllKeys:
 			}
 
 			for i, f := range fragments {
-				if !fuzzy.Match(keyFrags[i], f) {
+				if !b.matchName(keyFrags[i], f) {
 					continue AllKeys
 				}
 			}
@@ -129,6 +237,55 @@ AllKeys:
 	return entries, nil
 }
 
+// Ranked is an entry found by SearchRanked and how well it matched
+type Ranked struct {
+	UUID  string
+	Name  string
+	Score int
+}
+
+// SearchRanked finds entries the same way as Search but returns them best
+// match first, at most max of them (all of them if max is 0). Matches are
+// scored by fuzzy.Score, ties go to the shorter name.
+func (b Blobs) SearchRanked(search string, max int) ([]Ranked, error) {
+	entries, err := b.Search(search)
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+
+	fragments := strings.Split(search, "/")
+	ranked := make([]Ranked, 0, len(entries))
+	for uuid, name := range entries {
+		r := Ranked{UUID: uuid, Name: name}
+		if len(fragments) == 1 {
+			r.Score, _ = b.scoreName(name, search)
+		} else {
+			keyFrags := strings.Split(name, "/")
+			for i, f := range fragments {
+				score, _ := b.scoreName(keyFrags[i], f)
+				r.Score += score
+			}
+		}
+		ranked = append(ranked, r)
+	}
+
+	sort.Slice(ranked, func(i, j int) bool {
+		a, b := ranked[i], ranked[j]
+		switch {
+		case a.Score != b.Score:
+			return a.Score > b.Score
+		case len(a.Name) != len(b.Name):
+			return len(a.Name) < len(b.Name)
+		}
+		return a.Name < b.Name
+	})
+
+	if max > 0 && len(ranked) > max {
+		ranked = ranked[:max]
+	}
+	return ranked, nil
+}
+
 // SearchLabels searches by finding all entries with all the labels given.
 func (b Blobs) SearchLabels(labels ...string) (entries SearchResults, err error) {
 	if err := b.UpdateSnapshot(); err != nil {
@@ -139,12 +296,15 @@ func (b Blobs) SearchLabels(labels ...string) (entries SearchResults, err error)
 		return nil, nil
 	}
 	if len(labels) == 0 {
-		return b.allEntries(), nil
+		return b.allEntries(ScopeActive), nil
 	}
 
 	entries = make(map[string]string)
 	for uuid, entry := range b.DB.Snapshot {
 		blob := Blob(entry)
+		if !ScopeActive.includes(blob.Name()) {
+			continue
+		}
 
 		lblVal := blob[KeyLabels]
 		if len(lblVal) == 0 {
@@ -175,6 +335,51 @@ func (b Blobs) SearchLabels(labels ...string) (entries SearchResults, err error)
 	return entries, nil
 }
 
+// FindByLabel finds the entries that have every one of the labels given, a
+// label can list alternatives separated by | to match entries with any of
+// them. So "work", "aws|gcp" finds entries labeled work and either aws or
+// gcp.
+func (b Blobs) FindByLabel(labels ...string) (entries SearchResults, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	if len(b.DB.Snapshot) == 0 {
+		return nil, nil
+	}
+	if len(labels) == 0 {
+		return b.allEntries(ScopeActive), nil
+	}
+
+	entries = make(map[string]string)
+Entries:
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		if !ScopeActive.includes(blob.Name()) {
+			continue
+		}
+
+		have := make(map[string]bool)
+		for _, l := range blob.Labels() {
+			have[l] = true
+		}
+
+	Labels:
+		for _, want := range labels {
+			for _, alt := range strings.Split(want, "|") {
+				if have[alt] {
+					continue Labels
+				}
+			}
+			continue Entries
+		}
+
+		entries[uuid] = blob.Name()
+	}
+
+	return entries, nil
+}
+
 // Find returns nil if it does not find the object searched for.
 // Error does not occur unless something unexpected happened. This is slightly
 // useful because it calls UpdateSnapshot for you which does not happen
@@ -207,20 +412,42 @@ func (b Blobs) MustFind(uuid string) (Blob, error) {
 
 // FindByName returns "", nil if it does not find the
 // object. Error does not occur unless something unexpected
-// happened.
+// happened. An exact match is preferred over one that only matches with
+// FoldNames or after applying the NameRules.
 func (b Blobs) FindByName(name string) (string, Blob, error) {
 	if err := b.UpdateSnapshot(); err != nil {
 		return "", nil, err
 	}
 
+	normalized := b.normalizeName(name)
+	var foldUUID string
+	var foldBlob Blob
 	for uuid, entry := range b.DB.Snapshot {
 		blob := Blob(entry)
 		if blob.Name() == name {
 			return uuid, blob, nil
 		}
+		if b.sameName(blob.Name(), normalized) {
+			foldUUID, foldBlob = uuid, blob
+		}
 	}
 
-	return "", nil, nil
+	return foldUUID, foldBlob, nil
+}
+
+// Lookup finds an entry by its uuid or, failing that, its exact name. The
+// uuid never changes for the life of an entry so it's a stable way to refer
+// to it across renames. Returns "", nil if nothing was found.
+func (b Blobs) Lookup(uuidOrName string) (string, Blob, error) {
+	blob, err := b.Find(uuidOrName)
+	if err != nil {
+		return "", nil, err
+	}
+	if blob != nil {
+		return uuidOrName, blob, nil
+	}
+
+	return b.FindByName(uuidOrName)
 }
 
 // FindUser return "", nil if the user could not be found.
@@ -242,15 +469,18 @@ func (b Blobs) MustFindUser(username string) (string, Blob, error) {
 	return uuid, blob, nil
 }
 
-func (b Blobs) allEntries() (entries SearchResults) {
+func (b Blobs) allEntries(scope Scope) (entries SearchResults) {
 	if len(b.DB.Snapshot) == 0 {
 		return nil
 	}
 
 	entries = make(map[string]string)
 	for uuid, entry := range b.DB.Snapshot {
-		blob := Blob(entry)
-		entries[uuid] = blob.Name()
+		name := Blob(entry).Name()
+		if !scope.includes(name) {
+			continue
+		}
+		entries[uuid] = name
 	}
 	return entries
 }
@@ -281,6 +511,31 @@ func (s SearchResults) Names() []string {
 	return names
 }
 
+// Page returns the uuids of a page of the results sorted by name, skipping
+// the first offset and returning at most limit of them (all the rest if limit
+// is 0).
+func (s SearchResults) Page(offset, limit int) []string {
+	if offset >= len(s) {
+		return nil
+	}
+
+	uuids := s.UUIDs()
+	sort.Slice(uuids, func(i, j int) bool {
+		if s[uuids[i]] != s[uuids[j]] {
+			return s[uuids[i]] < s[uuids[j]]
+		}
+		return uuids[i] < uuids[j]
+	})
+
+	if offset > 0 {
+		uuids = uuids[offset:]
+	}
+	if limit > 0 && len(uuids) > limit {
+		uuids = uuids[:limit]
+	}
+	return uuids
+}
+
 // Users finds all the users in the system
 func (b Blobs) Users() (results SearchResults, err error) {
 	if err = b.UpdateSnapshot(); err != nil {
@@ -308,13 +563,17 @@ func (b Blobs) Users() (results SearchResults, err error) {
 // is not unique. The entry is not immediately inserted but instead returned
 // so things may be added to it before its stored with the Add function.
 func (b Blobs) New(name string) (uuid string, err error) {
+	name = b.normalizeName(name)
+	if err = b.validate(name, KeyName, name); err != nil {
+		return "", err
+	}
 	if err = b.UpdateSnapshot(); err != nil {
 		return "", err
 	}
 
 	for _, entry := range b.DB.Snapshot {
 		blob := Blob(entry)
-		if name == blob.Name() {
+		if b.sameName(name, blob.Name()) {
 			return "", ErrNameNotUnique
 		}
 	}
@@ -323,61 +582,136 @@ func (b Blobs) New(name string) (uuid string, err error) {
 	if err != nil {
 		return "", err
 	}
-	b.touchUpdated(uuid)
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	b.DB.Set(uuid, KeyCreated, now)
+	b.DB.Set(uuid, KeyUpdated, now)
 	b.DB.Set(uuid, KeyName, name)
 
 	return uuid, nil
 }
 
 // Rename a specific uuid to a new name, returns ErrNameNotUnique if not
-// possible.
+// possible. The entry keeps its uuid so its history is unaffected.
 func (b Blobs) Rename(uuid, newName string) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
 	if err := b.UpdateSnapshot(); err != nil {
 		return err
 	}
 
-	for _, entry := range b.DB.Snapshot {
+	newName = b.normalizeName(newName)
+	entry, ok := b.DB.Snapshot[uuid]
+	if !ok {
+		return ErrNotFound
+	}
+	if Blob(entry).Name() == newName {
+		return nil
+	}
+	if err := b.validate(newName, KeyName, newName); err != nil {
+		return err
+	}
+
+	for otherUUID, entry := range b.DB.Snapshot {
 		blob := Blob(entry)
-		if blob.Name() == newName {
+		if otherUUID != uuid && b.sameName(blob.Name(), newName) {
 			return ErrNameNotUnique
 		}
 	}
 
-	_, ok := b.DB.Snapshot[uuid]
-	if !ok {
-		return errors.New("uuid not found")
-	}
-
 	b.touchUpdated(uuid)
 	b.DB.Set(uuid, KeyName, newName)
 	return nil
 }
 
+// Delete an entry. Before the entry is removed a tombstone marker (the
+// deleted key) is written to it along with a fresh updated timestamp. This
+// means the final state of the entry and the time it was deleted remain in
+// the log for history and for sync/merge to reason about.
+func (b Blobs) Delete(uuid string) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	if err := b.UpdateSnapshot(); err != nil {
+		return err
+	}
+
+	if _, ok := b.DB.Snapshot[uuid]; !ok {
+		return ErrNotFound
+	}
+
+	now := strconv.FormatInt(time.Now().UnixNano(), 10)
+	b.DB.Set(uuid, KeyUpdated, now)
+	b.DB.Set(uuid, KeyDeleted, now)
+	b.DB.Delete(uuid)
+	return nil
+}
+
 // Set the key in name to value, properly updates 'updated' and 'snapshots'.
 // returns keyNotAllowed error if a protected key is attempted to be set.
 // To update protected keys like: labels, notes, twofactor, updated you must
 // use the specific setters.
+//
+// If the key has a type (see SetValue) the value must be of that type.
 func (b Blobs) Set(uuid, key, value string) error {
-	for _, p := range protectedKeys {
-		if strings.EqualFold(key, p) {
-			return keyNotAllowed(key)
-		}
+	if err := b.checkType(uuid, key, value); err != nil {
+		return err
 	}
 
-	b.touchUpdated(uuid)
-	b.DB.Set(uuid, key, value)
-	return nil
+	return b.set(uuid, key, value)
+}
+
+func (b Blobs) set(uuid, key, value string) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	if isProtected(key) {
+		return keyNotAllowed(key)
+	}
+	if err := b.validateEntry(uuid, key, value); err != nil {
+		return err
+	}
+
+	if changed, err := b.setKey(uuid, key, value); err != nil || !changed {
+		return err
+	}
+	return b.redactHistory(uuid, key)
 }
 
 // DeleteKey from an entry, follows the rules of Set() for protected keys.
+// Validators see it as the key being set to an empty value.
 func (b Blobs) DeleteKey(uuid, key string) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
 	switch key {
-	case KeyName, KeyUpdated:
+	case KeyName, KeyCreated, KeyUpdated, KeyAccessed, KeyDeleted, KeyExpires:
 		return keyNotAllowed(key)
 	}
+	if err := b.validateEntry(uuid, key, ""); err != nil {
+		return err
+	}
+	if err := b.UpdateSnapshot(); err != nil {
+		return err
+	}
+	if _, ok := b.DB.Snapshot[uuid][key]; !ok {
+		return nil
+	}
 
 	b.touchUpdated(uuid)
 	b.DB.DeleteKey(uuid, key)
+
+	// Metadata for a key that's gone is meaningless
+	if key != KeyFieldMeta {
+		if err := b.redactHistory(uuid, key); err != nil {
+			return err
+		}
+		return b.SetFieldMeta(uuid, key, FieldMeta{})
+	}
 	return nil
 }
 
@@ -386,16 +720,47 @@ func (b Blobs) DeleteKey(uuid, key string) error {
 //
 // This function accepts values in two formats, it may be a simple secret
 // key value like JBSWY3DPEHPK3PXP in which case it will coerced into a totp
-// url.
+// url. A secret prefixed with steam: (steam:JBSWY3DPEHPK3PXP) is made into a
+// Steam Guard one (encoder=steam). yubikey:<account> keeps the secret out of
+// the file, codes come from the OATH account on a YubiKey (see YubiKeyCode).
 //
 // Reference for format:
 // https://github.com/google/google-authenticator/wiki/Key-Uri-Format
 func (b Blobs) SetTwofactor(uuid, uriOrKey string) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	uri, err := twoFactorURIFromKey(uuid, uriOrKey)
+	if err != nil {
+		return err
+	}
+	if err = b.validateEntry(uuid, KeyTwoFactor, uri); err != nil {
+		return err
+	}
+
+	return b.setTwoFactorURI(uuid, "", uri)
+}
+
+// twoFactorURIFromKey turns a secret key into a totp uri (see SetTwofactor)
+// and checks that the uri can be used to generate codes.
+func twoFactorURIFromKey(uuid, uriOrKey string) (string, error) {
+	if account, ok := yubiKeyAccount(uriOrKey); ok {
+		if len(strings.TrimSpace(account)) == 0 {
+			return "", errors.New("could not set two factor key, yubikey account name is empty")
+		}
+		return uriOrKey, nil
+	}
+
 	var uri string
 	if strings.HasPrefix(uriOrKey, "otpauth://") {
 		uri = uriOrKey
 	} else {
 		vals := make(url.Values)
+		if strings.HasPrefix(uriOrKey, steamPrefix) {
+			uriOrKey = strings.TrimPrefix(uriOrKey, steamPrefix)
+			vals.Set("encoder", "steam")
+		}
 		vals.Set("secret", uriOrKey)
 		uri = fmt.Sprintf("otpauth://totp/%s?%s",
 			url.PathEscape("bpass:"+uuid),
@@ -405,16 +770,76 @@ func (b Blobs) SetTwofactor(uuid, uriOrKey string) error {
 
 	_, err := otp.NewKeyFromURL(uri)
 	if err != nil {
-		return fmt.Errorf("could not set two factor key, uri wouldn't parse: %w", err)
+		return "", fmt.Errorf("could not set two factor key, uri wouldn't parse: %w", err)
+	}
+	if _, err = parseOTPOptions(uri); err != nil {
+		return "", fmt.Errorf("could not set two factor key: %w", err)
 	}
 
-	b.touchUpdated(uuid)
-	b.DB.Set(uuid, KeyTwoFactor, uri)
-	return nil
+	return uri, nil
+}
+
+// SetExpires sets when the credentials in the entry should be rotated by,
+// a zero time removes the expiry.
+func (b Blobs) SetExpires(uuid string, expires time.Time) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	if expires.IsZero() {
+		if _, ok := blob[KeyExpires]; !ok {
+			return nil
+		}
+
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeyExpires)
+		return nil
+	}
+
+	_, err = b.setKey(uuid, KeyExpires, strconv.FormatInt(expires.UnixNano(), 10))
+	return err
+}
+
+// Expired returns all entries whose expiry is not after now.
+func (b Blobs) Expired(now time.Time) (entries SearchResults, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries = make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+
+		if IsTrashEntry(blob.Name()) {
+			continue
+		}
+
+		expired, err := blob.IsExpired(now)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check expiry of %s: %w", blob.Name(), err)
+		}
+		if expired {
+			entries[uuid] = blob.Name()
+		}
+	}
+
+	return entries, nil
 }
 
 // AddLabel to entry.
 func (b Blobs) AddLabel(uuid, label string) (err error) {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
 	entry, err := b.MustFind(uuid)
 	if err != nil {
 		return err
@@ -425,16 +850,24 @@ func (b Blobs) AddLabel(uuid, label string) (err error) {
 		labelVal = label
 	} else {
 		labels := strings.Split(labelVal, ",")
+		for _, l := range labels {
+			if l == label {
+				return nil
+			}
+		}
 		labels = append(labels, label)
 		labelVal = strings.Join(labels, ",")
 	}
 
-	b.touchUpdated(uuid)
 	return b.Set(uuid, KeyLabels, labelVal)
 }
 
 // RemoveLabel from uuid using the list element's index
 func (b Blobs) RemoveLabel(uuid string, index int) (err error) {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
 	entry, err := b.MustFind(uuid)
 	if err != nil {
 		return err
@@ -486,11 +919,22 @@ func (b Blobs) NewUser(name string) (uuid string, err error) {
 	return b.New(userPrefix + name)
 }
 
+// IsSyncEntry checks to see if the name is a sync entry
+func IsSyncEntry(name string) bool {
+	return strings.HasPrefix(name, syncPrefix)
+}
+
 // IsUserEntry checks to see if the name conforms to user standards
 func IsUserEntry(name string) bool {
 	return strings.HasPrefix(name, userPrefix)
 }
 
+// isSystemEntry is true for entries bpass keeps for itself (users, syncs,
+// templates, searches and the trash) rather than the user's own
+func isSystemEntry(name string) bool {
+	return IsUserEntry(name) || IsSyncEntry(name) || IsTemplateEntry(name) || IsSearchEntry(name) || IsTrashEntry(name)
+}
+
 // SplitUsername returns a username from an entry name, returns empty string
 // if this was not a proper user entryname
 func SplitUsername(entryname string) string {
@@ -502,7 +946,171 @@ func SplitUsername(entryname string) string {
 	return entryname[index+len(userPrefix):]
 }
 
+// SamePassword returns the other entries that have the same password as the
+// entry with the given uuid.
+func (b Blobs) SamePassword(uuid string) (entries SearchResults, err error) {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, ErrNotFound
+	}
+
+	entries = make(map[string]string)
+	pass := blob[KeyPass]
+	if len(pass) == 0 {
+		return entries, nil
+	}
+
+	for otherUUID, entry := range b.DB.Snapshot {
+		other := Blob(entry)
+		name := other.Name()
+		if otherUUID == uuid || IsUserEntry(name) || IsSyncEntry(name) || !ScopeActive.includes(name) {
+			continue
+		}
+
+		if other[KeyPass] == pass {
+			entries[otherUUID] = name
+		}
+	}
+
+	return entries, nil
+}
+
+// TouchAccessed records that the secrets of an entry were just read
+func (b Blobs) TouchAccessed(uuid string) {
+	b.DB.Set(uuid, KeyAccessed, strconv.FormatInt(time.Now().UnixNano(), 10))
+}
+
+// Untouched returns all entries that have not been created, updated or
+// accessed since the given time.
+func (b Blobs) Untouched(since time.Time) (entries SearchResults, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries = make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		name := blob.Name()
+		if isSystemEntry(name) {
+			continue
+		}
+
+		last, err := blob.LastTouched()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check timestamps of %s: %w", name, err)
+		}
+		if last.Before(since) {
+			entries[uuid] = name
+		}
+	}
+
+	return entries, nil
+}
+
+// Recent returns the uuids of the n entries whose secrets were read most
+// recently (see TouchAccessed), most recent first. Entries that were never
+// accessed are not included.
+func (b Blobs) Recent(n int) (uuids []string, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	accessed := make(map[string]time.Time)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		name := blob.Name()
+		if isSystemEntry(name) {
+			continue
+		}
+
+		t, err := blob.Accessed()
+		if err != nil {
+			return nil, fmt.Errorf("failed to check accessed of %s: %w", name, err)
+		}
+		if t.IsZero() {
+			continue
+		}
+		accessed[uuid] = t
+		uuids = append(uuids, uuid)
+	}
+
+	sort.Slice(uuids, func(i, j int) bool {
+		a, c := accessed[uuids[i]], accessed[uuids[j]]
+		if !a.Equal(c) {
+			return a.After(c)
+		}
+		return uuids[i] < uuids[j]
+	})
+	if n >= 0 && len(uuids) > n {
+		uuids = uuids[:n]
+	}
+
+	return uuids, nil
+}
+
+// UpdatedBetween returns the entries last updated at or after from and before
+// to, a zero from or to leaves that end of the range open.
+func (b Blobs) UpdatedBetween(from, to time.Time) (entries SearchResults, err error) {
+	return b.timestampBetween(KeyUpdated, from, to)
+}
+
+// CreatedBetween returns the entries created at or after from and before to,
+// a zero from or to leaves that end of the range open.
+func (b Blobs) CreatedBetween(from, to time.Time) (entries SearchResults, err error) {
+	return b.timestampBetween(KeyCreated, from, to)
+}
+
+func (b Blobs) timestampBetween(key string, from, to time.Time) (entries SearchResults, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries = make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		name := blob.Name()
+		if isSystemEntry(name) {
+			continue
+		}
+
+		t, err := blob.getTimestamp(key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check %s of %s: %w", key, name, err)
+		}
+		if t.IsZero() || (!from.IsZero() && t.Before(from)) || (!to.IsZero() && !t.Before(to)) {
+			continue
+		}
+		entries[uuid] = name
+	}
+
+	return entries, nil
+}
+
+// setKey sets a key and touches updated unless the key already has the value.
+// Writing the same value again (saving without changes, re-adding a label)
+// would otherwise add a snapshot identical to the last one to the history.
+func (b Blobs) setKey(uuid, key, value string) (changed bool, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return false, err
+	}
+	if cur, ok := b.DB.Snapshot[uuid][key]; ok && cur == value {
+		return false, nil
+	}
+
+	b.touchUpdated(uuid)
+	b.DB.Set(uuid, key, value)
+	return true, nil
+}
+
 // touchUpdated refreshes the updated timestamp for the given item
 func (b Blobs) touchUpdated(uuid string) {
+	if b.batch != nil {
+		b.batch.touch(uuid)
+		return
+	}
+
 	b.DB.Set(uuid, KeyUpdated, strconv.FormatInt(time.Now().UnixNano(), 10))
 }
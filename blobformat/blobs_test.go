@@ -0,0 +1,813 @@
+package blobformat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+func newTestBlobs() Blobs {
+	return Blobs{DB: new(txlogs.DB)}
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRename(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	_, err = b.New("two")
+	must(t, err)
+
+	if err = b.Rename(uuid, "two"); err != ErrNameNotUnique {
+		t.Error("expected name not unique error:", err)
+	}
+	if err = b.Rename("nope", "three"); err != ErrNotFound {
+		t.Error("expected not found error:", err)
+	}
+
+	must(t, b.Rename(uuid, "three"))
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if name := blob.Name(); name != "three" {
+		t.Error("name was wrong:", name)
+	}
+
+	// Renaming to its own name is a no-op
+	versions := b.NVersions(uuid)
+	must(t, b.Rename(uuid, "three"))
+	if b.NVersions(uuid) != versions {
+		t.Error("should not have created history")
+	}
+}
+
+func TestLookup(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+
+	for _, q := range []string{uuid, "one"} {
+		got, blob, err := b.Lookup(q)
+		must(t, err)
+		if got != uuid || blob.Name() != "one" {
+			t.Error("wrong lookup for", q, got)
+		}
+	}
+
+	// The uuid keeps working after a rename
+	must(t, b.Rename(uuid, "two"))
+	if got, _, err := b.Lookup(uuid); err != nil || got != uuid {
+		t.Error("uuid lookup failed after rename:", got, err)
+	}
+	if got, _, err := b.Lookup("one"); err != nil || len(got) != 0 {
+		t.Error("old name should not be found:", got, err)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	must(t, b.Set(uuid, KeyUser, "user"))
+
+	must(t, b.Delete(uuid))
+	blob, err := b.Find(uuid)
+	must(t, err)
+	if blob != nil {
+		t.Error("entry should be gone")
+	}
+
+	if err = b.Delete(uuid); err != ErrNotFound {
+		t.Error("expected not found error:", err)
+	}
+
+	// The tombstone should have been the last thing written before the delete
+	ln := len(b.Log)
+	if tx := b.Log[ln-1]; tx.Kind != txlogs.TxDelete {
+		t.Error("last tx should be a delete:", tx.Kind)
+	}
+	if tx := b.Log[ln-2]; tx.Key != KeyDeleted || len(tx.Value) == 0 {
+		t.Error("expected a tombstone tx:", tx)
+	}
+
+	// And the state just before deletion is still retrievable
+	entry, err := b.EntrySnapshotAt(uuid, 1)
+	must(t, err)
+	if entry[KeyUser] != "user" || len(entry[KeyDeleted]) == 0 {
+		t.Error("final state was wrong:", entry)
+	}
+}
+
+func TestCheckout(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+
+	if err = b.Set(uuid, KeyCheckout, "me"); !IsKeyNotAllowed(err) {
+		t.Error("checkout should not be settable directly:", err)
+	}
+
+	must(t, b.CheckOut(uuid, "alice", "rotating"))
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	c, ok, err := blob.Checkout()
+	must(t, err)
+	if !ok || c.Holder != "alice" || c.Reason != "rotating" {
+		t.Error("checkout was wrong:", ok, c)
+	}
+
+	if err = b.CheckOut(uuid, "bob", ""); !IsCheckedOut(err) {
+		t.Error("expected checked out error:", err)
+	}
+	if err = b.CheckIn(uuid, "bob", false); !IsCheckedOut(err) {
+		t.Error("expected checked out error:", err)
+	}
+
+	must(t, b.CheckIn(uuid, "bob", true))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, ok, _ = blob.Checkout(); ok {
+		t.Error("should have been checked in")
+	}
+
+	// Stale checkouts may be taken over
+	must(t, b.CheckOut(uuid, "alice", ""))
+	b.DB.Set(uuid, KeyCheckoutTime, "1")
+	must(t, b.CheckOut(uuid, "bob", ""))
+}
+
+func TestExpires(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	one, err := b.New("one")
+	must(t, err)
+	two, err := b.New("two")
+	must(t, err)
+	_, err = b.New("three")
+	must(t, err)
+
+	now := time.Now()
+	must(t, b.SetExpires(one, now.Add(-time.Hour)))
+	must(t, b.SetExpires(two, now.Add(time.Hour)))
+
+	blob, err := b.MustFind(two)
+	must(t, err)
+	expires, err := blob.Expires()
+	must(t, err)
+	if !expires.Equal(now.Add(time.Hour)) {
+		t.Error("expiry was wrong:", expires)
+	}
+
+	expired, err := b.Expired(now)
+	must(t, err)
+	if len(expired) != 1 || expired[one] != "one" {
+		t.Error("wrong expired entries:", expired)
+	}
+
+	must(t, b.SetExpires(one, time.Time{}))
+	expired, err = b.Expired(now)
+	must(t, err)
+	if len(expired) != 0 {
+		t.Error("wrong expired entries:", expired)
+	}
+
+	if err = b.Set(one, KeyExpires, "1"); !IsKeyNotAllowed(err) {
+		t.Error("expires should not be settable directly:", err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	one, err := b.New("one")
+	must(t, err)
+	two, err := b.New("two")
+	must(t, err)
+
+	if problems := b.Check(); len(problems) != 0 {
+		t.Error("expected no problems:", problems)
+	}
+
+	b.DB.Set(two, KeyName, "one")
+	b.DB.Set(one, KeyUpdated, "notanumber")
+	if problems := b.Check(); len(problems) != 2 {
+		t.Error("expected duplicate name and bad timestamp:", problems)
+	}
+}
+
+func TestFieldMeta(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	must(t, b.Set(uuid, "apikey", "secret"))
+
+	must(t, b.SetFieldMeta(uuid, "apikey", FieldMeta{Sensitive: true}))
+	must(t, b.SetFieldMeta(uuid, "recovery", FieldMeta{Hidden: true}))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	meta, err := blob.FieldMeta("apikey")
+	must(t, err)
+	if !meta.Sensitive || meta.Hidden {
+		t.Error("meta was wrong:", meta)
+	}
+	if meta, _ = blob.FieldMeta("other"); !meta.IsZero() {
+		t.Error("meta should be empty:", meta)
+	}
+
+	if err = b.Set(uuid, KeyFieldMeta, "{}"); !IsKeyNotAllowed(err) {
+		t.Error("fieldmeta should not be settable directly:", err)
+	}
+
+	// Deleting the key removes its metadata too
+	must(t, b.DeleteKey(uuid, "apikey"))
+	must(t, b.SetFieldMeta(uuid, "recovery", FieldMeta{}))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, ok := blob[KeyFieldMeta]; ok {
+		t.Error("fieldmeta should be gone:", blob[KeyFieldMeta])
+	}
+}
+
+func TestFieldMetaHistory(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	must(t, b.Set(uuid, "answer", "first"))
+	must(t, b.Set(uuid, "question", "pet?"))
+
+	if err = b.SetFieldMeta(uuid, "answer", FieldMeta{History: "some"}); err == nil {
+		t.Error("expected an error for an unknown history mode")
+	}
+
+	// Values from before the mode was set are redacted right away
+	must(t, b.SetFieldMeta(uuid, "answer", FieldMeta{History: HistoryNone}))
+	must(t, b.Set(uuid, "answer", "second"))
+	must(t, b.Set(uuid, "answer", "third"))
+
+	changes, err := b.KeyHistory(uuid, "answer")
+	must(t, err)
+	if len(changes) != 3 {
+		t.Fatal("changes should still be recorded:", changes)
+	}
+	if changes[0].Value != "third" || changes[1].Value != redactedValue || changes[2].Value != redactedValue {
+		t.Error("previous values should be redacted:", changes)
+	}
+
+	must(t, b.SetFieldMeta(uuid, "question", FieldMeta{History: HistoryHash}))
+	must(t, b.Set(uuid, "question", "car?"))
+	changes, err = b.KeyHistory(uuid, "question")
+	must(t, err)
+	sum := sha256.Sum256([]byte("pet?"))
+	if changes[0].Value != "car?" || changes[1].Value != "sha256:"+hex.EncodeToString(sum[:]) {
+		t.Error("previous value should be hashed:", changes)
+	}
+
+	// A merge bringing back an old value is redacted again
+	for i, tx := range b.DB.Log {
+		if tx.Key == "answer" && tx.Value == redactedValue {
+			b.DB.Log[i].Value = "first"
+			break
+		}
+	}
+	n, err := b.RedactHistory()
+	must(t, err)
+	if n != 1 {
+		t.Error("wrong number redacted:", n)
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob["answer"] != "third" || blob["question"] != "car?" {
+		t.Error("current values should be kept:", blob)
+	}
+}
+
+func TestPassHistory(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+
+	must(t, b.Set(uuid, KeyPass, "first"))
+	must(t, b.Set(uuid, KeyUser, "me"))
+	must(t, b.Set(uuid, KeyPass, "second"))
+	must(t, b.Set(uuid, KeyPass, "third"))
+
+	history, err := b.PassHistory(uuid)
+	must(t, err)
+	if len(history) != 2 || history[0].Value != "second" || history[1].Value != "first" {
+		t.Error("history was wrong:", history)
+	}
+	if history[0].Time.Before(history[1].Time) {
+		t.Error("history should be newest first")
+	}
+
+	must(t, b.DeleteKey(uuid, KeyPass))
+	history, err = b.PassHistory(uuid)
+	must(t, err)
+	if len(history) != 3 || history[0].Value != "third" {
+		t.Error("history was wrong:", history)
+	}
+
+	changes, err := b.KeyHistory(uuid, KeyPass)
+	must(t, err)
+	if len(changes) != 4 || !changes[0].Deleted {
+		t.Error("changes were wrong:", changes)
+	}
+}
+
+func TestRestoreSnapshot(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	must(t, b.Set(uuid, KeyUser, "bob"))
+	must(t, b.Set(uuid, KeyPass, "first"))
+
+	before := b.NVersions(uuid)
+	must(t, b.Set(uuid, KeyPass, "second"))
+	must(t, b.Set(uuid, KeyURL, "example.com"))
+	must(t, b.DeleteKey(uuid, KeyUser))
+	must(t, b.Rename(uuid, "two"))
+
+	beforeRestore := b.NVersions(uuid)
+	notKept, err := b.RestoreSnapshot(uuid, beforeRestore-before)
+	must(t, err)
+	if len(notKept) != 0 {
+		t.Error("everything should be restored:", notKept)
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob.Name() != "one" || blob[KeyUser] != "bob" || blob[KeyPass] != "first" {
+		t.Error("values were not restored:", blob)
+	}
+	if _, ok := blob[KeyURL]; ok {
+		t.Error("url should be gone:", blob)
+	}
+
+	// The state before the restore is a snapshot so it can be undone
+	_, err = b.RestoreSnapshot(uuid, b.NVersions(uuid)-beforeRestore)
+	must(t, err)
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if blob.Name() != "two" || blob[KeyPass] != "second" || blob[KeyURL] != "example.com" {
+		t.Error("restore was not undone:", blob)
+	}
+
+	// Redacted values can't come back
+	must(t, b.SetFieldMeta(uuid, KeyPass, FieldMeta{History: HistoryNone}))
+	must(t, b.Set(uuid, KeyPass, "third"))
+	notKept, err = b.RestoreSnapshot(uuid, 1)
+	must(t, err)
+	if len(notKept) != 1 || notKept[0] != KeyPass {
+		t.Error("pass should not be kept:", notKept)
+	}
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyPass] != "third" {
+		t.Error("pass should be left alone:", blob[KeyPass])
+	}
+
+	must(t, b.SetProtected(uuid, true))
+	if _, err = b.RestoreSnapshot(uuid, 1); err != ErrProtected {
+		t.Error("expected protected error, got:", err)
+	}
+}
+
+func TestSnapshotInfo(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	must(t, b.DB.Because("edit pass", func() error {
+		return b.Set(uuid, KeyPass, "first")
+	}))
+	must(t, b.Set(uuid, KeyUser, "bob"))
+
+	info, err := b.SnapshotInfo(uuid, 0)
+	must(t, err)
+	if info.Reason != "" || info.Blob[KeyUser] != "bob" || info.Time.IsZero() {
+		t.Error("current snapshot was wrong:", info)
+	}
+
+	// Setting user wrote user and updated
+	info, err = b.SnapshotInfo(uuid, 2)
+	must(t, err)
+	if info.Reason != "edit pass" || info.Blob[KeyPass] != "first" || len(info.Blob[KeyUser]) != 0 {
+		t.Error("pass snapshot was wrong:", info)
+	}
+
+	info, err = b.SnapshotInfo(uuid, b.NVersions(uuid))
+	must(t, err)
+	if len(info.Blob) != 0 || !info.Time.IsZero() {
+		t.Error("snapshot before the entry existed should be empty:", info)
+	}
+
+	must(t, b.Set(uuid, KeyPass, "second"))
+	_, err = b.RestoreSnapshot(uuid, 2)
+	must(t, err)
+	info, err = b.SnapshotInfo(uuid, 0)
+	must(t, err)
+	if info.Reason != "restore snapshot 2" {
+		t.Error("restore reason was wrong:", info.Reason)
+	}
+}
+
+func TestPurgeSnapshots(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	other, err := b.New("two")
+	must(t, err)
+	must(t, b.Set(uuid, KeyUser, "oops my password"))
+	must(t, b.Set(other, KeyUser, "bob"))
+	must(t, b.Set(uuid, KeyUser, "alice"))
+
+	// A copy from before the purge, like a remote that hasn't synced
+	unpurged := append([]txlogs.Tx(nil), b.DB.Log...)
+
+	n, err := b.PurgeSnapshots(uuid)
+	must(t, err)
+	if n == 0 {
+		t.Error("nothing was purged")
+	}
+	for _, tx := range b.DB.Log {
+		if tx.Value == "oops my password" {
+			t.Error("old value is still in the log")
+		}
+	}
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyUser] != "alice" {
+		t.Error("current value was lost:", blob)
+	}
+	if len(b.DB.KeyHistory(other, KeyUser)) != 1 {
+		t.Error("other entries should be left alone")
+	}
+
+	b.DB.Log = txlogs.Union(unpurged, b.DB.Log)
+	b.DB.ResetSnapshot()
+	n, err = b.ReapplyPurges()
+	must(t, err)
+	if n == 0 {
+		t.Error("merged changes were not purged")
+	}
+	for _, tx := range b.DB.Log {
+		if tx.Value == "oops my password" {
+			t.Error("old value came back with the merge")
+		}
+	}
+}
+
+func TestUnchangedSets(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	must(t, b.Set(uuid, KeyPass, "pass"))
+	must(t, b.AddLabel(uuid, "work"))
+	must(t, b.AddNote(uuid, "note"))
+
+	versions := b.NVersions(uuid)
+	must(t, b.Set(uuid, KeyPass, "pass"))
+	must(t, b.AddLabel(uuid, "work"))
+	must(t, b.DeleteKey(uuid, KeyURL))
+	must(t, b.SetFieldMeta(uuid, KeyUser, FieldMeta{}))
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	must(t, b.SetNotes(uuid, blob.Notes()))
+
+	if n := b.NVersions(uuid); n != versions {
+		t.Errorf("setting the same values added %d snapshots", n-versions)
+	}
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if labels := blob.Labels(); len(labels) != 1 {
+		t.Error("label should not be duplicated:", labels)
+	}
+
+	must(t, b.Set(uuid, KeyPass, "new"))
+	if n := b.NVersions(uuid); n != versions+2 {
+		t.Error("a change should add the key and updated, got:", n-versions)
+	}
+}
+
+func TestUntouched(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	old, err := b.New("old")
+	must(t, err)
+	accessed, err := b.New("accessed")
+	must(t, err)
+	_, err = b.New("new")
+	must(t, err)
+
+	blob, err := b.MustFind(old)
+	must(t, err)
+	if created, err := blob.Created(); err != nil || created.IsZero() {
+		t.Error("created was not set:", created, err)
+	}
+
+	longAgo := strconv.FormatInt(time.Now().AddDate(-3, 0, 0).UnixNano(), 10)
+	for _, uuid := range []string{old, accessed} {
+		b.DB.Set(uuid, KeyCreated, longAgo)
+		b.DB.Set(uuid, KeyUpdated, longAgo)
+	}
+	b.TouchAccessed(accessed)
+
+	if err = b.DeleteKey(accessed, KeyAccessed); !IsKeyNotAllowed(err) {
+		t.Error("accessed should not be deletable:", err)
+	}
+
+	results, err := b.Untouched(time.Now().AddDate(-1, 0, 0))
+	must(t, err)
+	if len(results) != 1 || results[old] != "old" {
+		t.Error("wrong results:", results)
+	}
+}
+
+func TestSearchResultsPage(t *testing.T) {
+	t.Parallel()
+
+	results := SearchResults{"4": "d", "2": "b", "1": "a", "3": "c", "0": "b"}
+
+	tests := []struct {
+		Offset int
+		Limit  int
+		Want   []string
+	}{
+		{0, 0, []string{"1", "0", "2", "3", "4"}},
+		{0, 2, []string{"1", "0"}},
+		{2, 2, []string{"2", "3"}},
+		{4, 2, []string{"4"}},
+		{5, 2, nil},
+	}
+
+	for i, test := range tests {
+		got := results.Page(test.Offset, test.Limit)
+		if !reflect.DeepEqual(got, test.Want) {
+			t.Errorf("%d) want: %v, got: %v", i, test.Want, got)
+		}
+	}
+}
+
+func TestRecent(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	var uuids []string
+	for i, name := range []string{"a", "b", "c", "never"} {
+		uuid, err := b.New(name)
+		must(t, err)
+		uuids = append(uuids, uuid)
+		if name != "never" {
+			b.DB.Set(uuid, KeyAccessed, strconv.FormatInt(time.Now().Add(-time.Duration(i)*time.Hour).UnixNano(), 10))
+		}
+	}
+	b.TouchAccessed(uuids[2])
+
+	recent, err := b.Recent(10)
+	must(t, err)
+	want := []string{uuids[2], uuids[0], uuids[1]}
+	if len(recent) != len(want) {
+		t.Fatal("wrong recent:", recent)
+	}
+	for i := range want {
+		if recent[i] != want[i] {
+			t.Errorf("%d) want: %s, got: %s", i, want[i], recent[i])
+		}
+	}
+
+	if recent, err = b.Recent(1); err != nil || len(recent) != 1 || recent[0] != uuids[2] {
+		t.Error("wrong recent:", recent, err)
+	}
+}
+
+func TestUpdatedBetween(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	now := time.Now()
+	stamps := map[string]time.Time{
+		"ancient":  now.AddDate(-3, 0, 0),
+		"lastyear": now.AddDate(-1, 0, 0),
+		"recent":   now.AddDate(0, 0, -1),
+	}
+	for name, stamp := range stamps {
+		uuid, err := b.New(name)
+		must(t, err)
+		ts := strconv.FormatInt(stamp.UnixNano(), 10)
+		b.DB.Set(uuid, KeyUpdated, ts)
+		b.DB.Set(uuid, KeyCreated, ts)
+	}
+
+	tests := []struct {
+		From, To time.Time
+		Want     []string
+	}{
+		{now.AddDate(0, -1, 0), time.Time{}, []string{"recent"}},
+		{time.Time{}, now.AddDate(-2, 0, 0), []string{"ancient"}},
+		{now.AddDate(-2, 0, 0), now.AddDate(0, -1, 0), []string{"lastyear"}},
+		{stamps["lastyear"], stamps["recent"], []string{"lastyear"}},
+	}
+	for i, test := range tests {
+		for _, fn := range []func(from, to time.Time) (SearchResults, error){b.UpdatedBetween, b.CreatedBetween} {
+			results, err := fn(test.From, test.To)
+			must(t, err)
+			names := results.Names()
+			sort.Strings(names)
+			if !reflect.DeepEqual(names, test.Want) {
+				t.Errorf("%d) wrong entries: %v", i, names)
+			}
+		}
+	}
+}
+
+func TestSamePassword(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	one, err := b.New("one")
+	must(t, err)
+	two, err := b.New("two")
+	must(t, err)
+	three, err := b.New("three")
+	must(t, err)
+	empty, err := b.New("empty")
+	must(t, err)
+	_, err = b.New("empty2")
+	must(t, err)
+
+	must(t, b.Set(one, KeyPass, "reused"))
+	must(t, b.Set(two, KeyPass, "reused"))
+	must(t, b.Set(three, KeyPass, "unique"))
+
+	same, err := b.SamePassword(one)
+	must(t, err)
+	if len(same) != 1 || same[two] != "two" {
+		t.Error("wrong entries:", same)
+	}
+	if same, err = b.SamePassword(three); err != nil || len(same) != 0 {
+		t.Error("should have no duplicates:", same, err)
+	}
+	if same, err = b.SamePassword(empty); err != nil || len(same) != 0 {
+		t.Error("empty passwords are not duplicates:", same, err)
+	}
+}
+
+func TestVerifyHistory(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	b.DB.Schema = SchemaVersion
+	b.DB.SetChainKey([]byte("key"))
+	one, err := b.New("one")
+	must(t, err)
+	two, err := b.New("two")
+	must(t, err)
+	must(t, b.Set(one, KeyPass, "first"))
+	must(t, b.Set(one, KeyPass, "second"))
+	must(t, b.Set(two, KeyPass, "first"))
+
+	// Purging is a legitimate change to the history
+	_, err = b.PurgeSnapshots(two)
+	must(t, err)
+
+	broken, err := b.VerifyHistory()
+	must(t, err)
+	if len(broken) != 0 {
+		t.Error("history should be intact:", broken)
+	}
+
+	for i, tx := range b.DB.Log {
+		if tx.UUID == one && tx.Key == KeyPass && tx.Value == "first" {
+			b.DB.Log[i].Value = "tampered"
+		}
+	}
+	broken, err = b.VerifyHistory()
+	must(t, err)
+	if len(broken) != 1 || broken[0] != one {
+		t.Error("wrong entries broken:", broken)
+	}
+
+	// Stripping the MACs doesn't hide a change
+	for i := range b.DB.Log {
+		b.DB.Log[i].MAC = ""
+	}
+	broken, err = b.VerifyHistory()
+	must(t, err)
+	if len(broken) != 2 {
+		t.Error("every entry should be broken:", broken)
+	}
+
+	// Files from before chaining aren't checked until they're migrated
+	b.DB.Schema = ChainedSchema - 1
+	if broken, err = b.VerifyHistory(); err != nil || len(broken) != 0 {
+		t.Error("unchained file should not be checked:", broken, err)
+	}
+}
+
+func TestFindByLabel(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	entries := map[string][]string{
+		"work/aws": {"work", "aws"},
+		"work/gcp": {"work", "gcp"},
+		"home/aws": {"aws"},
+		"none":     nil,
+	}
+	for name, labels := range entries {
+		uuid, err := b.New(name)
+		must(t, err)
+		for _, l := range labels {
+			must(t, b.AddLabel(uuid, l))
+		}
+	}
+
+	tests := []struct {
+		Labels []string
+		Want   []string
+	}{
+		{[]string{"work", "aws"}, []string{"work/aws"}},
+		{[]string{"aws|gcp"}, []string{"home/aws", "work/aws", "work/gcp"}},
+		{[]string{"work", "aws|gcp"}, []string{"work/aws", "work/gcp"}},
+		{[]string{"personal"}, nil},
+	}
+
+	for i, test := range tests {
+		results, err := b.FindByLabel(test.Labels...)
+		must(t, err)
+		names := results.Names()
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, test.Want) {
+			t.Errorf("%d) wrong entries: %v", i, names)
+		}
+	}
+}
+
+func TestSearchRanked(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	for _, name := range []string{"digital", "work/gitlab", "github", "git", "trash/git"} {
+		_, err := b.New(name)
+		must(t, err)
+	}
+
+	ranked, err := b.SearchRanked("git", 0)
+	must(t, err)
+	var names []string
+	for _, r := range ranked {
+		names = append(names, r.Name)
+	}
+	if !reflect.DeepEqual(names, []string{"git", "github", "work/gitlab", "digital"}) {
+		t.Error("wrong order:", names)
+	}
+
+	ranked, err = b.SearchRanked("w/gi", 2)
+	must(t, err)
+	if len(ranked) != 1 || ranked[0].Name != "work/gitlab" {
+		t.Error("wrong results:", ranked)
+	}
+
+	ranked, err = b.SearchRanked("", 2)
+	must(t, err)
+	if len(ranked) != 2 || ranked[0].Name != "git" || ranked[1].Name != "github" {
+		t.Error("results should be capped:", ranked)
+	}
+}
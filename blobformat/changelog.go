@@ -0,0 +1,86 @@
+package blobformat
+
+import (
+	"sort"
+	"time"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// changeGap is the most time between transactions on an entry that are
+// still considered part of the same change
+const changeGap = time.Second
+
+// Change is an operation on an entry in the changelog
+type Change struct {
+	Time time.Time
+	UUID string
+	// Name is the entry's name after the change
+	Name string
+	// Op is the reason given for the change, when there is none it's add,
+	// delete or edit
+	Op     string
+	Device string
+	// Keys are the keys that were set or removed, updated and accessed are
+	// left out
+	Keys []string
+}
+
+// Changelog returns every change made to the file since the given time,
+// oldest first. Transactions on the same entry made together (with the same
+// reason and device in quick succession) are one change.
+func (b Blobs) Changelog(since time.Time) []Change {
+	names := make(map[string]string)
+	keys := make(map[string]bool)
+	var changes []Change
+	var last txlogs.Tx
+
+	for _, tx := range b.DB.Log {
+		if tx.Kind == txlogs.TxSetKey && tx.Key == KeyName {
+			names[tx.UUID] = tx.Value
+		}
+		if tx.Time < since.UnixNano() {
+			continue
+		}
+
+		n := len(changes)
+		same := n != 0 && tx.UUID == last.UUID && tx.Reason == last.Reason &&
+			tx.Device == last.Device && time.Duration(tx.Time-last.Time) < changeGap
+		last = tx
+		if !same {
+			changes = append(changes, Change{
+				Time:   time.Unix(0, tx.Time),
+				UUID:   tx.UUID,
+				Op:     tx.Reason,
+				Device: tx.Device,
+			})
+			keys = make(map[string]bool)
+			n++
+		}
+
+		c := &changes[n-1]
+		c.Name = names[tx.UUID]
+		switch tx.Kind {
+		case txlogs.TxAdd:
+			if len(tx.Reason) == 0 {
+				c.Op = "add"
+			}
+		case txlogs.TxDelete:
+			if len(tx.Reason) == 0 {
+				c.Op = "delete"
+			}
+		case txlogs.TxSetKey, txlogs.TxDeleteKey:
+			if len(c.Op) == 0 {
+				c.Op = "edit"
+			}
+			if tx.Key == KeyUpdated || tx.Key == KeyAccessed || keys[tx.Key] {
+				continue
+			}
+			keys[tx.Key] = true
+			c.Keys = append(c.Keys, tx.Key)
+			sort.Strings(c.Keys)
+		}
+	}
+
+	return changes
+}
@@ -0,0 +1,47 @@
+package blobformat
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestChangelog(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	b.DB.SetDevice("laptop")
+	uuid, err := b.New("old")
+	must(t, err)
+
+	since := time.Now()
+	must(t, b.DB.Because("rotate password", func() error {
+		if err := b.Set(uuid, KeyPass, "new"); err != nil {
+			return err
+		}
+		return b.AddNote(uuid, "rotated")
+	}))
+	must(t, b.Rename(uuid, "new"))
+
+	changes := b.Changelog(since)
+	if len(changes) != 2 {
+		t.Fatal("wrong number of changes:", changes)
+	}
+
+	c := changes[0]
+	if c.UUID != uuid || c.Name != "old" || c.Op != "rotate password" || c.Device != "laptop" {
+		t.Error("first change was wrong:", c)
+	}
+	if !reflect.DeepEqual(c.Keys, []string{KeyNotes, KeyPass}) {
+		t.Error("first change keys were wrong:", c.Keys)
+	}
+
+	c = changes[1]
+	if c.Name != "new" || c.Op != "edit" || !reflect.DeepEqual(c.Keys, []string{KeyName}) {
+		t.Error("second change was wrong:", c)
+	}
+
+	if changes = b.Changelog(time.Time{}); len(changes) != 3 || changes[0].Op != "add" {
+		t.Error("the entry being added should be first:", changes)
+	}
+}
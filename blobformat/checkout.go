@@ -0,0 +1,129 @@
+package blobformat
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// CheckoutExpiry is how long a check-out is honored before it's considered
+// stale and may be taken over by someone else.
+const CheckoutExpiry = 24 * time.Hour
+
+// Checkout is an advisory lock on an entry. It's used in shared files so that
+// two people don't rotate the same credential at the same time. Nothing
+// prevents an entry that's checked out from being modified, it's up to
+// the UI to check and warn.
+type Checkout struct {
+	Holder string
+	Reason string
+	Time   time.Time
+}
+
+// Stale returns true if the checkout is old enough that it should no longer
+// be honored.
+func (c Checkout) Stale(now time.Time) bool {
+	return now.Sub(c.Time) > CheckoutExpiry
+}
+
+// CheckedOutError is returned when an entry is checked out by someone else.
+type CheckedOutError struct {
+	Checkout
+}
+
+func (c CheckedOutError) Error() string {
+	str := fmt.Sprintf("checked out by %s since %s", c.Holder, c.Time.Format(time.RFC3339))
+	if len(c.Reason) != 0 {
+		str += ": " + c.Reason
+	}
+	return str
+}
+
+// IsCheckedOut checks if the error is a checked out error
+func IsCheckedOut(err error) bool {
+	_, ok := err.(CheckedOutError)
+	return ok
+}
+
+// Checkout returns the current checkout of the entry, ok is false if it's not
+// checked out. Stale checkouts are still returned.
+func (b Blob) Checkout() (c Checkout, ok bool, err error) {
+	holder := b[KeyCheckout]
+	if len(holder) == 0 {
+		return c, false, nil
+	}
+
+	c.Holder = holder
+	c.Reason = b[KeyCheckoutReason]
+	c.Time, err = b.getTimestamp(KeyCheckoutTime)
+	if err != nil {
+		return c, false, err
+	}
+
+	return c, true, nil
+}
+
+// CheckOut takes an advisory lock on the entry for holder. If the entry is
+// already checked out by someone else and that checkout is not stale a
+// CheckedOutError is returned. Checking out an entry that holder already has
+// refreshes the reason and time.
+func (b Blobs) CheckOut(uuid, holder, reason string) error {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	now := time.Now()
+	c, ok, err := blob.Checkout()
+	if err != nil {
+		return err
+	}
+	if ok && c.Holder != holder && !c.Stale(now) {
+		return CheckedOutError{Checkout: c}
+	}
+
+	b.DB.Set(uuid, KeyCheckout, holder)
+	b.DB.Set(uuid, KeyCheckoutTime, strconv.FormatInt(now.UnixNano(), 10))
+	if len(reason) != 0 {
+		b.DB.Set(uuid, KeyCheckoutReason, reason)
+	} else if _, ok := blob[KeyCheckoutReason]; ok {
+		b.DB.DeleteKey(uuid, KeyCheckoutReason)
+	}
+
+	return nil
+}
+
+// CheckIn releases the advisory lock. If the entry is checked out by someone
+// else a CheckedOutError is returned unless force is true. Checking in an entry
+// that is not checked out does nothing.
+func (b Blobs) CheckIn(uuid, holder string, force bool) error {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	c, ok, err := blob.Checkout()
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return nil
+	}
+	if c.Holder != holder && !force {
+		return CheckedOutError{Checkout: c}
+	}
+
+	for _, k := range []string{KeyCheckout, KeyCheckoutReason, KeyCheckoutTime} {
+		if _, ok := blob[k]; ok {
+			b.DB.DeleteKey(uuid, k)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,83 @@
+package blobformat
+
+import "errors"
+
+// ErrCloneUser is returned when trying to clone a user entry
+var ErrCloneUser = errors.New("user entries cannot be cloned")
+
+// cloneSkip are the keys that describe an entry rather than the account in
+// it, a clone starts out with fresh ones (or none) instead.
+var cloneSkip = map[string]struct{}{
+	KeyName:           {},
+	KeyCreated:        {},
+	KeyUpdated:        {},
+	KeyAccessed:       {},
+	KeyDeleted:        {},
+	KeyAlias:          {},
+	KeyFavorite:       {},
+	KeyProtected:      {},
+	KeyShares:         {},
+	KeyTrashed:        {},
+	KeyTrashedName:    {},
+	KeyWindowOverride: {},
+	KeyImportSource:   {},
+	KeyImportID:       {},
+	KeyImported:       {},
+	KeyCheckout:       {},
+	KeyCheckoutReason: {},
+	KeyCheckoutTime:   {},
+	KeyRecoveryCodes:  {},
+}
+
+// Clone copies the keys of the entry src into a new entry named dst. The new
+// entry has none of src's history and the keys that are about src itself
+// (timestamps, shares, checkouts, provenance, recovery codes etc.) are not
+// copied. The twofactor key is only copied if withTwoFactor is set since a
+// second account on the same site won't share it.
+func (b Blobs) Clone(src, dst string, withTwoFactor bool) (uuid string, err error) {
+	blob, err := b.Find(src)
+	if err != nil {
+		return "", err
+	}
+	if blob == nil {
+		return "", ErrNotFound
+	}
+	if IsUserEntry(blob.Name()) {
+		return "", ErrCloneUser
+	}
+
+	keys := make(map[string]string, len(blob))
+	for k, v := range blob {
+		if _, ok := cloneSkip[k]; ok {
+			continue
+		}
+		if (k == KeyTwoFactor || k == KeyTwoFactors) && !withTwoFactor {
+			continue
+		}
+		keys[k] = v
+	}
+
+	name := b.normalizeName(dst)
+	for k, v := range keys {
+		if err = b.validate(name, k, v); err != nil {
+			return "", err
+		}
+	}
+
+	uuid, err = b.New(dst)
+	if err != nil {
+		return "", err
+	}
+	for k, v := range keys {
+		b.DB.Set(uuid, k, v)
+	}
+
+	// Field metadata for a key that wasn't copied is meaningless
+	if _, ok := keys[KeyFieldMeta]; ok && !withTwoFactor {
+		if err = b.SetFieldMeta(uuid, KeyTwoFactor, FieldMeta{}); err != nil {
+			return "", err
+		}
+	}
+
+	return uuid, nil
+}
@@ -0,0 +1,56 @@
+package blobformat
+
+import "testing"
+
+func TestClone(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	src, err := b.New("site/first")
+	must(t, err)
+	must(t, b.Set(src, KeyURL, "https://example.com"))
+	must(t, b.Set(src, KeyPass, "hunter2"))
+	must(t, b.SetTwofactor(src, "JBSWY3DPEHPK3PXP"))
+	must(t, b.AddNote(src, "a note"))
+	must(t, b.SetFavorite(src, true))
+	must(t, b.RecordShare(src, "bob"))
+
+	dst, err := b.Clone(src, "site/second", false)
+	must(t, err)
+	if dst == src {
+		t.Fatal("clone should be a new entry")
+	}
+
+	blob, err := b.MustFind(dst)
+	must(t, err)
+	if blob.Name() != "site/second" {
+		t.Error("name was wrong:", blob.Name())
+	}
+	if blob[KeyURL] != "https://example.com" || blob[KeyPass] != "hunter2" {
+		t.Error("keys were not copied:", blob)
+	}
+	if notes := blob.Notes(); len(notes) != 1 || notes[0].Text != "a note" {
+		t.Error("notes were not copied:", notes)
+	}
+	if _, ok := blob[KeyTwoFactor]; ok {
+		t.Error("twofactor should not be copied")
+	}
+	if blob.IsFavorite() {
+		t.Error("favorite should not be copied")
+	}
+	if _, ok := blob[KeyShares]; ok {
+		t.Error("shares should not be copied")
+	}
+
+	dst, err = b.Clone(src, "site/third", true)
+	must(t, err)
+	blob, err = b.MustFind(dst)
+	must(t, err)
+	if _, ok := blob[KeyTwoFactor]; !ok {
+		t.Error("twofactor should be copied")
+	}
+
+	if _, err = b.Clone(src, "site/second", false); err != ErrNameNotUnique {
+		t.Error("expected name not unique:", err)
+	}
+}
@@ -0,0 +1,72 @@
+package blobformat
+
+import (
+	"sort"
+	"strings"
+)
+
+// CompleteName returns the names of entries that start with prefix for tab
+// completion. Like paths in a shell, names are completed up to and including
+// the next / after the prefix so a pseudo-folder is completed once instead of
+// once for every entry in it. Entries in the trash are only completed when
+// the prefix is in the trash. The names are sorted.
+func (b Blobs) CompleteName(prefix string) ([]string, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	inTrash := IsTrashEntry(prefix)
+	seen := make(map[string]bool)
+	var names []string
+	for _, entry := range b.DB.Snapshot {
+		name := Blob(entry).Name()
+		if IsTrashEntry(name) != inTrash || !b.hasPrefix(name, prefix) {
+			continue
+		}
+
+		if i := strings.IndexByte(name[len(prefix):], '/'); i >= 0 {
+			name = name[:len(prefix)+i+1]
+		}
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	sort.Strings(names)
+	return names, nil
+}
+
+// CompleteKey returns the keys of an entry that start with prefix for tab
+// completion, sorted.
+func (b Blobs) CompleteKey(uuid, prefix string) ([]string, error) {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, ErrNotFound
+	}
+
+	var keys []string
+	for k := range blob {
+		if strings.HasPrefix(k, prefix) {
+			keys = append(keys, k)
+		}
+	}
+
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// hasPrefix checks if name starts with prefix, ignoring case when names are
+// folded
+func (b Blobs) hasPrefix(name, prefix string) bool {
+	if len(name) < len(prefix) {
+		return false
+	}
+	if b.FoldNames {
+		return strings.EqualFold(name[:len(prefix)], prefix)
+	}
+	return strings.HasPrefix(name, prefix)
+}
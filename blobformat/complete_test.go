@@ -0,0 +1,63 @@
+package blobformat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompleteName(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	for _, name := range []string{"work/aws", "work/gcp/prod", "work/gcp/dev", "wifi", "home", "trash/work/old"} {
+		_, err := b.New(name)
+		must(t, err)
+	}
+
+	tests := []struct {
+		Prefix string
+		Want   []string
+	}{
+		{"", []string{"home", "wifi", "work/"}},
+		{"w", []string{"wifi", "work/"}},
+		{"work/", []string{"work/aws", "work/gcp/"}},
+		{"work/g", []string{"work/gcp/"}},
+		{"work/gcp/", []string{"work/gcp/dev", "work/gcp/prod"}},
+		{"trash/", []string{"trash/work/"}},
+		{"x", nil},
+	}
+	for _, test := range tests {
+		names, err := b.CompleteName(test.Prefix)
+		must(t, err)
+		if !reflect.DeepEqual(names, test.Want) {
+			t.Errorf("%q: wrong completions: %v", test.Prefix, names)
+		}
+	}
+
+	b.FoldNames = true
+	names, err := b.CompleteName("WORK/A")
+	must(t, err)
+	if !reflect.DeepEqual(names, []string{"work/aws"}) {
+		t.Error("folded completion wrong:", names)
+	}
+}
+
+func TestCompleteKey(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("entry")
+	must(t, err)
+	must(t, b.Set(uuid, KeyUser, "bob"))
+	must(t, b.Set(uuid, "url", "example.com"))
+
+	keys, err := b.CompleteKey(uuid, "u")
+	must(t, err)
+	if !reflect.DeepEqual(keys, []string{KeyUpdated, "url", KeyUser}) {
+		t.Error("wrong keys:", keys)
+	}
+
+	if _, err = b.CompleteKey("missing", ""); err != ErrNotFound {
+		t.Error("expected not found, got:", err)
+	}
+}
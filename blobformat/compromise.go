@@ -0,0 +1,147 @@
+package blobformat
+
+import (
+	"sort"
+	"strconv"
+	"time"
+)
+
+// secretKeys are the keys that have to change for an entry to count as
+// rotated after a compromise.
+var secretKeys = []string{KeyPass, KeyPriv, KeyToken}
+
+// Rotation is an entry that still has to be rotated after a compromise.
+// Higher sensitivity entries should be rotated first, Reasons explains the
+// sensitivity.
+type Rotation struct {
+	UUID        string
+	Name        string
+	Sensitivity int
+	Reasons     []string
+}
+
+// FlagCompromised records that the secrets of every entry that has any may
+// have leaked at since. Entries count as rotated once one of their secrets
+// (pass, privkey, token) changes after that. Returns how many were flagged.
+//
+// Flagging isn't a change to the entry so it doesn't touch updated and works
+// on protected entries. User entries are not flagged, rekeying takes care of
+// them.
+func (b Blobs) FlagCompromised(since time.Time) (int, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	at := strconv.FormatInt(since.UnixNano(), 10)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		name := blob.Name()
+		if IsUserEntry(name) || IsTemplateEntry(name) || IsTrashEntry(name) || !hasSecret(blob) {
+			continue
+		}
+
+		b.DB.Set(uuid, KeyCompromised, at)
+		n++
+	}
+
+	return n, nil
+}
+
+// RotationQueue returns the flagged entries that have not been rotated yet
+// with the most sensitive first, and how many entries were flagged in total.
+func (b Blobs) RotationQueue() (queue []Rotation, flagged int, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, 0, err
+	}
+
+	pending := make(map[string]Blob)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		since, err := blob.getTimestamp(KeyCompromised)
+		if err != nil {
+			return nil, 0, err
+		}
+		if since.IsZero() {
+			continue
+		}
+
+		flagged++
+		if !b.rotatedSince(uuid, since) {
+			pending[uuid] = blob
+		}
+	}
+
+	passCount := make(map[string]int)
+	for _, blob := range pending {
+		if pass := blob[KeyPass]; len(pass) != 0 {
+			passCount[pass]++
+		}
+	}
+
+	for uuid, blob := range pending {
+		r := Rotation{UUID: uuid, Name: blob.Name()}
+		if IsSyncEntry(r.Name) {
+			r.Sensitivity += 3
+			r.Reasons = append(r.Reasons, "has access to copies of the file")
+		}
+		if passCount[blob[KeyPass]] > 1 {
+			r.Sensitivity += 2
+			r.Reasons = append(r.Reasons, "password is reused")
+		}
+		if len(blob[KeyPass]) != 0 && len(blob[KeyTwoFactor]) == 0 && len(blob[KeyTwoFactors]) == 0 {
+			r.Sensitivity++
+			r.Reasons = append(r.Reasons, "no two factor")
+		}
+		queue = append(queue, r)
+	}
+
+	sort.Slice(queue, func(i, j int) bool {
+		if queue[i].Sensitivity != queue[j].Sensitivity {
+			return queue[i].Sensitivity > queue[j].Sensitivity
+		}
+		return queue[i].Name < queue[j].Name
+	})
+
+	return queue, flagged, nil
+}
+
+// EndCompromise removes the compromised flag from every entry, it's done
+// once the rotation queue is empty.
+func (b Blobs) EndCompromise() error {
+	if err := b.UpdateSnapshot(); err != nil {
+		return err
+	}
+
+	for uuid, entry := range b.DB.Snapshot {
+		if _, ok := entry[KeyCompromised]; ok {
+			b.DB.DeleteKey(uuid, KeyCompromised)
+		}
+	}
+
+	return nil
+}
+
+// rotatedSince is true if any of the secrets of an entry changed after since
+func (b Blobs) rotatedSince(uuid string, since time.Time) bool {
+	for _, k := range secretKeys {
+		history := b.DB.KeyHistory(uuid, k)
+		if len(history) == 0 {
+			continue
+		}
+		if last := history[len(history)-1]; last.Time > since.UnixNano() {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasSecret(blob Blob) bool {
+	for _, k := range secretKeys {
+		if len(blob[k]) != 0 {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package blobformat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompromise(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	newEntry := func(name, pass string) string {
+		uuid, err := b.New(name)
+		must(t, err)
+		if len(pass) != 0 {
+			must(t, b.Set(uuid, KeyPass, pass))
+		}
+		return uuid
+	}
+
+	reused1 := newEntry("reused1", "same")
+	newEntry("reused2", "same")
+	twoFactor := newEntry("twofactor", "pass")
+	must(t, b.SetTwofactor(twoFactor, "JBSWY3DPEHPK3PXP"))
+	single := newEntry("single", "pass2")
+	newEntry("nosecret", "")
+	must(t, b.SetProtected(single, true))
+
+	n, err := b.FlagCompromised(time.Now())
+	must(t, err)
+	if n != 4 {
+		t.Error("expected 4 flagged, got:", n)
+	}
+
+	queue, flagged, err := b.RotationQueue()
+	must(t, err)
+	if flagged != 4 || len(queue) != 4 {
+		t.Fatal("queue wrong:", flagged, queue)
+	}
+	order := []string{"reused1", "reused2", "single", "twofactor"}
+	for i, r := range queue {
+		if r.Name != order[i] {
+			t.Errorf("%d) want %s got %s", i, order[i], r.Name)
+		}
+	}
+	if queue[0].Sensitivity != 3 || len(queue[0].Reasons) != 2 {
+		t.Error("reused entry should be most sensitive:", queue[0])
+	}
+
+	must(t, b.Set(reused1, KeyPass, "new"))
+	queue, flagged, err = b.RotationQueue()
+	must(t, err)
+	if flagged != 4 || len(queue) != 3 {
+		t.Fatal("rotated entry should leave the queue:", flagged, queue)
+	}
+	if queue[0].Name != "reused2" || queue[0].Sensitivity != 1 {
+		t.Error("reused2 no longer shares its password:", queue)
+	}
+
+	must(t, b.EndCompromise())
+	if queue, flagged, err = b.RotationQueue(); err != nil || flagged != 0 || len(queue) != 0 {
+		t.Error("flags should be gone:", flagged, queue, err)
+	}
+}
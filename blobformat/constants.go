@@ -4,66 +4,228 @@ package blobformat
 // Keys for the map
 const (
 	// System level keys (things that allow the system to work)
-	KeyName    = "name"
-	KeyUpdated = "updated"
+	KeyName     = "name"
+	KeyCreated  = "created"
+	KeyUpdated  = "updated"
+	KeyAccessed = "accessed"
+	KeyDeleted  = "deleted"
+	KeyExpires  = "expires"
+
+	// Metadata about other keys
+	KeyFieldMeta = "fieldmeta"
+
+	// KeyAlias holds the uuid of the entry this one is an alias of
+	KeyAlias = "alias"
+
+	// KeyFavorite is "true" for entries that are pinned
+	KeyFavorite = "favorite"
+
+	// KeyShares records who an entry was shared with
+	KeyShares = "shares"
+
+	// KeyIcon is a small image for the entry as a data uri
+	KeyIcon = "icon"
+
+	// KeyProtected is "true" for entries that may not be changed
+	KeyProtected = "protected"
+
+	// KeyQuestions holds security questions and their answers
+	KeyQuestions = "questions"
+
+	// KeyRecoveryCodes holds two factor recovery codes and when they were
+	// used, see UseRecoveryCode
+	KeyRecoveryCodes = "recoverycodes"
+
+	// KeyCompromised is when the secrets of an entry may have leaked, see
+	// FlagCompromised
+	KeyCompromised = "compromised"
+
+	// KeyPurged is when the history of an entry was purged, see
+	// PurgeSnapshots
+	KeyPurged = "purged"
+
+	// KeySnapshotCap is the most snapshots an entry keeps, see SetSnapshotCap
+	KeySnapshotCap = "snapshotcap"
+
+	// KeyQuery is the query of a saved search, see SaveSearch
+	KeyQuery = "query"
+
+	// KeyNeverMatch lists hosts an entry must never be offered for, see
+	// MatchDomain
+	KeyNeverMatch = "nevermatch"
+
+	// Trash keys, the time an entry was trashed and its name before it was
+	KeyTrashed     = "trashed"
+	KeyTrashedName = "trashedname"
 
 	// User level known keys
-	KeyUser      = "user"
-	KeyEmail     = "email"
-	KeyURL       = "url"
-	KeyPass      = "pass"
-	KeyTwoFactor = "totp"
-	KeyNotes     = "notes"
-	KeyLabels    = "labels"
+	KeyUser       = "user"
+	KeyEmail      = "email"
+	KeyURL        = "url"
+	KeyURLs       = "urls"
+	KeyPass       = "pass"
+	KeyTwoFactor  = "totp"
+	KeyTwoFactors = "totps"
+	KeyNotes      = "notes"
+	KeyLabels     = "labels"
+
+	// Infrastructure keys, see the infra template
+	KeyHostname    = "hostname"
+	KeyIP          = "ip"
+	KeyPort        = "port"
+	KeyEnvironment = "environment"
+	KeyOwner       = "owner"
+
+	// Access window keys
+	KeyWindow         = "window"
+	KeyWindowOverride = "windowoverride"
+
+	// Provenance keys for imported entries
+	KeyImportSource = "importsource"
+	KeyImportID     = "importid"
+	KeyImported     = "imported"
+
+	// Advisory lock keys for shared files
+	KeyCheckout       = "checkout"
+	KeyCheckoutReason = "checkoutreason"
+	KeyCheckoutTime   = "checkouttime"
 
 	// Synchronization keys in user data
 	KeySync       = "sync"
 	KeyPriv       = "privkey"
 	KeyPub        = "pubkey"
 	KeyKnownHosts = "knownhosts"
+	KeyToken      = "token"
 
 	// User keys
 	KeyIV   = "iv"
 	KeySalt = "salt"
 	KeyMKey = "mkey"
+
+	// Role keys in user entries, see RoleAssignment
+	KeySignPub    = "signpub"
+	KeySignPriv   = "signpriv"
+	KeyRole       = "role"
+	KeyRoleSigner = "rolesigner"
+	KeyRoleSig    = "rolesig"
 )
 
 const (
-	syncPrefix = "sync/"
-	userPrefix = "user/"
+	syncPrefix     = "sync/"
+	userPrefix     = "user/"
+	templatePrefix = "template/"
+	searchPrefix   = "search/"
+	trashPrefix    = "trash/"
 )
 
 var (
 	// known keys is a list of all known keys
 	knownKeys = []string{
 		KeyName,
+		KeyCreated,
 		KeyUpdated,
+		KeyAccessed,
+		KeyDeleted,
+		KeyExpires,
+		KeyFieldMeta,
+		KeyAlias,
+		KeyFavorite,
+		KeyShares,
+		KeyIcon,
+		KeyProtected,
+		KeyQuestions,
+		KeyRecoveryCodes,
+		KeyCompromised,
+		KeyPurged,
+		KeySnapshotCap,
+		KeyQuery,
+		KeyNeverMatch,
+		KeyTrashed,
+		KeyTrashedName,
 
 		KeyUser,
 		KeyEmail,
 		KeyPass,
 		KeyTwoFactor,
+		KeyTwoFactors,
 		KeyNotes,
 		KeyLabels,
+		KeyURLs,
+
+		KeyHostname,
+		KeyIP,
+		KeyPort,
+		KeyEnvironment,
+		KeyOwner,
+
+		KeyWindow,
+		KeyWindowOverride,
+
+		KeyImportSource,
+		KeyImportID,
+		KeyImported,
+
+		KeyCheckout,
+		KeyCheckoutReason,
+		KeyCheckoutTime,
 
 		KeySync,
 		KeyPriv,
 		KeyPub,
 		KeyKnownHosts,
+		KeyToken,
+
+		KeySignPub,
+		KeySignPriv,
+		KeyRole,
+		KeyRoleSigner,
+		KeyRoleSig,
 	}
 
 	// protectedKeys is a list of keys that cannot be set to a string value
 	protectedKeys = []string{
 		// Special setters
 		KeyTwoFactor,
+		KeyTwoFactors,
+		KeyNotes,
+		KeyFieldMeta,
+		KeyAlias,
+		KeyFavorite,
+		KeyShares,
+		KeyIcon,
+		KeyProtected,
+		KeyQuestions,
+		KeyRecoveryCodes,
+		KeySnapshotCap,
+		KeyTrashedName,
+		KeyWindow,
+		KeyWindowOverride,
+		KeyImportSource,
+		KeyImportID,
+		KeyCheckout,
+		KeyCheckoutReason,
+		KeyCheckoutTime,
 
 		// Forbidden
 		KeyName,
 		KeyIV,
 		KeySalt,
 		KeyMKey,
+		KeySignPub,
+		KeySignPriv,
+		KeyRole,
+		KeyRoleSigner,
+		KeyRoleSig,
 
 		// Dates
+		KeyCreated,
 		KeyUpdated,
+		KeyAccessed,
+		KeyDeleted,
+		KeyExpires,
+		KeyImported,
+		KeyTrashed,
+		KeyCompromised,
+		KeyPurged,
 	}
 )
@@ -0,0 +1,170 @@
+package blobformat
+
+import (
+	"errors"
+	"sort"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// KeyDiff is a key that differs between two versions of an entry, Old is
+// empty for added keys and New is empty for removed ones.
+type KeyDiff struct {
+	Key string
+	Old string
+	New string
+}
+
+// Diff is what changed between two versions of an entry, each list is sorted
+// by key.
+type Diff struct {
+	Added   []KeyDiff
+	Removed []KeyDiff
+	Changed []KeyDiff
+}
+
+// Empty is true if the two versions are the same
+func (d Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0
+}
+
+// Diff returns the keys that were added, removed or changed going from b to
+// newer.
+func (b Blob) Diff(newer Blob) Diff {
+	var d Diff
+	for k, v := range newer {
+		old, ok := b[k]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, KeyDiff{Key: k, New: v})
+		case old != v:
+			d.Changed = append(d.Changed, KeyDiff{Key: k, Old: old, New: v})
+		}
+	}
+	for k, v := range b {
+		if _, ok := newer[k]; !ok {
+			d.Removed = append(d.Removed, KeyDiff{Key: k, Old: v})
+		}
+	}
+
+	for _, list := range [][]KeyDiff{d.Added, d.Removed, d.Changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Key < list[j].Key })
+	}
+
+	return d
+}
+
+// EntryDiff is an entry that differs between two versions of a vault
+type EntryDiff struct {
+	UUID string
+	Name string
+	Diff Diff
+}
+
+// VaultDiff is what changed between two versions of a vault, each list is
+// sorted by name.
+type VaultDiff struct {
+	Added   []EntryDiff
+	Removed []EntryDiff
+	Changed []EntryDiff
+}
+
+// Empty is true if the two versions are the same
+func (v VaultDiff) Empty() bool {
+	return len(v.Added) == 0 && len(v.Removed) == 0 && len(v.Changed) == 0
+}
+
+// DiffVault returns the entries that were added, removed or changed going
+// from b to newer (the current file and a backup of it for example). Entries
+// are matched by uuid so a renamed entry shows up as changed, every key of an
+// added or removed entry is in its Diff.
+func (b Blobs) DiffVault(newer Blobs) (VaultDiff, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return VaultDiff{}, err
+	}
+	if err := newer.UpdateSnapshot(); err != nil {
+		return VaultDiff{}, err
+	}
+
+	var v VaultDiff
+	for uuid, entry := range newer.DB.Snapshot {
+		blob := Blob(entry)
+		old, ok := b.DB.Snapshot[uuid]
+		if !ok {
+			v.Added = append(v.Added, EntryDiff{UUID: uuid, Name: blob.Name(), Diff: Blob{}.Diff(blob)})
+			continue
+		}
+		if d := Blob(old).Diff(blob); !d.Empty() {
+			v.Changed = append(v.Changed, EntryDiff{UUID: uuid, Name: blob.Name(), Diff: d})
+		}
+	}
+	for uuid, entry := range b.DB.Snapshot {
+		if _, ok := newer.DB.Snapshot[uuid]; !ok {
+			blob := Blob(entry)
+			v.Removed = append(v.Removed, EntryDiff{UUID: uuid, Name: blob.Name(), Diff: blob.Diff(Blob{})})
+		}
+	}
+
+	for _, list := range [][]EntryDiff{v.Added, v.Removed, v.Changed} {
+		sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	}
+
+	return v, nil
+}
+
+// DiffSnapshot returns what changed in an entry going from snapshot i to
+// snapshot j. Snapshots are numbered like show: 0 is the current state and 1
+// is the version before the last change to the entry. A snapshot from before
+// the entry existed is empty, so every key shows up as added.
+func (b Blobs) DiffSnapshot(uuid string, i, j int) (Diff, error) {
+	from, err := b.entrySnapshot(uuid, i)
+	if err != nil {
+		return Diff{}, err
+	}
+	to, err := b.entrySnapshot(uuid, j)
+	if err != nil {
+		return Diff{}, err
+	}
+
+	return from.Diff(to), nil
+}
+
+// entrySnapshot returns the entry as it was versionsAgo, an empty blob if it
+// didn't exist (yet or anymore).
+func (b Blobs) entrySnapshot(uuid string, versionsAgo int) (Blob, error) {
+	if versionsAgo < 0 {
+		return nil, errors.New("snapshot must not be negative")
+	}
+
+	versions := b.DB.NVersions(uuid)
+	if versions == 0 {
+		return nil, ErrNotFound
+	}
+	if versionsAgo > versions {
+		return nil, errors.New("there are not that many versions for the entry")
+	} else if versionsAgo == versions {
+		return Blob{}, nil
+	}
+
+	if versionsAgo == 0 {
+		blob, err := b.Find(uuid)
+		if err != nil {
+			return nil, err
+		}
+		if blob == nil {
+			// Deleted entries have no current state
+			return Blob{}, nil
+		}
+		return blob, nil
+	}
+
+	entry, err := b.DB.EntrySnapshotAt(uuid, versionsAgo)
+	if err != nil {
+		if txlogs.IsKeyNotFound(err) {
+			return Blob{}, nil
+		}
+		return nil, err
+	}
+
+	return Blob(entry), nil
+}
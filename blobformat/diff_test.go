@@ -0,0 +1,119 @@
+package blobformat
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+func TestDiff(t *testing.T) {
+	t.Parallel()
+
+	old := Blob{"name": "a", "user": "bob", "pass": "one"}
+	newer := Blob{"name": "a", "pass": "two", "url": "example.com"}
+
+	d := old.Diff(newer)
+	if !reflect.DeepEqual(d.Added, []KeyDiff{{Key: "url", New: "example.com"}}) {
+		t.Error("added wrong:", d.Added)
+	}
+	if !reflect.DeepEqual(d.Removed, []KeyDiff{{Key: "user", Old: "bob"}}) {
+		t.Error("removed wrong:", d.Removed)
+	}
+	if !reflect.DeepEqual(d.Changed, []KeyDiff{{Key: "pass", Old: "one", New: "two"}}) {
+		t.Error("changed wrong:", d.Changed)
+	}
+
+	if !newer.Diff(newer).Empty() {
+		t.Error("a blob should not differ from itself")
+	}
+}
+
+func TestDiffSnapshot(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("entry")
+	must(t, err)
+	must(t, b.Set(uuid, KeyUser, "bob"))
+	must(t, b.Set(uuid, KeyPass, "one"))
+	must(t, b.Set(uuid, KeyPass, "two"))
+
+	d, err := b.DiffSnapshot(uuid, 1, 0)
+	must(t, err)
+	if len(d.Added) != 0 || len(d.Removed) != 0 {
+		t.Error("only pass should have changed:", d)
+	}
+	if !reflect.DeepEqual(d.Changed, []KeyDiff{{Key: KeyPass, Old: "one", New: "two"}}) {
+		t.Error("changed wrong:", d.Changed)
+	}
+
+	// Reversed the change goes the other way
+	d, err = b.DiffSnapshot(uuid, 0, 1)
+	must(t, err)
+	if len(d.Changed) != 1 || d.Changed[0].Old != "two" || d.Changed[0].New != "one" {
+		t.Error("changed wrong:", d.Changed)
+	}
+
+	// Before the entry existed everything was added
+	d, err = b.DiffSnapshot(uuid, b.NVersions(uuid), 0)
+	must(t, err)
+	if len(d.Added) == 0 || len(d.Removed) != 0 || len(d.Changed) != 0 {
+		t.Error("everything should be added:", d)
+	}
+
+	if _, err = b.DiffSnapshot(uuid, b.NVersions(uuid)+1, 0); err == nil {
+		t.Error("expected an error for too many versions")
+	}
+	if _, err = b.DiffSnapshot("nope", 1, 0); err != ErrNotFound {
+		t.Error("expected not found, got:", err)
+	}
+}
+
+func TestDiffVault(t *testing.T) {
+	t.Parallel()
+
+	old := newTestBlobs()
+	kept, err := old.New("kept")
+	must(t, err)
+	removed, err := old.New("removed")
+	must(t, err)
+	same, err := old.New("same")
+	must(t, err)
+	must(t, old.Set(kept, KeyPass, "one"))
+
+	newer := Blobs{DB: &txlogs.DB{Log: append([]txlogs.Tx(nil), old.DB.Log...)}}
+	added, err := newer.New("added")
+	must(t, err)
+	newer.DB.Delete(removed)
+	must(t, newer.Set(kept, KeyPass, "two"))
+	must(t, newer.Rename(kept, "renamed"))
+
+	v, err := old.DiffVault(newer)
+	must(t, err)
+	if len(v.Added) != 1 || v.Added[0].UUID != added || v.Added[0].Name != "added" {
+		t.Error("added wrong:", v.Added)
+	}
+	if len(v.Removed) != 1 || v.Removed[0].UUID != removed || len(v.Removed[0].Diff.Removed) == 0 {
+		t.Error("removed wrong:", v.Removed)
+	}
+	if len(v.Changed) != 1 || v.Changed[0].UUID != kept || v.Changed[0].Name != "renamed" {
+		t.Fatal("changed wrong:", v.Changed)
+	}
+	for _, k := range v.Changed[0].Diff.Changed {
+		if k.Key == KeyPass && (k.Old != "one" || k.New != "two") {
+			t.Error("pass change wrong:", k)
+		}
+	}
+	for _, list := range [][]EntryDiff{v.Added, v.Removed, v.Changed} {
+		for _, e := range list {
+			if e.UUID == same {
+				t.Error("unchanged entry should not be in the diff")
+			}
+		}
+	}
+
+	if v, err = newer.DiffVault(newer); err != nil || !v.Empty() {
+		t.Error("a vault should not differ from itself:", v, err)
+	}
+}
@@ -0,0 +1,90 @@
+package blobformat
+
+import "sort"
+
+// Kinds of Duplicate
+const (
+	// DuplicatePass entries have the same password
+	DuplicatePass = "pass"
+	// DuplicateUserPass entries have the same user and password, they're
+	// also part of a DuplicatePass cluster
+	DuplicateUserPass = "user+pass"
+)
+
+// Duplicate is a cluster of entries that share credentials
+type Duplicate struct {
+	Kind    string
+	Entries SearchResults
+}
+
+// Duplicates finds the entries that reuse a password, every password shared by
+// more than one entry makes a DuplicatePass cluster and every user and
+// password pair a DuplicateUserPass one. The biggest clusters come first.
+// Users, sync entries, templates and the trash are left out.
+func (b Blobs) Duplicates() ([]Duplicate, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	type userPass struct{ user, pass string }
+	byPass := make(map[string]SearchResults)
+	byUserPass := make(map[userPass]SearchResults)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		pass := blob[KeyPass]
+		if len(pass) == 0 || !reportEntry(blob) {
+			continue
+		}
+
+		if byPass[pass] == nil {
+			byPass[pass] = make(SearchResults)
+		}
+		byPass[pass][uuid] = blob.Name()
+
+		if user := blob[KeyUser]; len(user) != 0 {
+			key := userPass{user: user, pass: pass}
+			if byUserPass[key] == nil {
+				byUserPass[key] = make(SearchResults)
+			}
+			byUserPass[key][uuid] = blob.Name()
+		}
+	}
+
+	var dupes []Duplicate
+	for _, entries := range byPass {
+		if len(entries) > 1 {
+			dupes = append(dupes, Duplicate{Kind: DuplicatePass, Entries: entries})
+		}
+	}
+	for _, entries := range byUserPass {
+		if len(entries) > 1 {
+			dupes = append(dupes, Duplicate{Kind: DuplicateUserPass, Entries: entries})
+		}
+	}
+
+	// Biggest first, then by kind and the first name in them so the order is
+	// stable
+	sort.Slice(dupes, func(i, j int) bool {
+		a, b := dupes[i], dupes[j]
+		switch {
+		case len(a.Entries) != len(b.Entries):
+			return len(a.Entries) > len(b.Entries)
+		case a.Kind != b.Kind:
+			return a.Kind == DuplicatePass
+		}
+		return firstName(a.Entries) < firstName(b.Entries)
+	})
+
+	return dupes, nil
+}
+
+// firstName returns the name that sorts first in entries
+func firstName(entries SearchResults) string {
+	var first string
+	for _, name := range entries {
+		if len(first) == 0 || name < first {
+			first = name
+		}
+	}
+	return first
+}
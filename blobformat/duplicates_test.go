@@ -0,0 +1,55 @@
+package blobformat
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestDuplicates(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	creds := []struct {
+		Name, User, Pass string
+	}{
+		{"a", "bob", "hunter2"},
+		{"b", "bob", "hunter2"},
+		{"c", "alice", "hunter2"},
+		{"d", "bob", "other"},
+		{"e", "", "other"},
+		{"f", "bob", "unique"},
+		{"trash/g", "bob", "unique"},
+	}
+	for _, c := range creds {
+		uuid, err := b.New(c.Name)
+		must(t, err)
+		if len(c.User) != 0 {
+			must(t, b.Set(uuid, KeyUser, c.User))
+		}
+		must(t, b.Set(uuid, KeyPass, c.Pass))
+	}
+
+	dupes, err := b.Duplicates()
+	must(t, err)
+
+	type cluster struct {
+		Kind  string
+		Names []string
+	}
+	var got []cluster
+	for _, d := range dupes {
+		names := d.Entries.Names()
+		sort.Strings(names)
+		got = append(got, cluster{d.Kind, names})
+	}
+
+	want := []cluster{
+		{DuplicatePass, []string{"a", "b", "c"}},
+		{DuplicatePass, []string{"d", "e"}},
+		{DuplicateUserPass, []string{"a", "b"}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("wrong clusters:\n%v\n%v", got, want)
+	}
+}
@@ -0,0 +1,134 @@
+package blobformat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Entry is a typed view of a Blob for users of the package that would rather
+// not deal with the raw keys. Converting a Blob to an Entry and back gives the
+// same Blob.
+type Entry struct {
+	Name      string
+	User      string
+	Email     string
+	URL       string
+	Pass      string
+	TwoFactor string
+	Notes     []Note
+	Labels    []string
+
+	Created  time.Time
+	Updated  time.Time
+	Accessed time.Time
+	Expires  time.Time
+
+	// Extra holds every key that doesn't have a field
+	Extra map[string]string
+}
+
+// Entry converts the blob to its typed form, malformed values are returned
+// as errors.
+func (b Blob) Entry() (Entry, error) {
+	var e Entry
+	var err error
+
+	name, ok := b[KeyName]
+	if !ok || len(name) == 0 {
+		return e, errors.New("entry has no name")
+	}
+
+	e.Name = name
+	e.User = b[KeyUser]
+	e.Email = b[KeyEmail]
+	e.URL = b[KeyURL]
+	e.Pass = b[KeyPass]
+	e.TwoFactor = b[KeyTwoFactor]
+	e.Labels = b.Labels()
+	e.Notes = b.Notes()
+
+	timestamps := []struct {
+		key string
+		t   *time.Time
+	}{
+		{KeyCreated, &e.Created},
+		{KeyUpdated, &e.Updated},
+		{KeyAccessed, &e.Accessed},
+		{KeyExpires, &e.Expires},
+	}
+	for _, ts := range timestamps {
+		if *ts.t, err = b.getTimestamp(ts.key); err != nil {
+			return e, fmt.Errorf("%s: %s: %w", name, ts.key, err)
+		}
+	}
+
+	for k, v := range b {
+		if _, ok := entryKeys[k]; ok {
+			continue
+		}
+		if e.Extra == nil {
+			e.Extra = make(map[string]string)
+		}
+		e.Extra[k] = v
+	}
+
+	return e, nil
+}
+
+// entryKeys are the keys that have fields in Entry
+var entryKeys = map[string]struct{}{
+	KeyName: {}, KeyUser: {}, KeyEmail: {}, KeyURL: {}, KeyPass: {},
+	KeyTwoFactor: {}, KeyNotes: {}, KeyLabels: {}, KeyCreated: {}, KeyUpdated: {},
+	KeyAccessed: {}, KeyExpires: {},
+}
+
+// Blob converts the entry back to the raw form, empty fields are omitted.
+func (e Entry) Blob() Blob {
+	b := make(Blob, len(e.Extra)+len(entryKeys))
+	for k, v := range e.Extra {
+		b[k] = v
+	}
+
+	set := func(k, v string) {
+		if len(v) != 0 {
+			b[k] = v
+		}
+	}
+	set(KeyName, e.Name)
+	set(KeyUser, e.User)
+	set(KeyEmail, e.Email)
+	set(KeyURL, e.URL)
+	set(KeyPass, e.Pass)
+	set(KeyTwoFactor, e.TwoFactor)
+	set(KeyLabels, strings.Join(e.Labels, ","))
+	if len(e.Notes) != 0 {
+		b[KeyNotes] = formatNotes(e.Notes)
+	}
+	setTime := func(k string, t time.Time) {
+		if !t.IsZero() {
+			b[k] = strconv.FormatInt(t.UnixNano(), 10)
+		}
+	}
+	setTime(KeyCreated, e.Created)
+	setTime(KeyUpdated, e.Updated)
+	setTime(KeyAccessed, e.Accessed)
+	setTime(KeyExpires, e.Expires)
+
+	return b
+}
+
+// Entry returns the typed form of the entry with the given uuid
+func (b Blobs) Entry(uuid string) (Entry, error) {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return Entry{}, err
+	}
+	if blob == nil {
+		return Entry{}, ErrNotFound
+	}
+
+	return blob.Entry()
+}
@@ -0,0 +1,57 @@
+package blobformat
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestEntry(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("entry")
+	must(t, err)
+	must(t, b.Set(uuid, KeyUser, "user"))
+	must(t, b.Set(uuid, KeyPass, "pass"))
+	must(t, b.AddNote(uuid, "note one"))
+	must(t, b.AddNote(uuid, "note two"))
+	must(t, b.Set(uuid, "custom", "value"))
+	must(t, b.AddLabel(uuid, "a"))
+	must(t, b.AddLabel(uuid, "b"))
+	must(t, b.SetExpires(uuid, time.Unix(1000, 0)))
+
+	e, err := b.Entry(uuid)
+	must(t, err)
+
+	if e.Name != "entry" || e.User != "user" || e.Pass != "pass" {
+		t.Errorf("fields wrong: %#v", e)
+	}
+	if len(e.Notes) != 2 || e.Notes[0].Text != "note one" || e.Notes[1].Text != "note two" {
+		t.Error("notes wrong:", e.Notes)
+	}
+	if !reflect.DeepEqual(e.Labels, []string{"a", "b"}) {
+		t.Error("labels wrong:", e.Labels)
+	}
+	if e.Created.IsZero() || e.Updated.IsZero() || !e.Expires.Equal(time.Unix(1000, 0)) {
+		t.Error("timestamps wrong:", e.Created, e.Updated, e.Expires)
+	}
+	if !reflect.DeepEqual(e.Extra, map[string]string{"custom": "value"}) {
+		t.Error("extra wrong:", e.Extra)
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if back := e.Blob(); !reflect.DeepEqual(back, blob) {
+		t.Errorf("round trip failed:\n%#v\n%#v", back, blob)
+	}
+
+	// Malformed data is an error, not a panic
+	b.DB.Set(uuid, KeyUpdated, "garbage")
+	if _, err = b.Entry(uuid); err == nil {
+		t.Error("expected an error")
+	}
+	if _, err = (Blob{}).Entry(); err == nil {
+		t.Error("expected an error for a blob without a name")
+	}
+}
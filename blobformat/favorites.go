@@ -0,0 +1,46 @@
+package blobformat
+
+// IsFavorite returns true if the entry is pinned as a favorite
+func (b Blob) IsFavorite() bool {
+	return b[KeyFavorite] == "true"
+}
+
+// SetFavorite pins or unpins an entry as a favorite
+func (b Blobs) SetFavorite(uuid string, favorite bool) error {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	if blob.IsFavorite() == favorite {
+		return nil
+	}
+
+	b.touchUpdated(uuid)
+	if favorite {
+		b.DB.Set(uuid, KeyFavorite, "true")
+	} else {
+		b.DB.DeleteKey(uuid, KeyFavorite)
+	}
+	return nil
+}
+
+// Favorites returns all entries pinned as favorites that aren't in the trash
+func (b Blobs) Favorites() (entries SearchResults, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries = make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		if blob.IsFavorite() && ScopeActive.includes(blob.Name()) {
+			entries[uuid] = blob.Name()
+		}
+	}
+
+	return entries, nil
+}
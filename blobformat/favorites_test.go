@@ -0,0 +1,38 @@
+package blobformat
+
+import "testing"
+
+func TestFavorites(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	fav, err := b.New("fav")
+	must(t, err)
+	_, err = b.New("other")
+	must(t, err)
+
+	if err = b.Set(fav, KeyFavorite, "true"); !IsKeyNotAllowed(err) {
+		t.Error("favorite should not be settable directly:", err)
+	}
+
+	must(t, b.SetFavorite(fav, true))
+	versions := b.NVersions(fav)
+	must(t, b.SetFavorite(fav, true))
+	if b.NVersions(fav) != versions {
+		t.Error("setting favorite again should be a no-op")
+	}
+
+	favs, err := b.Favorites()
+	must(t, err)
+	if len(favs) != 1 || favs[fav] != "fav" {
+		t.Error("wrong favorites:", favs)
+	}
+
+	must(t, b.SetFavorite(fav, false))
+	if favs, err = b.Favorites(); err != nil || len(favs) != 0 {
+		t.Error("should have no favorites:", favs, err)
+	}
+	if err = b.SetFavorite("nope", true); err != ErrNotFound {
+		t.Error("expected not found:", err)
+	}
+}
@@ -0,0 +1,205 @@
+package blobformat
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// History modes for FieldMeta, they control what is kept of the previous
+// values of a key.
+const (
+	// HistoryFull keeps every previous value (the default)
+	HistoryFull = ""
+	// HistoryHash keeps only a sha256 hash of previous values
+	HistoryHash = "hash"
+	// HistoryNone keeps only the fact that the value changed
+	HistoryNone = "none"
+)
+
+const (
+	// redactedHashPrefix starts previous values that were replaced by
+	// their hash
+	redactedHashPrefix = "sha256:"
+	// redactedValue replaces previous values that are not kept at all
+	redactedValue = "(not kept)"
+)
+
+// FieldMeta is metadata about how a key in an entry should be treated by UIs
+type FieldMeta struct {
+	// Sensitive values should be masked when displayed and only ever
+	// copied, never printed.
+	Sensitive bool `json:"sensitive,omitempty"`
+	// Hidden values should not be displayed at all unless asked for
+	// specifically.
+	Hidden bool `json:"hidden,omitempty"`
+	// History is what is kept of previous values of the key, one of the
+	// History constants.
+	History string `json:"history,omitempty"`
+	// Type of the value, one of the Type constants.
+	Type string `json:"type,omitempty"`
+}
+
+// IsZero returns true if no flags are set
+func (f FieldMeta) IsZero() bool {
+	return !f.Sensitive && !f.Hidden && f.History == HistoryFull && f.Type == TypeString
+}
+
+// AllFieldMeta returns the metadata for all keys that have some. The field
+// metadata is stored as json in the fieldmeta key.
+func (b Blob) AllFieldMeta() (map[string]FieldMeta, error) {
+	metaVal := b[KeyFieldMeta]
+	if len(metaVal) == 0 {
+		return nil, nil
+	}
+
+	var meta map[string]FieldMeta
+	if err := json.Unmarshal([]byte(metaVal), &meta); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", KeyFieldMeta, err)
+	}
+
+	return meta, nil
+}
+
+// FieldMeta returns the metadata for a key, if the key has none the zero value
+// is returned.
+func (b Blob) FieldMeta(key string) (FieldMeta, error) {
+	meta, err := b.AllFieldMeta()
+	if err != nil {
+		return FieldMeta{}, err
+	}
+
+	return meta[key], nil
+}
+
+// SetFieldMeta sets the metadata for a key in an entry, setting the zero
+// value removes it. If the history mode keeps less than before the previous
+// values of the key are redacted right away. Giving the key a type fails with
+// ErrWrongType if its value is not of that type.
+func (b Blobs) SetFieldMeta(uuid, key string, meta FieldMeta) error {
+	switch meta.History {
+	case HistoryFull, HistoryHash, HistoryNone:
+	default:
+		return fmt.Errorf("unknown history mode %q", meta.History)
+	}
+	switch meta.Type {
+	case TypeString, TypeNumber, TypeBool:
+	default:
+		return fmt.Errorf("unknown type %q", meta.Type)
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	all, err := blob.AllFieldMeta()
+	if err != nil {
+		return err
+	}
+
+	if val, ok := blob[key]; ok && meta.Type != all[key].Type {
+		if _, err = parseValue(meta.Type, val); err != nil {
+			return err
+		}
+	}
+
+	if meta.IsZero() {
+		if _, ok := all[key]; !ok {
+			return nil
+		}
+		delete(all, key)
+	} else {
+		if all == nil {
+			all = make(map[string]FieldMeta)
+		}
+		all[key] = meta
+	}
+
+	if len(all) == 0 {
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeyFieldMeta)
+		return nil
+	}
+
+	metaVal, err := json.Marshal(all)
+	if err != nil {
+		return err
+	}
+
+	if _, err = b.setKey(uuid, KeyFieldMeta, string(metaVal)); err != nil {
+		return err
+	}
+	b.redactKey(uuid, key, meta.History)
+	return nil
+}
+
+// RedactHistory redacts the previous values of every key according to its
+// history mode. Changes are redacted as they are made but values from
+// before the mode was set can come back when merging with copies of the
+// file that had not redacted them yet. Returns the number of values
+// redacted.
+func (b Blobs) RedactHistory() (int, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for uuid, entry := range b.DB.Snapshot {
+		meta, err := Blob(entry).AllFieldMeta()
+		if err != nil {
+			return n, err
+		}
+
+		for key, m := range meta {
+			n += b.redactKey(uuid, key, m.History)
+		}
+	}
+
+	return n, nil
+}
+
+// redactHistory redacts the previous values of a key in an entry if its
+// history mode calls for it.
+func (b Blobs) redactHistory(uuid, key string) error {
+	blob, err := b.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	meta, err := blob.FieldMeta(key)
+	if err != nil {
+		return err
+	}
+
+	b.redactKey(uuid, key, meta.History)
+	return nil
+}
+
+func (b Blobs) redactKey(uuid, key, mode string) int {
+	switch mode {
+	case HistoryHash:
+		return b.DB.Redact(uuid, key, func(value string) string {
+			if isRedacted(value) {
+				return value
+			}
+			sum := sha256.Sum256([]byte(value))
+			return redactedHashPrefix + hex.EncodeToString(sum[:])
+		})
+	case HistoryNone:
+		return b.DB.Redact(uuid, key, func(string) string {
+			return redactedValue
+		})
+	}
+
+	return 0
+}
+
+// isRedacted is true for a previous value that was replaced by redactKey
+func isRedacted(value string) bool {
+	return strings.HasPrefix(value, redactedHashPrefix) || value == redactedValue
+}
@@ -0,0 +1,285 @@
+package blobformat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// ErrNoSnapshotEntry is returned when restoring a snapshot from before the
+// entry existed.
+var ErrNoSnapshotEntry = errors.New("entry did not exist at that snapshot")
+
+// restoreSkip are keys that describe the state of an entry rather than its
+// contents, restoring a snapshot leaves them as they are.
+var restoreSkip = map[string]struct{}{
+	KeyCreated: {}, KeyUpdated: {}, KeyAccessed: {}, KeyDeleted: {},
+	KeyTrashed: {}, KeyTrashedName: {}, KeyProtected: {},
+	KeyCheckout: {}, KeyCheckoutReason: {}, KeyCheckoutTime: {},
+	KeyCompromised: {}, KeyPurged: {}, KeySnapshotCap: {},
+}
+
+// KeyChange is a single change to a key in an entry
+type KeyChange struct {
+	Time time.Time
+	// Value is empty if Deleted is true
+	Value   string
+	Deleted bool
+}
+
+// KeyHistory returns all the changes made to a key in an entry, the most
+// recent change first.
+func (b Blobs) KeyHistory(uuid, key string) ([]KeyChange, error) {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, ErrNotFound
+	}
+
+	txs := b.DB.KeyHistory(uuid, key)
+	changes := make([]KeyChange, 0, len(txs))
+	for i := len(txs) - 1; i >= 0; i-- {
+		tx := txs[i]
+		changes = append(changes, KeyChange{
+			Time:    time.Unix(0, tx.Time),
+			Value:   tx.Value,
+			Deleted: tx.Kind == txlogs.TxDeleteKey,
+		})
+	}
+
+	return changes, nil
+}
+
+// PassHistory returns the previous passwords of an entry, most recent first.
+// The current password and deletions are not included.
+func (b Blobs) PassHistory(uuid string) ([]KeyChange, error) {
+	changes, err := b.KeyHistory(uuid, KeyPass)
+	if err != nil {
+		return nil, err
+	}
+
+	blob, err := b.MustFind(uuid)
+	if err != nil {
+		return nil, err
+	}
+
+	var history []KeyChange
+	for i, c := range changes {
+		if c.Deleted {
+			continue
+		}
+		// The most recent set is the current password if it wasn't deleted
+		// since
+		if i == 0 {
+			if _, ok := blob[KeyPass]; ok {
+				continue
+			}
+		}
+
+		history = append(history, c)
+	}
+
+	return history, nil
+}
+
+// SnapshotInfo is an entry as it was at a snapshot along with when and why
+// the change that produced it was made.
+type SnapshotInfo struct {
+	Time time.Time
+	// Reason is empty for changes made before reasons were recorded or by
+	// something that didn't give one
+	Reason string
+	Blob   Blob
+}
+
+// SnapshotInfo returns the entry as it was at a snapshot (numbered like
+// DiffSnapshot) and the time and reason of the change that produced it. The
+// snapshot from before the entry existed has an empty Blob and zero Time.
+func (b Blobs) SnapshotInfo(uuid string, versionsAgo int) (SnapshotInfo, error) {
+	blob, err := b.entrySnapshot(uuid, versionsAgo)
+	if err != nil {
+		return SnapshotInfo{}, err
+	}
+
+	info := SnapshotInfo{Blob: blob}
+	skip := versionsAgo
+	for i := len(b.DB.Log) - 1; i >= 0; i-- {
+		tx := b.DB.Log[i]
+		if tx.UUID != uuid {
+			continue
+		}
+		if skip > 0 {
+			skip--
+			continue
+		}
+
+		info.Time = time.Unix(0, tx.Time)
+		info.Reason = tx.Reason
+		break
+	}
+
+	return info, nil
+}
+
+// RestoreSnapshot sets the keys of an entry back to what they were in a
+// snapshot (numbered like DiffSnapshot). The restore is recorded as a change
+// like any other so the state before it becomes a snapshot in turn and can be
+// restored to undo it.
+//
+// Values whose history was redacted (see FieldMeta.History) can't be
+// restored, those keys are left alone and returned in notKept.
+//
+// RestoreSnapshot uses Batch so it must not be called inside of one.
+func (b Blobs) RestoreSnapshot(uuid string, versionsAgo int) (notKept []string, err error) {
+	if err := b.checkProtected(uuid); err != nil {
+		return nil, err
+	}
+
+	current, err := b.Find(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if current == nil {
+		return nil, ErrNotFound
+	}
+
+	snap, err := b.entrySnapshot(uuid, versionsAgo)
+	if err != nil {
+		return nil, err
+	}
+	if len(snap) == 0 {
+		return nil, ErrNoSnapshotEntry
+	}
+
+	d := current.Diff(snap)
+	var restored []string
+	reason := fmt.Sprintf("restore snapshot %d", versionsAgo)
+	err = b.DB.Because(reason, func() error {
+		return b.Batch(func(tx *Tx) error {
+			for _, list := range [][]KeyDiff{d.Added, d.Changed} {
+				for _, k := range list {
+					if _, ok := restoreSkip[k.Key]; ok {
+						continue
+					}
+					if isRedacted(k.New) {
+						notKept = append(notKept, k.Key)
+						continue
+					}
+
+					if k.Key == KeyName {
+						if err := tx.Rename(uuid, k.New); err != nil {
+							return err
+						}
+						continue
+					}
+
+					tx.touchUpdated(uuid)
+					tx.DB.Set(uuid, k.Key, k.New)
+					restored = append(restored, k.Key)
+				}
+			}
+
+			for _, k := range d.Removed {
+				if _, ok := restoreSkip[k.Key]; ok {
+					continue
+				}
+
+				tx.touchUpdated(uuid)
+				tx.DB.DeleteKey(uuid, k.Key)
+				restored = append(restored, k.Key)
+			}
+
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// The values that were replaced are history now
+	for _, k := range restored {
+		if err := b.redactHistory(uuid, k); err != nil {
+			return nil, err
+		}
+	}
+
+	return notKept, nil
+}
+
+// PurgeSnapshots irreversibly removes every change to an entry that no longer
+// affects it, leaving only the values it has now. Returns how many changes
+// were removed.
+//
+// When the entry is purged is recorded in it so that ReapplyPurges can remove
+// the same changes again when they come back from a copy of the file that
+// hasn't been purged yet (through a sync).
+func (b Blobs) PurgeSnapshots(uuid string) (int, error) {
+	if err := b.checkProtected(uuid); err != nil {
+		return 0, err
+	}
+	if _, err := b.MustFind(uuid); err != nil {
+		return 0, err
+	}
+
+	now := time.Now().UnixNano()
+	b.DB.Set(uuid, KeyPurged, strconv.FormatInt(now, 10))
+	removed, err := b.DB.Purge(uuid, now)
+	return len(removed), err
+}
+
+// ReapplyPurges purges the entries that were purged again, it should be done
+// after merging with other copies of the file. Returns how many changes were
+// removed.
+func (b Blobs) ReapplyPurges() (int, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return 0, err
+	}
+
+	purges := make(map[string]time.Time)
+	for uuid, entry := range b.DB.Snapshot {
+		purged, err := Blob(entry).getTimestamp(KeyPurged)
+		if err != nil {
+			return 0, err
+		}
+		if !purged.IsZero() {
+			purges[uuid] = purged
+		}
+	}
+
+	n := 0
+	for uuid, purged := range purges {
+		removed, err := b.DB.Purge(uuid, purged.UnixNano())
+		if err != nil {
+			return n, err
+		}
+		n += len(removed)
+	}
+
+	return n, nil
+}
+
+// ChainedSchema is the schema version from which the history of every entry
+// is chained, older files are chained when they're migrated to it.
+const ChainedSchema = 3
+
+// HistoryChained returns true if the history has been chained, see
+// ChainedSchema
+func (b Blobs) HistoryChained() bool {
+	return b.DB.Schema >= ChainedSchema
+}
+
+// VerifyHistory checks that the history of every entry is intact, returning
+// the uuids of the entries whose history was changed outside of bpass. The
+// log must have a chain key set (see txlogs.DB.SetChainKey). Nothing is
+// broken in files that haven't been chained yet (see HistoryChained).
+func (b Blobs) VerifyHistory() (broken []string, err error) {
+	if !b.HistoryChained() {
+		return nil, nil
+	}
+	return b.DB.VerifyChain()
+}
@@ -0,0 +1,103 @@
+package blobformat
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/pquerna/otp"
+	"github.com/pquerna/otp/hotp"
+)
+
+var (
+	// ErrHOTP is returned by Blob.TwoFactor for hotp keys, their codes must be
+	// generated with Blobs.NextTwoFactor so the counter is moved along
+	ErrHOTP = errors.New("hotp codes must be generated with NextTwoFactor")
+	// ErrNotHOTP is returned by HOTPCounter when the two factor key isn't hotp
+	ErrNotHOTP = errors.New("two factor key is not a hotp key")
+)
+
+// HOTPCounter returns the counter the next HOTP code will be generated with.
+// ErrNotHOTP is returned if the two factor key is not set or is not HOTP.
+func (b Blob) HOTPCounter() (uint64, error) {
+	return b.hotpCounter(b[KeyTwoFactor])
+}
+
+func (b Blob) hotpCounter(twoFactorURI string) (uint64, error) {
+	uri, err := url.Parse(twoFactorURI)
+	if err != nil || uri.Scheme != "otpauth" || uri.Host != "hotp" {
+		return 0, ErrNotHOTP
+	}
+
+	counter := uri.Query().Get("counter")
+	if len(counter) == 0 {
+		return 0, nil
+	}
+
+	n, err := strconv.ParseUint(counter, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse hotp counter for %s: %w", b.Name(), err)
+	}
+	return n, nil
+}
+
+// NextTwoFactor returns an authentication code like Blob.TwoFactor but also
+// handles HOTP keys: the code is generated from the counter, which is then
+// incremented and saved so the same code is never given out twice.
+func (b Blobs) NextTwoFactor(uuid string) (string, error) {
+	return b.NextTwoFactorNamed(uuid, "")
+}
+
+// NextTwoFactorNamed is NextTwoFactor for the two factor key with label (see
+// SetTwofactorNamed), an empty label is the entry's main key.
+func (b Blobs) NextTwoFactorNamed(uuid, label string) (string, error) {
+	blob, err := b.MustFind(uuid)
+	if err != nil {
+		return "", err
+	}
+
+	twoFactorURI, err := blob.twoFactorURI(label)
+	if err != nil {
+		return "", err
+	}
+	code, err := blob.twoFactorAt(twoFactorURI, time.Now())
+	if err != ErrHOTP {
+		return code, err
+	}
+
+	counter, err := blob.hotpCounter(twoFactorURI)
+	if err != nil {
+		return "", err
+	}
+	key, err := otp.NewKeyFromURL(twoFactorURI)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse two factor uri for %s: %w", blob.Name(), err)
+	}
+	opts, err := parseOTPOptions(twoFactorURI)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse two factor uri for %s: %w", blob.Name(), err)
+	}
+	code, err = hotp.GenerateCodeCustom(key.Secret(), counter, hotp.ValidateOpts{
+		Digits:    opts.Digits,
+		Algorithm: opts.Algorithm,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	uri, err := url.Parse(twoFactorURI)
+	if err != nil {
+		return "", err
+	}
+	query := uri.Query()
+	query.Set("counter", strconv.FormatUint(counter+1, 10))
+	uri.RawQuery = query.Encode()
+
+	if err = b.setTwoFactorURI(uuid, label, uri.String()); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
@@ -0,0 +1,51 @@
+package blobformat
+
+import "testing"
+
+func TestHOTP(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("hotp")
+	must(t, err)
+
+	// Test vectors from RFC 4226
+	must(t, b.SetTwofactor(uuid, "otpauth://hotp/bpass:test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=1"))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if _, err = blob.TwoFactor(); err != ErrHOTP {
+		t.Error("expected ErrHOTP:", err)
+	}
+	if counter, err := blob.HOTPCounter(); err != nil || counter != 1 {
+		t.Error("wrong counter:", counter, err)
+	}
+
+	changes := len(b.DB.KeyHistory(uuid, KeyTwoFactor))
+	for i, want := range []string{"287082", "359152", "969429"} {
+		code, err := b.NextTwoFactor(uuid)
+		must(t, err)
+		if code != want {
+			t.Errorf("%d) want: %s, got: %s", i, want, code)
+		}
+	}
+	if len(b.DB.KeyHistory(uuid, KeyTwoFactor)) != changes+3 {
+		t.Error("each code should have saved the counter")
+	}
+
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if counter, err := blob.HOTPCounter(); err != nil || counter != 4 {
+		t.Error("wrong counter:", counter, err)
+	}
+
+	must(t, b.SetTwofactor(uuid, "JBSWY3DPEHPK3PXP"))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, err = blob.HOTPCounter(); err != ErrNotHOTP {
+		t.Error("expected ErrNotHOTP:", err)
+	}
+	if code, err := b.NextTwoFactor(uuid); err != nil || len(code) != 6 {
+		t.Error("totp code was wrong:", code, err)
+	}
+}
@@ -0,0 +1,80 @@
+package blobformat
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// MaxIconSize is the largest icon in bytes that can be stored in an entry,
+// icons are stored in the file (and every snapshot) so they must stay small.
+const MaxIconSize = 32 * 1024
+
+// Icon errors
+var (
+	ErrIconTooLarge = errors.New("icon is too large")
+	ErrIconNotImage = errors.New("icon is not an image")
+	ErrIconInvalid  = errors.New("icon is not a base64 data uri")
+)
+
+// Icon returns the image data of the entry's icon and its mime type. The data
+// is nil if the entry has no icon.
+func (b Blob) Icon() (mimeType string, data []byte, err error) {
+	val, ok := b[KeyIcon]
+	if !ok || len(val) == 0 {
+		return "", nil, nil
+	}
+
+	if !strings.HasPrefix(val, "data:") {
+		return "", nil, ErrIconInvalid
+	}
+	comma := strings.IndexByte(val, ',')
+	if comma < 0 || !strings.HasSuffix(val[:comma], ";base64") {
+		return "", nil, ErrIconInvalid
+	}
+
+	data, err = base64.StdEncoding.DecodeString(val[comma+1:])
+	if err != nil {
+		return "", nil, ErrIconInvalid
+	}
+
+	return strings.TrimSuffix(val[len("data:"):comma], ";base64"), data, nil
+}
+
+// SetIcon stores an image (png, ico, gif etc.) as the icon of the entry. The
+// type of image is detected from its contents. Empty data removes the icon.
+func (b Blobs) SetIcon(uuid string, data []byte) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	if len(data) == 0 {
+		if _, ok := blob[KeyIcon]; !ok {
+			return nil
+		}
+
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeyIcon)
+		return nil
+	}
+
+	if len(data) > MaxIconSize {
+		return ErrIconTooLarge
+	}
+	mimeType := http.DetectContentType(data)
+	if !strings.HasPrefix(mimeType, "image/") {
+		return ErrIconNotImage
+	}
+
+	_, err = b.setKey(uuid, KeyIcon, "data:"+mimeType+";base64,"+base64.StdEncoding.EncodeToString(data))
+	return err
+}
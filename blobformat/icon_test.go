@@ -0,0 +1,43 @@
+package blobformat
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestIcon(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("entry")
+	must(t, err)
+
+	if err = b.Set(uuid, KeyIcon, "data:image/png;base64,"); !IsKeyNotAllowed(err) {
+		t.Error("icon should not be settable directly:", err)
+	}
+
+	png := append([]byte("\x89PNG\x0D\x0A\x1A\x0A"), make([]byte, 16)...)
+	must(t, b.SetIcon(uuid, png))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	mimeType, data, err := blob.Icon()
+	must(t, err)
+	if mimeType != "image/png" || !bytes.Equal(data, png) {
+		t.Error("wrong icon:", mimeType, data)
+	}
+
+	if err = b.SetIcon(uuid, []byte("<html></html>")); err != ErrIconNotImage {
+		t.Error("expected not an image:", err)
+	}
+	if err = b.SetIcon(uuid, append(png, make([]byte, MaxIconSize)...)); err != ErrIconTooLarge {
+		t.Error("expected too large:", err)
+	}
+
+	must(t, b.SetIcon(uuid, nil))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, data, err = blob.Icon(); err != nil || data != nil {
+		t.Error("icon should be removed:", data, err)
+	}
+}
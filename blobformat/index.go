@@ -0,0 +1,194 @@
+package blobformat
+
+import (
+	"strings"
+
+	"github.com/aarondl/bpass/txlogs"
+	"golang.org/x/text/unicode/norm"
+)
+
+// SearchIndex speeds up Search for large files by keeping the characters in
+// the name of every entry. A fuzzy match needs every character of the search
+// to be in the name, so only the entries that have all of them are checked.
+//
+// The index is brought up to date with the log on each search: new changes
+// to names are applied as they come and it's rebuilt if the log was replaced
+// or rewritten (by a merge or compaction for example). A SearchIndex must
+// only be used with one Blobs, set it on Blobs.Index.
+type SearchIndex struct {
+	// slots holds the uuid of the entry in each slot, empty slots are free
+	slots []string
+	free  []int
+	uuids map[string]indexed
+	// runes has a bitset of the slots whose names have the rune
+	runes map[rune][]uint64
+
+	// n is how much of the log has been indexed and last the time of the
+	// last transaction indexed, to notice when the log is replaced
+	n    int
+	last int64
+}
+
+type indexed struct {
+	slot  int
+	runes []rune
+}
+
+// NewSearchIndex creates an empty index, it's built on first use
+func NewSearchIndex() *SearchIndex {
+	return &SearchIndex{}
+}
+
+// update brings the index up to date with the log, the snapshot must be up to
+// date.
+func (s *SearchIndex) update(db *txlogs.DB) {
+	if s.uuids == nil || s.n > len(db.Log) || (s.n != 0 && db.Log[s.n-1].Time != s.last) {
+		s.rebuild(db)
+		return
+	}
+
+	for _, tx := range db.Log[s.n:] {
+		switch tx.Kind {
+		case txlogs.TxAdd, txlogs.TxDelete:
+		case txlogs.TxSetKey, txlogs.TxDeleteKey:
+			if tx.Key != KeyName {
+				continue
+			}
+		default:
+			continue
+		}
+
+		s.remove(tx.UUID)
+		if entry, ok := db.Snapshot[tx.UUID]; ok {
+			s.add(tx.UUID, Blob(entry).Name())
+		}
+	}
+	s.mark(db)
+}
+
+func (s *SearchIndex) rebuild(db *txlogs.DB) {
+	*s = SearchIndex{
+		uuids: make(map[string]indexed, len(db.Snapshot)),
+		runes: make(map[rune][]uint64),
+	}
+	for uuid, entry := range db.Snapshot {
+		s.add(uuid, Blob(entry).Name())
+	}
+	s.mark(db)
+}
+
+func (s *SearchIndex) mark(db *txlogs.DB) {
+	s.n = len(db.Log)
+	if s.n != 0 {
+		s.last = db.Log[s.n-1].Time
+	}
+}
+
+func (s *SearchIndex) add(uuid, name string) {
+	var slot int
+	if len(s.free) != 0 {
+		slot = s.free[len(s.free)-1]
+		s.free = s.free[:len(s.free)-1]
+		s.slots[slot] = uuid
+	} else {
+		slot = len(s.slots)
+		s.slots = append(s.slots, uuid)
+	}
+
+	runes := indexRunes(name)
+	for _, r := range runes {
+		set := s.runes[r]
+		for len(set) <= slot/64 {
+			set = append(set, 0)
+		}
+		set[slot/64] |= 1 << uint(slot%64)
+		s.runes[r] = set
+	}
+	s.uuids[uuid] = indexed{slot: slot, runes: runes}
+}
+
+func (s *SearchIndex) remove(uuid string) {
+	idx, ok := s.uuids[uuid]
+	if !ok {
+		return
+	}
+
+	for _, r := range idx.runes {
+		s.runes[r][idx.slot/64] &^= 1 << uint(idx.slot%64)
+	}
+	delete(s.uuids, uuid)
+	s.slots[idx.slot] = ""
+	s.free = append(s.free, idx.slot)
+}
+
+// candidates returns the uuids of the entries that have every character of
+// search in their name. With fold the search is composed the same way
+// matchName composes it, the characters it had before that don't have to be
+// in the name.
+func (s *SearchIndex) candidates(search string, fold bool) []string {
+	if fold {
+		search = norm.NFC.String(search)
+	}
+
+	var set []uint64
+	first := true
+	for _, r := range lowerRunes(search) {
+		if r == '/' {
+			// Splits fragments, it doesn't have to be in the name
+			continue
+		}
+
+		have := s.runes[r]
+		if first {
+			set = append([]uint64(nil), have...)
+			first = false
+			continue
+		}
+		if len(have) < len(set) {
+			set = set[:len(have)]
+		}
+		for i := range set {
+			set[i] &= have[i]
+		}
+	}
+
+	if first {
+		// Nothing to narrow down by
+		uuids := make([]string, 0, len(s.uuids))
+		for uuid := range s.uuids {
+			uuids = append(uuids, uuid)
+		}
+		return uuids
+	}
+
+	var uuids []string
+	for i, word := range set {
+		for bit := 0; word != 0; bit++ {
+			if word&1 != 0 {
+				uuids = append(uuids, s.slots[i*64+bit])
+			}
+			word >>= 1
+		}
+	}
+	return uuids
+}
+
+// indexRunes returns the distinct lowercase runes of a name as it is and in
+// its composed form, a search is narrowed down by one form or the other
+// depending on FoldNames (see candidates).
+func indexRunes(name string) []rune {
+	return lowerRunes(name + norm.NFC.String(name))
+}
+
+// lowerRunes returns the distinct lowercase runes of s
+func lowerRunes(s string) []rune {
+	var runes []rune
+	seen := make(map[rune]bool)
+	for _, r := range strings.ToLower(s) {
+		if !seen[r] {
+			seen[r] = true
+			runes = append(runes, r)
+		}
+	}
+	return runes
+}
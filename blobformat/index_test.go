@@ -0,0 +1,120 @@
+package blobformat
+
+import (
+	"fmt"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+func TestSearchIndex(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	b.Index = NewSearchIndex()
+	plain := Blobs{DB: b.DB}
+
+	check := func(search string) {
+		t.Helper()
+		want, err := plain.Search(search)
+		must(t, err)
+		got, err := b.Search(search)
+		must(t, err)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: index found %v, want %v", search, got, want)
+		}
+	}
+
+	for _, name := range []string{"github", "GitLab", "work/gmail", "aws"} {
+		_, err := b.New(name)
+		must(t, err)
+	}
+	for _, search := range []string{"", "g", "gl", "GL", "w/gm", "x"} {
+		check(search)
+	}
+
+	// Changes made after the index was built are picked up
+	uuid, _, err := b.FindByName("aws")
+	must(t, err)
+	must(t, b.Rename(uuid, "amazon"))
+	gmail, _, err := b.FindByName("work/gmail")
+	must(t, err)
+	b.DB.Delete(gmail)
+	_, err = b.New("gitea")
+	must(t, err)
+	for _, search := range []string{"aws", "amz", "gm", "gi"} {
+		check(search)
+	}
+
+	// As is the log being replaced
+	b.DB.Log = b.DB.Log[:4]
+	b.DB.ResetSnapshot()
+	check("g")
+
+	// Folded searches are narrowed down by their composed form, a decomposed
+	// search still finds a composed name and the other way around
+	b.FoldNames, plain.FoldNames = true, true
+	_, err = b.New("caf\u00e9")
+	must(t, err)
+	_, err = b.New("re\u0301sume\u0301")
+	must(t, err)
+	for _, search := range []string{"e\u0301", "cafe\u0301", "\u00e9", "r\u00e9s"} {
+		check(search)
+		if got, err := b.Search(search); err != nil {
+			t.Fatal(err)
+		} else if len(got) == 0 {
+			t.Errorf("%q: expected a match", search)
+		}
+	}
+}
+
+func BenchmarkSearch(b *testing.B) {
+	blobs := benchBlobs(20000)
+	benchSearch(b, blobs)
+}
+
+func BenchmarkSearchIndexed(b *testing.B) {
+	blobs := benchBlobs(20000)
+	blobs.Index = NewSearchIndex()
+	benchSearch(b, blobs)
+}
+
+func benchSearch(b *testing.B, blobs Blobs) {
+	searches := []string{"gthb", "wrk/aws", "qz", "mail"}
+	if _, err := blobs.Search(""); err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := blobs.Search(searches[i%len(searches)]); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchBlobs creates a file with n entries with random names
+func benchBlobs(n int) Blobs {
+	words := []string{"github", "gitlab", "aws", "gmail", "bank", "work", "home", "vpn", "wifi", "router", "db", "prod", "staging"}
+	r := rand.New(rand.NewSource(1))
+
+	blobs := Blobs{DB: new(txlogs.DB)}
+	names := make(map[string]bool, n)
+	for len(names) < n {
+		name := fmt.Sprintf("%s/%s-%d", words[r.Intn(len(words))], words[r.Intn(len(words))], r.Intn(n*10))
+		if names[name] {
+			continue
+		}
+		names[name] = true
+
+		uuid, err := blobs.DB.Add()
+		if err != nil {
+			panic(err)
+		}
+		blobs.DB.Set(uuid, KeyName, name)
+	}
+
+	return blobs
+}
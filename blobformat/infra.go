@@ -0,0 +1,60 @@
+package blobformat
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"strings"
+)
+
+// ErrNoHost is returned when an entry has nothing to connect to
+var ErrNoHost = errors.New("entry has no hostname, ip or host")
+
+// SSHTarget is where to connect to for an entry made from the infra (or
+// server) template.
+type SSHTarget struct {
+	User string
+	Host string
+	Port int
+}
+
+// SSHTarget returns the host to connect to for the entry. The hostname key
+// is preferred over the ip key, the host key of the server template is used
+// if neither is set. The port defaults to 22.
+func (b Blob) SSHTarget() (SSHTarget, error) {
+	t := SSHTarget{User: b[KeyUser], Port: 22}
+
+	switch {
+	case len(b[KeyHostname]) != 0:
+		t.Host = b[KeyHostname]
+	case len(b[KeyIP]) != 0:
+		t.Host = b[KeyIP]
+		if net.ParseIP(t.Host) == nil {
+			return t, ValidationError{Name: b.Name(), Key: KeyIP, Msg: "must be an ip address"}
+		}
+	case len(b["host"]) != 0:
+		t.Host = b["host"]
+	default:
+		return t, ErrNoHost
+	}
+
+	if p := strings.TrimSpace(b[KeyPort]); len(p) != 0 {
+		port, err := strconv.Atoi(p)
+		if err != nil || port < 1 || port > 65535 {
+			return t, ValidationError{Name: b.Name(), Key: KeyPort, Msg: "must be a port number"}
+		}
+		t.Port = port
+	}
+
+	return t, nil
+}
+
+// Args returns the arguments for the ssh command to connect to the target
+func (t SSHTarget) Args() []string {
+	dest := t.Host
+	if len(t.User) != 0 {
+		dest = t.User + "@" + dest
+	}
+
+	return []string{"-p", strconv.Itoa(t.Port), dest}
+}
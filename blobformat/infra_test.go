@@ -0,0 +1,38 @@
+package blobformat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSSHTarget(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		Blob Blob
+		Args []string
+		Err  bool
+	}{
+		{Blob{KeyName: "db", KeyHostname: "db.example.com", KeyIP: "10.0.0.1", KeyUser: "root"}, []string{"-p", "22", "root@db.example.com"}, false},
+		{Blob{KeyName: "db", KeyIP: "10.0.0.1", KeyPort: "2222"}, []string{"-p", "2222", "10.0.0.1"}, false},
+		{Blob{KeyName: "db", "host": "old.example.com"}, []string{"-p", "22", "old.example.com"}, false},
+		{Blob{KeyName: "db", KeyIP: "10.0.0"}, nil, true},
+		{Blob{KeyName: "db", KeyHostname: "db", KeyPort: "ssh"}, nil, true},
+		{Blob{KeyName: "db", KeyUser: "root"}, nil, true},
+	}
+
+	for i, test := range tests {
+		target, err := test.Blob.SSHTarget()
+		if test.Err {
+			if err == nil {
+				t.Errorf("%d) expected an error", i)
+			}
+			continue
+		}
+		must(t, err)
+
+		if args := target.Args(); !reflect.DeepEqual(args, test.Args) {
+			t.Errorf("%d) want: %v got: %v", i, test.Args, args)
+		}
+	}
+}
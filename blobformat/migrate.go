@@ -0,0 +1,168 @@
+package blobformat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// SchemaVersion is the current layout version of the data, files with an
+// older version are migrated by Migrate.
+const SchemaVersion = 3
+
+// Migration upgrades the data from Version-1 to Version. Run must not make
+// any changes when dryRun is set but still report what it would change.
+type Migration struct {
+	Version     uint
+	Description string
+	Run         func(b Blobs, dryRun bool) (changes []string, err error)
+}
+
+// migrations must be kept in order of Version
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "convert bare two factor secrets to otpauth uris",
+		Run:         migrateTwofactorURIs,
+	},
+	{
+		Version:     2,
+		Description: "convert plain text notes to structured notes",
+		Run:         migrateStructuredNotes,
+	},
+	{
+		Version:     ChainedSchema,
+		Description: "chain the history of every entry",
+		Run:         migrateChainHistory,
+	},
+}
+
+// NeedsMigration returns true if the data is in an older layout
+func (b Blobs) NeedsMigration() bool {
+	return b.DB.Schema < SchemaVersion
+}
+
+// Migrate runs all migrations newer than the file's schema version and
+// returns a description of each change made. With dryRun set nothing is
+// changed (including the version) and the changes are what would have been
+// done.
+func (b Blobs) Migrate(dryRun bool) (changes []string, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	for _, m := range migrations {
+		if m.Version <= b.DB.Schema {
+			continue
+		}
+
+		// Migrations change layout not content, protection doesn't apply
+		var c []string
+		reason := fmt.Sprintf("migrate to v%d", m.Version)
+		err := b.DB.Because(reason, func() (err error) {
+			c, err = m.Run(b.Force(), dryRun)
+			return err
+		})
+		if err != nil {
+			return changes, fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+		for _, change := range c {
+			changes = append(changes, fmt.Sprintf("v%d: %s", m.Version, change))
+		}
+
+		if !dryRun {
+			b.DB.Schema = m.Version
+		}
+	}
+
+	return changes, nil
+}
+
+// migrateTwofactorURIs converts twofactor keys that hold just the secret (as
+// set by very old versions or typed in by hand) to otpauth uris.
+func migrateTwofactorURIs(b Blobs, dryRun bool) (changes []string, err error) {
+	var uuids []string
+	for uuid, entry := range b.DB.Snapshot {
+		val, ok := entry[KeyTwoFactor]
+		if ok && len(val) != 0 && !strings.HasPrefix(val, "otpauth://") && !strings.HasPrefix(val, yubiKeyPrefix) {
+			uuids = append(uuids, uuid)
+		}
+	}
+	sort.Slice(uuids, func(i, j int) bool {
+		return Blob(b.DB.Snapshot[uuids[i]]).Name() < Blob(b.DB.Snapshot[uuids[j]]).Name()
+	})
+
+	for _, uuid := range uuids {
+		name := Blob(b.DB.Snapshot[uuid]).Name()
+		secret := strings.ToUpper(strings.ReplaceAll(b.DB.Snapshot[uuid][KeyTwoFactor], " ", ""))
+
+		changes = append(changes, fmt.Sprintf("%s: convert totp secret to an otpauth uri", name))
+		if dryRun {
+			continue
+		}
+
+		if err := b.SetTwofactor(uuid, secret); err != nil {
+			return changes, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return changes, nil
+}
+
+// migrateStructuredNotes turns plain text notes into a single structured note
+// created when the notes were last set.
+func migrateStructuredNotes(b Blobs, dryRun bool) (changes []string, err error) {
+	var uuids []string
+	for uuid, entry := range b.DB.Snapshot {
+		val, ok := entry[KeyNotes]
+		if !ok || len(val) == 0 {
+			continue
+		}
+		if _, ok := parseNotes(val); !ok {
+			uuids = append(uuids, uuid)
+		}
+	}
+	sort.Slice(uuids, func(i, j int) bool {
+		return Blob(b.DB.Snapshot[uuids[i]]).Name() < Blob(b.DB.Snapshot[uuids[j]]).Name()
+	})
+
+	for _, uuid := range uuids {
+		blob := Blob(b.DB.Snapshot[uuid])
+		changes = append(changes, fmt.Sprintf("%s: convert notes to a structured note", blob.Name()))
+		if dryRun {
+			continue
+		}
+
+		var created time.Time
+		if history := b.DB.KeyHistory(uuid, KeyNotes); len(history) != 0 {
+			created = time.Unix(0, history[len(history)-1].Time)
+		}
+
+		b.DB.Set(uuid, KeyNotes, formatNotes([]Note{{Created: created, Text: blob[KeyNotes]}}))
+	}
+
+	return changes, nil
+}
+
+// migrateChainHistory chains the history of every entry with the log's chain
+// key. It's only ever done here, once a file is chained a transaction without
+// a MAC is a change made outside of bpass.
+func migrateChainHistory(b Blobs, dryRun bool) (changes []string, err error) {
+	if len(b.DB.Log) == 0 {
+		return nil, nil
+	}
+
+	changes = append(changes, "chain the history of every entry")
+	if dryRun {
+		return changes, nil
+	}
+	if !b.DB.HasChainKey() {
+		return nil, txlogs.ErrNoChainKey
+	}
+
+	b.DB.Rechain()
+	return changes, nil
+}
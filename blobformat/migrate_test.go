@@ -0,0 +1,60 @@
+package blobformat
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	b.DB.SetChainKey([]byte("key"))
+	bare, err := b.New("bare")
+	must(t, err)
+	uri, err := b.New("uri")
+	must(t, err)
+
+	b.DB.Set(bare, KeyTwoFactor, "jbsw y3dp ehpk 3pxp")
+	must(t, b.SetTwofactor(uri, "JBSWY3DPEHPK3PXP"))
+	b.DB.Schema = 0
+
+	if !b.NeedsMigration() {
+		t.Fatal("should need migration")
+	}
+
+	logLen := len(b.DB.Log)
+	changes, err := b.Migrate(true)
+	must(t, err)
+	if len(changes) != 2 || !strings.Contains(changes[0], "bare") {
+		t.Error("wrong changes:", changes)
+	}
+	if len(b.DB.Log) != logLen || !b.NeedsMigration() {
+		t.Error("dry run should not change anything")
+	}
+
+	changes, err = b.Migrate(false)
+	must(t, err)
+	if len(changes) != 2 {
+		t.Error("wrong changes:", changes)
+	}
+	if b.NeedsMigration() {
+		t.Error("should be up to date")
+	}
+	if broken, err := b.VerifyHistory(); err != nil || len(broken) != 0 {
+		t.Error("history should be chained:", broken, err)
+	}
+
+	blob, err := b.MustFind(bare)
+	must(t, err)
+	if !strings.HasPrefix(blob[KeyTwoFactor], "otpauth://") {
+		t.Error("totp was not converted:", blob[KeyTwoFactor])
+	}
+	if _, err = blob.TwoFactor(); err != nil {
+		t.Error(err)
+	}
+
+	if changes, err = b.Migrate(false); err != nil || len(changes) != 0 {
+		t.Error("should have nothing left to do:", changes, err)
+	}
+}
@@ -0,0 +1,203 @@
+package blobformat
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aarondl/bpass/fuzzy"
+	"golang.org/x/text/unicode/norm"
+)
+
+// NameRules are normalizations applied to entry names when they're created
+// or renamed.
+type NameRules uint8
+
+// Name rules, see ParseNameRules
+const (
+	// NameLower lowercases names
+	NameLower NameRules = 1 << iota
+	// NameDashes replaces spaces with dashes
+	NameDashes
+	// NameNFC normalizes names to NFC so accents are precomposed characters
+	NameNFC
+)
+
+var nameRuleNames = []struct {
+	Name string
+	Rule NameRules
+}{
+	{"lower", NameLower},
+	{"dash", NameDashes},
+	{"nfc", NameNFC},
+}
+
+// ParseNameRules parses a comma separated list of rules: lower, dash and nfc.
+func ParseNameRules(s string) (NameRules, error) {
+	var rules NameRules
+	for _, r := range strings.Split(s, ",") {
+		r = strings.TrimSpace(r)
+		if len(r) == 0 {
+			continue
+		}
+
+		found := false
+		for _, n := range nameRuleNames {
+			if n.Name == r {
+				rules |= n.Rule
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("unknown name rule %q (want lower, dash or nfc)", r)
+		}
+	}
+
+	return rules, nil
+}
+
+// String returns the rules in the format ParseNameRules takes
+func (r NameRules) String() string {
+	var names []string
+	for _, n := range nameRuleNames {
+		if r&n.Rule != 0 {
+			names = append(names, n.Name)
+		}
+	}
+	return strings.Join(names, ",")
+}
+
+// Apply the rules to a name
+func (r NameRules) Apply(name string) string {
+	if r&NameNFC != 0 {
+		name = norm.NFC.String(name)
+	}
+	if r&NameLower != 0 {
+		name = strings.ToLower(name)
+	}
+	if r&NameDashes != 0 {
+		name = strings.Replace(name, " ", "-", -1)
+	}
+	return name
+}
+
+// NameChange is a rename made (or that would be made) by NormalizeNames
+type NameChange struct {
+	UUID string
+	Old  string
+	New  string
+	// Conflict is set when the new name is taken by another entry, the entry
+	// is left alone.
+	Conflict bool
+}
+
+// NormalizeNames renames existing entries to follow the NameRules. Entries
+// whose new name would collide with another entry's are not renamed and are
+// returned with Conflict set. With dryRun set nothing is changed. User, sync
+// and protected entries are never renamed.
+func (b Blobs) NormalizeNames(dryRun bool) ([]NameChange, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	var changes []NameChange
+	claims := make(map[string]int)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		name := blob.Name()
+		newName := b.normalizeName(name)
+		if blob.IsProtected() {
+			newName = name
+		}
+		claims[b.nameKey(newName)]++
+
+		if newName != name {
+			changes = append(changes, NameChange{UUID: uuid, Old: name, New: newName})
+		}
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Old < changes[j].Old
+	})
+	for i, c := range changes {
+		changes[i].Conflict = claims[b.nameKey(c.New)] > 1
+	}
+
+	if dryRun {
+		return changes, nil
+	}
+
+	err := b.DB.Because("normalize names", func() error {
+		return b.Batch(func(tx *Tx) error {
+			for _, c := range changes {
+				if c.Conflict {
+					continue
+				}
+				if err := tx.Rename(c.UUID, c.New); err != nil {
+					return fmt.Errorf("failed to rename %s: %w", c.Old, err)
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return changes, nil
+}
+
+// normalizeName applies the NameRules to a name. FoldNames composes the
+// accents in a name so that names typed on systems that produce decomposed
+// characters (macOS) are the same as ones that produce precomposed
+// characters. User and sync entries are only affected by FoldNames since
+// their names are looked up by other means.
+func (b Blobs) normalizeName(name string) string {
+	if b.FoldNames {
+		name = norm.NFC.String(name)
+	}
+	if b.NameRules == 0 || IsUserEntry(name) || IsSyncEntry(name) {
+		return name
+	}
+
+	return b.NameRules.Apply(name)
+}
+
+// nameKey returns a key that is equal for two names when sameName is true
+func (b Blobs) nameKey(name string) string {
+	if !b.FoldNames {
+		return name
+	}
+
+	return strings.ToLower(norm.NFC.String(name))
+}
+
+// sameName compares two names, ignoring case and unicode normalization
+// differences if FoldNames is set.
+func (b Blobs) sameName(a, c string) bool {
+	if !b.FoldNames {
+		return a == c
+	}
+
+	return strings.EqualFold(norm.NFC.String(a), norm.NFC.String(c))
+}
+
+// matchName fuzzy matches a name (or fragment of one), see sameName.
+func (b Blobs) matchName(name, search string) bool {
+	if !b.FoldNames {
+		return fuzzy.Match(name, search)
+	}
+
+	return fuzzy.MatchFold(norm.NFC.String(name), norm.NFC.String(search))
+}
+
+// scoreName scores a fuzzy match of a name (or fragment of one), see
+// matchName.
+func (b Blobs) scoreName(name, search string) (int, bool) {
+	if !b.FoldNames {
+		return fuzzy.Score(name, search)
+	}
+
+	return fuzzy.ScoreFold(norm.NFC.String(name), norm.NFC.String(search))
+}
@@ -0,0 +1,172 @@
+package blobformat
+
+import "testing"
+
+func TestNameNFC(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		In   string
+		Want string
+	}{
+		{"github", "github"},
+		{"caf\u00e9", "caf\u00e9"},
+		{"cafe\u0301", "caf\u00e9"},
+		{"Ba\u0308ckerei", "B\u00e4ckerei"},
+		// Two marks compose one after the other, in either order
+		{"e\u0323\u0302", "\u1ec7"},
+		{"e\u0302\u0323", "\u1ec7"},
+		// Hangul jamo compose into syllables
+		{"\u1100\u1161", "\uac00"},
+		// No precomposed character, left alone
+		{"q\u0301", "q\u0301"},
+		{"\u0301start", "\u0301start"},
+	}
+
+	for i, test := range tests {
+		if got := NameNFC.Apply(test.In); got != test.Want {
+			t.Errorf("%d) want: %q got: %q", i, test.Want, got)
+		}
+	}
+}
+
+func TestFoldNames(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	github, err := b.New("GitHub")
+	must(t, err)
+	// Without folding these are different entries
+	other, err := b.New("github")
+	must(t, err)
+	must(t, b.Delete(other))
+
+	b.FoldNames = true
+	if _, err = b.New("github"); err != ErrNameNotUnique {
+		t.Error("expected name not unique:", err)
+	}
+
+	uuid, _, err := b.FindByName("GITHUB")
+	must(t, err)
+	if uuid != github {
+		t.Error("should have found GitHub")
+	}
+
+	results, err := b.Search("GITH")
+	must(t, err)
+	if len(results) != 1 {
+		t.Error("search should ignore case:", results)
+	}
+
+	// Renaming to a different case of the same name is fine
+	must(t, b.Rename(github, "github"))
+
+	cafe, err := b.New("cafe\u0301")
+	must(t, err)
+	blob, err := b.MustFind(cafe)
+	must(t, err)
+	if blob.Name() != "caf\u00e9" {
+		t.Errorf("name should be composed: %q", blob.Name())
+	}
+	if _, err = b.New("CAF\u00c9"); err != ErrNameNotUnique {
+		t.Error("expected name not unique:", err)
+	}
+}
+
+func TestParseNameRules(t *testing.T) {
+	t.Parallel()
+
+	rules, err := ParseNameRules("lower, dash,nfc")
+	must(t, err)
+	if rules != NameLower|NameDashes|NameNFC {
+		t.Error("wrong rules:", rules)
+	}
+	if s := rules.String(); s != "lower,dash,nfc" {
+		t.Error("wrong string:", s)
+	}
+
+	if _, err = ParseNameRules("lower,upper"); err == nil {
+		t.Error("expected an error for an unknown rule")
+	}
+
+	if got := rules.Apply("My Cafe\u0301"); got != "my-caf\u00e9" {
+		t.Errorf("wrong name: %q", got)
+	}
+}
+
+func TestNameRules(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	b.NameRules = NameLower | NameDashes
+
+	uuid, err := b.New("My Bank")
+	must(t, err)
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob.Name() != "my-bank" {
+		t.Error("name was not normalized:", blob.Name())
+	}
+
+	if _, err = b.New("MY BANK"); err != ErrNameNotUnique {
+		t.Error("expected name not unique:", err)
+	}
+
+	found, _, err := b.FindByName("My Bank")
+	must(t, err)
+	if found != uuid {
+		t.Error("should find the entry by its unnormalized name")
+	}
+
+	// User entries are looked up by exact name
+	user, err := b.NewUser("Bob")
+	must(t, err)
+	blob, err = b.MustFind(user)
+	must(t, err)
+	if blob.Name() != "user/Bob" {
+		t.Error("user names should not be normalized:", blob.Name())
+	}
+}
+
+func TestNormalizeNames(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	bank, err := b.New("My Bank")
+	must(t, err)
+	_, err = b.New("email")
+	must(t, err)
+	_, err = b.New("Email")
+	must(t, err)
+
+	b.NameRules = NameLower | NameDashes
+
+	changes, err := b.NormalizeNames(true)
+	must(t, err)
+	if len(changes) != 2 {
+		t.Fatal("wrong changes:", changes)
+	}
+	if c := changes[0]; c.Old != "Email" || c.New != "email" || !c.Conflict {
+		t.Error("Email should conflict:", c)
+	}
+	if c := changes[1]; c.Old != "My Bank" || c.New != "my-bank" || c.Conflict {
+		t.Error("My Bank should be renamed:", c)
+	}
+
+	blob, err := b.MustFind(bank)
+	must(t, err)
+	if blob.Name() != "My Bank" {
+		t.Error("dry run should not rename:", blob.Name())
+	}
+
+	_, err = b.NormalizeNames(false)
+	must(t, err)
+	blob, err = b.MustFind(bank)
+	must(t, err)
+	if blob.Name() != "my-bank" {
+		t.Error("should have been renamed:", blob.Name())
+	}
+	if uuid, _, err := b.FindByName("Email"); err != nil || len(uuid) == 0 {
+		t.Error("conflicting entry should be left alone:", err)
+	}
+}
@@ -0,0 +1,196 @@
+package blobformat
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Note is a single note on an entry
+type Note struct {
+	// Created is zero for notes that were migrated without a known time
+	Created time.Time
+	Text    string
+}
+
+type jsonNote struct {
+	Created int64  `json:"created,omitempty"`
+	Text    string `json:"text"`
+}
+
+// Notes returns the notes of the entry oldest first. Notes stored as plain
+// text (before notes were structured) are returned as a single note with no
+// created time.
+func (b Blob) Notes() []Note {
+	notesVal := b[KeyNotes]
+	if len(notesVal) == 0 {
+		return nil
+	}
+
+	notes, ok := parseNotes(notesVal)
+	if !ok {
+		return []Note{{Text: notesVal}}
+	}
+
+	return notes
+}
+
+// AddNote appends a note to the entry
+func (b Blobs) AddNote(uuid, text string) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	notes := append(blob.Notes(), Note{Created: time.Now(), Text: text})
+	return b.setNotes(uuid, notes)
+}
+
+// RemoveNote removes the note at index (0-based) from the entry
+func (b Blobs) RemoveNote(uuid string, index int) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	notes := blob.Notes()
+	if index < 0 || index >= len(notes) {
+		return errors.New("index out of range")
+	}
+
+	notes = append(notes[:index], notes[index+1:]...)
+	return b.setNotes(uuid, notes)
+}
+
+// SetNotes replaces all the notes of the entry
+func (b Blobs) SetNotes(uuid string, notes []Note) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	return b.setNotes(uuid, notes)
+}
+
+func (b Blobs) setNotes(uuid string, notes []Note) error {
+	if len(notes) == 0 {
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeyNotes)
+		return nil
+	}
+
+	_, err := b.setKey(uuid, KeyNotes, formatNotes(notes))
+	return err
+}
+
+// NoteMatch is a line of a note found by SearchNotes
+type NoteMatch struct {
+	UUID string
+	Name string
+	// Note is the index of the note (0-based like RemoveNote) and Line the
+	// index of the line in it
+	Note int
+	Line int
+	Text string
+}
+
+// SearchNotes finds the lines of notes that contain search, ignoring case.
+// The matches are sorted by entry name then where they are in the notes.
+// Entries in the trash are not searched.
+func (b Blobs) SearchNotes(search string) ([]NoteMatch, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	search = strings.ToLower(search)
+	var matches []NoteMatch
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		name := blob.Name()
+		if len(blob[KeyNotes]) == 0 || IsTrashEntry(name) {
+			continue
+		}
+
+		for i, note := range blob.Notes() {
+			for j, line := range strings.Split(note.Text, "\n") {
+				if strings.Contains(strings.ToLower(line), search) {
+					matches = append(matches, NoteMatch{UUID: uuid, Name: name, Note: i, Line: j, Text: line})
+				}
+			}
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		a, b := matches[i], matches[j]
+		switch {
+		case a.Name != b.Name:
+			return a.Name < b.Name
+		case a.Note != b.Note:
+			return a.Note < b.Note
+		}
+		return a.Line < b.Line
+	})
+
+	return matches, nil
+}
+
+func formatNotes(notes []Note) string {
+	out := make([]jsonNote, len(notes))
+	for i, n := range notes {
+		out[i].Text = n.Text
+		if !n.Created.IsZero() {
+			out[i].Created = n.Created.UnixNano()
+		}
+	}
+
+	b, err := json.Marshal(out)
+	if err != nil {
+		// This is a slice of simple structs, it can't fail
+		panic(err)
+	}
+	return string(b)
+}
+
+// parseNotes returns false if the value is not structured notes
+func parseNotes(notesVal string) ([]Note, bool) {
+	if !strings.HasPrefix(notesVal, "[") {
+		return nil, false
+	}
+
+	var in []jsonNote
+	if err := json.Unmarshal([]byte(notesVal), &in); err != nil {
+		return nil, false
+	}
+
+	notes := make([]Note, len(in))
+	for i, n := range in {
+		notes[i].Text = n.Text
+		if n.Created != 0 {
+			notes[i].Created = time.Unix(0, n.Created)
+		}
+	}
+	return notes, true
+}
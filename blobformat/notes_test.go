@@ -0,0 +1,116 @@
+package blobformat
+
+import (
+	"testing"
+)
+
+func TestNotes(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("entry")
+	must(t, err)
+
+	if err = b.Set(uuid, KeyNotes, "text"); !IsKeyNotAllowed(err) {
+		t.Error("notes should not be settable directly:", err)
+	}
+
+	must(t, b.AddNote(uuid, "one"))
+	must(t, b.AddNote(uuid, "two"))
+	must(t, b.AddNote(uuid, "three"))
+	must(t, b.RemoveNote(uuid, 1))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	notes := blob.Notes()
+	if len(notes) != 2 || notes[0].Text != "one" || notes[1].Text != "three" {
+		t.Fatal("notes wrong:", notes)
+	}
+	if notes[0].Created.IsZero() || notes[1].Created.Before(notes[0].Created) {
+		t.Error("created times wrong:", notes)
+	}
+
+	if err = b.RemoveNote(uuid, 2); err == nil {
+		t.Error("expected an out of range error")
+	}
+
+	must(t, b.RemoveNote(uuid, 0))
+	must(t, b.RemoveNote(uuid, 0))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, ok := blob[KeyNotes]; ok {
+		t.Error("notes key should be gone when the last note is removed")
+	}
+}
+
+func TestNotesLegacy(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("entry")
+	must(t, err)
+	b.DB.Set(uuid, KeyNotes, "[plain] text\nsecond line")
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	notes := blob.Notes()
+	if len(notes) != 1 || notes[0].Text != "[plain] text\nsecond line" || !notes[0].Created.IsZero() {
+		t.Error("legacy notes wrong:", notes)
+	}
+
+	b.DB.Schema = 1
+	b.DB.SetChainKey([]byte("key"))
+	changes, err := b.Migrate(false)
+	must(t, err)
+	if len(changes) != 2 {
+		t.Error("wrong changes:", changes)
+	}
+
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	notes = blob.Notes()
+	if len(notes) != 1 || notes[0].Text != "[plain] text\nsecond line" || notes[0].Created.IsZero() {
+		t.Error("migrated notes wrong:", notes)
+	}
+
+	// Adding to legacy notes keeps them
+	b.DB.Set(uuid, KeyNotes, "legacy")
+	must(t, b.AddNote(uuid, "new"))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if notes = blob.Notes(); len(notes) != 2 || notes[0].Text != "legacy" {
+		t.Error("notes wrong:", notes)
+	}
+}
+
+func TestSearchNotes(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	one, err := b.New("one")
+	must(t, err)
+	two, err := b.New("two")
+	must(t, err)
+	must(t, b.AddNote(one, "nothing here"))
+	must(t, b.AddNote(one, "recovery codes:\nabc-123\nABC-456"))
+	must(t, b.AddNote(two, "old abc"))
+
+	matches, err := b.SearchNotes("abc")
+	must(t, err)
+	if len(matches) != 3 {
+		t.Fatal("wrong number of matches:", matches)
+	}
+	if m := matches[0]; m.UUID != one || m.Note != 1 || m.Line != 1 || m.Text != "abc-123" {
+		t.Error("first match wrong:", m)
+	}
+	if m := matches[1]; m.Line != 2 || m.Text != "ABC-456" {
+		t.Error("second match wrong:", m)
+	}
+	if m := matches[2]; m.UUID != two || m.Name != "two" || m.Note != 0 {
+		t.Error("third match wrong:", m)
+	}
+
+	if matches, err = b.SearchNotes("missing"); err != nil || len(matches) != 0 {
+		t.Error("should not match:", matches, err)
+	}
+}
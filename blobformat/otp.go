@@ -0,0 +1,164 @@
+package blobformat
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pquerna/otp"
+)
+
+// steamAlphabet is what Steam Guard codes are made of
+const steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+
+// steamPrefix marks a bare secret given to SetTwofactor as a Steam Guard one
+const steamPrefix = "steam:"
+
+// otpOptions are the parameters of an otpauth uri that change how codes are
+// generated, see:
+// https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+type otpOptions struct {
+	Digits    otp.Digits
+	Period    uint
+	Algorithm otp.Algorithm
+	// Steam codes are generated for Steam Guard, it's set by encoder=steam
+	Steam bool
+}
+
+// parseOTPOptions reads the digits, period and algorithm of an otpauth uri,
+// the ones that aren't set get the defaults most authenticators use: 6 digits,
+// 30 seconds and SHA1.
+func parseOTPOptions(uri string) (opts otpOptions, err error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return opts, err
+	}
+	query := u.Query()
+
+	opts = otpOptions{Digits: otp.DigitsSix, Period: 30, Algorithm: otp.AlgorithmSHA1}
+
+	if digits := query.Get("digits"); len(digits) != 0 {
+		n, err := strconv.Atoi(digits)
+		if err != nil || n < 1 || n > 10 {
+			return opts, fmt.Errorf("digits must be a number from 1 to 10, got %q", digits)
+		}
+		opts.Digits = otp.Digits(n)
+	}
+
+	if period := query.Get("period"); len(period) != 0 {
+		n, err := strconv.ParseUint(period, 10, 32)
+		if err != nil || n == 0 {
+			return opts, fmt.Errorf("period must be a number of seconds, got %q", period)
+		}
+		opts.Period = uint(n)
+	}
+
+	if algorithm := query.Get("algorithm"); len(algorithm) != 0 {
+		switch strings.ToUpper(algorithm) {
+		case "SHA1":
+			opts.Algorithm = otp.AlgorithmSHA1
+		case "SHA256":
+			opts.Algorithm = otp.AlgorithmSHA256
+		case "SHA512":
+			opts.Algorithm = otp.AlgorithmSHA512
+		case "MD5":
+			opts.Algorithm = otp.AlgorithmMD5
+		default:
+			return opts, fmt.Errorf("unknown algorithm %q, use SHA1, SHA256 or SHA512", algorithm)
+		}
+	}
+
+	switch encoder := query.Get("encoder"); strings.ToLower(encoder) {
+	case "":
+	case "steam":
+		opts.Steam = true
+	default:
+		return opts, fmt.Errorf("unknown encoder %q, only steam is supported", encoder)
+	}
+
+	return opts, nil
+}
+
+// steamCode generates a Steam Guard code: a TOTP (SHA1) whose number is
+// written with 5 characters of steamAlphabet instead of as digits.
+func steamCode(secret string, counter uint64) (string, error) {
+	secret = strings.ToUpper(strings.TrimSpace(secret))
+	if n := len(secret) % 8; n != 0 {
+		secret += strings.Repeat("=", 8-n)
+	}
+	key, err := base32.StdEncoding.DecodeString(secret)
+	if err != nil {
+		return "", otp.ErrValidateSecretInvalidBase32
+	}
+
+	var buf [8]byte
+	binary.BigEndian.PutUint64(buf[:], counter)
+	mac := hmac.New(sha1.New, key)
+	mac.Write(buf[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0xf
+	value := binary.BigEndian.Uint32(sum[offset:]) & 0x7fffffff
+
+	code := make([]byte, 5)
+	for i := range code {
+		code[i] = steamAlphabet[value%uint32(len(steamAlphabet))]
+		value /= uint32(len(steamAlphabet))
+	}
+	return string(code), nil
+}
+
+// TwoFactorCode is a TOTP code and the window of time it's valid in
+type TwoFactorCode struct {
+	Code string
+	// From is when the code becomes valid, Until is when the next one takes
+	// over
+	From  time.Time
+	Until time.Time
+}
+
+// UpcomingTwoFactors returns n codes for the two factor key starting with
+// the current one, each with the window it's valid in. They're computed
+// from the secret for the start of each window so they can be written down
+// ahead of time. HOTP keys return ErrHOTP since their codes can only be used
+// in order (see Blobs.NextTwoFactor) and keys kept on a YubiKey return
+// ErrYubiKeySecret since the secret isn't in the file.
+func (b Blob) UpcomingTwoFactors(n int) ([]TwoFactorCode, error) {
+	twoFactorURI := b[KeyTwoFactor]
+	if len(twoFactorURI) == 0 {
+		return nil, ErrNoTwoFactor
+	}
+	if _, ok := yubiKeyAccount(twoFactorURI); ok {
+		return nil, ErrYubiKeySecret
+	}
+
+	opts, err := parseOTPOptions(twoFactorURI)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse two factor uri for %s: %w", b.Name(), err)
+	}
+	period := int64(opts.Period)
+	start := time.Now().Unix() / period * period
+
+	codes := make([]TwoFactorCode, 0, n)
+	for i := 0; i < n; i++ {
+		from := time.Unix(start+int64(i)*period, 0)
+		code, err := b.twoFactorAt(twoFactorURI, from)
+		if err != nil {
+			return nil, err
+		}
+
+		codes = append(codes, TwoFactorCode{
+			Code:  code,
+			From:  from,
+			Until: from.Add(time.Duration(period) * time.Second),
+		})
+	}
+
+	return codes, nil
+}
@@ -0,0 +1,118 @@
+package blobformat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTwoFactorOptions(t *testing.T) {
+	t.Parallel()
+
+	// Test vectors from RFC 6238
+	const (
+		sha1Secret   = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+		sha256Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZA"
+		sha512Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQGEZDGNA"
+	)
+
+	tests := []struct {
+		URI  string
+		At   int64
+		Want string
+	}{
+		{"otpauth://totp/test?secret=" + sha1Secret, 59, "287082"},
+		{"otpauth://totp/test?secret=" + sha1Secret + "&digits=8", 59, "94287082"},
+		{"otpauth://totp/test?secret=" + sha1Secret + "&digits=8&period=60", 119, "94287082"},
+		{"otpauth://totp/test?secret=" + sha256Secret + "&digits=8&algorithm=SHA256", 59, "46119246"},
+		{"otpauth://totp/test?secret=" + sha512Secret + "&digits=8&algorithm=sha512", 59, "90693936"},
+		{"otpauth://totp/test?secret=" + sha1Secret + "&encoder=steam", 59, "PV9M4"},
+		{"otpauth://totp/Steam:test?secret=" + sha1Secret + "&encoder=Steam", 1111111109, "PY4YB"},
+	}
+
+	for i, test := range tests {
+		blob := Blob{KeyName: "test", KeyTwoFactor: test.URI}
+		code, err := blob.twoFactorAt(test.URI, time.Unix(test.At, 0))
+		if err != nil {
+			t.Errorf("%d) %v", i, err)
+			continue
+		}
+		if code != test.Want {
+			t.Errorf("%d) want: %s, got: %s", i, test.Want, code)
+		}
+	}
+
+	b := newTestBlobs()
+	uuid, err := b.New("test")
+	must(t, err)
+	for _, bad := range []string{"digits=0", "period=-30", "algorithm=SHA3", "encoder=bnet"} {
+		if err = b.SetTwofactor(uuid, "otpauth://totp/test?secret="+sha1Secret+"&"+bad); err == nil {
+			t.Error("expected an error for", bad)
+		}
+	}
+
+	must(t, b.SetTwofactor(uuid, "steam:"+sha1Secret))
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if code, err := blob.TwoFactor(); err != nil || len(code) != 5 {
+		t.Error("expected a steam code:", code, err)
+	}
+}
+
+func TestTwoFactorWithExpiry(t *testing.T) {
+	t.Parallel()
+
+	blob := Blob{KeyName: "test"}
+	if code, remaining, err := blob.TwoFactorWithExpiry(); err != nil || len(code) != 0 || remaining != 0 {
+		t.Error("expected nothing without a key:", code, remaining, err)
+	}
+
+	for _, period := range []time.Duration{30, 60} {
+		blob[KeyTwoFactor] = "otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&period=" + strconv.Itoa(int(period))
+		code, remaining, err := blob.TwoFactorWithExpiry()
+		must(t, err)
+		if len(code) != 6 {
+			t.Error("wrong code:", code)
+		}
+		if remaining <= 0 || remaining > period*time.Second {
+			t.Errorf("remaining is out of range for period %d: %v", period, remaining)
+		}
+	}
+}
+
+func TestUpcomingTwoFactors(t *testing.T) {
+	t.Parallel()
+
+	blob := Blob{KeyName: "test"}
+	if _, err := blob.UpcomingTwoFactors(3); err != ErrNoTwoFactor {
+		t.Error("expected no two factor error:", err)
+	}
+
+	blob[KeyTwoFactor] = "otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&period=60"
+	codes, err := blob.UpcomingTwoFactors(3)
+	must(t, err)
+	if len(codes) != 3 {
+		t.Fatal("wrong number of codes:", len(codes))
+	}
+
+	now := time.Now()
+	if now.Before(codes[0].From) || !now.Before(codes[0].Until) {
+		t.Error("first code should be the current one:", codes[0].From, codes[0].Until)
+	}
+	for i, c := range codes {
+		if c.Until.Sub(c.From) != time.Minute || c.From.Unix()%60 != 0 {
+			t.Errorf("%d) window is wrong: %v - %v", i, c.From, c.Until)
+		}
+		if i != 0 && !c.From.Equal(codes[i-1].Until) {
+			t.Errorf("%d) windows should follow each other", i)
+		}
+		if want, err := blob.twoFactorAt(blob[KeyTwoFactor], c.From.Add(59*time.Second)); err != nil || c.Code != want {
+			t.Errorf("%d) code was wrong, want: %s, got: %s (%v)", i, want, c.Code, err)
+		}
+	}
+
+	blob[KeyTwoFactor] = "otpauth://hotp/test?secret=JBSWY3DPEHPK3PXP"
+	if _, err = blob.UpcomingTwoFactors(3); err != ErrHOTP {
+		t.Error("expected hotp error:", err)
+	}
+}
@@ -0,0 +1,249 @@
+package blobformat
+
+import (
+	"encoding/base32"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// OTPMigrationPrefix starts the uris of Google Authenticator's account exports
+const OTPMigrationPrefix = "otpauth-migration://"
+
+// ErrBadOTPMigration is returned when an otpauth-migration uri can't be read
+var ErrBadOTPMigration = errors.New("not a valid otpauth-migration uri")
+
+// OTPAccount is an account from a Google Authenticator export
+type OTPAccount struct {
+	Name   string
+	Issuer string
+	// URI is the otpauth uri for the account, see SetTwofactor
+	URI string
+}
+
+// EntryName is the name an account is imported as, the issuer (or the
+// account name if there's none). If the issuer has more than one account in
+// the export they're told apart as issuer/account.
+func (o OTPAccount) EntryName(accounts []OTPAccount) string {
+	if len(o.Issuer) == 0 {
+		return o.Name
+	}
+
+	for _, other := range accounts {
+		if other.Issuer == o.Issuer && other.Name != o.Name {
+			return o.Issuer + "/" + o.Name
+		}
+	}
+	return o.Issuer
+}
+
+// ParseOTPMigration reads the accounts in an otpauth-migration uri, these are
+// what Google Authenticator puts in the QR codes it exports accounts with. The
+// data is a base64 encoded protobuf, see:
+// https://github.com/google/google-authenticator-android/issues/118
+func ParseOTPMigration(uri string) ([]OTPAccount, error) {
+	if !strings.HasPrefix(uri, OTPMigrationPrefix) {
+		return nil, ErrBadOTPMigration
+	}
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, ErrBadOTPMigration
+	}
+
+	data := u.Query().Get("data")
+	payload, err := base64.StdEncoding.DecodeString(data)
+	if err != nil {
+		// Some tools leave off the padding
+		if payload, err = base64.RawStdEncoding.DecodeString(strings.TrimRight(data, "=")); err != nil {
+			return nil, ErrBadOTPMigration
+		}
+	}
+
+	var accounts []OTPAccount
+	err = readProto(payload, func(field int, varint uint64, bytes []byte) error {
+		// 1 is otp_parameters, the rest are about batches of QR codes
+		if field != 1 || bytes == nil {
+			return nil
+		}
+
+		account, err := parseOTPParameters(bytes)
+		if err != nil {
+			return err
+		}
+		accounts = append(accounts, account)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return accounts, nil
+}
+
+// parseOTPParameters reads a single account from the migration payload
+func parseOTPParameters(data []byte) (account OTPAccount, err error) {
+	var secret []byte
+	typ, algorithm, digits := "totp", "", ""
+	var counter uint64
+
+	err = readProto(data, func(field int, varint uint64, bytes []byte) error {
+		switch field {
+		case 1:
+			secret = bytes
+		case 2:
+			account.Name = string(bytes)
+		case 3:
+			account.Issuer = string(bytes)
+		case 4:
+			algorithm = map[uint64]string{2: "SHA256", 3: "SHA512", 4: "MD5"}[varint]
+		case 5:
+			if varint == 2 {
+				digits = "8"
+			}
+		case 6:
+			if varint == 1 {
+				typ = "hotp"
+			}
+		case 7:
+			counter = varint
+		}
+		return nil
+	})
+	if err != nil {
+		return account, err
+	}
+	if len(secret) == 0 {
+		return account, ErrBadOTPMigration
+	}
+
+	// The name is often issuer:account already
+	if i := strings.IndexByte(account.Name, ':'); i >= 0 {
+		if len(account.Issuer) == 0 {
+			account.Issuer = account.Name[:i]
+		}
+		account.Name = account.Name[i+1:]
+	}
+
+	vals := make(url.Values)
+	vals.Set("secret", base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(secret))
+	if len(account.Issuer) != 0 {
+		vals.Set("issuer", account.Issuer)
+	}
+	if len(algorithm) != 0 {
+		vals.Set("algorithm", algorithm)
+	}
+	if len(digits) != 0 {
+		vals.Set("digits", digits)
+	}
+	if typ == "hotp" {
+		vals.Set("counter", strconv.FormatUint(counter, 10))
+	}
+
+	label := account.Name
+	if len(account.Issuer) != 0 {
+		label = account.Issuer + ":" + label
+	}
+	account.URI = fmt.Sprintf("otpauth://%s/%s?%s", typ, url.PathEscape(label), vals.Encode())
+
+	return account, nil
+}
+
+// readProto calls fn with each field of a protobuf message, bytes is nil for
+// varint fields. Fixed size fields are skipped, the migration payload has
+// none.
+func readProto(data []byte, fn func(field int, varint uint64, bytes []byte) error) error {
+	for len(data) != 0 {
+		key, n := readVarint(data)
+		if n == 0 {
+			return ErrBadOTPMigration
+		}
+		data = data[n:]
+		field, wire := int(key>>3), key&7
+
+		switch wire {
+		case 0:
+			v, n := readVarint(data)
+			if n == 0 {
+				return ErrBadOTPMigration
+			}
+			data = data[n:]
+			if err := fn(field, v, nil); err != nil {
+				return err
+			}
+		case 1, 5:
+			size := 8
+			if wire == 5 {
+				size = 4
+			}
+			if len(data) < size {
+				return ErrBadOTPMigration
+			}
+			data = data[size:]
+		case 2:
+			length, n := readVarint(data)
+			if n == 0 || uint64(len(data)-n) < length {
+				return ErrBadOTPMigration
+			}
+			data = data[n:]
+			if err := fn(field, 0, data[:length:length]); err != nil {
+				return err
+			}
+			data = data[length:]
+		default:
+			return ErrBadOTPMigration
+		}
+	}
+
+	return nil
+}
+
+// readVarint reads a protobuf varint, n is 0 if it's cut off
+func readVarint(data []byte) (v uint64, n int) {
+	for i, b := range data {
+		if i == 10 {
+			return 0, 0
+		}
+		v |= uint64(b&0x7f) << (7 * uint(i))
+		if b < 0x80 {
+			return v, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// ImportOTPMigration sets the two factor keys of the accounts in an
+// otpauth-migration uri (see ParseOTPMigration) on the entries named after
+// them (see OTPAccount.EntryName), creating the entries that don't exist.
+// The names of the entries are returned.
+func (b Blobs) ImportOTPMigration(uri string) (created, updated []string, err error) {
+	accounts, err := ParseOTPMigration(uri)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, account := range accounts {
+		name := account.EntryName(accounts)
+		uuid, _, err := b.FindByName(name)
+		if err != nil {
+			return created, updated, err
+		}
+
+		if len(uuid) == 0 {
+			if uuid, err = b.New(name); err != nil {
+				return created, updated, err
+			}
+			created = append(created, name)
+		} else {
+			updated = append(updated, name)
+		}
+
+		if err = b.SetTwofactor(uuid, account.URI); err != nil {
+			return created, updated, fmt.Errorf("failed to set two factor key for %s: %w", name, err)
+		}
+	}
+
+	return created, updated, nil
+}
@@ -0,0 +1,71 @@
+package blobformat
+
+import (
+	"reflect"
+	"testing"
+)
+
+// testOTPMigration has two accounts:
+// Example:alice@example.com, totp
+// GitHub:bob, hotp, 8 digits, sha256, counter 5
+const testOTPMigration = "otpauth-migration://offline?data=CjgKFDEyMzQ1Njc4OTAxMjM0NTY3ODkwEhFhbGljZUBleGFtcGxlLmNvbRoHRXhhbXBsZSABKAEwAgoqChRoZWxsbyB3b3JsZCBzZWNyZXQhIRIKR2l0SHViOmJvYiACKAIwATgFEAEYASAAKLlg"
+
+func TestParseOTPMigration(t *testing.T) {
+	t.Parallel()
+
+	accounts, err := ParseOTPMigration(testOTPMigration)
+	must(t, err)
+
+	want := []OTPAccount{
+		{
+			Name:   "alice@example.com",
+			Issuer: "Example",
+			URI:    "otpauth://totp/Example:alice@example.com?issuer=Example&secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ",
+		},
+		{
+			Name:   "bob",
+			Issuer: "GitHub",
+			URI:    "otpauth://hotp/GitHub:bob?algorithm=SHA256&counter=5&digits=8&issuer=GitHub&secret=NBSWY3DPEB3W64TMMQQHGZLDOJSXIIJB",
+		},
+	}
+	if !reflect.DeepEqual(accounts, want) {
+		t.Errorf("wrong accounts:\n%#v", accounts)
+	}
+
+	for _, bad := range []string{
+		"otpauth://totp/test?secret=GEZDGNBV",
+		"otpauth-migration://offline?data=!!!",
+		"otpauth-migration://offline?data=CjgKFDEy",
+	} {
+		if _, err = ParseOTPMigration(bad); err == nil {
+			t.Error("expected an error for", bad)
+		}
+	}
+}
+
+func TestImportOTPMigration(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	existing, err := b.New("GitHub")
+	must(t, err)
+
+	created, updated, err := b.ImportOTPMigration(testOTPMigration)
+	must(t, err)
+	if !reflect.DeepEqual(created, []string{"Example"}) || !reflect.DeepEqual(updated, []string{"GitHub"}) {
+		t.Error("wrong entries:", created, updated)
+	}
+
+	blob, err := b.MustFind(existing)
+	must(t, err)
+	if counter, err := blob.HOTPCounter(); err != nil || counter != 5 {
+		t.Error("wrong counter:", counter, err)
+	}
+
+	accounts := []OTPAccount{{Name: "a", Issuer: "AWS"}, {Name: "b", Issuer: "AWS"}, {Name: "c"}}
+	for i, want := range []string{"AWS/a", "AWS/b", "c"} {
+		if name := accounts[i].EntryName(accounts); name != want {
+			t.Errorf("%d) want: %s, got: %s", i, want, name)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package blobformat
+
+import "errors"
+
+// ErrProtected is returned when changing an entry that is protected, see
+// SetProtected.
+var ErrProtected = errors.New("entry is protected")
+
+// IsProtected returns true if the entry is protected from changes
+func (b Blob) IsProtected() bool {
+	return b[KeyProtected] == "true"
+}
+
+// SetProtected protects an entry from being changed, renamed or deleted by
+// accident. Changes to a protected entry return ErrProtected unless they're
+// made with Force. Favorites, field metadata, shares and access times may
+// still change.
+func (b Blobs) SetProtected(uuid string, protected bool) error {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	if blob.IsProtected() == protected {
+		return nil
+	}
+
+	b.touchUpdated(uuid)
+	if protected {
+		b.DB.Set(uuid, KeyProtected, "true")
+	} else {
+		b.DB.DeleteKey(uuid, KeyProtected)
+	}
+	return nil
+}
+
+// Force returns a Blobs that is allowed to change protected entries
+func (b Blobs) Force() Blobs {
+	b.force = true
+	return b
+}
+
+// checkProtected returns ErrProtected if the entry is protected and this
+// isn't a forced change.
+func (b Blobs) checkProtected(uuid string) error {
+	if b.force {
+		return nil
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob != nil && blob.IsProtected() {
+		return ErrProtected
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package blobformat
+
+import "testing"
+
+func TestProtected(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("seed")
+	must(t, err)
+	must(t, b.Set(uuid, KeyPass, "words"))
+
+	if err = b.Set(uuid, KeyProtected, "true"); !IsKeyNotAllowed(err) {
+		t.Error("protected should not be settable directly:", err)
+	}
+
+	must(t, b.SetProtected(uuid, true))
+
+	if err = b.Set(uuid, KeyPass, "oops"); err != ErrProtected {
+		t.Error("set should fail:", err)
+	}
+	if err = b.DeleteKey(uuid, KeyPass); err != ErrProtected {
+		t.Error("delete key should fail:", err)
+	}
+	if err = b.AddNote(uuid, "note"); err != ErrProtected {
+		t.Error("add note should fail:", err)
+	}
+	if err = b.Rename(uuid, "other"); err != ErrProtected {
+		t.Error("rename should fail:", err)
+	}
+	if err = b.MoveToTrash(uuid); err != ErrProtected {
+		t.Error("trash should fail:", err)
+	}
+	if err = b.Delete(uuid); err != ErrProtected {
+		t.Error("delete should fail:", err)
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyPass] != "words" || blob.Name() != "seed" {
+		t.Error("entry should be unchanged:", blob)
+	}
+
+	must(t, b.Force().Set(uuid, KeyPass, "forced"))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyPass] != "forced" {
+		t.Error("forced change should be kept:", blob[KeyPass])
+	}
+
+	must(t, b.SetProtected(uuid, false))
+	must(t, b.Set(uuid, KeyPass, "again"))
+	must(t, b.Delete(uuid))
+}
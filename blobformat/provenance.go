@@ -0,0 +1,81 @@
+package blobformat
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Provenance records where an imported entry came from
+type Provenance struct {
+	// Source is the tool the entry was imported from (eg. lastpass)
+	Source string
+	// ID identifies the entry in the source so re-imports can find it
+	ID string
+	// Imported is the last time the entry was imported
+	Imported time.Time
+}
+
+// Provenance returns where the entry was imported from, the zero value if it
+// was not imported.
+func (b Blob) Provenance() (Provenance, error) {
+	imported, err := b.getTimestamp(KeyImported)
+	if err != nil {
+		return Provenance{}, err
+	}
+
+	return Provenance{
+		Source:   b[KeyImportSource],
+		ID:       b[KeyImportID],
+		Imported: imported,
+	}, nil
+}
+
+// SetProvenance records that the entry was imported from id in source now
+func (b Blobs) SetProvenance(uuid, source, id string) {
+	b.DB.Set(uuid, KeyImportSource, source)
+	b.DB.Set(uuid, KeyImportID, id)
+	b.DB.Set(uuid, KeyImported, strconv.FormatInt(time.Now().UnixNano(), 10))
+}
+
+// FindByProvenance returns the entry that was imported from id in source,
+// uuid is empty if there is none.
+func (b Blobs) FindByProvenance(source, id string) (uuid string, blob Blob, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return "", nil, err
+	}
+
+	for uuid, entry := range b.DB.Snapshot {
+		if entry[KeyImportSource] == source && entry[KeyImportID] == id {
+			return uuid, Blob(entry), nil
+		}
+	}
+
+	return "", nil, nil
+}
+
+// ImportedFrom returns all entries imported from source, or all imported
+// entries if source is empty.
+func (b Blobs) ImportedFrom(source string) (entries SearchResults, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries = make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		from, ok := blob[KeyImportSource]
+		if !ok || (len(source) != 0 && from != source) {
+			continue
+		}
+
+		entries[uuid] = blob.Name()
+	}
+
+	return entries, nil
+}
+
+// String describes the provenance, eg: lastpass (id 1234) on 2006-01-02
+func (p Provenance) String() string {
+	return fmt.Sprintf("%s (id %s) on %s", p.Source, p.ID, p.Imported.Format("2006-01-02"))
+}
@@ -0,0 +1,44 @@
+package blobformat
+
+import "testing"
+
+func TestProvenance(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	imported, err := b.New("imported")
+	must(t, err)
+	_, err = b.New("local")
+	must(t, err)
+
+	if err = b.Set(imported, KeyImportID, "5"); !IsKeyNotAllowed(err) {
+		t.Error("provenance should not be settable directly:", err)
+	}
+
+	b.SetProvenance(imported, "lastpass", "1234")
+
+	uuid, blob, err := b.FindByProvenance("lastpass", "1234")
+	must(t, err)
+	if uuid != imported {
+		t.Error("wrong entry found:", uuid)
+	}
+
+	p, err := blob.Provenance()
+	must(t, err)
+	if p.Source != "lastpass" || p.ID != "1234" || p.Imported.IsZero() {
+		t.Errorf("provenance wrong: %#v", p)
+	}
+
+	if uuid, _, err = b.FindByProvenance("lastpass", "1"); err != nil || len(uuid) != 0 {
+		t.Error("should not have found anything:", uuid, err)
+	}
+
+	results, err := b.ImportedFrom("lastpass")
+	must(t, err)
+	if len(results) != 1 || results[imported] != "imported" {
+		t.Error("wrong results:", results)
+	}
+	if results, err = b.ImportedFrom("keepass"); err != nil || len(results) != 0 {
+		t.Error("should not have found anything:", results, err)
+	}
+}
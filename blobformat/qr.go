@@ -0,0 +1,92 @@
+package blobformat
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"strings"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/qr"
+)
+
+// ErrNoTwoFactor is returned when an entry has no two factor key
+var ErrNoTwoFactor = errors.New("two factor key is not set")
+
+// qrQuietZone is the number of blank modules around a QR code, scanners need
+// some space to find it
+const qrQuietZone = 2
+
+// TwoFactorQR encodes the two factor uri as a QR code so it can be enrolled
+// into an authenticator app again.
+func (b Blob) TwoFactorQR() (barcode.Barcode, error) {
+	uri := b[KeyTwoFactor]
+	if len(uri) == 0 {
+		return nil, ErrNoTwoFactor
+	}
+	if _, ok := yubiKeyAccount(uri); ok {
+		return nil, ErrYubiKeySecret
+	}
+
+	return qr.Encode(uri, qr.M, qr.Auto)
+}
+
+// TwoFactorPNG returns the QR code of the two factor uri as a PNG image size
+// pixels wide and high.
+func (b Blob) TwoFactorPNG(size int) ([]byte, error) {
+	code, err := b.TwoFactorQR()
+	if err != nil {
+		return nil, err
+	}
+	if code, err = barcode.Scale(code, size, size); err != nil {
+		return nil, err
+	}
+
+	buf := new(bytes.Buffer)
+	if err = png.Encode(buf, code); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// TwoFactorANSI returns the QR code of the two factor uri drawn with ANSI
+// background colors for printing to a terminal, each module is two spaces
+// wide so it comes out square.
+func (b Blob) TwoFactorANSI() (string, error) {
+	code, err := b.TwoFactorQR()
+	if err != nil {
+		return "", err
+	}
+
+	const (
+		black = "\x1b[40m  "
+		white = "\x1b[47m  "
+		reset = "\x1b[0m\n"
+	)
+
+	bounds := code.Bounds()
+	var sb strings.Builder
+	for y := bounds.Min.Y - qrQuietZone; y < bounds.Max.Y+qrQuietZone; y++ {
+		for x := bounds.Min.X - qrQuietZone; x < bounds.Max.X+qrQuietZone; x++ {
+			if qrDark(code, image.Pt(x, y)) {
+				sb.WriteString(black)
+			} else {
+				sb.WriteString(white)
+			}
+		}
+		sb.WriteString(reset)
+	}
+
+	return sb.String(), nil
+}
+
+// qrDark checks if the module at p is dark, the quiet zone outside of the
+// code's bounds is light
+func qrDark(code image.Image, p image.Point) bool {
+	if !p.In(code.Bounds()) {
+		return false
+	}
+	r, _, _, _ := code.At(p.X, p.Y).RGBA()
+	return r < 0x8000
+}
@@ -0,0 +1,40 @@
+package blobformat
+
+import (
+	"bytes"
+	"image/png"
+	"strings"
+	"testing"
+)
+
+func TestTwoFactorQR(t *testing.T) {
+	t.Parallel()
+
+	blob := Blob{KeyName: "test"}
+	if _, err := blob.TwoFactorPNG(200); err != ErrNoTwoFactor {
+		t.Error("expected ErrNoTwoFactor:", err)
+	}
+
+	blob[KeyTwoFactor] = "otpauth://totp/bpass:test?secret=JBSWY3DPEHPK3PXP"
+	data, err := blob.TwoFactorPNG(200)
+	must(t, err)
+	img, err := png.Decode(bytes.NewReader(data))
+	must(t, err)
+	if b := img.Bounds(); b.Dx() != 200 || b.Dy() != 200 {
+		t.Error("wrong size:", b)
+	}
+
+	code, err := blob.TwoFactorQR()
+	must(t, err)
+	ansi, err := blob.TwoFactorANSI()
+	must(t, err)
+	lines := strings.Split(strings.TrimSuffix(ansi, "\n"), "\n")
+	size := code.Bounds().Dx() + 2*qrQuietZone
+	if len(lines) != size {
+		t.Errorf("want %d lines, got %d", size, len(lines))
+	}
+	// The top left finder pattern starts after the quiet zone
+	if !strings.HasPrefix(lines[qrQuietZone], strings.Repeat("\x1b[47m  ", qrQuietZone)+"\x1b[40m  ") {
+		t.Errorf("wrong first row: %q", lines[qrQuietZone])
+	}
+}
@@ -0,0 +1,436 @@
+package blobformat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// queryTimestampKeys are compared as dates by Query
+var queryTimestampKeys = []string{KeyCreated, KeyUpdated, KeyAccessed, KeyExpires, KeyCheckoutTime, KeyImported}
+
+// queryDateLayouts are the layouts dates can be given in, in local time
+var queryDateLayouts = []string{"2006-01-02", "2006-01-02 15:04:05", time.RFC3339}
+
+// Query finds the entries that match a filter expression made of conditions
+// joined by AND, OR and NOT and grouped with parentheses, conditions next to
+// each other are ANDed:
+//
+//	label:work AND updated<2023-01-01 AND user~"@corp.com"
+//
+// A condition is a key, an operator and a value:
+//
+//	:          has the label for label, otherwise equal ignoring case
+//	=, !=      equal, not equal
+//	~          contains, ignoring case
+//	<, <=, >, >=
+//	           dates (YYYY-MM-DD) for timestamp keys like updated and
+//	           expires, numbers or text for any other key
+//
+// Dates can also be given relative to the time the query is run as now, or now
+// plus or minus a duration in days, weeks, months or years (now+30d, now-1y).
+//
+// A value on its own matches entries whose name contains it. Values with
+// spaces, parentheses or operators in them must be quoted. Keywords are not
+// case sensitive. Entries in the trash are not included, see QueryScoped.
+func (b Blobs) Query(query string) (entries SearchResults, err error) {
+	return b.QueryScoped(query, ScopeActive)
+}
+
+// QueryScoped is Query but only looks through the entries in scope
+func (b Blobs) QueryScoped(query string, scope Scope) (entries SearchResults, err error) {
+	match, err := parseQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries = make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		name := blob.Name()
+		if !scope.includes(name) || !match(blob) {
+			continue
+		}
+		entries[uuid] = name
+	}
+
+	return entries, nil
+}
+
+// parseQuery turns a query into the check for whether an entry matches it
+func parseQuery(query string) (queryFunc, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, err
+	}
+
+	p := queryParser{tokens: tokens}
+	match, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.tokens) {
+		return nil, fmt.Errorf("query: unexpected %s", p.tokens[p.pos])
+	}
+
+	return match, nil
+}
+
+type queryTokenKind int
+
+const (
+	queryWord queryTokenKind = iota
+	queryString
+	queryOp
+	queryOpen
+	queryClose
+)
+
+type queryToken struct {
+	kind  queryTokenKind
+	value string
+}
+
+func (t queryToken) String() string {
+	if t.kind == queryString {
+		return strconv.Quote(t.value)
+	}
+	return t.value
+}
+
+// isQueryOp checks if c starts an operator
+func isQueryOp(c byte) bool {
+	return strings.IndexByte(":=!~<>", c) >= 0
+}
+
+// lexQuery splits a query into words, quoted strings, operators and
+// parentheses
+func lexQuery(query string) (tokens []queryToken, err error) {
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == ' ' || c == '\t':
+			i++
+		case c == '(':
+			tokens = append(tokens, queryToken{kind: queryOpen, value: "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, queryToken{kind: queryClose, value: ")"})
+			i++
+		case c == '"':
+			end := i + 1
+			for ; end < len(query) && query[end] != '"'; end++ {
+				if query[end] == '\\' {
+					end++
+				}
+			}
+			if end >= len(query) {
+				return nil, errors.New("query: unterminated quote")
+			}
+			value, err := strconv.Unquote(query[i : end+1])
+			if err != nil {
+				return nil, fmt.Errorf("query: bad quoted value %s", query[i:end+1])
+			}
+			tokens = append(tokens, queryToken{kind: queryString, value: value})
+			i = end + 1
+		case isQueryOp(c):
+			op := query[i : i+1]
+			if i+1 < len(query) && query[i+1] == '=' && strings.IndexByte("!<>", c) >= 0 {
+				op = query[i : i+2]
+			} else if c == '!' {
+				return nil, errors.New("query: ! must be followed by =")
+			}
+			tokens = append(tokens, queryToken{kind: queryOp, value: op})
+			i += len(op)
+		default:
+			end := i
+			for ; end < len(query); end++ {
+				c := query[end]
+				if c == ' ' || c == '\t' || c == '(' || c == ')' || c == '"' || isQueryOp(c) {
+					break
+				}
+			}
+			tokens = append(tokens, queryToken{kind: queryWord, value: query[i:end]})
+			i = end
+		}
+	}
+
+	return tokens, nil
+}
+
+// queryFunc checks if an entry matches part of a query
+type queryFunc func(Blob) bool
+
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+	return p.tokens[p.pos], true
+}
+
+// keyword consumes the next token if it's the keyword kw
+func (p *queryParser) keyword(kw string) bool {
+	t, ok := p.peek()
+	if !ok || t.kind != queryWord || !strings.EqualFold(t.value, kw) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+func (p *queryParser) parseOr() (queryFunc, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	for p.keyword("or") {
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(b Blob) bool { return l(b) || right(b) }
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseAnd() (queryFunc, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+
+	for {
+		if !p.keyword("and") {
+			// Conditions next to each other are ANDed too
+			t, ok := p.peek()
+			if !ok || t.kind == queryClose || t.kind == queryOp ||
+				(t.kind == queryWord && strings.EqualFold(t.value, "or")) {
+				break
+			}
+		}
+
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l := left
+		left = func(b Blob) bool { return l(b) && right(b) }
+	}
+
+	return left, nil
+}
+
+func (p *queryParser) parseNot() (queryFunc, error) {
+	if p.keyword("not") {
+		inner, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return func(b Blob) bool { return !inner(b) }, nil
+	}
+
+	t, ok := p.peek()
+	if !ok {
+		return nil, errors.New("query: unexpected end")
+	}
+
+	switch t.kind {
+	case queryOpen:
+		p.pos++
+		inner, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t, ok := p.peek(); !ok || t.kind != queryClose {
+			return nil, errors.New("query: missing )")
+		}
+		p.pos++
+		return inner, nil
+	case queryWord, queryString:
+		return p.parseCond()
+	}
+
+	return nil, fmt.Errorf("query: unexpected %s", t)
+}
+
+func (p *queryParser) parseCond() (queryFunc, error) {
+	key := p.tokens[p.pos]
+	p.pos++
+
+	op, ok := p.peek()
+	if !ok || op.kind != queryOp {
+		search := strings.ToLower(key.value)
+		return func(b Blob) bool {
+			return strings.Contains(strings.ToLower(b.Name()), search)
+		}, nil
+	}
+	p.pos++
+
+	if key.kind != queryWord {
+		return nil, fmt.Errorf("query: key %s must not be quoted", key)
+	}
+	value, ok := p.peek()
+	if !ok || (value.kind != queryWord && value.kind != queryString) {
+		return nil, fmt.Errorf("query: %s%s needs a value", key, op)
+	}
+	p.pos++
+
+	return queryCond(strings.ToLower(key.value), op.value, value.value)
+}
+
+// queryCond creates the check for a single condition
+func queryCond(key, op, value string) (queryFunc, error) {
+	if key == "label" || key == KeyLabels {
+		if op != ":" && op != "=" && op != "!=" {
+			return nil, fmt.Errorf("query: labels can't be compared with %s", op)
+		}
+		return func(b Blob) bool {
+			for _, l := range b.Labels() {
+				if l == value {
+					return op != "!="
+				}
+			}
+			return op == "!="
+		}, nil
+	}
+
+	switch op {
+	case ":":
+		return func(b Blob) bool {
+			v, ok := b[key]
+			return ok && strings.EqualFold(v, value)
+		}, nil
+	case "=":
+		return func(b Blob) bool {
+			v, ok := b[key]
+			return ok && v == value
+		}, nil
+	case "!=":
+		return func(b Blob) bool { return b[key] != value }, nil
+	case "~":
+		value = strings.ToLower(value)
+		return func(b Blob) bool {
+			v, ok := b[key]
+			return ok && strings.Contains(strings.ToLower(v), value)
+		}, nil
+	}
+
+	for _, k := range queryTimestampKeys {
+		if k != key {
+			continue
+		}
+
+		t, err := parseQueryDate(value)
+		if err != nil {
+			return nil, err
+		}
+		return func(b Blob) bool {
+			ts, err := b.getTimestamp(key)
+			if err != nil || ts.IsZero() {
+				return false
+			}
+			c := 0
+			if ts.Before(t) {
+				c = -1
+			} else if ts.After(t) {
+				c = 1
+			}
+			return compareQuery(op, c)
+		}, nil
+	}
+
+	num, numErr := strconv.ParseFloat(value, 64)
+	return func(b Blob) bool {
+		v, ok := b[key]
+		if !ok {
+			return false
+		}
+
+		if n, err := strconv.ParseFloat(v, 64); err == nil && numErr == nil {
+			c := 0
+			if n < num {
+				c = -1
+			} else if n > num {
+				c = 1
+			}
+			return compareQuery(op, c)
+		}
+		return compareQuery(op, strings.Compare(v, value))
+	}, nil
+}
+
+// compareQuery checks the result of a comparison (-1, 0, 1) against op
+func compareQuery(op string, c int) bool {
+	switch op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	case ">=":
+		return c >= 0
+	}
+	return false
+}
+
+func parseQueryDate(value string) (time.Time, error) {
+	for _, layout := range queryDateLayouts {
+		if t, err := time.ParseInLocation(layout, value, time.Local); err == nil {
+			return t, nil
+		}
+	}
+	if t, ok := parseQueryRelative(strings.ToLower(value), time.Now()); ok {
+		return t, nil
+	}
+	return time.Time{}, fmt.Errorf("query: could not understand date %q, use YYYY-MM-DD or now+30d", value)
+}
+
+// parseQueryRelative parses now, now+<n><unit> and now-<n><unit> where unit is
+// one of d, w, m, y
+func parseQueryRelative(value string, now time.Time) (time.Time, bool) {
+	if !strings.HasPrefix(value, "now") {
+		return time.Time{}, false
+	}
+	value = value[len("now"):]
+	if len(value) == 0 {
+		return now, true
+	}
+	if len(value) < 3 || (value[0] != '+' && value[0] != '-') {
+		return time.Time{}, false
+	}
+
+	n, err := strconv.Atoi(value[1 : len(value)-1])
+	if err != nil || n < 0 {
+		return time.Time{}, false
+	}
+	if value[0] == '-' {
+		n = -n
+	}
+
+	switch value[len(value)-1] {
+	case 'd':
+		return now.AddDate(0, 0, n), true
+	case 'w':
+		return now.AddDate(0, 0, n*7), true
+	case 'm':
+		return now.AddDate(0, n, 0), true
+	case 'y':
+		return now.AddDate(n, 0, 0), true
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,81 @@
+package blobformat
+
+import (
+	"reflect"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestQuery(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	old := time.Date(2022, 6, 1, 0, 0, 0, 0, time.Local).UnixNano()
+	entries := []struct {
+		Name    string
+		User    string
+		Labels  []string
+		Updated int64
+	}{
+		{"github", "bob@corp.com", []string{"work"}, old},
+		{"aws", "admin@corp.com", []string{"work", "aws"}, 0},
+		{"gmail", "bob@gmail.com", nil, old},
+	}
+	for _, e := range entries {
+		uuid, err := b.New(e.Name)
+		must(t, err)
+		must(t, b.Set(uuid, KeyUser, e.User))
+		for _, l := range e.Labels {
+			must(t, b.AddLabel(uuid, l))
+		}
+		if e.Updated != 0 {
+			b.DB.Set(uuid, KeyUpdated, strconv.FormatInt(e.Updated, 10))
+		}
+	}
+
+	tests := []struct {
+		Query string
+		Want  []string
+	}{
+		{`label:work AND updated<2023-01-01 AND user~"@corp.com"`, []string{"github"}},
+		{`label:work user~CORP.COM`, []string{"aws", "github"}},
+		{`label:aws OR name=gmail`, []string{"aws", "gmail"}},
+		{`NOT label:work`, []string{"gmail"}},
+		{`label!=work and (updated>=2022-06-01 or user:ADMIN@corp.com)`, []string{"gmail"}},
+		{`gi`, []string{"github"}},
+		{`user~nobody`, nil},
+		{`updated<now-1y`, []string{"github", "gmail"}},
+		{`updated>=NOW-1w`, []string{"aws"}},
+	}
+
+	for i, test := range tests {
+		results, err := b.Query(test.Query)
+		if err != nil {
+			t.Errorf("%d) %v", i, err)
+			continue
+		}
+		names := results.Names()
+		sort.Strings(names)
+		if !reflect.DeepEqual(names, test.Want) {
+			t.Errorf("%d) wrong entries: %v", i, names)
+		}
+	}
+
+	bad := []string{
+		`label:`,
+		`(label:work`,
+		`label<work`,
+		`updated<yesterday`,
+		`updated<now+1x`,
+		`user~"unterminated`,
+		`user!bob`,
+		`label:work )`,
+	}
+	for _, q := range bad {
+		if _, err := b.Query(q); err == nil {
+			t.Errorf("%s: expected an error", q)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package blobformat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// ErrNoQuestion is returned when a security question has no text
+var ErrNoQuestion = errors.New("question must not be empty")
+
+// Question is a security question and the answer given for it. Truthful
+// answers can be found out or guessed so they're usually generated.
+type Question struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+	// Generated is true if the answer was random rather than typed in
+	Generated bool `json:"generated,omitempty"`
+}
+
+// Questions returns the security questions of the entry in the order they
+// were added. They're stored as json in the questions key.
+func (b Blob) Questions() ([]Question, error) {
+	questionsVal := b[KeyQuestions]
+	if len(questionsVal) == 0 {
+		return nil, nil
+	}
+
+	var questions []Question
+	if err := json.Unmarshal([]byte(questionsVal), &questions); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", KeyQuestions, err)
+	}
+
+	return questions, nil
+}
+
+// AddQuestion adds a security question to the entry, if the entry already
+// has the same question its answer is replaced.
+func (b Blobs) AddQuestion(uuid string, q Question) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	q.Question = strings.TrimSpace(q.Question)
+	if len(q.Question) == 0 {
+		return ErrNoQuestion
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	questions, err := blob.Questions()
+	if err != nil {
+		return err
+	}
+
+	replaced := false
+	for i, existing := range questions {
+		if strings.EqualFold(existing.Question, q.Question) {
+			questions[i] = q
+			replaced = true
+			break
+		}
+	}
+	if !replaced {
+		questions = append(questions, q)
+	}
+
+	return b.setQuestions(uuid, questions)
+}
+
+// RemoveQuestion removes the question at index (0-based) from the entry
+func (b Blobs) RemoveQuestion(uuid string, index int) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	questions, err := blob.Questions()
+	if err != nil {
+		return err
+	}
+	if index < 0 || index >= len(questions) {
+		return errors.New("index out of range")
+	}
+
+	questions = append(questions[:index], questions[index+1:]...)
+	if len(questions) == 0 {
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeyQuestions)
+		return nil
+	}
+
+	return b.setQuestions(uuid, questions)
+}
+
+func (b Blobs) setQuestions(uuid string, questions []Question) error {
+	questionsJSON, err := json.Marshal(questions)
+	if err != nil {
+		return err
+	}
+
+	if changed, err := b.setKey(uuid, KeyQuestions, string(questionsJSON)); err != nil || !changed {
+		return err
+	}
+	return b.redactHistory(uuid, KeyQuestions)
+}
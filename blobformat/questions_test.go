@@ -0,0 +1,48 @@
+package blobformat
+
+import "testing"
+
+func TestQuestions(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("bank")
+	must(t, err)
+
+	must(t, b.AddQuestion(uuid, Question{Question: "First pet?", Answer: "rex"}))
+	must(t, b.AddQuestion(uuid, Question{Question: " Mother's maiden name? ", Answer: "xq7v", Generated: true}))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	questions, err := blob.Questions()
+	must(t, err)
+	if len(questions) != 2 || questions[0].Answer != "rex" || questions[1].Question != "Mother's maiden name?" || !questions[1].Generated {
+		t.Fatal("questions wrong:", questions)
+	}
+
+	// The same question replaces the answer
+	must(t, b.AddQuestion(uuid, Question{Question: "first pet?", Answer: "spot"}))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if questions, err = blob.Questions(); err != nil || len(questions) != 2 || questions[0].Answer != "spot" {
+		t.Error("answer should be replaced:", questions, err)
+	}
+
+	if err = b.AddQuestion(uuid, Question{Question: " "}); err != ErrNoQuestion {
+		t.Error("expected no question error, got:", err)
+	}
+	if err = b.Set(uuid, KeyQuestions, "[]"); err == nil {
+		t.Error("questions should need the special setter")
+	}
+
+	if err = b.RemoveQuestion(uuid, 2); err == nil {
+		t.Error("expected an index error")
+	}
+	must(t, b.RemoveQuestion(uuid, 0))
+	must(t, b.RemoveQuestion(uuid, 0))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, ok := blob[KeyQuestions]; ok {
+		t.Error("key should be gone with the last question")
+	}
+}
@@ -0,0 +1,138 @@
+package blobformat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrNoRecoveryCodes is returned by UseRecoveryCode when every code has been
+// used
+var ErrNoRecoveryCodes = errors.New("no unused recovery codes left")
+
+// RecoveryCode is a backup code a site gives out for when the two factor key
+// is lost, each can only be used once.
+type RecoveryCode struct {
+	Code string `json:"code"`
+	// Used is the unix time the code was used at, 0 if it hasn't been
+	Used int64 `json:"used,omitempty"`
+}
+
+// RecoveryCodes returns the recovery codes of the entry in the order they were
+// given, used ones included. They're stored as json in the recoverycodes key.
+func (b Blob) RecoveryCodes() ([]RecoveryCode, error) {
+	codesVal := b[KeyRecoveryCodes]
+	if len(codesVal) == 0 {
+		return nil, nil
+	}
+
+	var codes []RecoveryCode
+	if err := json.Unmarshal([]byte(codesVal), &codes); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", KeyRecoveryCodes, err)
+	}
+
+	return codes, nil
+}
+
+// RecoveryCodesLeft returns how many recovery codes haven't been used and how
+// many there are in total
+func (b Blob) RecoveryCodesLeft() (left, total int, err error) {
+	codes, err := b.RecoveryCodes()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	for _, c := range codes {
+		if c.Used == 0 {
+			left++
+		}
+	}
+	return left, len(codes), nil
+}
+
+// SetRecoveryCodes replaces the recovery codes of the entry, sites invalidate
+// the old ones when new ones are generated. No codes removes them.
+func (b Blobs) SetRecoveryCodes(uuid string, codes []string) error {
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	var recoveryCodes []RecoveryCode
+	for _, c := range codes {
+		if c = strings.TrimSpace(c); len(c) != 0 {
+			recoveryCodes = append(recoveryCodes, RecoveryCode{Code: c})
+		}
+	}
+
+	if len(recoveryCodes) == 0 {
+		blob, err := b.MustFind(uuid)
+		if err != nil {
+			return err
+		}
+		if _, ok := blob[KeyRecoveryCodes]; ok {
+			b.touchUpdated(uuid)
+			b.DB.DeleteKey(uuid, KeyRecoveryCodes)
+		}
+		return nil
+	}
+
+	return b.setRecoveryCodes(uuid, recoveryCodes)
+}
+
+// UseRecoveryCode returns the first unused recovery code of the entry and
+// marks it used so it's never given out again. The change is recorded with a
+// reason so it shows up in the entry's snapshots. ErrNoRecoveryCodes is
+// returned if none are left.
+func (b Blobs) UseRecoveryCode(uuid string) (code string, left int, err error) {
+	if err = b.checkProtected(uuid); err != nil {
+		return "", 0, err
+	}
+
+	blob, err := b.MustFind(uuid)
+	if err != nil {
+		return "", 0, err
+	}
+	codes, err := blob.RecoveryCodes()
+	if err != nil {
+		return "", 0, err
+	}
+
+	use := -1
+	for i, c := range codes {
+		if c.Used != 0 {
+			continue
+		}
+		if use < 0 {
+			use = i
+		} else {
+			left++
+		}
+	}
+	if use < 0 {
+		return "", 0, ErrNoRecoveryCodes
+	}
+
+	codes[use].Used = time.Now().Unix()
+	err = b.DB.Because("use recovery code", func() error {
+		return b.setRecoveryCodes(uuid, codes)
+	})
+	if err != nil {
+		return "", 0, err
+	}
+
+	return codes[use].Code, left, nil
+}
+
+func (b Blobs) setRecoveryCodes(uuid string, codes []RecoveryCode) error {
+	codesJSON, err := json.Marshal(codes)
+	if err != nil {
+		return err
+	}
+
+	if changed, err := b.setKey(uuid, KeyRecoveryCodes, string(codesJSON)); err != nil || !changed {
+		return err
+	}
+	return b.redactHistory(uuid, KeyRecoveryCodes)
+}
@@ -0,0 +1,57 @@
+package blobformat
+
+import "testing"
+
+func TestRecoveryCodes(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("site")
+	must(t, err)
+
+	must(t, b.SetRecoveryCodes(uuid, []string{"aaaa-1111", " ", "bbbb-2222 "}))
+	if err = b.Set(uuid, KeyRecoveryCodes, "[]"); err == nil {
+		t.Error("recovery codes should need the special setter")
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if left, total, err := blob.RecoveryCodesLeft(); err != nil || left != 2 || total != 2 {
+		t.Error("wrong count:", left, total, err)
+	}
+
+	code, left, err := b.UseRecoveryCode(uuid)
+	must(t, err)
+	if code != "aaaa-1111" || left != 1 {
+		t.Error("wrong code:", code, left)
+	}
+	info, err := b.SnapshotInfo(uuid, 0)
+	must(t, err)
+	if info.Reason != "use recovery code" {
+		t.Error("reason was wrong:", info.Reason)
+	}
+
+	code, left, err = b.UseRecoveryCode(uuid)
+	must(t, err)
+	if code != "bbbb-2222" || left != 0 {
+		t.Error("wrong code:", code, left)
+	}
+	if _, _, err = b.UseRecoveryCode(uuid); err != ErrNoRecoveryCodes {
+		t.Error("expected no codes left, got:", err)
+	}
+
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	codes, err := blob.RecoveryCodes()
+	must(t, err)
+	if len(codes) != 2 || codes[0].Used == 0 || codes[1].Used == 0 {
+		t.Error("codes should be marked used:", codes)
+	}
+
+	must(t, b.SetRecoveryCodes(uuid, nil))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, ok := blob[KeyRecoveryCodes]; ok {
+		t.Error("key should be gone")
+	}
+}
@@ -0,0 +1,173 @@
+package blobformat
+
+import (
+	"sort"
+	"time"
+)
+
+// ReportMinPassLen is the shortest password a report considers compliant
+const ReportMinPassLen = 12
+
+// Report summarizes the credential hygiene of a file without including any
+// names or secret values so it can be handed to an auditor.
+//
+// An entry with a password is compliant when the password is at least
+// ReportMinPassLen long, is not used by another entry, the entry hasn't
+// expired and the password was changed within MaxAgeDays.
+type Report struct {
+	Generated  time.Time `json:"generated"`
+	MaxAgeDays int       `json:"maxAgeDays"`
+
+	Entries   int `json:"entries"`
+	Passwords int `json:"passwords"`
+	TwoFactor int `json:"twoFactor"`
+
+	Short   int `json:"short"`
+	Reused  int `json:"reused"`
+	Expired int `json:"expired"`
+	Overdue int `json:"overdue"`
+
+	Compliant int `json:"compliant"`
+	// Score is the percent of entries with passwords that are compliant
+	Score int `json:"score"`
+
+	Labels []LabelReport `json:"labels"`
+}
+
+// LabelReport is rotation compliance for the entries with a label, entries
+// without labels are reported under an empty label.
+type LabelReport struct {
+	Label     string `json:"label"`
+	Entries   int    `json:"entries"`
+	Passwords int    `json:"passwords"`
+	Overdue   int    `json:"overdue"`
+	Compliant int    `json:"compliant"`
+	Score     int    `json:"score"`
+}
+
+// Report creates a report of every entry as of now, passwords that haven't
+// changed in maxAge are overdue for rotation. User, sync, template and
+// trashed entries are not counted.
+func (b Blobs) Report(now time.Time, maxAge time.Duration) (Report, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return Report{}, err
+	}
+
+	r := Report{
+		Generated:  now,
+		MaxAgeDays: int(maxAge / (24 * time.Hour)),
+	}
+
+	passCount := make(map[string]int)
+	for _, entry := range b.DB.Snapshot {
+		if pass := entry[KeyPass]; len(pass) != 0 && reportEntry(Blob(entry)) {
+			passCount[pass]++
+		}
+	}
+
+	labels := make(map[string]*LabelReport)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		if !reportEntry(blob) {
+			continue
+		}
+
+		r.Entries++
+		if len(blob[KeyTwoFactor]) != 0 || len(blob[KeyTwoFactors]) != 0 {
+			r.TwoFactor++
+		}
+
+		entryLabels := blob.Labels()
+		if len(entryLabels) == 0 {
+			entryLabels = []string{""}
+		}
+		for _, l := range entryLabels {
+			if labels[l] == nil {
+				labels[l] = &LabelReport{Label: l}
+			}
+			labels[l].Entries++
+		}
+
+		pass := blob[KeyPass]
+		if len(pass) == 0 {
+			continue
+		}
+		r.Passwords++
+
+		compliant, overdue := true, false
+		if len(pass) < ReportMinPassLen {
+			r.Short++
+			compliant = false
+		}
+		if passCount[pass] > 1 {
+			r.Reused++
+			compliant = false
+		}
+		expired, err := blob.IsExpired(now)
+		if err != nil {
+			return Report{}, err
+		}
+		if expired {
+			r.Expired++
+			compliant = false
+		}
+
+		changed, err := b.passChanged(uuid, blob)
+		if err != nil {
+			return Report{}, err
+		}
+		if !changed.IsZero() && now.Sub(changed) > maxAge {
+			r.Overdue++
+			overdue, compliant = true, false
+		}
+
+		if compliant {
+			r.Compliant++
+		}
+		for _, l := range entryLabels {
+			lr := labels[l]
+			lr.Passwords++
+			if overdue {
+				lr.Overdue++
+			}
+			if compliant {
+				lr.Compliant++
+			}
+		}
+	}
+
+	r.Score = percent(r.Compliant, r.Passwords)
+	for _, lr := range labels {
+		lr.Score = percent(lr.Compliant, lr.Passwords)
+		r.Labels = append(r.Labels, *lr)
+	}
+	sort.Slice(r.Labels, func(i, j int) bool { return r.Labels[i].Label < r.Labels[j].Label })
+
+	return r, nil
+}
+
+// passChanged returns when the password of an entry was last set, entries
+// whose password history was archived fall back to when they were created.
+func (b Blobs) passChanged(uuid string, blob Blob) (time.Time, error) {
+	history := b.DB.KeyHistory(uuid, KeyPass)
+	if len(history) != 0 {
+		return time.Unix(0, history[len(history)-1].Time), nil
+	}
+
+	return blob.Created()
+}
+
+// reportEntry is false for entries that aren't credentials
+func reportEntry(blob Blob) bool {
+	name := blob.Name()
+	return !IsUserEntry(name) && !IsSyncEntry(name) && !IsTemplateEntry(name) && !IsSearchEntry(name) && !IsTrashEntry(name)
+}
+
+// percent returns n as a percentage of total, 100 when there's nothing to
+// count.
+func percent(n, total int) int {
+	if total == 0 {
+		return 100
+	}
+	return n * 100 / total
+}
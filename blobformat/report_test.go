@@ -0,0 +1,70 @@
+package blobformat
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	good, err := b.New("good")
+	must(t, err)
+	must(t, b.Set(good, KeyPass, "a-long-unique-password"))
+	must(t, b.AddLabel(good, "work"))
+	must(t, b.SetTwofactor(good, "JBSWY3DPEHPK3PXP"))
+
+	short, err := b.New("short")
+	must(t, err)
+	must(t, b.Set(short, KeyPass, "hunter2"))
+	must(t, b.AddLabel(short, "work"))
+
+	reused1, err := b.New("reused1")
+	must(t, err)
+	must(t, b.Set(reused1, KeyPass, "the-same-long-password"))
+	reused2, err := b.New("reused2")
+	must(t, err)
+	must(t, b.Set(reused2, KeyPass, "the-same-long-password"))
+
+	_, err = b.New("nopass")
+	must(t, err)
+	_, err = b.NewTemplate("tmpl", KeyPass)
+	must(t, err)
+
+	r, err := b.Report(time.Now(), 24*time.Hour)
+	must(t, err)
+	if r.Entries != 5 || r.Passwords != 4 || r.TwoFactor != 1 {
+		t.Error("counts wrong:", r)
+	}
+	if r.Short != 1 || r.Reused != 2 || r.Expired != 0 || r.Overdue != 0 {
+		t.Error("problems wrong:", r)
+	}
+	if r.Compliant != 1 || r.Score != 25 {
+		t.Error("compliance wrong:", r.Compliant, r.Score)
+	}
+	if len(r.Labels) != 2 || r.Labels[0].Label != "" || r.Labels[1].Label != "work" {
+		t.Fatal("labels wrong:", r.Labels)
+	}
+	if l := r.Labels[1]; l.Entries != 2 || l.Passwords != 2 || l.Compliant != 1 || l.Score != 50 {
+		t.Error("work label wrong:", l)
+	}
+
+	// A year from now every password is overdue
+	r, err = b.Report(time.Now().AddDate(1, 0, 0), 24*time.Hour)
+	must(t, err)
+	if r.Overdue != 4 || r.Compliant != 0 || r.Score != 0 {
+		t.Error("everything should be overdue:", r)
+	}
+
+	// Reports must never contain secrets or names
+	out, err := json.Marshal(r)
+	must(t, err)
+	for _, secret := range []string{"hunter2", "the-same-long-password", "good", "reused1"} {
+		if strings.Contains(string(out), secret) {
+			t.Errorf("report contains %q: %s", secret, out)
+		}
+	}
+}
@@ -0,0 +1,283 @@
+package blobformat
+
+import (
+	"crypto/ed25519"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// Roles in a multi-user file. Admins can add and remove users, assign roles
+// and rekey the file. Users can read and write entries.
+const (
+	RoleAdmin = "admin"
+	RoleUser  = "user"
+)
+
+// Role errors
+var (
+	ErrRolesEnabled = errors.New("roles are already enabled")
+	ErrNoSigningKey = errors.New("user has no signing key")
+	ErrNotAdmin     = errors.New("only admins can do that")
+	ErrUnknownRole  = errors.New("role must be admin or user")
+)
+
+// RoleAssignment is a user's role signed by the admin that assigned it
+type RoleAssignment struct {
+	User   string
+	Role   string
+	Signer string
+	// Valid is true if the signature checks out and the signer was an admin
+	// with a valid assignment of their own.
+	Valid bool
+}
+
+// RolesEnabled is true if the file has a root admin. Files without one have
+// no roles and every user can do everything.
+func (b Blobs) RolesEnabled() (bool, error) {
+	root, _, err := b.rootAdmin()
+	return len(root) != 0, err
+}
+
+// EnableRoles makes username the root admin of the file by having them sign
+// their own admin assignment. The root admin is the only self-signed
+// assignment that's trusted and all other assignments must lead back to it.
+func (b Blobs) EnableRoles(username string, priv ed25519.PrivateKey) error {
+	if enabled, err := b.RolesEnabled(); err != nil {
+		return err
+	} else if enabled {
+		return ErrRolesEnabled
+	}
+
+	return b.signRole(username, RoleAdmin, username, priv)
+}
+
+// AssignRole signs and stores a role for username. signer must be an admin
+// and priv their signing key. The user must have a signing key so that the
+// assignment is bound to it.
+func (b Blobs) AssignRole(username, role, signer string, priv ed25519.PrivateKey) error {
+	if role != RoleAdmin && role != RoleUser {
+		return ErrUnknownRole
+	}
+
+	signerRole, err := b.RoleOf(signer)
+	if err != nil {
+		return err
+	}
+	if signerRole != RoleAdmin {
+		return ErrNotAdmin
+	}
+
+	return b.signRole(username, role, signer, priv)
+}
+
+// SetSigningKey stores a user's public signing key and their private key
+// (which the caller must have encrypted so only the user can read it).
+// Changing the public key invalidates the user's role assignment.
+func (b Blobs) SetSigningKey(username string, pub ed25519.PublicKey, sealedPriv string) error {
+	uuid, _, err := b.FindUser(username)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return ErrNotFound
+	}
+
+	b.DB.Set(uuid, KeySignPub, hex.EncodeToString(pub))
+	b.DB.Set(uuid, KeySignPriv, sealedPriv)
+	return nil
+}
+
+// SigningKey returns the public signing key of a user and the sealed private
+// key that was stored with it.
+func (b Blobs) SigningKey(username string) (pub ed25519.PublicKey, sealedPriv string, err error) {
+	_, blob, err := b.FindUser(username)
+	if err != nil {
+		return nil, "", err
+	}
+	if blob == nil {
+		return nil, "", ErrNotFound
+	}
+
+	pubHex := blob[KeySignPub]
+	if len(pubHex) == 0 {
+		return nil, "", ErrNoSigningKey
+	}
+	pubBytes, err := hex.DecodeString(pubHex)
+	if err != nil || len(pubBytes) != ed25519.PublicKeySize {
+		return nil, "", fmt.Errorf("user %s has a malformed signing key", username)
+	}
+
+	return ed25519.PublicKey(pubBytes), blob[KeySignPriv], nil
+}
+
+// RoleOf returns the verified role of a user. If roles are not enabled or
+// the user's assignment can't be verified it returns "".
+func (b Blobs) RoleOf(username string) (string, error) {
+	assignments, err := b.Roles()
+	if err != nil {
+		return "", err
+	}
+
+	for _, a := range assignments {
+		if a.User == username && a.Valid {
+			return a.Role, nil
+		}
+	}
+
+	return "", nil
+}
+
+// Roles returns the role assignments of all users, the Valid field says if
+// the assignment could be verified. Verification starts at the root admin and
+// an assignment is only valid if it was signed by an admin whose own
+// assignment is valid.
+func (b Blobs) Roles() ([]RoleAssignment, error) {
+	root, pinned, err := b.rootAdmin()
+	if err != nil || len(root) == 0 {
+		return nil, err
+	}
+
+	users, err := b.Users()
+	if err != nil {
+		return nil, err
+	}
+
+	var assignments []RoleAssignment
+	for uuid, name := range users {
+		blob := Blob(b.DB.Snapshot[uuid])
+		if len(blob[KeyRole]) == 0 {
+			continue
+		}
+
+		assignments = append(assignments, RoleAssignment{
+			User:   SplitUsername(name),
+			Role:   blob[KeyRole],
+			Signer: blob[KeyRoleSigner],
+		})
+	}
+
+	valid := func(a RoleAssignment) bool {
+		if a.User == root {
+			return pinned && a.Signer == root && a.Role == RoleAdmin && b.verifyRole(a)
+		}
+		return a.Signer != a.User && b.verifyRole(a)
+	}
+
+	// Keep validating assignments signed by admins we've already validated
+	// until nothing changes
+	admins := map[string]bool{}
+	for changed := true; changed; {
+		changed = false
+		for i, a := range assignments {
+			if a.Valid {
+				continue
+			}
+			if a.User != root && !admins[a.Signer] {
+				continue
+			}
+			if !valid(a) {
+				continue
+			}
+
+			assignments[i].Valid = true
+			if a.Role == RoleAdmin {
+				admins[a.User] = true
+			}
+			changed = true
+		}
+	}
+
+	return assignments, nil
+}
+
+// rootAdmin returns the user who enabled roles. It's the user with a self
+// signed admin assignment that was signed first, a user that adds a self
+// signed assignment later can't take over. pinned is false if the root's
+// signing key has changed since, then nothing can be trusted.
+func (b Blobs) rootAdmin() (username string, pinned bool, err error) {
+	users, err := b.Users()
+	if err != nil {
+		return "", false, err
+	}
+
+	candidates := make(map[string]string)
+	for uuid, name := range users {
+		blob := Blob(b.DB.Snapshot[uuid])
+		username := SplitUsername(name)
+		if blob[KeyRole] == RoleAdmin && blob[KeyRoleSigner] == username {
+			candidates[uuid] = username
+		}
+	}
+	if len(candidates) == 0 {
+		return "", false, nil
+	}
+
+	firstKey := make(map[string]string)
+	for _, tx := range b.DB.Log {
+		switch tx.Key {
+		case KeySignPub:
+			if _, ok := firstKey[tx.UUID]; !ok {
+				firstKey[tx.UUID] = tx.Value
+			}
+		case KeyRoleSig:
+			if name, ok := candidates[tx.UUID]; ok {
+				current := b.DB.Snapshot[tx.UUID][KeySignPub]
+				return name, firstKey[tx.UUID] == current, nil
+			}
+		}
+	}
+
+	return "", false, nil
+}
+
+func (b Blobs) signRole(username, role, signer string, priv ed25519.PrivateKey) error {
+	uuid, _, err := b.FindUser(username)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return ErrNotFound
+	}
+
+	pub, _, err := b.SigningKey(username)
+	if err != nil {
+		return err
+	}
+
+	sig := ed25519.Sign(priv, roleMessage(username, role, pub))
+
+	b.DB.Set(uuid, KeyRole, role)
+	b.DB.Set(uuid, KeyRoleSigner, signer)
+	b.DB.Set(uuid, KeyRoleSig, hex.EncodeToString(sig))
+	return nil
+}
+
+func (b Blobs) verifyRole(a RoleAssignment) bool {
+	_, blob, err := b.FindUser(a.User)
+	if err != nil || blob == nil {
+		return false
+	}
+
+	pub, _, err := b.SigningKey(a.User)
+	if err != nil {
+		return false
+	}
+	signerPub, _, err := b.SigningKey(a.Signer)
+	if err != nil {
+		return false
+	}
+	sig, err := hex.DecodeString(blob[KeyRoleSig])
+	if err != nil {
+		return false
+	}
+
+	return ed25519.Verify(signerPub, roleMessage(a.User, a.Role, pub), sig)
+}
+
+// roleMessage is what's signed for a role assignment, it binds the role to
+// the user's name and signing key.
+func roleMessage(username, role string, pub ed25519.PublicKey) []byte {
+	msg := []byte("bpass-role\x00" + username + "\x00" + role + "\x00")
+	return append(msg, pub...)
+}
@@ -0,0 +1,88 @@
+package blobformat
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"testing"
+)
+
+func newTestSigner(t *testing.T, b Blobs, username string) ed25519.PrivateKey {
+	t.Helper()
+
+	if _, err := b.NewUser(username); err != nil {
+		t.Fatal(err)
+	}
+
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	must(t, err)
+	must(t, b.SetSigningKey(username, pub, "sealed"))
+	return priv
+}
+
+func TestRoles(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	alice := newTestSigner(t, b, "alice")
+	bob := newTestSigner(t, b, "bob")
+	carol := newTestSigner(t, b, "carol")
+
+	if enabled, err := b.RolesEnabled(); err != nil || enabled {
+		t.Error("roles should not be enabled", err)
+	}
+	if err := b.AssignRole("bob", RoleUser, "alice", alice); err != ErrNotAdmin {
+		t.Error("expected not admin:", err)
+	}
+
+	must(t, b.EnableRoles("alice", alice))
+	if err := b.EnableRoles("bob", bob); err != ErrRolesEnabled {
+		t.Error("expected roles enabled:", err)
+	}
+
+	must(t, b.AssignRole("bob", RoleAdmin, "alice", alice))
+	must(t, b.AssignRole("carol", RoleUser, "bob", bob))
+	if err := b.AssignRole("alice", RoleUser, "carol", carol); err != ErrNotAdmin {
+		t.Error("expected not admin:", err)
+	}
+
+	for user, want := range map[string]string{"alice": RoleAdmin, "bob": RoleAdmin, "carol": RoleUser} {
+		if role, err := b.RoleOf(user); err != nil || role != want {
+			t.Errorf("%s role was %q want %q (%v)", user, role, want, err)
+		}
+	}
+}
+
+func TestRolesForged(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	alice := newTestSigner(t, b, "alice")
+	carol := newTestSigner(t, b, "carol")
+
+	must(t, b.EnableRoles("alice", alice))
+	must(t, b.AssignRole("carol", RoleUser, "alice", alice))
+
+	// Carol writes an admin assignment for herself signed with her own key,
+	// bypassing AssignRole
+	must(t, b.signRole("carol", RoleAdmin, "carol", carol))
+	if role, err := b.RoleOf("carol"); err != nil || len(role) != 0 {
+		t.Errorf("forged self assignment should not be valid: %q %v", role, err)
+	}
+
+	// Carol replaces alice's key with her own to sign as alice
+	pub := carol.Public().(ed25519.PublicKey)
+	uuid, _, err := b.FindUser("alice")
+	must(t, err)
+	b.DB.Set(uuid, KeySignPub, hex.EncodeToString(pub))
+	must(t, b.signRole("alice", RoleAdmin, "alice", carol))
+	must(t, b.signRole("carol", RoleAdmin, "alice", carol))
+
+	roles, err := b.Roles()
+	must(t, err)
+	for _, a := range roles {
+		if a.Valid {
+			t.Errorf("%s should not be valid after the root key changed", a.User)
+		}
+	}
+}
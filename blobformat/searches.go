@@ -0,0 +1,68 @@
+package blobformat
+
+import (
+	"errors"
+	"strings"
+)
+
+// ErrSearchNotFound is returned when a saved search does not exist
+var ErrSearchNotFound = errors.New("saved search not found")
+
+// SaveSearch stores a query (see Query) in the file under a name so it can be
+// run again with SavedSearch, saving it again under the same name replaces
+// the query. It's kept in an entry named search/<name>.
+func (b Blobs) SaveSearch(name, query string) (uuid string, err error) {
+	if _, err = parseQuery(query); err != nil {
+		return "", err
+	}
+
+	uuid, _, err = b.FindByName(searchPrefix + name)
+	if err != nil {
+		return "", err
+	}
+	if len(uuid) == 0 {
+		if uuid, err = b.New(searchPrefix + name); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err = b.setKey(uuid, KeyQuery, query); err != nil {
+		return "", err
+	}
+	return uuid, nil
+}
+
+// SavedSearch runs the search saved under name
+func (b Blobs) SavedSearch(name string) (entries SearchResults, err error) {
+	_, blob, err := b.FindByName(searchPrefix + name)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, ErrSearchNotFound
+	}
+
+	return b.Query(blob[KeyQuery])
+}
+
+// SavedSearches returns the queries of all saved searches by their name
+func (b Blobs) SavedSearches() (map[string]string, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	searches := make(map[string]string)
+	for _, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		if name := blob.Name(); IsSearchEntry(name) {
+			searches[strings.TrimPrefix(name, searchPrefix)] = blob[KeyQuery]
+		}
+	}
+
+	return searches, nil
+}
+
+// IsSearchEntry checks to see if the name is a saved search entry
+func IsSearchEntry(name string) bool {
+	return strings.HasPrefix(name, searchPrefix)
+}
@@ -0,0 +1,47 @@
+package blobformat
+
+import "testing"
+
+func TestSavedSearch(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	work, err := b.New("github")
+	must(t, err)
+	must(t, b.AddLabel(work, "work"))
+	_, err = b.New("gmail")
+	must(t, err)
+
+	if _, err = b.SaveSearch("bad", "label:"); err == nil {
+		t.Error("expected an error for a bad query")
+	}
+
+	uuid, err := b.SaveSearch("work", "label:work")
+	must(t, err)
+	results, err := b.SavedSearch("work")
+	must(t, err)
+	if len(results) != 1 || results[work] != "github" {
+		t.Error("wrong results:", results)
+	}
+
+	again, err := b.SaveSearch("work", "gmail")
+	must(t, err)
+	if again != uuid {
+		t.Error("saving again should replace the search")
+	}
+	results, err = b.SavedSearch("work")
+	must(t, err)
+	if len(results) != 1 || results[work] == "github" {
+		t.Error("wrong results:", results)
+	}
+
+	searches, err := b.SavedSearches()
+	must(t, err)
+	if len(searches) != 1 || searches["work"] != "gmail" {
+		t.Error("wrong searches:", searches)
+	}
+
+	if _, err = b.SavedSearch("nope"); err != ErrSearchNotFound {
+		t.Error("expected not found:", err)
+	}
+}
@@ -0,0 +1,114 @@
+package blobformat
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Share records that the credentials in an entry were given to someone
+type Share struct {
+	Recipient string    `json:"recipient"`
+	Time      time.Time `json:"time"`
+	// Recalled is set once the share has been recalled
+	Recalled time.Time `json:"recalled,omitempty"`
+}
+
+// Shares returns who the entry has been shared with, oldest first. They're
+// stored as json in the shares key.
+func (b Blob) Shares() ([]Share, error) {
+	sharesVal := b[KeyShares]
+	if len(sharesVal) == 0 {
+		return nil, nil
+	}
+
+	var shares []Share
+	if err := json.Unmarshal([]byte(sharesVal), &shares); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", KeyShares, err)
+	}
+
+	return shares, nil
+}
+
+// ActiveShares returns the shares that have not been recalled
+func (b Blob) ActiveShares() ([]Share, error) {
+	shares, err := b.Shares()
+	if err != nil {
+		return nil, err
+	}
+
+	var active []Share
+	for _, s := range shares {
+		if s.Recalled.IsZero() {
+			active = append(active, s)
+		}
+	}
+	return active, nil
+}
+
+// RecordShare records that the entry was given to recipient now
+func (b Blobs) RecordShare(uuid, recipient string) error {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	shares, err := blob.Shares()
+	if err != nil {
+		return err
+	}
+
+	shares = append(shares, Share{Recipient: recipient, Time: time.Now()})
+	return b.setShares(uuid, shares)
+}
+
+// Recall marks every active share of the entry as recalled and flags the
+// entry for rotation by expiring it now. The shares that were recalled are
+// returned so the recipients can be told.
+func (b Blobs) Recall(uuid string) ([]Share, error) {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return nil, err
+	}
+	if blob == nil {
+		return nil, ErrNotFound
+	}
+
+	shares, err := blob.Shares()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	var recalled []Share
+	for i, s := range shares {
+		if s.Recalled.IsZero() {
+			shares[i].Recalled = now
+			recalled = append(recalled, shares[i])
+		}
+	}
+
+	if len(recalled) != 0 {
+		if err = b.setShares(uuid, shares); err != nil {
+			return nil, err
+		}
+	}
+	if err = b.SetExpires(uuid, now); err != nil {
+		return nil, err
+	}
+
+	return recalled, nil
+}
+
+func (b Blobs) setShares(uuid string, shares []Share) error {
+	sharesJSON, err := json.Marshal(shares)
+	if err != nil {
+		return err
+	}
+
+	_, err = b.setKey(uuid, KeyShares, string(sharesJSON))
+	return err
+}
@@ -0,0 +1,51 @@
+package blobformat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShares(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("shared")
+	must(t, err)
+
+	must(t, b.RecordShare(uuid, "alice"))
+	must(t, b.RecordShare(uuid, "bob"))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	shares, err := blob.ActiveShares()
+	must(t, err)
+	if len(shares) != 2 || shares[0].Recipient != "alice" || shares[1].Recipient != "bob" {
+		t.Fatal("shares wrong:", shares)
+	}
+
+	recalled, err := b.Recall(uuid)
+	must(t, err)
+	if len(recalled) != 2 || recalled[0].Recalled.IsZero() {
+		t.Error("recalled wrong:", recalled)
+	}
+
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if shares, err = blob.ActiveShares(); err != nil || len(shares) != 0 {
+		t.Error("should have no active shares:", shares, err)
+	}
+	if all, err := blob.Shares(); err != nil || len(all) != 2 {
+		t.Error("recalled shares should be kept:", all, err)
+	}
+	if expired, err := blob.IsExpired(time.Now()); err != nil || !expired {
+		t.Error("recall should flag the entry for rotation:", expired, err)
+	}
+
+	// Sharing again after a recall only recalls the new share
+	must(t, b.RecordShare(uuid, "carol"))
+	recalled, err = b.Recall(uuid)
+	must(t, err)
+	if len(recalled) != 1 || recalled[0].Recipient != "carol" {
+		t.Error("recalled wrong:", recalled)
+	}
+}
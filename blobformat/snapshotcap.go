@@ -0,0 +1,86 @@
+package blobformat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// SnapshotCap returns the most snapshots the entry keeps, 0 if it keeps all
+// of them.
+func (b Blob) SnapshotCap() (int, error) {
+	val, ok := b[KeySnapshotCap]
+	if !ok {
+		return 0, nil
+	}
+
+	max, err := strconv.Atoi(val)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse snapshot cap: %w", err)
+	}
+	return max, nil
+}
+
+// SetSnapshotCap sets the most snapshots an entry keeps, 0 removes the cap.
+// Once an entry has more the oldest are dropped by CapSnapshots, this is for
+// entries that change often (like rotating tokens) so they don't grow the
+// file forever. Snapshots that hold values the entry still has are never
+// dropped so an entry can end up with more than max.
+func (b Blobs) SetSnapshotCap(uuid string, max int) error {
+	if max < 0 {
+		return errors.New("snapshot cap must not be negative")
+	}
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	blob, err := b.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	if max == 0 {
+		if _, ok := blob[KeySnapshotCap]; !ok {
+			return nil
+		}
+
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeySnapshotCap)
+		return nil
+	}
+
+	_, err = b.setKey(uuid, KeySnapshotCap, strconv.Itoa(max))
+	return err
+}
+
+// CapSnapshots drops the oldest snapshots of every entry that has more than
+// its cap (see SetSnapshotCap) and returns how many changes were removed.
+// The log can't be changed in the middle of a transaction so this is done
+// before saving rather than on every change.
+func (b Blobs) CapSnapshots() (int, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return 0, err
+	}
+
+	caps := make(map[string]int)
+	for uuid, entry := range b.DB.Snapshot {
+		max, err := Blob(entry).SnapshotCap()
+		if err != nil {
+			return 0, err
+		}
+		if max != 0 {
+			caps[uuid] = max
+		}
+	}
+
+	n := 0
+	for uuid, max := range caps {
+		removed, err := b.DB.Trim(uuid, max)
+		if err != nil {
+			return n, err
+		}
+		n += len(removed)
+	}
+
+	return n, nil
+}
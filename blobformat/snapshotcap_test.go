@@ -0,0 +1,53 @@
+package blobformat
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestSnapshotCap(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("token")
+	must(t, err)
+	other, err := b.New("other")
+	must(t, err)
+
+	must(t, b.SetSnapshotCap(uuid, 6))
+	for i := 0; i < 10; i++ {
+		must(t, b.Set(uuid, KeyToken, strconv.Itoa(i)))
+		must(t, b.Set(other, KeyToken, strconv.Itoa(i)))
+	}
+
+	n, err := b.CapSnapshots()
+	must(t, err)
+	if n == 0 {
+		t.Error("nothing was removed")
+	}
+	if v := b.NVersions(uuid); v != 6 {
+		t.Error("wrong number of versions:", v)
+	}
+	if v := b.NVersions(other); v != 24 {
+		t.Error("entries without a cap should be left alone:", v)
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyToken] != "9" {
+		t.Error("current value was lost:", blob[KeyToken])
+	}
+	if max, err := blob.SnapshotCap(); err != nil || max != 6 {
+		t.Error("cap was wrong:", max, err)
+	}
+
+	if err = b.SetSnapshotCap(uuid, -1); err == nil {
+		t.Error("expected an error for a negative cap")
+	}
+	must(t, b.SetSnapshotCap(uuid, 0))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, ok := blob[KeySnapshotCap]; ok {
+		t.Error("cap should be removed")
+	}
+}
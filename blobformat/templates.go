@@ -0,0 +1,196 @@
+package blobformat
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrTemplateNotFound is returned when a template does not exist
+var ErrTemplateNotFound = errors.New("template not found")
+
+// Template is a set of keys (with optional default values) that new entries
+// can be created with.
+type Template struct {
+	Name string
+	// Keys in the order they should be filled in
+	Keys []string
+	// Defaults for keys, keys without one start out empty
+	Defaults map[string]string
+	// Types of keys that aren't strings, see SetValue
+	Types map[string]string
+}
+
+var builtinTemplates = map[string]Template{
+	"login": {
+		Name: "login",
+		Keys: []string{KeyURL, KeyUser, KeyEmail, KeyPass, KeyTwoFactor},
+	},
+	"server": {
+		Name:     "server",
+		Keys:     []string{"host", "port", KeyUser, KeyPass, "privkey"},
+		Defaults: map[string]string{"port": "22"},
+	},
+	"bank": {
+		Name: "bank",
+		Keys: []string{KeyURL, KeyUser, KeyPass, "account", "routing", "pin", KeyTwoFactor},
+	},
+	"infra": {
+		Name:     "infra",
+		Keys:     []string{KeyHostname, KeyIP, KeyPort, KeyEnvironment, KeyOwner, KeyUser, KeyPass, KeyPriv},
+		Defaults: map[string]string{KeyPort: "22"},
+		Types:    map[string]string{KeyPort: TypeNumber},
+	},
+}
+
+// templateOrder is the order known keys appear in user templates, the rest
+// are sorted after these.
+var templateOrder = []string{KeyURL, KeyUser, KeyEmail, KeyPass, KeyTwoFactor}
+
+// Template returns the template with the given name. Templates stored in the
+// file (entries named template/<name>) take precedence over the built-in ones.
+func (b Blobs) Template(name string) (Template, error) {
+	_, blob, err := b.FindByName(templatePrefix + name)
+	if err != nil {
+		return Template{}, err
+	}
+
+	if blob == nil {
+		t, ok := builtinTemplates[name]
+		if !ok {
+			return Template{}, ErrTemplateNotFound
+		}
+		return t, nil
+	}
+
+	meta, err := blob.AllFieldMeta()
+	if err != nil {
+		return Template{}, err
+	}
+
+	t := Template{Name: name, Defaults: make(map[string]string), Types: make(map[string]string)}
+	var rest []string
+	for k, v := range blob {
+		if !templateKey(k) {
+			continue
+		}
+
+		if len(v) != 0 {
+			t.Defaults[k] = v
+		}
+		if typ := meta[k].Type; typ != TypeString {
+			t.Types[k] = typ
+		}
+
+		known := false
+		for _, o := range templateOrder {
+			if o == k {
+				known = true
+				break
+			}
+		}
+		if !known {
+			rest = append(rest, k)
+		}
+	}
+
+	for _, o := range templateOrder {
+		if _, ok := blob[o]; ok {
+			t.Keys = append(t.Keys, o)
+		}
+	}
+	sort.Strings(rest)
+	t.Keys = append(t.Keys, rest...)
+
+	return t, nil
+}
+
+// Templates returns the names of all templates, built-in and user defined
+func (b Blobs) Templates() ([]string, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	for name := range builtinTemplates {
+		names[name] = struct{}{}
+	}
+	for _, entry := range b.DB.Snapshot {
+		if name := Blob(entry).Name(); IsTemplateEntry(name) {
+			names[strings.TrimPrefix(name, templatePrefix)] = struct{}{}
+		}
+	}
+
+	list := make([]string, 0, len(names))
+	for name := range names {
+		list = append(list, name)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// NewTemplate creates a new user defined template with the given keys, the
+// values of the keys in the entry are used as defaults.
+func (b Blobs) NewTemplate(name string, keys ...string) (uuid string, err error) {
+	uuid, err = b.New(templatePrefix + name)
+	if err != nil {
+		return "", err
+	}
+
+	for _, k := range keys {
+		if templateKey(k) {
+			b.DB.Set(uuid, k, "")
+		}
+	}
+
+	return uuid, nil
+}
+
+// NewFromTemplate creates a new entry with the keys from the template set to
+// their defaults and types. Notes are added as notes, other keys that require
+// a special setter (totp) are left for the caller to fill in.
+func (b Blobs) NewFromTemplate(templateName, entryName string) (uuid string, err error) {
+	t, err := b.Template(templateName)
+	if err != nil {
+		return "", err
+	}
+
+	uuid, err = b.New(entryName)
+	if err != nil {
+		return "", err
+	}
+
+	for _, k := range t.Keys {
+		switch {
+		case k == KeyNotes:
+			for _, n := range (Blob{KeyNotes: t.Defaults[k]}).Notes() {
+				if err = b.AddNote(uuid, n.Text); err != nil {
+					return "", err
+				}
+			}
+		case isProtected(k):
+			continue
+		default:
+			b.DB.Set(uuid, k, t.Defaults[k])
+		}
+
+		if typ, ok := t.Types[k]; ok {
+			if err = b.SetFieldMeta(uuid, k, FieldMeta{Type: typ}); err != nil {
+				return "", err
+			}
+		}
+	}
+
+	return uuid, nil
+}
+
+// IsTemplateEntry checks to see if the name is a template entry
+func IsTemplateEntry(name string) bool {
+	return strings.HasPrefix(name, templatePrefix)
+}
+
+// templateKey returns false for keys that should not be copied from a
+// template: the ones that belong to the template entry itself.
+func templateKey(key string) bool {
+	return key == KeyTwoFactor || key == KeyNotes || !isProtected(key)
+}
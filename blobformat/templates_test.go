@@ -0,0 +1,63 @@
+package blobformat
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestNewFromTemplate(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+
+	if _, err := b.NewFromTemplate("nope", "one"); err != ErrTemplateNotFound {
+		t.Error("expected template not found:", err)
+	}
+
+	uuid, err := b.NewFromTemplate("server", "one")
+	must(t, err)
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob["port"] != "22" {
+		t.Error("default was not set:", blob["port"])
+	}
+	if v, ok := blob["host"]; !ok || len(v) != 0 {
+		t.Error("host should be present and empty")
+	}
+
+	// User templates override built-in ones
+	tuuid, err := b.NewTemplate("server", "host", KeyNotes, KeyTwoFactor, KeyUpdated)
+	must(t, err)
+	b.DB.Set(tuuid, "host", "example.com")
+
+	tmpl, err := b.Template("server")
+	must(t, err)
+	if !reflect.DeepEqual(tmpl.Keys, []string{KeyTwoFactor, "host", KeyNotes}) {
+		t.Error("keys were wrong:", tmpl.Keys)
+	}
+
+	uuid, err = b.NewFromTemplate("server", "two")
+	must(t, err)
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if blob["host"] != "example.com" {
+		t.Error("default was not set:", blob["host"])
+	}
+	if _, ok := blob[KeyTwoFactor]; ok {
+		t.Error("totp must be set with its own setter")
+	}
+
+	names, err := b.Templates()
+	must(t, err)
+	if !reflect.DeepEqual(names, []string{"bank", "infra", "login", "server"}) {
+		t.Error("names were wrong:", names)
+	}
+
+	// Types from the template are kept
+	uuid, err = b.NewFromTemplate("infra", "three")
+	must(t, err)
+	if err = b.Set(uuid, KeyPort, "ssh"); !errors.Is(err, ErrWrongType) {
+		t.Error("port should be a number:", err)
+	}
+}
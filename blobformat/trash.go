@@ -0,0 +1,225 @@
+package blobformat
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// MoveToTrash moves an entry into the trash instead of deleting it. It's
+// renamed to trash/<name> (with a number appended if that's taken) and the
+// time and its original name are recorded so it can be restored.
+func (b Blobs) MoveToTrash(uuid string) error {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	name := blob.Name()
+	if IsTrashEntry(name) {
+		return nil
+	}
+
+	trashName := trashPrefix + name
+	for i := 1; ; i++ {
+		err = b.Rename(uuid, trashName)
+		if err == nil {
+			break
+		} else if err != ErrNameNotUnique {
+			return err
+		}
+		trashName = trashPrefix + name + strconv.Itoa(i)
+	}
+
+	b.DB.Set(uuid, KeyTrashedName, name)
+	b.DB.Set(uuid, KeyTrashed, strconv.FormatInt(time.Now().UnixNano(), 10))
+	return nil
+}
+
+// Trashed returns when the entry was moved to the trash, the zero time if
+// it's not in the trash.
+func (b Blob) Trashed() (time.Time, error) {
+	return b.getTimestamp(KeyTrashed)
+}
+
+// Trash returns all the entries in the trash
+func (b Blobs) Trash() (entries SearchResults, err error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries = make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		if name := Blob(entry).Name(); IsTrashEntry(name) {
+			entries[uuid] = name
+		}
+	}
+
+	return entries, nil
+}
+
+// Restore moves an entry out of the trash back to its original name. If the
+// name has been taken since ErrNameNotUnique is returned.
+func (b Blobs) Restore(uuid string) error {
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil || !IsTrashEntry(blob.Name()) {
+		return ErrNotFound
+	}
+
+	name := blob[KeyTrashedName]
+	if len(name) == 0 {
+		name = strings.TrimPrefix(blob.Name(), trashPrefix)
+	}
+
+	if err = b.Rename(uuid, name); err != nil {
+		return err
+	}
+
+	b.DB.DeleteKey(uuid, KeyTrashedName)
+	b.DB.DeleteKey(uuid, KeyTrashed)
+	return nil
+}
+
+// EmptyTrash deletes the entries that were moved to the trash before
+// olderThan and returns their names.
+func (b Blobs) EmptyTrash(olderThan time.Time) (deleted []string, err error) {
+	trash, err := b.Trash()
+	if err != nil {
+		return nil, err
+	}
+
+	for uuid, name := range trash {
+		trashed, err := Blob(b.DB.Snapshot[uuid]).Trashed()
+		if err != nil {
+			return deleted, err
+		}
+		if !trashed.Before(olderThan) {
+			continue
+		}
+
+		if err = b.Delete(uuid); err != nil {
+			return deleted, err
+		}
+		deleted = append(deleted, name)
+	}
+
+	return deleted, nil
+}
+
+// undeleteSkip are the keys about an entry's life (and death) that an
+// undeleted entry starts out without
+var undeleteSkip = map[string]struct{}{
+	KeyName:           {},
+	KeyCreated:        {},
+	KeyUpdated:        {},
+	KeyAccessed:       {},
+	KeyDeleted:        {},
+	KeyTrashed:        {},
+	KeyTrashedName:    {},
+	KeyCheckout:       {},
+	KeyCheckoutReason: {},
+	KeyCheckoutTime:   {},
+}
+
+// DeletedEntry is an entry that was permanently deleted but is still in the
+// log
+type DeletedEntry struct {
+	UUID    string
+	Name    string
+	Deleted time.Time
+}
+
+// DeletedEntries returns the entries that were permanently deleted (by
+// emptying the trash or removing users) most recently deleted first. Delete
+// leaves their last state in the log so they can be brought back with
+// Undelete, until archiving moves them out of it.
+func (b Blobs) DeletedEntries() []DeletedEntry {
+	names := make(map[string]string)
+	var deleted []DeletedEntry
+	for _, tx := range b.DB.Log {
+		switch tx.Kind {
+		case txlogs.TxSetKey:
+			// The name it had before it was put in the trash is the one
+			// people remember
+			if tx.Key == KeyName || tx.Key == KeyTrashedName {
+				names[tx.UUID] = tx.Value
+			}
+		case txlogs.TxDelete:
+			deleted = append(deleted, DeletedEntry{
+				UUID:    tx.UUID,
+				Name:    names[tx.UUID],
+				Deleted: time.Unix(0, tx.Time),
+			})
+		}
+	}
+
+	sort.SliceStable(deleted, func(i, j int) bool {
+		return deleted[i].Deleted.After(deleted[j].Deleted)
+	})
+	return deleted
+}
+
+// Undelete creates a new entry with the keys a permanently deleted entry had
+// when it was deleted and returns its uuid. It's named what the entry was
+// called before it went in the trash (with a number appended if that's
+// taken). The deleted entry's history stays with it, the new entry starts
+// fresh.
+func (b Blobs) Undelete(uuid string) (newUUID string, err error) {
+	var state, last Blob
+	for _, tx := range b.DB.Log {
+		if tx.UUID != uuid {
+			continue
+		}
+
+		switch tx.Kind {
+		case txlogs.TxAdd:
+			state = make(Blob)
+		case txlogs.TxSetKey:
+			state[tx.Key] = tx.Value
+		case txlogs.TxDeleteKey:
+			delete(state, tx.Key)
+		case txlogs.TxDelete:
+			last, state = state, nil
+		}
+	}
+	if last == nil || state != nil {
+		return "", ErrNotFound
+	}
+
+	name := last.Name()
+	if trashedName, ok := last[KeyTrashedName]; ok {
+		name = trashedName
+	}
+	newName := name
+	for i := 1; ; i++ {
+		newUUID, err = b.New(newName)
+		if err == nil {
+			break
+		} else if err != ErrNameNotUnique {
+			return "", err
+		}
+		newName = name + strconv.Itoa(i)
+	}
+
+	for k, v := range last {
+		if _, ok := undeleteSkip[k]; !ok {
+			b.DB.Set(newUUID, k, v)
+		}
+	}
+
+	return newUUID, nil
+}
+
+// IsTrashEntry checks to see if the name is an entry in the trash
+func IsTrashEntry(name string) bool {
+	return strings.HasPrefix(name, trashPrefix)
+}
@@ -0,0 +1,207 @@
+package blobformat
+
+import (
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestTrash(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("test")
+	must(t, err)
+	must(t, b.MoveToTrash(uuid))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if name := blob.Name(); name != "trash/test" {
+		t.Error("name was wrong:", name)
+	}
+	if trashed, err := blob.Trashed(); err != nil || trashed.IsZero() {
+		t.Error("trashed was not set:", trashed, err)
+	}
+
+	results, err := b.Search("")
+	must(t, err)
+	if len(results) != 0 {
+		t.Error("trashed entries should not be found:", results)
+	}
+	results, err = b.Search("trash/")
+	must(t, err)
+	if len(results) != 1 {
+		t.Error("trashed entries should be found with trash/:", results)
+	}
+	results, err = b.Trash()
+	must(t, err)
+	if results[uuid] != "trash/test" {
+		t.Error("entry should be in the trash:", results)
+	}
+
+	// A second entry with the same name gets a unique name in the trash
+	uuid2, err := b.New("test")
+	must(t, err)
+	must(t, b.MoveToTrash(uuid2))
+	blob, err = b.MustFind(uuid2)
+	must(t, err)
+	if name := blob.Name(); name != "trash/test1" {
+		t.Error("name was wrong:", name)
+	}
+
+	must(t, b.Restore(uuid))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if name := blob.Name(); name != "test" {
+		t.Error("name was wrong:", name)
+	}
+	if _, ok := blob[KeyTrashed]; ok {
+		t.Error("trashed key should be removed")
+	}
+
+	if err = b.Restore(uuid2); err != ErrNameNotUnique {
+		t.Error("expected name not unique, got:", err)
+	}
+	if err = b.Restore(uuid); err != ErrNotFound {
+		t.Error("expected not found, got:", err)
+	}
+}
+
+func TestEmptyTrash(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	old, err := b.New("old")
+	must(t, err)
+	recent, err := b.New("recent")
+	must(t, err)
+	must(t, b.MoveToTrash(old))
+	must(t, b.MoveToTrash(recent))
+
+	longAgo := strconv.FormatInt(time.Now().AddDate(0, -2, 0).UnixNano(), 10)
+	b.DB.Set(old, KeyTrashed, longAgo)
+
+	deleted, err := b.EmptyTrash(time.Now().AddDate(0, -1, 0))
+	must(t, err)
+	if len(deleted) != 1 || deleted[0] != "trash/old" {
+		t.Error("wrong entries deleted:", deleted)
+	}
+
+	results, err := b.Trash()
+	must(t, err)
+	if len(results) != 1 || results[recent] != "trash/recent" {
+		t.Error("recent entry should still be in the trash:", results)
+	}
+}
+
+func TestTrashHidden(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	kept, err := b.New("gitlab")
+	must(t, err)
+	trashed, err := b.New("github")
+	must(t, err)
+	for _, uuid := range []string{kept, trashed} {
+		must(t, b.AddLabel(uuid, "work"))
+		must(t, b.SetFavorite(uuid, true))
+		must(t, b.Set(uuid, KeyPass, "secret"))
+	}
+	must(t, b.MoveToTrash(trashed))
+
+	want := SearchResults{kept: "gitlab"}
+	check := func(what string, got SearchResults, err error) {
+		t.Helper()
+		must(t, err)
+		if len(got) != len(want) || got[kept] != "gitlab" {
+			t.Errorf("%s should not have trashed entries: %v", what, got)
+		}
+	}
+
+	got, err := b.SearchLabels("work")
+	check("SearchLabels", got, err)
+	got, err = b.FindByLabel("work")
+	check("FindByLabel", got, err)
+	got, err = b.Favorites()
+	check("Favorites", got, err)
+
+	got, err = b.SamePassword(kept)
+	must(t, err)
+	if len(got) != 0 {
+		t.Error("SamePassword should not have trashed entries:", got)
+	}
+}
+
+func TestUndelete(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("test")
+	must(t, err)
+	must(t, b.Set(uuid, KeyPass, "secret"))
+	must(t, b.MoveToTrash(uuid))
+	must(t, b.Delete(uuid))
+
+	if _, err = b.Undelete("nope"); err != ErrNotFound {
+		t.Error("expected not found, got:", err)
+	}
+
+	deleted := b.DeletedEntries()
+	if len(deleted) != 1 || deleted[0].UUID != uuid || deleted[0].Name != "test" || deleted[0].Deleted.IsZero() {
+		t.Fatal("deleted entries were wrong:", deleted)
+	}
+
+	// Something else took the name in the meantime
+	_, err = b.New("test")
+	must(t, err)
+
+	newUUID, err := b.Undelete(uuid)
+	must(t, err)
+	blob, err := b.MustFind(newUUID)
+	must(t, err)
+	if blob.Name() != "test1" || blob[KeyPass] != "secret" {
+		t.Error("entry was not brought back:", blob)
+	}
+	for _, k := range []string{KeyDeleted, KeyTrashed, KeyTrashedName} {
+		if _, ok := blob[k]; ok {
+			t.Error("key should not have been brought back:", k)
+		}
+	}
+}
+
+func TestSearchScoped(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	active, err := b.New("github")
+	must(t, err)
+	trashed, err := b.New("gitlab")
+	must(t, err)
+	must(t, b.MoveToTrash(trashed))
+
+	tests := []struct {
+		Search string
+		Scope  Scope
+		Want   []string
+	}{
+		{"git", ScopeActive, []string{active}},
+		{"git", ScopeTrash, []string{trashed}},
+		{"git", ScopeAll, []string{active, trashed}},
+		{"", ScopeTrash, []string{trashed}},
+		{"", ScopeAll, []string{active, trashed}},
+	}
+
+	for i, test := range tests {
+		results, err := b.SearchScoped(test.Search, test.Scope)
+		must(t, err)
+		if len(results) != len(test.Want) {
+			t.Errorf("%d) wrong results: %v", i, results)
+			continue
+		}
+		for _, uuid := range test.Want {
+			if _, ok := results[uuid]; !ok {
+				t.Errorf("%d) missing %s: %v", i, uuid, results)
+			}
+		}
+	}
+}
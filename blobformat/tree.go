@@ -0,0 +1,157 @@
+package blobformat
+
+import (
+	"errors"
+	"sort"
+	"strings"
+)
+
+// ErrDirNotAllowed is returned when trying to move a protected directory
+// (users) or moving a directory inside itself.
+var ErrDirNotAllowed = errors.New("directory may not be moved there")
+
+// Dir is a pseudo-directory made from the "/" separated parts of entry names.
+type Dir struct {
+	// Name is the last path component, empty for the root
+	Name string
+	// Path is the full path to the directory, empty for the root
+	Path string
+
+	// Dirs are the sub-directories sorted by name
+	Dirs []*Dir
+	// Entries that are directly inside this directory
+	Entries SearchResults
+}
+
+// Tree builds the directory hierarchy of all entries. Empty path components
+// (a//b or a trailing /) are ignored.
+func (b Blobs) Tree() (*Dir, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	root := &Dir{Entries: make(SearchResults)}
+	dirs := map[string]*Dir{"": root}
+
+	for uuid, entry := range b.DB.Snapshot {
+		name := Blob(entry).Name()
+		parts := splitPath(name)
+
+		parent := root
+		for i := 0; i < len(parts)-1; i++ {
+			path := strings.Join(parts[:i+1], "/")
+			dir, ok := dirs[path]
+			if !ok {
+				dir = &Dir{Name: parts[i], Path: path, Entries: make(SearchResults)}
+				dirs[path] = dir
+				parent.Dirs = append(parent.Dirs, dir)
+			}
+			parent = dir
+		}
+
+		parent.Entries[uuid] = name
+	}
+
+	for _, d := range dirs {
+		sort.Slice(d.Dirs, func(i, j int) bool { return d.Dirs[i].Name < d.Dirs[j].Name })
+	}
+
+	return root, nil
+}
+
+// ListDir returns the names of the sub-directories (sorted) and the entries
+// directly inside the directory at prefix. If the directory does not exist
+// both are empty.
+func (b Blobs) ListDir(prefix string) (dirs []string, entries SearchResults, err error) {
+	root, err := b.Tree()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	dir := root
+	for _, part := range splitPath(prefix) {
+		var next *Dir
+		for _, d := range dir.Dirs {
+			if d.Name == part {
+				next = d
+				break
+			}
+		}
+
+		if next == nil {
+			return nil, nil, nil
+		}
+		dir = next
+	}
+
+	for _, d := range dir.Dirs {
+		dirs = append(dirs, d.Name)
+	}
+
+	return dirs, dir.Entries, nil
+}
+
+// MoveDir renames every entry under oldPrefix to be under newPrefix instead.
+// Entries keep their uuids so their history is kept. If any of the new names
+// would collide with an existing entry nothing is moved and ErrNameNotUnique
+// is returned. Returns a map of old name to new name.
+func (b Blobs) MoveDir(oldPrefix, newPrefix string) (map[string]string, error) {
+	oldPrefix = strings.Join(splitPath(oldPrefix), "/")
+	newPrefix = strings.Join(splitPath(newPrefix), "/")
+
+	if len(oldPrefix) == 0 || len(newPrefix) == 0 ||
+		IsUserEntry(oldPrefix+"/") || IsUserEntry(newPrefix+"/") ||
+		newPrefix == oldPrefix || strings.HasPrefix(newPrefix+"/", oldPrefix+"/") {
+		return nil, ErrDirNotAllowed
+	}
+
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	names := make(map[string]struct{})
+	moves := make(map[string]string)
+	renames := make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		name := Blob(entry).Name()
+		names[name] = struct{}{}
+
+		if !strings.HasPrefix(name, oldPrefix+"/") {
+			continue
+		}
+
+		if err := b.checkProtected(uuid); err != nil {
+			return nil, err
+		}
+
+		newName := newPrefix + strings.TrimPrefix(name, oldPrefix)
+		moves[uuid] = newName
+		renames[name] = newName
+	}
+
+	for _, newName := range moves {
+		if _, ok := names[newName]; ok {
+			return nil, ErrNameNotUnique
+		}
+	}
+
+	for uuid, newName := range moves {
+		b.touchUpdated(uuid)
+		b.DB.Set(uuid, KeyName, newName)
+	}
+
+	return renames, nil
+}
+
+// splitPath splits a name on / and removes empty components
+func splitPath(name string) []string {
+	parts := strings.Split(name, "/")
+	n := 0
+	for _, p := range parts {
+		if len(p) != 0 {
+			parts[n] = p
+			n++
+		}
+	}
+	return parts[:n]
+}
@@ -0,0 +1,82 @@
+package blobformat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTree(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	for _, name := range []string{"top", "work/github", "work/aws/prod", "work/aws/dev", "home/wifi"} {
+		_, err := b.New(name)
+		must(t, err)
+	}
+
+	root, err := b.Tree()
+	must(t, err)
+	if len(root.Entries) != 1 || len(root.Dirs) != 2 {
+		t.Fatal("root was wrong:", root.Entries, len(root.Dirs))
+	}
+	if root.Dirs[0].Name != "home" || root.Dirs[1].Name != "work" {
+		t.Error("dirs should be sorted:", root.Dirs[0].Name, root.Dirs[1].Name)
+	}
+	if aws := root.Dirs[1].Dirs[0]; aws.Path != "work/aws" || len(aws.Entries) != 2 {
+		t.Error("aws dir was wrong:", aws.Path, aws.Entries)
+	}
+
+	dirs, entries, err := b.ListDir("/work/")
+	must(t, err)
+	if !reflect.DeepEqual(dirs, []string{"aws"}) {
+		t.Error("dirs were wrong:", dirs)
+	}
+	if names := entries.Names(); len(names) != 1 || names[0] != "work/github" {
+		t.Error("entries were wrong:", names)
+	}
+
+	dirs, entries, err = b.ListDir("nope")
+	must(t, err)
+	if len(dirs) != 0 || len(entries) != 0 {
+		t.Error("should be empty:", dirs, entries)
+	}
+}
+
+func TestMoveDir(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	prod, err := b.New("work/aws/prod")
+	must(t, err)
+	_, err = b.New("work/aws/dev")
+	must(t, err)
+	_, err = b.New("old/aws/dev")
+	must(t, err)
+	must(t, b.Set(prod, KeyUser, "me"))
+
+	if _, err = b.MoveDir("work", "old"); err != ErrNameNotUnique {
+		t.Error("expected name not unique:", err)
+	}
+	if _, err = b.MoveDir("work", "work/sub"); err != ErrDirNotAllowed {
+		t.Error("expected dir not allowed:", err)
+	}
+	if _, err = b.MoveDir("user", "people"); err != ErrDirNotAllowed {
+		t.Error("expected dir not allowed:", err)
+	}
+
+	versions := b.NVersions(prod)
+	renames, err := b.MoveDir("work/", "job")
+	must(t, err)
+	if len(renames) != 2 || renames["work/aws/prod"] != "job/aws/prod" {
+		t.Error("renames were wrong:", renames)
+	}
+
+	blob, err := b.MustFind(prod)
+	must(t, err)
+	if blob.Name() != "job/aws/prod" || blob.Get(KeyUser) != "me" {
+		t.Error("entry was wrong:", blob)
+	}
+	if b.NVersions(prod) <= versions {
+		t.Error("history should have been kept and added to")
+	}
+}
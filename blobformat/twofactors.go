@@ -0,0 +1,156 @@
+package blobformat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ErrTwoFactorNotFound is returned when an entry has no two factor key with
+// the label asked for
+var ErrTwoFactorNotFound = errors.New("two factor key not found")
+
+// TwoFactors returns the uris of the entry's extra two factor keys by their
+// label (see SetTwofactorNamed). They're stored as json in the totps key.
+func (b Blob) TwoFactors() (map[string]string, error) {
+	twoFactorsVal := b[KeyTwoFactors]
+	if len(twoFactorsVal) == 0 {
+		return nil, nil
+	}
+
+	var twoFactors map[string]string
+	if err := json.Unmarshal([]byte(twoFactorsVal), &twoFactors); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", KeyTwoFactors, err)
+	}
+
+	return twoFactors, nil
+}
+
+// TwoFactorLabels returns the labels of the entry's extra two factor keys in
+// sorted order
+func (b Blob) TwoFactorLabels() ([]string, error) {
+	twoFactors, err := b.TwoFactors()
+	if err != nil {
+		return nil, err
+	}
+
+	labels := make([]string, 0, len(twoFactors))
+	for label := range twoFactors {
+		labels = append(labels, label)
+	}
+	sort.Strings(labels)
+	return labels, nil
+}
+
+// TwoFactorNamed is TwoFactor for the two factor key with label, an empty
+// label is the entry's main key. ErrTwoFactorNotFound is returned if there's
+// no key with the label.
+func (b Blob) TwoFactorNamed(label string) (string, error) {
+	twoFactorURI, err := b.twoFactorURI(label)
+	if err != nil {
+		return "", err
+	}
+	return b.twoFactorAt(twoFactorURI, time.Now())
+}
+
+// TwoFactorNamedWithExpiry is TwoFactorNamed but also returns how long the
+// code is valid for, see TwoFactorWithExpiry.
+func (b Blob) TwoFactorNamedWithExpiry(label string) (code string, remaining time.Duration, err error) {
+	twoFactorURI, err := b.twoFactorURI(label)
+	if err != nil {
+		return "", 0, err
+	}
+	return b.twoFactorWithExpiry(twoFactorURI)
+}
+
+// twoFactorURI returns the uri of the two factor key with label
+func (b Blob) twoFactorURI(label string) (string, error) {
+	if len(label) == 0 {
+		return b[KeyTwoFactor], nil
+	}
+
+	twoFactors, err := b.TwoFactors()
+	if err != nil {
+		return "", err
+	}
+	uri, ok := twoFactors[label]
+	if !ok {
+		return "", ErrTwoFactorNotFound
+	}
+	return uri, nil
+}
+
+// SetTwofactorNamed sets a two factor key under a label, for sites that want
+// more than one (an admin and a personal login on the same entry for
+// example). It takes the same values as SetTwofactor, an empty label sets the
+// entry's main key and an empty value removes the key with the label.
+func (b Blobs) SetTwofactorNamed(uuid, label, uriOrKey string) error {
+	label = strings.TrimSpace(label)
+	if len(label) == 0 {
+		return b.SetTwofactor(uuid, uriOrKey)
+	}
+	if err := b.checkProtected(uuid); err != nil {
+		return err
+	}
+
+	if len(uriOrKey) == 0 {
+		return b.setTwoFactorURI(uuid, label, "")
+	}
+
+	uri, err := twoFactorURIFromKey(uuid, uriOrKey)
+	if err != nil {
+		return err
+	}
+	return b.setTwoFactorURI(uuid, label, uri)
+}
+
+// setTwoFactorURI saves the uri of the two factor key with label, an empty uri
+// deletes a labelled key. Old values are redacted from the history since
+// they're secret.
+func (b Blobs) setTwoFactorURI(uuid, label, uri string) error {
+	if len(label) == 0 {
+		if changed, err := b.setKey(uuid, KeyTwoFactor, uri); err != nil || !changed {
+			return err
+		}
+		return b.redactHistory(uuid, KeyTwoFactor)
+	}
+
+	blob, err := b.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	twoFactors, err := blob.TwoFactors()
+	if err != nil {
+		return err
+	}
+
+	if len(uri) == 0 {
+		if _, ok := twoFactors[label]; !ok {
+			return ErrTwoFactorNotFound
+		}
+		delete(twoFactors, label)
+	} else {
+		if twoFactors == nil {
+			twoFactors = make(map[string]string)
+		}
+		twoFactors[label] = uri
+	}
+
+	if len(twoFactors) == 0 {
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeyTwoFactors)
+		return b.redactHistory(uuid, KeyTwoFactors)
+	}
+
+	twoFactorsJSON, err := json.Marshal(twoFactors)
+	if err != nil {
+		return err
+	}
+	if changed, err := b.setKey(uuid, KeyTwoFactors, string(twoFactorsJSON)); err != nil || !changed {
+		return err
+	}
+	return b.redactHistory(uuid, KeyTwoFactors)
+}
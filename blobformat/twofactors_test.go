@@ -0,0 +1,72 @@
+package blobformat
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestTwoFactorNamed(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("test")
+	must(t, err)
+
+	must(t, b.SetTwofactor(uuid, "JBSWY3DPEHPK3PXP"))
+	must(t, b.SetTwofactorNamed(uuid, "admin", "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"))
+	must(t, b.SetTwofactorNamed(uuid, "backup", "otpauth://hotp/test?secret=GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ&counter=1"))
+	if err = b.SetTwofactorNamed(uuid, "bad", "otpauth://totp/test?secret=JBSWY3DPEHPK3PXP&digits=0"); err == nil {
+		t.Error("expected an error for a bad uri")
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	labels, err := blob.TwoFactorLabels()
+	must(t, err)
+	if want := []string{"admin", "backup"}; !reflect.DeepEqual(labels, want) {
+		t.Error("labels were wrong:", labels)
+	}
+
+	main, err := blob.TwoFactorNamed("")
+	must(t, err)
+	if code, err := blob.TwoFactor(); err != nil || code != main {
+		t.Error("empty label should be the main key:", code, main, err)
+	}
+	if code, err := blob.TwoFactorNamed("admin"); err != nil || len(code) != 6 {
+		t.Error("expected an admin code:", code, err)
+	}
+	if _, err = blob.TwoFactorNamed("nope"); err != ErrTwoFactorNotFound {
+		t.Error("expected not found:", err)
+	}
+	if _, err = blob.TwoFactorNamed("backup"); err != ErrHOTP {
+		t.Error("expected hotp error:", err)
+	}
+
+	// RFC 4226 test vector for counter 1
+	code, err := b.NextTwoFactorNamed(uuid, "backup")
+	must(t, err)
+	if code != "287082" {
+		t.Error("hotp code was wrong:", code)
+	}
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	twoFactors, err := blob.TwoFactors()
+	must(t, err)
+	if counter, err := blob.hotpCounter(twoFactors["backup"]); err != nil || counter != 2 {
+		t.Error("counter was not moved along:", counter, err)
+	}
+
+	must(t, b.SetTwofactorNamed(uuid, "admin", ""))
+	must(t, b.SetTwofactorNamed(uuid, "backup", ""))
+	if err = b.SetTwofactorNamed(uuid, "backup", ""); err != ErrTwoFactorNotFound {
+		t.Error("expected not found:", err)
+	}
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if _, ok := blob[KeyTwoFactors]; ok {
+		t.Error("key should be gone with no labels left")
+	}
+	if len(blob[KeyTwoFactor]) == 0 {
+		t.Error("main key should be left alone")
+	}
+}
@@ -0,0 +1,196 @@
+package blobformat
+
+import (
+	"errors"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+var (
+	// ErrNothingToUndo is returned by Undo when there are no steps left
+	ErrNothingToUndo = errors.New("nothing to undo")
+	// ErrNothingToRedo is returned by Redo when there are no steps left
+	ErrNothingToRedo = errors.New("nothing to redo")
+)
+
+// Undo keeps the inverse of the changes made during a session so they can be
+// undone (and redone) before the file is saved without going through
+// snapshots. Changes are grouped into steps by Record, usually one step per
+// command. Undoing writes the inverse changes to the log like any other
+// change so nothing is lost from the history.
+//
+// Steps that delete an entry can't be reversed, recording one clears the
+// stacks since earlier steps may refer to the entry. This also means undoing
+// the creation of an entry (which deletes it) can't be redone.
+//
+// The stacks only live in memory, previous values are kept in them even if
+// the key's history is redacted.
+type Undo struct {
+	undo []undoStep
+	redo []undoStep
+	// gen changes on Clear so steps that were being recorded when the log was
+	// replaced are dropped
+	gen int
+}
+
+type undoStep struct {
+	name string
+	ops  []txlogs.Tx
+}
+
+// Record runs fn and records the changes it made as a step called name.
+// Recording a step clears the redo stack. The step is recorded even if fn
+// returns an error, whatever it changed before failing is still changed.
+func (u *Undo) Record(b Blobs, name string, fn func() error) error {
+	before, err := copyEntries(b)
+	if err != nil {
+		return err
+	}
+
+	gen, mark := u.gen, len(b.DB.Log)
+	fnErr := fn()
+	if u.gen != gen || len(b.DB.Log) < mark {
+		// The log was replaced under us
+		u.Clear()
+		return fnErr
+	}
+
+	ops, ok := inverseTxs(before, b.DB.Log[mark:])
+	switch {
+	case !ok:
+		u.Clear()
+	case len(ops) != 0:
+		u.undo = append(u.undo, undoStep{name: name, ops: ops})
+		u.redo = nil
+	}
+
+	return fnErr
+}
+
+// Undo reverses the last recorded step and returns its name
+func (u *Undo) Undo(b Blobs) (name string, err error) {
+	return u.move(b, &u.undo, &u.redo, ErrNothingToUndo)
+}
+
+// Redo reapplies the last undone step and returns its name
+func (u *Undo) Redo(b Blobs) (name string, err error) {
+	return u.move(b, &u.redo, &u.undo, ErrNothingToRedo)
+}
+
+// CanUndo returns the name of the step Undo would reverse, if there is one
+func (u *Undo) CanUndo() (name string, ok bool) {
+	if len(u.undo) == 0 {
+		return "", false
+	}
+	return u.undo[len(u.undo)-1].name, true
+}
+
+// CanRedo returns the name of the step Redo would reapply, if there is one
+func (u *Undo) CanRedo() (name string, ok bool) {
+	if len(u.redo) == 0 {
+		return "", false
+	}
+	return u.redo[len(u.redo)-1].name, true
+}
+
+// Clear forgets every step, it must be called when the log is replaced (by a
+// merge for example) since the steps may no longer apply.
+func (u *Undo) Clear() {
+	u.undo = nil
+	u.redo = nil
+	u.gen++
+}
+
+// move applies the last step of from and pushes its inverse onto to
+func (u *Undo) move(b Blobs, from, to *[]undoStep, empty error) (string, error) {
+	if len(*from) == 0 {
+		return "", empty
+	}
+	step := (*from)[len(*from)-1]
+
+	if err := b.UpdateSnapshot(); err != nil {
+		return "", err
+	}
+	for _, op := range step.ops {
+		if _, ok := b.DB.Snapshot[op.UUID]; !ok {
+			// Something other than this session deleted it
+			*from = (*from)[:len(*from)-1]
+			return "", ErrNotFound
+		}
+	}
+
+	before, err := copyEntries(b)
+	if err != nil {
+		return "", err
+	}
+
+	mark := len(b.DB.Log)
+	for _, op := range step.ops {
+		switch op.Kind {
+		case txlogs.TxSetKey:
+			b.DB.Set(op.UUID, op.Key, op.Value)
+		case txlogs.TxDeleteKey:
+			b.DB.DeleteKey(op.UUID, op.Key)
+		case txlogs.TxDelete:
+			b.DB.Delete(op.UUID)
+		}
+	}
+
+	*from = (*from)[:len(*from)-1]
+	if ops, ok := inverseTxs(before, b.DB.Log[mark:]); ok && len(ops) != 0 {
+		*to = append(*to, undoStep{name: step.name, ops: ops})
+	}
+
+	return step.name, nil
+}
+
+// inverseTxs returns the changes that put the entries back to how they were
+// in before after txs were applied to them. ok is false if txs can't be
+// reversed.
+func inverseTxs(before map[string]Blob, txs []txlogs.Tx) (ops []txlogs.Tx, ok bool) {
+	added := make(map[string]bool)
+	seen := make(map[string]map[string]bool)
+	for _, tx := range txs {
+		switch tx.Kind {
+		case txlogs.TxAdd:
+			added[tx.UUID] = true
+			ops = append(ops, txlogs.Tx{Kind: txlogs.TxDelete, UUID: tx.UUID})
+		case txlogs.TxDelete:
+			return nil, false
+		case txlogs.TxSetKey, txlogs.TxDeleteKey:
+			if added[tx.UUID] || seen[tx.UUID][tx.Key] {
+				continue
+			}
+			if seen[tx.UUID] == nil {
+				seen[tx.UUID] = make(map[string]bool)
+			}
+			seen[tx.UUID][tx.Key] = true
+
+			op := txlogs.Tx{UUID: tx.UUID, Key: tx.Key, Kind: txlogs.TxDeleteKey}
+			if old, ok := before[tx.UUID][tx.Key]; ok {
+				op.Kind, op.Value = txlogs.TxSetKey, old
+			}
+			ops = append(ops, op)
+		}
+	}
+
+	return ops, true
+}
+
+// copyEntries returns a copy of every entry as it is now
+func copyEntries(b Blobs) (map[string]Blob, error) {
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries := make(map[string]Blob, len(b.DB.Snapshot))
+	for uuid, entry := range b.DB.Snapshot {
+		blob := make(Blob, len(entry))
+		for k, v := range entry {
+			blob[k] = v
+		}
+		entries[uuid] = blob
+	}
+
+	return entries, nil
+}
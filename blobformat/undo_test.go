@@ -0,0 +1,108 @@
+package blobformat
+
+import "testing"
+
+func TestUndo(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+	must(t, b.Set(uuid, KeyPass, "first"))
+
+	var u Undo
+	if _, err = u.Undo(b); err != ErrNothingToUndo {
+		t.Error("expected nothing to undo, got:", err)
+	}
+
+	must(t, u.Record(b, "set pass", func() error {
+		if err := b.Set(uuid, KeyPass, "second"); err != nil {
+			return err
+		}
+		return b.AddNote(uuid, "changed it")
+	}))
+	must(t, u.Record(b, "rmk pass", func() error {
+		return b.DeleteKey(uuid, KeyPass)
+	}))
+	// Steps that change nothing aren't recorded
+	must(t, u.Record(b, "ls", func() error { return nil }))
+
+	if name, ok := u.CanUndo(); !ok || name != "rmk pass" {
+		t.Error("wrong step to undo:", name)
+	}
+
+	name, err := u.Undo(b)
+	must(t, err)
+	if name != "rmk pass" {
+		t.Error("wrong step undone:", name)
+	}
+	name, err = u.Undo(b)
+	must(t, err)
+	if name != "set pass" {
+		t.Error("wrong step undone:", name)
+	}
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyPass] != "first" || len(blob.Notes()) != 0 {
+		t.Error("changes were not undone:", blob)
+	}
+
+	_, err = u.Redo(b)
+	must(t, err)
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if blob[KeyPass] != "second" || len(blob.Notes()) != 1 {
+		t.Error("changes were not redone:", blob)
+	}
+
+	// A new step drops what could be redone
+	must(t, u.Record(b, "set user", func() error {
+		return b.Set(uuid, KeyUser, "bob")
+	}))
+	if _, ok := u.CanRedo(); ok {
+		t.Error("redo should have been cleared")
+	}
+
+	// Undoing an add deletes the entry and can't be redone
+	var two string
+	must(t, u.Record(b, "add two", func() (err error) {
+		two, err = b.New("two")
+		return err
+	}))
+	_, err = u.Undo(b)
+	must(t, err)
+	if found, err := b.Find(two); err != nil || found != nil {
+		t.Error("entry should be gone:", found, err)
+	}
+	if _, ok := u.CanRedo(); ok {
+		t.Error("deleting an entry can't be redone")
+	}
+
+	// Deleting an entry clears everything
+	must(t, u.Record(b, "rm one", func() error {
+		b.DB.Delete(uuid)
+		return nil
+	}))
+	if _, ok := u.CanUndo(); ok {
+		t.Error("undo should have been cleared")
+	}
+}
+
+func TestUndoClear(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("one")
+	must(t, err)
+
+	var u Undo
+	must(t, u.Record(b, "sync", func() error {
+		must(t, b.Set(uuid, KeyPass, "merged"))
+		u.Clear()
+		return nil
+	}))
+	if _, ok := u.CanUndo(); ok {
+		t.Error("changes made while the log was replaced should not be recorded")
+	}
+}
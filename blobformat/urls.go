@@ -0,0 +1,279 @@
+package blobformat
+
+import (
+	"errors"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/publicsuffix"
+)
+
+var (
+	// ErrInvalidURL is returned when a url has no host to match against
+	ErrInvalidURL = errors.New("url has no host")
+)
+
+// URLs returns all the urls for the entry, the url key comes first followed
+// by each line of the urls key. Blank lines and duplicates are omitted.
+func (b Blob) URLs() []string {
+	var urls []string
+	seen := make(map[string]struct{})
+
+	add := func(u string) {
+		u = strings.TrimSpace(u)
+		if len(u) == 0 {
+			return
+		}
+		if _, ok := seen[u]; ok {
+			return
+		}
+		seen[u] = struct{}{}
+		urls = append(urls, u)
+	}
+
+	add(b[KeyURL])
+	for _, u := range strings.Split(b[KeyURLs], "\n") {
+		add(u)
+	}
+
+	return urls
+}
+
+// AddURL appends a url to the urls key of the entry. If the entry has no url
+// key set it's set there instead. Adding a url the entry already has does
+// nothing.
+func (b Blobs) AddURL(uuid, rawURL string) error {
+	rawURL = strings.TrimSpace(rawURL)
+	if _, err := urlHost(rawURL); err != nil {
+		return err
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	for _, u := range blob.URLs() {
+		if u == rawURL {
+			return nil
+		}
+	}
+
+	if len(blob[KeyURL]) == 0 {
+		return b.Set(uuid, KeyURL, rawURL)
+	}
+
+	urlsVal := blob[KeyURLs]
+	if len(urlsVal) == 0 {
+		urlsVal = rawURL
+	} else {
+		urlsVal = strings.TrimRight(urlsVal, "\n") + "\n" + rawURL
+	}
+
+	return b.Set(uuid, KeyURLs, urlsVal)
+}
+
+// FindByURL returns all entries that have a url belonging to the same site as
+// rawURL. Sites are compared by their registrable domain (eTLD+1) so
+// https://login.example.co.uk/path matches an entry with example.co.uk in it.
+// IP addresses and single label hosts (localhost) must match exactly.
+//
+// Sync, user and trashed entries are never returned.
+func (b Blobs) FindByURL(rawURL string) (entries SearchResults, err error) {
+	host, err := urlHost(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	want := RegistrableDomain(host)
+
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	entries = make(map[string]string)
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		name := blob.Name()
+		if IsUserEntry(name) || IsSyncEntry(name) || IsTrashEntry(name) {
+			continue
+		}
+
+		for _, u := range blob.URLs() {
+			h, err := urlHost(u)
+			if err != nil {
+				continue
+			}
+
+			if RegistrableDomain(h) == want {
+				entries[uuid] = name
+				break
+			}
+		}
+	}
+
+	return entries, nil
+}
+
+// DomainMatchKind is how well an entry matched a host
+type DomainMatchKind int
+
+// Kinds of DomainMatch, best first
+const (
+	// MatchExact entries have a url with the same host
+	MatchExact DomainMatchKind = iota
+	// MatchSubdomain entries have a url for a parent domain of the host,
+	// example.com for login.example.com
+	MatchSubdomain
+	// MatchSite entries have a url on the same registrable domain, see
+	// RegistrableDomain
+	MatchSite
+)
+
+// DomainMatch is an entry found by MatchDomain
+type DomainMatch struct {
+	UUID string
+	Name string
+	Kind DomainMatchKind
+}
+
+// NeverMatch returns the hosts the entry must never be matched to by
+// MatchDomain, one per line of the nevermatch key. A * means it's never
+// matched to any host.
+func (b Blob) NeverMatch() []string {
+	var hosts []string
+	for _, line := range strings.Split(b[KeyNeverMatch], "\n") {
+		if line = strings.TrimSpace(line); len(line) == 0 {
+			continue
+		}
+		if line != "*" {
+			if host, err := urlHost(line); err == nil {
+				line = normalizeHost(host)
+			}
+		}
+		hosts = append(hosts, line)
+	}
+	return hosts
+}
+
+// MatchDomain finds the entries to offer when filling in a login form on host
+// (a url works too), best match first. An entry matches with the best of its
+// urls (see URLs): the same host, a parent domain of the host or the same
+// site. Ties are sorted by name.
+//
+// Entries that list the host or one of its parent domains in their
+// nevermatch key are left out, as are users, sync entries, templates, saved
+// searches and the trash.
+func (b Blobs) MatchDomain(host string) ([]DomainMatch, error) {
+	host, err := urlHost(host)
+	if err != nil {
+		return nil, err
+	}
+	host = normalizeHost(host)
+	site := RegistrableDomain(host)
+
+	if err := b.UpdateSnapshot(); err != nil {
+		return nil, err
+	}
+
+	var matches []DomainMatch
+Entries:
+	for uuid, entry := range b.DB.Snapshot {
+		blob := Blob(entry)
+		if !reportEntry(blob) {
+			continue
+		}
+
+		for _, never := range blob.NeverMatch() {
+			if never == "*" || inDomain(host, never) {
+				continue Entries
+			}
+		}
+
+		best := DomainMatchKind(-1)
+		for _, u := range blob.URLs() {
+			h, err := urlHost(u)
+			if err != nil {
+				continue
+			}
+			h = normalizeHost(h)
+
+			kind := DomainMatchKind(-1)
+			switch {
+			case h == host:
+				kind = MatchExact
+			case inDomain(host, h):
+				kind = MatchSubdomain
+			case RegistrableDomain(h) == site:
+				kind = MatchSite
+			}
+			if kind >= 0 && (best < 0 || kind < best) {
+				best = kind
+			}
+		}
+
+		if best >= 0 {
+			matches = append(matches, DomainMatch{UUID: uuid, Name: blob.Name(), Kind: best})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Kind != matches[j].Kind {
+			return matches[i].Kind < matches[j].Kind
+		}
+		return matches[i].Name < matches[j].Name
+	})
+
+	return matches, nil
+}
+
+// inDomain checks if host is domain or one of its subdomains
+func inDomain(host, domain string) bool {
+	return host == domain || strings.HasSuffix(host, "."+domain)
+}
+
+// normalizeHost lowercases a host and removes a trailing dot
+func normalizeHost(host string) string {
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// RegistrableDomain returns the eTLD+1 of a hostname using the public suffix
+// list, eg. www.example.co.uk returns example.co.uk. IP addresses and hosts
+// that are nothing but a public suffix are returned as is.
+func RegistrableDomain(host string) string {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if net.ParseIP(host) != nil {
+		return host
+	}
+
+	domain, err := publicsuffix.EffectiveTLDPlusOne(host)
+	if err != nil {
+		return host
+	}
+	return domain
+}
+
+// urlHost returns the hostname of a url, urls without a scheme
+// (example.com/login) are treated as https.
+func urlHost(rawURL string) (string, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	host := u.Hostname()
+	if len(host) == 0 {
+		return "", ErrInvalidURL
+	}
+
+	return host, nil
+}
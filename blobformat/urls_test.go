@@ -0,0 +1,141 @@
+package blobformat
+
+import (
+	"testing"
+)
+
+func TestRegistrableDomain(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		In   string
+		Want string
+	}{
+		{"example.com", "example.com"},
+		{"www.Example.com.", "example.com"},
+		{"a.b.example.com", "example.com"},
+		{"login.example.co.uk", "example.co.uk"},
+		{"login.example.co.at", "example.co.at"},
+		{"www.example.kyoto.jp", "example.kyoto.jp"},
+		{"co.uk", "co.uk"},
+		{"me.github.io", "me.github.io"},
+		{"localhost", "localhost"},
+		{"127.0.0.1", "127.0.0.1"},
+		{"::1", "::1"},
+	}
+
+	for i, test := range tests {
+		if got := RegistrableDomain(test.In); got != test.Want {
+			t.Errorf("%d) %s: want: %s, got: %s", i, test.In, test.Want, got)
+		}
+	}
+}
+
+func TestFindByURL(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	one, err := b.New("one")
+	must(t, err)
+	two, err := b.New("two")
+	must(t, err)
+	sync, err := b.NewSync("scp")
+	must(t, err)
+
+	must(t, b.AddURL(one, "https://example.com/login"))
+	must(t, b.AddURL(one, "https://accounts.example.co.uk"))
+	must(t, b.AddURL(one, "https://accounts.example.co.uk"))
+	must(t, b.AddURL(two, "other.com"))
+	must(t, b.Set(sync, KeyURL, "scp://example.com/file"))
+
+	blob, err := b.MustFind(one)
+	must(t, err)
+	if urls := blob.URLs(); len(urls) != 2 || urls[0] != "https://example.com/login" {
+		t.Error("urls were wrong:", urls)
+	}
+	if blob[KeyURLs] != "https://accounts.example.co.uk" {
+		t.Error("second url should have gone into the list:", blob[KeyURLs])
+	}
+
+	results, err := b.FindByURL("https://www.example.com/")
+	must(t, err)
+	if len(results) != 1 || results[one] != "one" {
+		t.Error("wrong results:", results)
+	}
+
+	results, err = b.FindByURL("http://example.co.uk")
+	must(t, err)
+	if len(results) != 1 || results[one] != "one" {
+		t.Error("wrong results:", results)
+	}
+
+	results, err = b.FindByURL("https://co.uk")
+	must(t, err)
+	if len(results) != 0 {
+		t.Error("wrong results:", results)
+	}
+
+	if _, err = b.FindByURL("https://"); err != ErrInvalidURL {
+		t.Error("expected invalid url error:", err)
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	urls := map[string][]string{
+		"exact":  {"https://login.example.com"},
+		"parent": {"other.com", "example.com"},
+		"site":   {"https://mail.example.com/inbox"},
+		"never":  {"example.com"},
+		"other":  {"example.org"},
+	}
+	for name, list := range urls {
+		uuid, err := b.New(name)
+		must(t, err)
+		for _, u := range list {
+			must(t, b.AddURL(uuid, u))
+		}
+		if name == "never" {
+			must(t, b.Set(uuid, KeyNeverMatch, "\nlogin.EXAMPLE.com\n"))
+		}
+	}
+
+	matches, err := b.MatchDomain("https://Login.Example.com./form")
+	must(t, err)
+	want := []DomainMatch{
+		{Name: "exact", Kind: MatchExact},
+		{Name: "parent", Kind: MatchSubdomain},
+		{Name: "site", Kind: MatchSite},
+	}
+	if len(matches) != len(want) {
+		t.Fatal("wrong matches:", matches)
+	}
+	for i, w := range want {
+		if matches[i].Name != w.Name || matches[i].Kind != w.Kind {
+			t.Errorf("%d) want: %v, got: %v", i, w, matches[i])
+		}
+	}
+
+	// nevermatch only applies to the host and its subdomains
+	matches, err = b.MatchDomain("www.example.com")
+	must(t, err)
+	if len(matches) != 4 {
+		t.Error("wrong matches:", matches)
+	}
+
+	matches, err = b.MatchDomain("example.org")
+	must(t, err)
+	if len(matches) != 1 {
+		t.Fatal("wrong matches:", matches)
+	}
+	must(t, b.Set(matches[0].UUID, KeyNeverMatch, "*"))
+	if matches, err = b.MatchDomain("example.org"); err != nil || len(matches) != 0 {
+		t.Error("* should never match:", matches, err)
+	}
+
+	if _, err = b.MatchDomain(""); err != ErrInvalidURL {
+		t.Error("expected invalid url:", err)
+	}
+}
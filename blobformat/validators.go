@@ -0,0 +1,114 @@
+package blobformat
+
+import (
+	"fmt"
+	"net"
+	"net/mail"
+	"strconv"
+	"strings"
+)
+
+// Validator checks a change to an entry before it's made, returning an error
+// stops the change. name is the name of the entry (the new name when it's
+// being created or renamed, in which case key is KeyName).
+type Validator func(name, key, value string) error
+
+// ValidationError is returned by the validators in this package
+type ValidationError struct {
+	Name string
+	Key  string
+	Msg  string
+}
+
+// Error implements error
+func (v ValidationError) Error() string {
+	return fmt.Sprintf("%s: %s %s", v.Name, v.Key, v.Msg)
+}
+
+// NotEmpty is a validator that does not allow key to be empty (or deleted)
+func NotEmpty(key string) Validator {
+	return func(name, k, value string) error {
+		if k == key && len(strings.TrimSpace(value)) == 0 {
+			return ValidationError{Name: name, Key: key, Msg: "must not be empty"}
+		}
+		return nil
+	}
+}
+
+// IsEmail is a validator that requires key to be an email address
+func IsEmail(key string) Validator {
+	return func(name, k, value string) error {
+		if k != key {
+			return nil
+		}
+
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Address != value {
+			return ValidationError{Name: name, Key: key, Msg: "must be an email address"}
+		}
+		return nil
+	}
+}
+
+// IsIP is a validator that requires key to be an IPv4 or IPv6 address
+func IsIP(key string) Validator {
+	return func(name, k, value string) error {
+		if k == key && net.ParseIP(value) == nil {
+			return ValidationError{Name: name, Key: key, Msg: "must be an ip address"}
+		}
+		return nil
+	}
+}
+
+// IsPort is a validator that requires key to be a port number (1-65535)
+func IsPort(key string) Validator {
+	return func(name, k, value string) error {
+		if k != key {
+			return nil
+		}
+
+		if port, err := strconv.Atoi(value); err != nil || port < 1 || port > 65535 {
+			return ValidationError{Name: name, Key: key, Msg: "must be a port number"}
+		}
+		return nil
+	}
+}
+
+// InFolder only runs v for entries in the pseudo-folder prefix (work/ etc.)
+func InFolder(prefix string, v Validator) Validator {
+	prefix = strings.TrimSuffix(prefix, "/") + "/"
+	return func(name, key, value string) error {
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		return v(name, key, value)
+	}
+}
+
+// validate runs all the validators, stopping at the first error
+func (b Blobs) validate(name, key, value string) error {
+	for _, v := range b.Validators {
+		if err := v(name, key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// validateEntry runs the validators for a change to an existing entry
+func (b Blobs) validateEntry(uuid, key, value string) error {
+	if len(b.Validators) == 0 {
+		return nil
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+
+	return b.validate(blob.Name(), key, value)
+}
@@ -0,0 +1,79 @@
+package blobformat
+
+import "testing"
+
+func TestValidators(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	b.Validators = []Validator{
+		NotEmpty(KeyPass),
+		InFolder("work", IsEmail(KeyUser)),
+	}
+
+	home, err := b.New("home/site")
+	must(t, err)
+	work, err := b.New("work/site")
+	must(t, err)
+
+	if err = b.Set(home, KeyPass, ""); err == nil {
+		t.Error("empty password should not be allowed")
+	}
+	must(t, b.Set(home, KeyPass, "hunter2"))
+	if err = b.DeleteKey(home, KeyPass); err == nil {
+		t.Error("password should not be deletable")
+	}
+
+	must(t, b.Set(home, KeyUser, "someone"))
+	if err = b.Set(work, KeyUser, "someone"); err == nil {
+		t.Error("user must be an email in work/")
+	} else if _, ok := err.(ValidationError); !ok {
+		t.Errorf("wrong error type: %T", err)
+	}
+	must(t, b.Set(work, KeyUser, "someone@example.com"))
+
+	// Moving an entry into work/ is checked against the name it will have
+	b.Validators = append(b.Validators, func(name, key, value string) error {
+		if key == KeyName && name == "work/nope" {
+			return ValidationError{Name: name, Key: key, Msg: "is not allowed"}
+		}
+		return nil
+	})
+	if err = b.Rename(home, "work/nope"); err == nil {
+		t.Error("rename should have been stopped")
+	}
+	if _, err = b.New("work/nope"); err == nil {
+		t.Error("new should have been stopped")
+	}
+
+	blob, err := b.MustFind(home)
+	must(t, err)
+	if blob.Name() != "home/site" || blob[KeyPass] != "hunter2" {
+		t.Error("entry should be unchanged:", blob)
+	}
+}
+
+func TestInfraValidators(t *testing.T) {
+	t.Parallel()
+
+	ip, port := IsIP(KeyIP), IsPort(KeyPort)
+	for _, v := range []string{"10.0.0.1", "::1"} {
+		if err := ip("db", KeyIP, v); err != nil {
+			t.Error(v, err)
+		}
+	}
+	for _, v := range []string{"", "10.0.0", "db.example.com"} {
+		if err := ip("db", KeyIP, v); err == nil {
+			t.Errorf("%q should not be an ip", v)
+		}
+	}
+
+	if err := port("db", KeyPort, "5432"); err != nil {
+		t.Error(err)
+	}
+	for _, v := range []string{"0", "65536", "ssh"} {
+		if err := port("db", KeyPort, v); err == nil {
+			t.Errorf("%q should not be a port", v)
+		}
+	}
+}
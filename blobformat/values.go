@@ -0,0 +1,137 @@
+package blobformat
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// Types of values for FieldMeta, values are always stored as strings but
+// keys with a type are checked to hold that type and Value converts them
+// back to it.
+const (
+	TypeString = ""
+	TypeNumber = "number"
+	TypeBool   = "bool"
+)
+
+// ErrWrongType is returned when a value doesn't match the type of its key
+var ErrWrongType = errors.New("value does not match the type of the key")
+
+// Value returns the value of the key as its type: a string, an int64 or
+// float64 for numbers, or a bool. nil is returned if the key is not set.
+func (b Blob) Value(key string) (interface{}, error) {
+	val, ok := b[key]
+	if !ok {
+		return nil, nil
+	}
+
+	meta, err := b.FieldMeta(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseValue(meta.Type, val)
+}
+
+// SetValue sets a key to a string, number (any int, uint or float kind) or
+// bool. The type is recorded in the field metadata so Value gives back the
+// same type and later changes to the key must be of that type as well.
+func (b Blobs) SetValue(uuid, key string, value interface{}) error {
+	var typ, val string
+	switch v := value.(type) {
+	case string:
+		typ, val = TypeString, v
+	case bool:
+		typ, val = TypeBool, strconv.FormatBool(v)
+	case int:
+		typ, val = TypeNumber, strconv.FormatInt(int64(v), 10)
+	case int8:
+		typ, val = TypeNumber, strconv.FormatInt(int64(v), 10)
+	case int16:
+		typ, val = TypeNumber, strconv.FormatInt(int64(v), 10)
+	case int32:
+		typ, val = TypeNumber, strconv.FormatInt(int64(v), 10)
+	case int64:
+		typ, val = TypeNumber, strconv.FormatInt(v, 10)
+	case uint:
+		typ, val = TypeNumber, strconv.FormatUint(uint64(v), 10)
+	case uint8:
+		typ, val = TypeNumber, strconv.FormatUint(uint64(v), 10)
+	case uint16:
+		typ, val = TypeNumber, strconv.FormatUint(uint64(v), 10)
+	case uint32:
+		typ, val = TypeNumber, strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		typ, val = TypeNumber, strconv.FormatUint(v, 10)
+	case float32:
+		typ, val = TypeNumber, strconv.FormatFloat(float64(v), 'g', -1, 32)
+	case float64:
+		typ, val = TypeNumber, strconv.FormatFloat(v, 'g', -1, 64)
+	default:
+		return fmt.Errorf("unsupported value type %T", value)
+	}
+
+	blob, err := b.Find(uuid)
+	if err != nil {
+		return err
+	}
+	if blob == nil {
+		return ErrNotFound
+	}
+	meta, err := blob.FieldMeta(key)
+	if err != nil {
+		return err
+	}
+
+	// The value may not fit the key's current type, it's replaced below
+	if err = b.set(uuid, key, val); err != nil {
+		return err
+	}
+	if meta.Type == typ {
+		return nil
+	}
+
+	meta.Type = typ
+	return b.SetFieldMeta(uuid, key, meta)
+}
+
+// checkType returns ErrWrongType if the value doesn't fit the type the key
+// has in the entry
+func (b Blobs) checkType(uuid, key, value string) error {
+	blob, err := b.Find(uuid)
+	if err != nil || blob == nil {
+		return err
+	}
+	meta, err := blob.FieldMeta(key)
+	if err != nil {
+		return err
+	}
+
+	_, err = parseValue(meta.Type, value)
+	return err
+}
+
+func parseValue(typ, val string) (interface{}, error) {
+	switch typ {
+	case TypeString:
+		return val, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not a bool", ErrWrongType, val)
+		}
+		return b, nil
+	case TypeNumber:
+		if i, err := strconv.ParseInt(val, 10, 64); err == nil {
+			return i, nil
+		}
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q is not a number", ErrWrongType, val)
+		}
+		return f, nil
+	default:
+		return nil, fmt.Errorf("unknown type %q", typ)
+	}
+}
@@ -0,0 +1,59 @@
+package blobformat
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestValues(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("db")
+	must(t, err)
+
+	must(t, b.SetValue(uuid, "port", 5432))
+	must(t, b.SetValue(uuid, "mfa", true))
+	must(t, b.SetValue(uuid, "ratio", 0.5))
+	must(t, b.SetValue(uuid, "host", "localhost"))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	tests := []struct {
+		Key  string
+		Want interface{}
+	}{
+		{"port", int64(5432)},
+		{"mfa", true},
+		{"ratio", 0.5},
+		{"host", "localhost"},
+		{"missing", nil},
+	}
+	for _, test := range tests {
+		got, err := blob.Value(test.Key)
+		must(t, err)
+		if got != test.Want {
+			t.Errorf("%s: want: %#v got: %#v", test.Key, test.Want, got)
+		}
+	}
+
+	if err = b.Set(uuid, "port", "abc"); !errors.Is(err, ErrWrongType) {
+		t.Error("expected wrong type:", err)
+	}
+	must(t, b.Set(uuid, "port", "5433"))
+	if err = b.SetFieldMeta(uuid, "host", FieldMeta{Type: TypeNumber}); !errors.Is(err, ErrWrongType) {
+		t.Error("expected wrong type:", err)
+	}
+
+	// Changing the type with a new value is fine
+	must(t, b.SetValue(uuid, "port", "default"))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if got, err := blob.Value("port"); err != nil || got != "default" {
+		t.Error("port should be a string now:", got, err)
+	}
+
+	if err = b.SetValue(uuid, "port", []string{"a"}); err == nil {
+		t.Error("expected an error for an unsupported type")
+	}
+}
@@ -0,0 +1,214 @@
+package blobformat
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Window is a time of day range on certain days of the week where an entry may
+// be revealed. End may be before Start for windows that cross midnight, in
+// which case the window belongs to the day it starts on.
+type Window struct {
+	// Days the window starts on, all days if empty
+	Days []time.Weekday
+	// Start and End are durations since midnight (local time)
+	Start time.Duration
+	End   time.Duration
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// ParseWindows parses a comma separated list of windows in the form:
+// [day[-day]] hh:mm-hh:mm, eg: "mon-fri 09:00-17:00, sat 22:00-02:00"
+func ParseWindows(s string) ([]Window, error) {
+	var windows []Window
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+
+		w, err := parseWindow(part)
+		if err != nil {
+			return nil, fmt.Errorf("invalid window %q: %w", part, err)
+		}
+		windows = append(windows, w)
+	}
+
+	if len(windows) == 0 {
+		return nil, fmt.Errorf("no windows given")
+	}
+
+	return windows, nil
+}
+
+func parseWindow(s string) (w Window, err error) {
+	fields := strings.Fields(s)
+	switch len(fields) {
+	case 1:
+	case 2:
+		w.Days, err = parseDays(fields[0])
+		if err != nil {
+			return w, err
+		}
+		fields = fields[1:]
+	default:
+		return w, fmt.Errorf("expected [days] hh:mm-hh:mm")
+	}
+
+	times := strings.Split(fields[0], "-")
+	if len(times) != 2 {
+		return w, fmt.Errorf("expected a time range like 09:00-17:00")
+	}
+	if w.Start, err = parseClock(times[0]); err != nil {
+		return w, err
+	}
+	if w.End, err = parseClock(times[1]); err != nil {
+		return w, err
+	}
+	if w.Start == w.End {
+		return w, fmt.Errorf("window is empty")
+	}
+
+	return w, nil
+}
+
+func parseDays(s string) ([]time.Weekday, error) {
+	s = strings.ToLower(s)
+	rng := strings.Split(s, "-")
+	if len(rng) > 2 {
+		return nil, fmt.Errorf("bad day range %q", s)
+	}
+
+	start, ok := weekdays[rng[0]]
+	if !ok {
+		return nil, fmt.Errorf("unknown day %q", rng[0])
+	}
+	if len(rng) == 1 {
+		return []time.Weekday{start}, nil
+	}
+
+	end, ok := weekdays[rng[1]]
+	if !ok {
+		return nil, fmt.Errorf("unknown day %q", rng[1])
+	}
+
+	var days []time.Weekday
+	for d := start; ; d = (d + 1) % 7 {
+		days = append(days, d)
+		if d == end {
+			break
+		}
+	}
+	return days, nil
+}
+
+func parseClock(s string) (time.Duration, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("bad time %q, expected hh:mm", s)
+	}
+
+	h, err := strconv.Atoi(parts[0])
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("bad hour in %q", s)
+	}
+	m, err := strconv.Atoi(parts[1])
+	if err != nil || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("bad minute in %q", s)
+	}
+
+	return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+}
+
+// Contains checks if t (in its own location) is inside the window
+func (w Window) Contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	since := t.Sub(midnight)
+
+	if w.Start < w.End {
+		return w.hasDay(t.Weekday()) && since >= w.Start && since < w.End
+	}
+
+	// Crosses midnight, either we're in the late part of the starting day
+	// or the early part of the day after
+	if since >= w.Start && w.hasDay(t.Weekday()) {
+		return true
+	}
+	yesterday := (t.Weekday() + 6) % 7
+	return since < w.End && w.hasDay(yesterday)
+}
+
+func (w Window) hasDay(d time.Weekday) bool {
+	if len(w.Days) == 0 {
+		return true
+	}
+	for _, day := range w.Days {
+		if day == d {
+			return true
+		}
+	}
+	return false
+}
+
+// Windows returns the access windows of the entry, nil if it has none.
+func (b Blob) Windows() ([]Window, error) {
+	windowVal := b[KeyWindow]
+	if len(windowVal) == 0 {
+		return nil, nil
+	}
+
+	return ParseWindows(windowVal)
+}
+
+// InWindow returns true if the entry has no access windows or if now is
+// inside one of them.
+func (b Blob) InWindow(now time.Time) (bool, error) {
+	windows, err := b.Windows()
+	if err != nil || len(windows) == 0 {
+		return true, err
+	}
+
+	for _, w := range windows {
+		if w.Contains(now) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// SetWindows validates and sets the access windows for an entry (see
+// ParseWindows for the format). An empty string removes them.
+func (b Blobs) SetWindows(uuid, windows string) error {
+	if len(strings.TrimSpace(windows)) == 0 {
+		b.touchUpdated(uuid)
+		b.DB.DeleteKey(uuid, KeyWindow)
+		return nil
+	}
+
+	if _, err := ParseWindows(windows); err != nil {
+		return err
+	}
+
+	b.touchUpdated(uuid)
+	b.DB.Set(uuid, KeyWindow, windows)
+	return nil
+}
+
+// RecordOverride records that who revealed the entry outside of its access
+// windows and why. Each override is kept in the entry's history.
+func (b Blobs) RecordOverride(uuid, who, reason string) {
+	b.DB.Set(uuid, KeyWindowOverride, fmt.Sprintf("%s %s: %s",
+		time.Now().Format(time.RFC3339), who, reason))
+}
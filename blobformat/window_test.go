@@ -0,0 +1,84 @@
+package blobformat
+
+import (
+	"testing"
+	"time"
+)
+
+func TestWindows(t *testing.T) {
+	t.Parallel()
+
+	windows, err := ParseWindows("mon-fri 09:00-17:00, sat 22:00-02:00")
+	must(t, err)
+	if len(windows) != 2 || len(windows[0].Days) != 5 {
+		t.Fatal("windows were wrong:", windows)
+	}
+
+	// 2020-06-01 is a monday
+	at := func(day, hour, min int) time.Time {
+		return time.Date(2020, 6, day, hour, min, 0, 0, time.UTC)
+	}
+
+	tests := []struct {
+		Time time.Time
+		In   bool
+	}{
+		{at(1, 9, 0), true},
+		{at(1, 16, 59), true},
+		{at(1, 17, 0), false},
+		{at(1, 8, 59), false},
+		{at(6, 12, 0), false},
+		{at(6, 23, 0), true},
+		{at(7, 1, 0), true},
+		{at(7, 2, 0), false},
+		{at(1, 1, 0), false},
+	}
+
+	for i, test := range tests {
+		in := false
+		for _, w := range windows {
+			in = in || w.Contains(test.Time)
+		}
+		if in != test.In {
+			t.Errorf("%d) %s: want: %t, got: %t", i, test.Time, test.In, in)
+		}
+	}
+
+	bad := []string{"", "09:00", "mon 09:00-09:00", "funday 09:00-10:00", "25:00-26:00", "mon tue 09:00-10:00"}
+	for _, b := range bad {
+		if _, err := ParseWindows(b); err == nil {
+			t.Errorf("%q should not parse", b)
+		}
+	}
+}
+
+func TestInWindow(t *testing.T) {
+	t.Parallel()
+
+	b := newTestBlobs()
+	uuid, err := b.New("prod")
+	must(t, err)
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if in, err := blob.InWindow(time.Now()); err != nil || !in {
+		t.Error("entries without windows are always in window", err)
+	}
+
+	if err = b.SetWindows(uuid, "nope"); err == nil {
+		t.Error("expected an error")
+	}
+	if err = b.Set(uuid, KeyWindow, "09:00-10:00"); !IsKeyNotAllowed(err) {
+		t.Error("window should not be settable directly:", err)
+	}
+
+	must(t, b.SetWindows(uuid, "09:00-10:00"))
+	blob, err = b.MustFind(uuid)
+	must(t, err)
+	if in, _ := blob.InWindow(time.Date(2020, 1, 1, 9, 30, 0, 0, time.Local)); !in {
+		t.Error("should be in window")
+	}
+	if in, _ := blob.InWindow(time.Date(2020, 1, 1, 11, 0, 0, 0, time.Local)); in {
+		t.Error("should not be in window")
+	}
+}
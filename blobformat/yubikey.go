@@ -0,0 +1,47 @@
+package blobformat
+
+import (
+	"errors"
+	"strings"
+)
+
+// yubiKeyPrefix marks a two factor key that lives on a YubiKey, it's followed
+// by the name of the OATH account on the device
+const yubiKeyPrefix = "yubikey:"
+
+var (
+	// ErrNoYubiKey is returned for two factor keys on a YubiKey when there's
+	// no YubiKeyCode to generate codes with
+	ErrNoYubiKey = errors.New("two factor key is on a yubikey and yubikeys are not supported here")
+	// ErrYubiKeySecret is returned when the secret of a two factor key is
+	// needed but it's on a YubiKey where it can't be read back
+	ErrYubiKeySecret = errors.New("two factor key is on a yubikey, its secret can't be read")
+)
+
+// YubiKeyCode generates a code for the OATH account with the given name on a
+// YubiKey, TwoFactor calls it for two factor keys set as yubikey:<account>
+// (see SetTwofactor) so the secret is never in the file. Talking to the device
+// needs tools outside of this package so it's nil (and ErrNoYubiKey is
+// returned) unless the program using it sets it.
+var YubiKeyCode func(account string) (string, error)
+
+// YubiKeyAccount returns the name of the OATH account on a YubiKey the two
+// factor key is kept in, ok is false if it's not kept on one.
+func (b Blob) YubiKeyAccount() (account string, ok bool) {
+	return yubiKeyAccount(b[KeyTwoFactor])
+}
+
+func yubiKeyAccount(twoFactorURI string) (account string, ok bool) {
+	if !strings.HasPrefix(twoFactorURI, yubiKeyPrefix) {
+		return "", false
+	}
+	return strings.TrimPrefix(twoFactorURI, yubiKeyPrefix), true
+}
+
+// yubiKeyCode asks the YubiKey for a code for account
+func yubiKeyCode(account string) (string, error) {
+	if YubiKeyCode == nil {
+		return "", ErrNoYubiKey
+	}
+	return YubiKeyCode(account)
+}
@@ -0,0 +1,41 @@
+package blobformat
+
+import "testing"
+
+// Not parallel since YubiKeyCode is global
+func TestYubiKey(t *testing.T) {
+	b := newTestBlobs()
+	uuid, err := b.New("test")
+	must(t, err)
+
+	if err = b.SetTwofactor(uuid, "yubikey:"); err == nil {
+		t.Error("expected an error for an empty account")
+	}
+	must(t, b.SetTwofactor(uuid, "yubikey:GitHub:me"))
+
+	blob, err := b.MustFind(uuid)
+	must(t, err)
+	if account, ok := blob.YubiKeyAccount(); !ok || account != "GitHub:me" {
+		t.Error("account was wrong:", account, ok)
+	}
+	if _, err = blob.TwoFactor(); err != ErrNoYubiKey {
+		t.Error("expected no yubikey error, got:", err)
+	}
+	if _, err = blob.TwoFactorQR(); err != ErrYubiKeySecret {
+		t.Error("expected secret error, got:", err)
+	}
+
+	YubiKeyCode = func(account string) (string, error) {
+		if account != "GitHub:me" {
+			t.Error("account was wrong:", account)
+		}
+		return "123456", nil
+	}
+	defer func() { YubiKeyCode = nil }()
+
+	code, remaining, err := blob.TwoFactorWithExpiry()
+	must(t, err)
+	if code != "123456" || remaining <= 0 {
+		t.Error("code was wrong:", code, remaining)
+	}
+}
@@ -0,0 +1,116 @@
+// bpass-server stores encrypted bpass files for teams, see the syncserver
+// package for details. Add it to bpass with: addsync https
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/aarondl/bpass/syncserver"
+	"github.com/integrii/flaggy"
+)
+
+var (
+	flagAddr    = ":8443"
+	flagDir     = "vaults"
+	flagTokens  = "tokens"
+	flagKeep    = 20
+	flagTLSCert string
+	flagTLSKey  string
+
+	flagMetricsAddr string
+
+	flagTeam string
+)
+
+func main() {
+	parser := flaggy.NewParser("bpass-server")
+	parser.Description = "store encrypted bpass files for teams"
+	parser.String(&flagAddr, "a", "addr", "Address to listen on")
+	parser.String(&flagDir, "d", "dir", "Directory to store files in")
+	parser.String(&flagTokens, "", "tokens", "File of tokens (<team> <hash> per line)")
+	parser.Int(&flagKeep, "", "keep", "Versions of each file to keep")
+	parser.String(&flagTLSCert, "", "tls-cert", "TLS certificate file")
+	parser.String(&flagTLSKey, "", "tls-key", "TLS key file")
+	parser.String(&flagMetricsAddr, "", "metrics-addr", "Serve prometheus metrics on /metrics at this address (off by default)")
+
+	tokenCmd := flaggy.NewSubcommand("token")
+	tokenCmd.Description = "create a token for a team and add it to the tokens file"
+	tokenCmd.AddPositionalValue(&flagTeam, "team", 1, true, "The team the token is for")
+	parser.AttachSubcommand(tokenCmd, 1)
+	parser.Parse()
+
+	if tokenCmd.Used {
+		if err := newToken(flagTeam); err != nil {
+			fmt.Println("failed to create token:", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	tokens, err := syncserver.LoadTokens(flagTokens)
+	if err != nil {
+		fmt.Println("failed to load tokens:", err)
+		os.Exit(1)
+	}
+	if err = os.MkdirAll(flagDir, 0700); err != nil {
+		fmt.Println("failed to create directory:", err)
+		os.Exit(1)
+	}
+
+	srv := syncserver.New(flagDir, flagKeep, tokens)
+
+	// Metrics are served on their own address so they can be kept off the
+	// public internet
+	if len(flagMetricsAddr) != 0 {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", srv.MetricsHandler())
+		go func() {
+			fmt.Println("metrics:", http.ListenAndServe(flagMetricsAddr, mux))
+			os.Exit(1)
+		}()
+	}
+
+	fmt.Printf("listening on %s, %d tokens loaded\n", flagAddr, len(tokens))
+	if len(flagTLSCert) != 0 {
+		err = http.ListenAndServeTLS(flagAddr, flagTLSCert, flagTLSKey, srv)
+	} else {
+		fmt.Println("WARNING: serving without TLS, tokens are sent in the clear")
+		err = http.ListenAndServe(flagAddr, srv)
+	}
+
+	fmt.Println(err)
+	os.Exit(1)
+}
+
+// newToken generates a token, prints it and appends its hash to the tokens
+// file. The token itself is never stored.
+func newToken(team string) error {
+	if !syncserver.ValidName(team) {
+		return fmt.Errorf("team names may only contain letters, numbers, ., _ and -")
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+	token := hex.EncodeToString(b)
+
+	f, err := os.OpenFile(flagTokens, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err = fmt.Fprintf(f, "%s %s\n", team, syncserver.HashToken(token)); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Println(token)
+	return nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"crypto/sha256"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/crypt"
+)
+
+// historyKey returns the key the history is chained with. It has to be the
+// same for every copy of the file so multi-user files use the master key,
+// single-user files the key derived from the passphrase.
+func historyKey(key, master []byte) []byte {
+	if len(master) != 0 {
+		key = master
+	}
+
+	sum := sha256.Sum256(append([]byte("bpass-history-key"), key...))
+	return sum[:]
+}
+
+// paramsHistoryKey returns the history key for a file opened with params
+func paramsHistoryKey(params crypt.Params) []byte {
+	return historyKey(params.Keys[params.User], params.Master)
+}
+
+// setHistoryKey chains the history with the current key, if the key has
+// changed since it was last set (the passphrase was changed for example) the
+// history is rechained with the new one.
+func (u *uiContext) setHistoryKey() {
+	u.store.DB.SetChainKey(historyKey(u.key, u.master))
+}
+
+// checkHistory warns about entries in store whose history was changed outside
+// of bpass
+func checkHistory(name string, store blobformat.Blobs) error {
+	broken, err := store.VerifyHistory()
+	if err != nil || len(broken) == 0 {
+		return err
+	}
+	if err = store.UpdateSnapshot(); err != nil {
+		return err
+	}
+
+	errColor.Printf("WARNING: the history of %d entries in %s was changed outside of bpass:\n", len(broken), name)
+	for _, uuid := range broken {
+		if entry, ok := store.Snapshot[uuid]; ok {
+			errColor.Printf("  %s\n", blobformat.Blob(entry).Name())
+		} else {
+			errColor.Printf("  %s (deleted)\n", uuid)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,68 @@
+// Package chunkstore keeps many versions of a file in a directory using
+// content-defined chunking so that the parts the versions share are only
+// stored once. Chunks and manifests are encrypted.
+package chunkstore
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+)
+
+const (
+	// MinChunk is the smallest chunk that will be cut (except for the last)
+	MinChunk = 2 * 1024
+	// MaxChunk is the largest chunk that will be cut
+	MaxChunk = 64 * 1024
+
+	// chunkMask decides the average chunk size, a boundary is found when the
+	// masked bits of the hash are all zero, on average once every 8KiB.
+	chunkMask = (1 << 13) - 1
+)
+
+// gear is the table of random values for the gear hash. It's generated from
+// a fixed seed so that boundaries are the same on every machine.
+var gear [256]uint64
+
+func init() {
+	for i := range gear {
+		sum := sha256.Sum256([]byte{'b', 'p', 'a', 's', 's', byte(i)})
+		gear[i] = binary.LittleEndian.Uint64(sum[:8])
+	}
+}
+
+// Split data into chunks at content-defined boundaries. Inserting or removing
+// bytes only changes the chunks around the change, the rest of the chunks
+// stay the same. The returned chunks are slices of data.
+func Split(data []byte) [][]byte {
+	var chunks [][]byte
+
+	for len(data) != 0 {
+		n := cut(data)
+		chunks = append(chunks, data[:n])
+		data = data[n:]
+	}
+
+	return chunks
+}
+
+// cut returns the length of the first chunk in data using a gear hash
+func cut(data []byte) int {
+	if len(data) <= MinChunk {
+		return len(data)
+	}
+
+	max := len(data)
+	if max > MaxChunk {
+		max = MaxChunk
+	}
+
+	var hash uint64
+	for i := MinChunk; i < max; i++ {
+		hash = (hash << 1) + gear[data[i]]
+		if hash&chunkMask == 0 {
+			return i + 1
+		}
+	}
+
+	return max
+}
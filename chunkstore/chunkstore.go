@@ -0,0 +1,375 @@
+package chunkstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// KeySize is the size of the key a store must be opened with
+const KeySize = 32
+
+const (
+	chunkDir    = "chunks"
+	manifestDir = "manifests"
+)
+
+var (
+	// ErrKeySize is returned when the key is not KeySize bytes
+	ErrKeySize = errors.New("chunkstore key must be 32 bytes")
+	// ErrNotFound is returned when a snapshot does not exist
+	ErrNotFound = errors.New("snapshot not found")
+	// ErrCorrupt is returned when a chunk or manifest fails to decrypt or
+	// doesn't match what it should be
+	ErrCorrupt = errors.New("chunkstore is corrupt")
+)
+
+// Store is a directory of encrypted chunks and the manifests that list which
+// chunks make up each snapshot.
+//
+// Chunks are named by an hmac of their contents so chunk names don't reveal
+// anything about the contents to someone without the key.
+type Store struct {
+	dir   string
+	aead  cipher.AEAD
+	idKey []byte
+}
+
+// Snapshot is a single version of the data in the store
+type Snapshot struct {
+	ID   string    `json:"-"`
+	Time time.Time `json:"time"`
+	Size int       `json:"size"`
+	// Chunks are the ids of the chunks in order
+	Chunks []string `json:"chunks"`
+}
+
+// Open a store in dir, it's created if it does not exist. The key is used to
+// derive the encryption key and the key used to name the chunks.
+func Open(dir string, key []byte) (*Store, error) {
+	if len(key) != KeySize {
+		return nil, ErrKeySize
+	}
+
+	for _, d := range []string{chunkDir, manifestDir} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0700); err != nil {
+			return nil, err
+		}
+	}
+
+	block, err := aes.NewCipher(deriveKey(key, "encrypt"))
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Store{
+		dir:   dir,
+		aead:  aead,
+		idKey: deriveKey(key, "chunkid"),
+	}, nil
+}
+
+// Put stores data as a new snapshot. Only chunks that aren't already in the
+// store are written, the number of them is returned along with the snapshot.
+func (s *Store) Put(data []byte) (snap Snapshot, written int, err error) {
+	snap.Time = time.Now()
+	snap.Size = len(data)
+
+	for _, chunk := range Split(data) {
+		id := s.chunkID(chunk)
+		snap.Chunks = append(snap.Chunks, id)
+
+		filename := filepath.Join(s.dir, chunkDir, id)
+		if _, err := os.Stat(filename); err == nil {
+			continue
+		} else if !os.IsNotExist(err) {
+			return snap, written, err
+		}
+
+		if err = s.writeFile(filename, chunk); err != nil {
+			return snap, written, err
+		}
+		written++
+	}
+
+	manifest, err := json.Marshal(snap)
+	if err != nil {
+		return snap, written, err
+	}
+
+	snap.ID = strconv.FormatInt(snap.Time.UnixNano(), 10)
+	err = s.writeFile(filepath.Join(s.dir, manifestDir, snap.ID), manifest)
+	return snap, written, err
+}
+
+// Get the data of a snapshot
+func (s *Store) Get(id string) ([]byte, error) {
+	snap, err := s.snapshot(id)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]byte, 0, snap.Size)
+	for _, chunkID := range snap.Chunks {
+		chunk, err := s.readFile(filepath.Join(s.dir, chunkDir, chunkID))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read chunk %s: %w", chunkID, err)
+		}
+		if s.chunkID(chunk) != chunkID {
+			return nil, ErrCorrupt
+		}
+		data = append(data, chunk...)
+	}
+
+	if len(data) != snap.Size {
+		return nil, ErrCorrupt
+	}
+
+	return data, nil
+}
+
+// List the snapshots in the store oldest first
+func (s *Store) List() ([]Snapshot, error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	snaps := make([]Snapshot, 0, len(ids))
+	for _, id := range ids {
+		snap, err := s.snapshot(id)
+		if err != nil {
+			return nil, err
+		}
+		snaps = append(snaps, snap)
+	}
+
+	return snaps, nil
+}
+
+// Prune deletes all but the newest keep snapshots and then deletes the chunks
+// that no snapshot uses anymore. It returns the number of snapshots and
+// chunks deleted.
+func (s *Store) Prune(keep int) (snapshots, chunks int, err error) {
+	ids, err := s.ids()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if len(ids) > keep {
+		for _, id := range ids[:len(ids)-keep] {
+			if err = os.Remove(filepath.Join(s.dir, manifestDir, id)); err != nil {
+				return snapshots, 0, err
+			}
+			snapshots++
+		}
+	}
+
+	snaps, err := s.List()
+	if err != nil {
+		return snapshots, 0, err
+	}
+
+	used := make(map[string]struct{})
+	for _, snap := range snaps {
+		for _, id := range snap.Chunks {
+			used[id] = struct{}{}
+		}
+	}
+
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, chunkDir))
+	if err != nil {
+		return snapshots, 0, err
+	}
+	for _, f := range files {
+		if _, ok := used[f.Name()]; ok {
+			continue
+		}
+		if err = os.Remove(filepath.Join(s.dir, chunkDir, f.Name())); err != nil {
+			return snapshots, chunks, err
+		}
+		chunks++
+	}
+
+	return snapshots, chunks, nil
+}
+
+// Verify checks that every snapshot's manifest and chunks decrypt and are
+// what they should be without putting the snapshots back together. Each
+// problem found is described, there are none if the store is intact.
+func (s *Store) Verify() (problems []string, err error) {
+	ids, err := s.ids()
+	if err != nil {
+		return nil, err
+	}
+
+	// Chunks are shared between snapshots, each is only read once
+	sizes := make(map[string]int)
+	bad := make(map[string]string)
+	for _, id := range ids {
+		snap, err := s.snapshot(id)
+		if err == ErrCorrupt {
+			problems = append(problems, fmt.Sprintf("snapshot %s: manifest is corrupt", id))
+			continue
+		} else if err != nil {
+			return problems, err
+		}
+
+		size, broken := 0, false
+		for i, chunkID := range snap.Chunks {
+			n, ok := sizes[chunkID]
+			reason, isBad := bad[chunkID]
+			if !ok && !isBad {
+				n, reason, err = s.verifyChunk(chunkID)
+				if err != nil {
+					return problems, err
+				}
+				if isBad = len(reason) != 0; isBad {
+					bad[chunkID] = reason
+				} else {
+					sizes[chunkID] = n
+				}
+			}
+
+			if isBad {
+				problems = append(problems, fmt.Sprintf("snapshot %s: chunk %d (%s) is %s", id, i, chunkID, reason))
+				broken = true
+				continue
+			}
+			size += n
+		}
+
+		if !broken && size != snap.Size {
+			problems = append(problems, fmt.Sprintf("snapshot %s: chunks add up to %d bytes, should be %d", id, size, snap.Size))
+		}
+	}
+
+	return problems, nil
+}
+
+// verifyChunk reads a chunk and checks its id, reason says what's wrong
+// with it if anything
+func (s *Store) verifyChunk(id string) (size int, reason string, err error) {
+	chunk, err := s.readFile(filepath.Join(s.dir, chunkDir, id))
+	switch {
+	case os.IsNotExist(err):
+		return 0, "missing", nil
+	case err == ErrCorrupt:
+		return 0, "corrupt", nil
+	case err != nil:
+		return 0, "", err
+	case s.chunkID(chunk) != id:
+		return 0, "not what it's named", nil
+	}
+
+	return len(chunk), "", nil
+}
+
+// ids returns the ids of the snapshots oldest first
+func (s *Store) ids() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Join(s.dir, manifestDir))
+	if err != nil {
+		return nil, err
+	}
+
+	type idTime struct {
+		id string
+		t  int64
+	}
+	var found []idTime
+	for _, f := range files {
+		t, err := strconv.ParseInt(f.Name(), 10, 64)
+		if err != nil {
+			continue
+		}
+		found = append(found, idTime{id: f.Name(), t: t})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].t < found[j].t })
+
+	ids := make([]string, len(found))
+	for i, f := range found {
+		ids[i] = f.id
+	}
+	return ids, nil
+}
+
+func (s *Store) snapshot(id string) (snap Snapshot, err error) {
+	manifest, err := s.readFile(filepath.Join(s.dir, manifestDir, filepath.Base(id)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return snap, ErrNotFound
+		}
+		return snap, err
+	}
+
+	if err = json.Unmarshal(manifest, &snap); err != nil {
+		return snap, ErrCorrupt
+	}
+	snap.ID = id
+	return snap, nil
+}
+
+func (s *Store) chunkID(chunk []byte) string {
+	mac := hmac.New(sha256.New, s.idKey)
+	_, _ = mac.Write(chunk)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// writeFile encrypts data and writes it to filename, the file's name is used
+// as additional data so files can't be swapped for one another.
+func (s *Store) writeFile(filename string, data []byte) error {
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return err
+	}
+
+	ct := s.aead.Seal(nonce, nonce, data, []byte(filepath.Base(filename)))
+
+	// Write to a temporary file first so a partial write never leaves a
+	// chunk that looks like it's already stored
+	tmp := filename + ".tmp"
+	if err := ioutil.WriteFile(tmp, ct, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filename)
+}
+
+func (s *Store) readFile(filename string) ([]byte, error) {
+	ct, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	n := s.aead.NonceSize()
+	if len(ct) < n {
+		return nil, ErrCorrupt
+	}
+
+	pt, err := s.aead.Open(nil, ct[:n], ct[n:], []byte(filepath.Base(filename)))
+	if err != nil {
+		return nil, ErrCorrupt
+	}
+	return pt, nil
+}
+
+func deriveKey(key []byte, purpose string) []byte {
+	mac := hmac.New(sha256.New, key)
+	_, _ = mac.Write([]byte(purpose))
+	return mac.Sum(nil)
+}
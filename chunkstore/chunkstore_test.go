@@ -0,0 +1,220 @@
+package chunkstore
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testData(n int) []byte {
+	data := make([]byte, n)
+	r := rand.New(rand.NewSource(1))
+	_, _ = r.Read(data)
+	return data
+}
+
+func testStore(t *testing.T) (*Store, func()) {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "chunkstore")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanup := func() { _ = os.RemoveAll(dir) }
+
+	s, err := Open(dir, bytes.Repeat([]byte{1}, KeySize))
+	if err != nil {
+		cleanup()
+		t.Fatal(err)
+	}
+	return s, cleanup
+}
+
+func TestSplit(t *testing.T) {
+	t.Parallel()
+
+	data := testData(512 * 1024)
+	chunks := Split(data)
+	if len(chunks) < 2 {
+		t.Fatal("expected many chunks, got:", len(chunks))
+	}
+
+	if got := bytes.Join(chunks, nil); !bytes.Equal(got, data) {
+		t.Error("chunks did not join back into the data")
+	}
+	for i, c := range chunks {
+		if len(c) > MaxChunk {
+			t.Error("chunk too large", i, len(c))
+		}
+		if i != len(chunks)-1 && len(c) < MinChunk {
+			t.Error("chunk too small", i, len(c))
+		}
+	}
+
+	// Inserting bytes at the start should only change the chunks near it
+	inserted := append([]byte("hello world"), data...)
+	seen := make(map[string]struct{})
+	for _, c := range chunks {
+		seen[string(c)] = struct{}{}
+	}
+	same := 0
+	for _, c := range Split(inserted) {
+		if _, ok := seen[string(c)]; ok {
+			same++
+		}
+	}
+	if same < len(chunks)-2 {
+		t.Errorf("expected most chunks to be unchanged, %d of %d were", same, len(chunks))
+	}
+}
+
+func TestPutGet(t *testing.T) {
+	t.Parallel()
+
+	s, cleanup := testStore(t)
+	defer cleanup()
+	data := testData(256 * 1024)
+
+	first, written, err := s.Put(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written != len(first.Chunks) {
+		t.Error("all chunks should be written the first time", written, len(first.Chunks))
+	}
+
+	changed := append(append([]byte{}, data...), "appended"...)
+	second, written, err := s.Put(changed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if written > 2 {
+		t.Error("expected only the last chunk to be written, wrote:", written)
+	}
+
+	got, err := s.Get(first.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Error("first snapshot was wrong")
+	}
+	got, err = s.Get(second.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, changed) {
+		t.Error("second snapshot was wrong")
+	}
+
+	if _, err = s.Get("1"); err != ErrNotFound {
+		t.Error("expected not found:", err)
+	}
+
+	// A different key can't read the store
+	other, err := Open(s.dir, bytes.Repeat([]byte{2}, KeySize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = other.Get(first.ID); err != ErrCorrupt {
+		t.Error("expected corrupt:", err)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	t.Parallel()
+
+	s, cleanup := testStore(t)
+	defer cleanup()
+	data := testData(128 * 1024)
+
+	var ids []string
+	for i := 0; i < 3; i++ {
+		data = append(testData(4*1024*(i+1)), data...)
+		snap, _, err := s.Put(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, snap.ID)
+	}
+
+	snapshots, chunks, err := s.Prune(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if snapshots != 2 {
+		t.Error("expected two snapshots to be pruned:", snapshots)
+	}
+	if chunks == 0 {
+		t.Error("expected unused chunks to be pruned")
+	}
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(list) != 1 || list[0].ID != ids[2] {
+		t.Error("wrong snapshots left:", list)
+	}
+	if got, err := s.Get(ids[2]); err != nil {
+		t.Error(err)
+	} else if !bytes.Equal(got, data) {
+		t.Error("kept snapshot was wrong")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	t.Parallel()
+
+	s, cleanup := testStore(t)
+	defer cleanup()
+	data := testData(128 * 1024)
+
+	first, _, err := s.Put(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := s.Put(append(testData(4*1024), data...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if problems, err := s.Verify(); err != nil {
+		t.Fatal(err)
+	} else if len(problems) != 0 {
+		t.Error("expected no problems:", problems)
+	}
+
+	// Damage a chunk both snapshots share and remove the manifest of the
+	// second, the damage is reported where it is
+	chunk := filepath.Join(s.dir, chunkDir, first.Chunks[len(first.Chunks)-1])
+	b, err := ioutil.ReadFile(chunk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b[len(b)-1] ^= 1
+	if err = ioutil.WriteFile(chunk, b, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = ioutil.WriteFile(filepath.Join(s.dir, manifestDir, second.ID), []byte("junk"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	problems, err := s.Verify()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Fatal("expected two problems:", problems)
+	}
+	if !strings.Contains(problems[0], first.ID) || !strings.Contains(problems[0], "chunk") {
+		t.Error("expected the damaged chunk:", problems[0])
+	}
+	if !strings.Contains(problems[1], second.ID) || !strings.Contains(problems[1], "manifest") {
+		t.Error("expected the damaged manifest:", problems[1])
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"time"
 
+	"github.com/aarondl/bpass/blobformat"
 	"github.com/integrii/flaggy"
 )
 
@@ -15,19 +16,100 @@ const (
 
 var (
 	historyTime time.Time
+	nameRules   blobformat.NameRules
+	keyCacheTTL time.Duration
 
 	flagHelp        bool
 	flagNoColor     bool
 	flagNoClearClip bool
+	flagStrictClip  bool
+	flagNotify      bool
+	flagTrackAccess bool
+	flagFoldNames   bool
+	flagNameRules   string
 	flagNoAutoSync  bool
 	flagTime        string
 	flagFile        string
+	flagKeyfile     string
+	flagIdentity    string
+	flagCacheKey    string
+	flagStealLock   bool
+	flagVaults      string
+
+	flagEntropyFile string
+	flagDice        bool
+
+	flagMoveEntry string
+	flagMoveTo    string
+
+	flagVerifyFile           string
+	flagVerifyFull           bool
+	flagVerifyPassphraseFile string
+	flagVerifyUser           string
+
+	flagDoctorOffline bool
+
+	flagMigrateDryRun bool
+
+	flagNormalizeDryRun bool
+
+	flagArchiveMonths  int
+	flagHistoryEntry   string
+	flagHistoryArchive bool
+	flagHistoryReveal  bool
+
+	flagRotateEntry string
+
+	flagBackups   int
+	flagCopies    int
+	flagRestoreID string
+	flagRestoreTo string
+
+	flagReportFormat string
+	flagReportOut    string
+	flagReportMaxAge int
+	flagReportVerify string
+
+	flagPurgeEntry string
+
+	flagRekeyKeepPass  bool
+	flagRekeyCalibrate int
+	flagRekeyTime      int
+	flagRekeyMemory    int
+	flagRekeyThreads   int
+
+	flagListFilter        string
+	flagListSaved         string
+	flagListUpdatedAfter  string
+	flagListUpdatedBefore string
+	flagListCreatedAfter  string
+	flagListCreatedBefore string
+	flagListTrash         bool
+	flagListAll           bool
+	flagListOffset        int
+	flagListLimit         int
 )
 
 var (
-	versionCmd     = flaggy.NewSubcommand("version")
-	genCmd         = flaggy.NewSubcommand("gen")
-	lpassImportCmd = flaggy.NewSubcommand("lpassimport")
+	versionCmd       = flaggy.NewSubcommand("version")
+	genCmd           = flaggy.NewSubcommand("gen")
+	lpassImportCmd   = flaggy.NewSubcommand("lpassimport")
+	verifyCmd        = flaggy.NewSubcommand("verify")
+	mvVaultCmd       = flaggy.NewSubcommand("mv-vault")
+	doctorCmd        = flaggy.NewSubcommand("doctor")
+	migrateCmd       = flaggy.NewSubcommand("migrate")
+	normalizeCmd     = flaggy.NewSubcommand("normalize-names")
+	archiveCmd       = flaggy.NewSubcommand("archive")
+	unarchiveCmd     = flaggy.NewSubcommand("unarchive")
+	historyCmd       = flaggy.NewSubcommand("history")
+	rotateCmd        = flaggy.NewSubcommand("rotate")
+	backupsCmd       = flaggy.NewSubcommand("backups")
+	restoreBackupCmd = flaggy.NewSubcommand("restore-backup")
+	reportCmd        = flaggy.NewSubcommand("report")
+	compromiseCmd    = flaggy.NewSubcommand("compromise-response")
+	purgeCmd         = flaggy.NewSubcommand("purge-history")
+	rekeyCmd         = flaggy.NewSubcommand("rekey")
+	listCmd          = flaggy.NewSubcommand("list")
 )
 
 func parseCli() {
@@ -42,15 +124,84 @@ func parseCli() {
 	parser.Bool(&flagNoColor, "", "no-color", "Turn off color output")
 	parser.Bool(&flagNoAutoSync, "", "no-sync", "Do not sync the file automatically")
 	parser.Bool(&flagNoClearClip, "", "no-clear-clip", "Do not clear clipboard on exit")
+	parser.Bool(&flagStrictClip, "", "strict-clip", "Refuse to copy secrets when a clipboard manager would keep them")
+	parser.Bool(&flagNotify, "", "notify", "Show desktop notifications for sync results and clipboard clearing")
+	parser.Bool(&flagTrackAccess, "", "track-access", "Record when passwords and totp codes are read")
+	parser.Bool(&flagFoldNames, "", "fold-names", "Treat entry names that only differ by case or accent encoding as the same")
+	parser.String(&flagNameRules, "", "name-rules", "Normalize new entry names with these rules (lower,dash,nfc)")
+	parser.Int(&flagBackups, "", "backups", "Keep this many backups of the file when it changes (deduplicated)")
+	parser.Int(&flagCopies, "", "copies", "Keep this many timestamped copies of the file from before each save")
 	parser.Bool(&flagHelp, "h", "help", "Show help")
 	parser.String(&flagTime, "t", "time", "Open the file read-only at a time in the past (YYYY-MM-DD HH:mm:ss)")
 	parser.String(&flagFile, "f", "file", "The file to open (can be set by $BPASS)")
+	parser.String(&flagKeyfile, "", "keyfile", "The keyfile needed along with the passphrase (can be set by $BPASS_KEYFILE)")
+	parser.String(&flagIdentity, "", "identity", "Open a multi-user file with an age identity file instead of a user and passphrase")
+	parser.String(&flagVaults, "", "vaults", "Open other files along with this one as name=file,name=file (see help vaults)")
+	parser.Bool(&flagStealLock, "", "steal-lock", "Open the file even if another bpass has it locked")
+	parser.String(&flagCacheKey, "", "cache-key", "Cache the unlocked key in the OS keychain for this long, eg. 15m (can be set by $BPASS_CACHE_KEY)")
 
 	versionCmd.Description = "print version and exit"
 	lpassImportCmd.Description = "import lastpass csv by running `lpass export`"
 	genCmd.Description = "generate a password"
+	genCmd.String(&flagEntropyFile, "", "entropy-file", "Mix entropy from a file or device (eg. /dev/hwrng) into generation")
+	genCmd.Bool(&flagDice, "", "dice", "Prompt for dice rolls to mix into generation")
+	mvVaultCmd.Description = "move an entry and its history to another file"
+	mvVaultCmd.String(&flagMoveTo, "", "to", "The file to move the entry to")
+	mvVaultCmd.AddPositionalValue(&flagMoveEntry, "entry", 1, true, "The entry to move")
+	verifyCmd.Description = "check a file for corruption, exits non-zero on failure"
+	verifyCmd.Bool(&flagVerifyFull, "", "full", "Decrypt and check the integrity and structure of the contents")
+	verifyCmd.String(&flagVerifyPassphraseFile, "", "passphrase-file", "Read the passphrase for --full from a file")
+	verifyCmd.String(&flagVerifyUser, "", "user", "The user to decrypt a multi-user file as for --full")
+	verifyCmd.AddPositionalValue(&flagVerifyFile, "file", 1, true, "The file to verify")
+	doctorCmd.Description = "check the environment for problems that could leak secrets"
+	doctorCmd.Bool(&flagDoctorOffline, "", "offline", "Skip checks that use the network (clock skew)")
+	migrateCmd.Description = "upgrade a file from an older version of bpass (done automatically on open)"
+	migrateCmd.Bool(&flagMigrateDryRun, "", "dry-run", "Report what would change without changing anything")
+	normalizeCmd.Description = "rename existing entries to follow --name-rules"
+	normalizeCmd.Bool(&flagNormalizeDryRun, "", "dry-run", "Report what would be renamed without changing anything")
+	archiveCmd.Description = "move old history out of the file into an encrypted archive file"
+	flagArchiveMonths = 12
+	archiveCmd.Int(&flagArchiveMonths, "", "older-than", "Archive history older than this many months")
+	unarchiveCmd.Description = "move the archived history back into the file"
+	historyCmd.Description = "show what changed in each snapshot of an entry"
+	historyCmd.Bool(&flagHistoryArchive, "", "archive", "Include changes from the archive file")
+	historyCmd.Bool(&flagHistoryReveal, "", "reveal", "Show secret values instead of masking them")
+	historyCmd.AddPositionalValue(&flagHistoryEntry, "entry", 1, true, "The entry to show history for")
+	rotateCmd.Description = "walk through changing the password of an entry"
+	rotateCmd.AddPositionalValue(&flagRotateEntry, "entry", 1, true, "The entry to rotate")
+	backupsCmd.Description = "list the backups kept with --backups"
+	restoreBackupCmd.Description = "write a backup to a new file"
+	restoreBackupCmd.String(&flagRestoreTo, "", "to", "The file to write the backup to")
+	restoreBackupCmd.AddPositionalValue(&flagRestoreID, "backup", 1, true, "The backup to restore (see backups)")
+	reportCmd.Description = "write a signed credential hygiene report (no secrets) for auditors"
+	flagReportFormat = "json"
+	reportCmd.String(&flagReportFormat, "", "format", "The format of the report: json, html or pdf")
+	reportCmd.String(&flagReportOut, "o", "out", "The file to write the report to (defaults to stdout)")
+	flagReportMaxAge = 365
+	reportCmd.Int(&flagReportMaxAge, "", "max-age", "Passwords older than this many days are overdue for rotation")
+	reportCmd.String(&flagReportVerify, "", "verify", "Check the signature of a json report instead of writing one")
+	compromiseCmd.Description = "rekey and rotate everything after the passphrase leaked, run again to continue"
+	purgeCmd.Description = "permanently destroy the previous values of an entry"
+	purgeCmd.AddPositionalValue(&flagPurgeEntry, "entry", 1, true, "The entry to purge the history of")
+	rekeyCmd.Description = "change the passphrase or key cost and rewrite the file, its archive and backup key"
+	rekeyCmd.Bool(&flagRekeyKeepPass, "", "keep-passphrase", "Only change the salt and key cost, not the passphrase")
+	rekeyCmd.Int(&flagRekeyCalibrate, "", "calibrate", "Pick a key cost that takes this many seconds to derive here")
+	rekeyCmd.Int(&flagRekeyTime, "", "time", "Argon2id passes of the key cost (defaults to the current key's)")
+	rekeyCmd.Int(&flagRekeyMemory, "", "memory", "Argon2id memory of the key cost in MiB")
+	rekeyCmd.Int(&flagRekeyThreads, "", "threads", "Argon2id threads of the key cost")
+	listCmd.Description = "list the names of entries"
+	listCmd.String(&flagListFilter, "", "filter", `Only list entries matching a query (eg. 'label:work AND updated<2023-01-01')`)
+	listCmd.String(&flagListSaved, "", "saved", "Only list entries found by a saved search (see savesearch)")
+	listCmd.String(&flagListUpdatedAfter, "", "updated-after", "Only list entries updated after a date or time ago (2006-01-02, 90d, 2w, 6m, 1y)")
+	listCmd.String(&flagListUpdatedBefore, "", "updated-before", "Only list entries last updated before a date or time ago")
+	listCmd.String(&flagListCreatedAfter, "", "created-after", "Only list entries created after a date or time ago")
+	listCmd.String(&flagListCreatedBefore, "", "created-before", "Only list entries created before a date or time ago")
+	listCmd.Bool(&flagListTrash, "", "trash", "Only list entries in the trash")
+	listCmd.Bool(&flagListAll, "", "all", "List entries in the trash as well")
+	listCmd.Int(&flagListOffset, "", "offset", "Skip this many entries before listing")
+	listCmd.Int(&flagListLimit, "", "limit", "List at most this many entries (0 for all)")
 
-	parser.AdditionalHelpAppend = "bpass respects $BPASS, $EDITOR, $PINENTRY env vars\n$PINENTRY can be set to none to prevent it from using pinentry"
+	parser.AdditionalHelpAppend = "bpass respects $BPASS, $BPASS_KEYFILE, $EDITOR, $PINENTRY env vars\n$PINENTRY can be set to none to prevent it from using pinentry"
 
 	parser.ShowHelpWithHFlag = false
 	parser.ShowHelpOnUnexpected = false
@@ -65,6 +216,22 @@ func parseCli() {
 	parser.AttachSubcommand(versionCmd, 1)
 	parser.AttachSubcommand(genCmd, 1)
 	parser.AttachSubcommand(lpassImportCmd, 1)
+	parser.AttachSubcommand(verifyCmd, 1)
+	parser.AttachSubcommand(mvVaultCmd, 1)
+	parser.AttachSubcommand(doctorCmd, 1)
+	parser.AttachSubcommand(migrateCmd, 1)
+	parser.AttachSubcommand(normalizeCmd, 1)
+	parser.AttachSubcommand(archiveCmd, 1)
+	parser.AttachSubcommand(unarchiveCmd, 1)
+	parser.AttachSubcommand(historyCmd, 1)
+	parser.AttachSubcommand(rotateCmd, 1)
+	parser.AttachSubcommand(backupsCmd, 1)
+	parser.AttachSubcommand(restoreBackupCmd, 1)
+	parser.AttachSubcommand(reportCmd, 1)
+	parser.AttachSubcommand(compromiseCmd, 1)
+	parser.AttachSubcommand(purgeCmd, 1)
+	parser.AttachSubcommand(rekeyCmd, 1)
+	parser.AttachSubcommand(listCmd, 1)
 	parser.Parse()
 
 	if flagFile == defaultFilePath {
@@ -73,6 +240,20 @@ func parseCli() {
 			flagFile = envFile
 		}
 	}
+	if len(flagKeyfile) == 0 {
+		flagKeyfile = os.Getenv("BPASS_KEYFILE")
+	}
+	if len(flagCacheKey) == 0 {
+		flagCacheKey = os.Getenv("BPASS_CACHE_KEY")
+	}
+	if len(flagCacheKey) != 0 {
+		var err error
+		keyCacheTTL, err = time.ParseDuration(flagCacheKey)
+		if err != nil || keyCacheTTL <= 0 {
+			fmt.Println("failed to parse the cache-key flag, it's a duration like: 15m")
+			os.Exit(1)
+		}
+	}
 	if len(flagTime) != 0 {
 		var err error
 		historyTime, err = time.Parse(historyLayout, flagTime)
@@ -82,6 +263,15 @@ func parseCli() {
 		}
 	}
 
+	if len(flagNameRules) != 0 {
+		var err error
+		nameRules, err = blobformat.ParseNameRules(flagNameRules)
+		if err != nil {
+			fmt.Println(err)
+			os.Exit(1)
+		}
+	}
+
 	if flagHelp {
 		parser.ShowHelp()
 		os.Exit(0)
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aarondl/bpass/osutil"
+)
+
+// clipManager is a clipboard manager that may persist what we copy
+type clipManager struct {
+	Name string
+	// Processes are the (lowercase) process names the manager runs as
+	Processes []string
+	// GOOS limits the manager to one OS when its process name is also the
+	// name of a common command elsewhere
+	GOOS string
+	// Pause and Resume are commands that temporarily stop the manager from
+	// recording the clipboard, empty if the manager has no way to do that.
+	Pause  []string
+	Resume []string
+}
+
+// resumeDelay is how long we wait to resume a paused clipboard manager, they
+// notice clipboard changes asynchronously.
+const resumeDelay = 2 * time.Second
+
+var clipManagers = []clipManager{
+	{Name: "CopyQ", Processes: []string{"copyq"}, Pause: []string{"copyq", "disable"}, Resume: []string{"copyq", "enable"}},
+	{Name: "Klipper", Processes: []string{"klipper"}},
+	{Name: "GPaste", Processes: []string{"gpaste-daemon"}},
+	{Name: "Parcellite", Processes: []string{"parcellite"}},
+	{Name: "ClipIt", Processes: []string{"clipit"}},
+	{Name: "Diodon", Processes: []string{"diodon"}},
+	{Name: "Clipman", Processes: []string{"xfce4-clipman", "clipman"}},
+	{Name: "Greenclip", Processes: []string{"greenclip"}},
+	{Name: "clipmenu", Processes: []string{"clipmenud"}},
+	{Name: "cliphist", Processes: []string{"cliphist"}},
+	{Name: "Maccy", Processes: []string{"maccy"}},
+	{Name: "Pastebot", Processes: []string{"pastebot"}},
+	{Name: "Flycut", Processes: []string{"flycut"}},
+	{Name: "ClipMenu", Processes: []string{"clipmenu"}},
+	{Name: "Clipy", Processes: []string{"clipy"}},
+	{Name: "CopyClip", Processes: []string{"copyclip"}},
+	// ditto copies files on macOS
+	{Name: "Ditto", Processes: []string{"ditto"}, GOOS: "windows"},
+	{Name: "ClipboardFusion", Processes: []string{"clipboardfusion"}},
+	{Name: "ClipClip", Processes: []string{"clipclip"}},
+}
+
+var (
+	clipPausedMut sync.Mutex
+	clipPaused    []clipManager
+)
+
+// runningClipManagers returns the clipboard managers that are running. The
+// windows clipboard history is reported as a manager as well.
+func runningClipManagers() []clipManager {
+	var running []clipManager
+
+	if osutil.ClipboardHistoryEnabled() {
+		running = append(running, clipManager{Name: "Windows clipboard history"})
+	}
+
+	procs, err := osutil.RunningProcesses()
+	if err != nil {
+		return running
+	}
+
+	names := make(map[string]struct{}, len(procs))
+	for _, p := range procs {
+		names[strings.ToLower(p)] = struct{}{}
+	}
+
+	for _, m := range clipManagers {
+		if len(m.GOOS) != 0 && m.GOOS != runtime.GOOS {
+			continue
+		}
+		for _, p := range m.Processes {
+			if _, ok := names[p]; ok {
+				running = append(running, m)
+				break
+			}
+		}
+	}
+
+	return running
+}
+
+// guardClipboard checks for clipboard managers before a secret is copied. It
+// pauses the ones it can and warns about the rest. If strict is set and there
+// are managers that can't be paused it returns false and the copy should not
+// happen. The returned function must be called after the copy.
+func guardClipboard(strict bool) (ok bool, done func()) {
+	var unguarded []string
+
+	clipPausedMut.Lock()
+	for _, m := range runningClipManagers() {
+		if len(m.Pause) != 0 && exec.Command(m.Pause[0], m.Pause[1:]...).Run() == nil {
+			clipPaused = append(clipPaused, m)
+		} else {
+			unguarded = append(unguarded, m.Name)
+		}
+	}
+	clipPausedMut.Unlock()
+
+	done = func() {
+		time.AfterFunc(resumeDelay, resumeClipManagers)
+	}
+
+	if len(unguarded) == 0 {
+		return true, done
+	}
+
+	if strict {
+		errColor.Printf("refusing to copy, clipboard history would keep it: %s\n", strings.Join(unguarded, ", "))
+		resumeClipManagers()
+		return false, nil
+	}
+
+	errColor.Printf("warning: clipboard history may keep this: %s\n", strings.Join(unguarded, ", "))
+	return true, done
+}
+
+// resumeClipManagers resumes all the clipboard managers we paused, it must
+// be called before exiting so they aren't left paused.
+func resumeClipManagers() {
+	clipPausedMut.Lock()
+	defer clipPausedMut.Unlock()
+
+	for _, m := range clipPaused {
+		_ = exec.Command(m.Resume[0], m.Resume[1:]...).Run()
+	}
+	clipPaused = nil
+}
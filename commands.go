@@ -9,6 +9,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -17,6 +18,7 @@ import (
 	"net/url"
 	"os"
 	"os/exec"
+	"os/user"
 	"path/filepath"
 	"sort"
 	"strconv"
@@ -44,11 +46,34 @@ var (
 )
 
 const (
-	syncSCP  = "scp"
-	syncFile = "file"
+	syncSCP   = "scp"
+	syncFile  = "file"
+	syncHTTPS = "https"
 )
 
+// totpMinValidity is the least time a totp code must have left to be handed
+// out, there'd be no time to type it in otherwise
+const totpMinValidity = 5 * time.Second
+
+// twoStepTimeout is how long twostep waits before copying the totp code
+const twoStepTimeout = 15 * time.Second
+
+// qrPNGSize is how many pixels wide and high qr codes saved as png are
+const qrPNGSize = 512
+
 func (u *uiContext) passwd(user string) error {
+	if crypt.IsRecipient(u.user) || crypt.IsRecipient(user) {
+		errColor.Println(recipientKeyBlurb)
+		return nil
+	}
+	if u.tokenOnly() {
+		errColor.Println("you open the file with your token alone, remove it with rmtoken to use a passphrase")
+		return nil
+	}
+	if u.keyFromCache("change it") {
+		return nil
+	}
+
 	pass, err := u.getPassword()
 	if err != nil {
 		return err
@@ -59,13 +84,20 @@ func (u *uiContext) passwd(user string) error {
 		return nil
 	}
 
-	key, salt, err := crypt.DeriveKey(cryptVersion, []byte(pass))
+	isCurrentUser := len(u.user) == 0 || u.user == user
+	unlock := pass
+	if isCurrentUser {
+		unlock = u.unlockPass(pass)
+	}
+
+	key, salt, err := u.deriveKey(u.version, []byte(unlock))
 	if err != nil {
 		return err
 	}
 
+	oldKey := u.key
 	// Update our "fast-path" credentials if we're re-doing the current user
-	if len(u.user) == 0 || u.user == user {
+	if isCurrentUser {
 		u.pass = pass
 		u.key = key
 		u.salt = salt
@@ -78,7 +110,7 @@ func (u *uiContext) passwd(user string) error {
 			return err
 		}
 
-		mkey, iv, err := crypt.EncryptMasterKey(cryptVersion, key, u.master)
+		mkey, iv, err := crypt.EncryptMasterKey(u.version, key, u.master)
 		if err != nil {
 			return err
 		}
@@ -86,6 +118,12 @@ func (u *uiContext) passwd(user string) error {
 		u.store.DB.Set(uuid, blobformat.KeySalt, hex.EncodeToString(salt))
 		u.store.DB.Set(uuid, blobformat.KeyIV, hex.EncodeToString(iv))
 		u.store.DB.Set(uuid, blobformat.KeyMKey, hex.EncodeToString(mkey))
+
+		if !bytes.Equal(oldKey, u.key) {
+			if err = u.resealSigningKey(oldKey); err != nil {
+				return err
+			}
+		}
 	}
 
 	infoColor.Println("passphrase updated, bits will be re-encrypted with it on exit")
@@ -93,6 +131,10 @@ func (u *uiContext) passwd(user string) error {
 }
 
 func (u *uiContext) adduser(user string) error {
+	if ok, err := u.requireAdmin("add users"); err != nil || !ok {
+		return err
+	}
+
 	uuid, err := u.store.NewUser(user)
 	if err == blobformat.ErrNameNotUnique {
 		errColor.Println("user already exists")
@@ -104,12 +146,13 @@ func (u *uiContext) adduser(user string) error {
 	var key, salt []byte
 	var pass string
 	if len(u.master) == 0 {
-		u.master, u.ivm, err = crypt.NewMasterKey(cryptVersion)
+		u.master, u.ivm, err = crypt.NewMasterKey(u.version)
 		if err != nil {
 			return nil
 		}
 
 		u.user = user
+		u.tokenToUser(user)
 		key = u.key
 		salt = u.salt
 	} else {
@@ -118,13 +161,13 @@ func (u *uiContext) adduser(user string) error {
 			return err
 		}
 
-		key, salt, err = crypt.DeriveKey(cryptVersion, []byte(pass))
+		key, salt, err = u.deriveKey(u.version, []byte(pass))
 		if err != nil {
 			return err
 		}
 	}
 
-	mkey, iv, err := crypt.EncryptMasterKey(cryptVersion, key, u.master)
+	mkey, iv, err := crypt.EncryptMasterKey(u.version, key, u.master)
 	if err != nil {
 		return err
 	}
@@ -133,6 +176,21 @@ func (u *uiContext) adduser(user string) error {
 	u.store.DB.Set(uuid, blobformat.KeyIV, hex.EncodeToString(iv))
 	u.store.DB.Set(uuid, blobformat.KeyMKey, hex.EncodeToString(mkey))
 
+	if err = u.newSigningKey(user, key); err != nil {
+		return err
+	}
+	if enabled, err := u.store.RolesEnabled(); err != nil {
+		return err
+	} else if enabled {
+		priv, err := u.signingKey()
+		if err != nil {
+			return err
+		}
+		if err = u.store.AssignRole(user, blobformat.RoleUser, u.user, priv); err != nil {
+			return err
+		}
+	}
+
 	if len(pass) == 0 {
 		infoColor.Printf("re-used your key to create first user: %s\n", user)
 	} else {
@@ -143,7 +201,23 @@ func (u *uiContext) adduser(user string) error {
 }
 
 func (u *uiContext) rekey(user string) error {
-	isCurrentUser := len(user) == 0
+	isCurrentUser := len(user) == 0 || user == u.user
+	if (isCurrentUser && crypt.IsRecipient(u.user)) || crypt.IsRecipient(user) {
+		errColor.Println(recipientKeyBlurb)
+		return nil
+	}
+	if isCurrentUser && u.keyFromCache("rekey") {
+		return nil
+	}
+
+	if !isCurrentUser {
+		if ok, err := u.requireAdmin("rekey other users"); err != nil || !ok {
+			return err
+		}
+		if ok, err := u.rootAdminCheck(user); err != nil || !ok {
+			return err
+		}
+	}
 
 	var pass string
 	var err error
@@ -157,16 +231,23 @@ func (u *uiContext) rekey(user string) error {
 		}
 	}
 
-	if len(pass) == 0 {
+	// The current user can have a token instead of a passphrase
+	if len(pass) == 0 && !(isCurrentUser && u.tokenOnly()) {
 		errColor.Println("refusing to use empty password")
 		return nil
 	}
 
-	key, salt, err := crypt.DeriveKey(cryptVersion, []byte(pass))
+	unlock := pass
+	if isCurrentUser {
+		unlock = u.unlockPass(pass)
+	}
+
+	key, salt, err := u.deriveKey(u.version, []byte(unlock))
 	if err != nil {
 		return err
 	}
 
+	oldKey := u.key
 	if isCurrentUser {
 		// Update fast-path credentials
 		u.pass = pass
@@ -186,7 +267,7 @@ func (u *uiContext) rekey(user string) error {
 			return err
 		}
 
-		mkey, iv, err := crypt.EncryptMasterKey(cryptVersion, key, u.master)
+		mkey, iv, err := crypt.EncryptMasterKey(u.version, key, u.master)
 		if err != nil {
 			return err
 		}
@@ -194,12 +275,52 @@ func (u *uiContext) rekey(user string) error {
 		u.store.DB.Set(uuid, blobformat.KeySalt, hex.EncodeToString(salt))
 		u.store.DB.Set(uuid, blobformat.KeyIV, hex.EncodeToString(iv))
 		u.store.DB.Set(uuid, blobformat.KeyMKey, hex.EncodeToString(mkey))
+
+		if isCurrentUser {
+			err = u.resealSigningKey(oldKey)
+		} else {
+			// Their token's secret isn't part of the new key
+			u.tokens = crypt.RemoveToken(u.tokens, []byte(username))
+
+			// Their signing key can't be decrypted with the new key
+			var roles []blobformat.RoleAssignment
+			if roles, err = u.store.Roles(); err != nil {
+				return err
+			}
+			if err = u.newSigningKey(username, key); err != nil {
+				return err
+			}
+			err = u.restoreRoles(roles)
+		}
+		if err != nil {
+			return err
+		}
 	}
 
 	infoColor.Println("key updated, bits will be re-encrypted with it on exit")
 	return nil
 }
 
+// calibrate rekeys the current user with a key cost that takes target to
+// derive on this machine
+func (u *uiContext) calibrate(target time.Duration) error {
+	if _, ok := crypt.SaltKeyCost(u.salt); !ok {
+		errColor.Println("the file's format has no key cost, it must be upgraded with rekeyall first")
+		return nil
+	}
+	if u.keyFromCache("rekey") {
+		return nil
+	}
+
+	infoColor.Printf("calibrating key cost to take %v...\n", target)
+	u.keyCost = crypt.Calibrate(u.currentKeyCost(), target)
+	infoColor.Println("key cost:", u.keyCost)
+
+	return u.rekey("")
+}
+
+var recipientKeyBlurb = "recipients have no passphrase, remove them with rm and add their new key"
+
 var rekeyAllBlurb = `WARNING: This will change ALL user's passwords and print new
 ones to the screen. No one will be able to access the file with the old
 passwords again after this operation.
@@ -211,6 +332,25 @@ func (u *uiContext) rekeyAll() error {
 		return nil
 	}
 
+	if ok, err := u.requireAdmin("rekey the file"); err != nil || !ok {
+		return err
+	}
+	if u.keyFromCache("rekey the file") {
+		return nil
+	}
+
+	users, err := u.store.Users()
+	if err != nil {
+		return err
+	}
+	for _, name := range users {
+		if username := blobformat.SplitUsername(name); username != u.user {
+			if ok, err := u.rootAdminCheck(username); err != nil || !ok {
+				return err
+			}
+		}
+	}
+
 	errColor.Println(rekeyAllBlurb)
 	yes, err := u.getYesNo("are you sure you wish to proceed?")
 	if err != nil {
@@ -226,11 +366,6 @@ func (u *uiContext) rekeyAll() error {
 		return err
 	}
 
-	users, err := u.store.Users()
-	if err != nil {
-		return err
-	}
-
 	var width int
 	for _, name := range users {
 		username := blobformat.SplitUsername(name)
@@ -239,40 +374,96 @@ func (u *uiContext) rekeyAll() error {
 		}
 	}
 
+	oldKey := u.key
+	newKeys := make(map[string][]byte)
 	for uuid, name := range users {
 		username := blobformat.SplitUsername(name)
 
-		pass, err := genPassword(32, 0, 0, 0, 0, 0)
-		if err != nil {
-			return err
-		}
+		var pass string
+		var key, salt, iv, mkey []byte
+		if crypt.IsRecipient(username) {
+			// Recipients keep their identity, the new master key is sealed
+			// to them again
+			key, salt, iv, mkey, err = crypt.EncryptMasterKeyTo(cryptVersion, username, master)
+			if err != nil {
+				return err
+			}
+		} else {
+			// Our token can be all we need
+			if username != u.user || !u.tokenOnly() {
+				pass, err = genPassword(32, 0, 0, 0, 0, 0)
+				if err != nil {
+					return err
+				}
+			}
 
-		key, salt, err := crypt.DeriveKey(cryptVersion, []byte(pass))
-		if err != nil {
-			return err
+			unlock := pass
+			if username == u.user {
+				unlock = u.unlockPass(pass)
+			}
+
+			key, salt, err = u.deriveKey(cryptVersion, []byte(unlock))
+			if err != nil {
+				return err
+			}
+
+			mkey, iv, err = crypt.EncryptMasterKey(cryptVersion, key, master)
+			if err != nil {
+				return err
+			}
 		}
 
 		if username == u.user {
 			// Keep these up to date!
-			u.pass = pass
+			if len(pass) != 0 {
+				u.pass = pass
+			}
 			u.key = key
 			u.salt = salt
-		}
-
-		mkey, iv, err := crypt.EncryptMasterKey(cryptVersion, key, u.master)
-		if err != nil {
-			return err
+		} else {
+			newKeys[username] = key
 		}
 
 		u.store.DB.Set(uuid, blobformat.KeySalt, hex.EncodeToString(salt))
 		u.store.DB.Set(uuid, blobformat.KeyIV, hex.EncodeToString(iv))
 		u.store.DB.Set(uuid, blobformat.KeyMKey, hex.EncodeToString(mkey))
 
-		infoColor.Printf("%*s %s\n", width, username+":", pass)
+		if crypt.IsRecipient(username) {
+			infoColor.Printf("%*s %s\n", width, username+":", "(recipient, use the same identity)")
+		} else if len(pass) == 0 {
+			infoColor.Printf("%*s %s\n", width, username+":", "(use the same token)")
+		} else {
+			infoColor.Printf("%*s %s\n", width, username+":", pass)
+		}
+	}
+
+	// Everyone else's signing key can't be decrypted with their new key,
+	// ours has to be resealed before it can sign their roles again
+	roles, err := u.store.Roles()
+	if err != nil {
+		return err
+	}
+	if err = u.resealSigningKey(oldKey); err != nil {
+		return err
+	}
+	for username, key := range newKeys {
+		if err = u.newSigningKey(username, key); err != nil {
+			return err
+		}
+	}
+	if err = u.restoreRoles(roles); err != nil {
+		return err
 	}
 
 	u.master = master
 	u.ivm = ivm
+	u.version = cryptVersion
+	// Only our token's secret is part of a new key
+	if t, ok := crypt.FindToken(u.tokens, []byte(u.user)); ok {
+		u.tokens = []crypt.Token{t}
+	} else {
+		u.tokens = nil
+	}
 
 	infoColor.Println("master key updated, all users have been rekeyed")
 	return nil
@@ -293,7 +484,7 @@ func (u *uiContext) addSyncInterruptible(kind string) error {
 
 func (u *uiContext) addSync(kind string) error {
 	found := false
-	for _, k := range []string{syncSCP, syncFile} {
+	for _, k := range []string{syncSCP, syncFile, syncHTTPS} {
 		if k == kind {
 			found = true
 			break
@@ -334,6 +525,10 @@ func (u *uiContext) addSync(kind string) error {
 			if uri, err = addSCPEntry(u, uuid); err != nil {
 				return err
 			}
+		case syncHTTPS:
+			if uri, err = addHTTPSEntry(u, uuid); err != nil {
+				return err
+			}
 		}
 
 		// Use raw-er sets to avoid timestamp spam
@@ -352,6 +547,41 @@ func (u *uiContext) addSync(kind string) error {
 	})
 }
 
+func addHTTPSEntry(u *uiContext, uuid string) (uri url.URL, err error) {
+	for {
+		raw, err := u.getString("server (https://host:port)")
+		if err != nil {
+			return uri, err
+		}
+
+		parsed, err := url.Parse(raw)
+		if err != nil || parsed.Scheme != syncHTTPS || len(parsed.Host) == 0 {
+			errColor.Println("server must be an https url")
+			continue
+		}
+		uri = *parsed
+		break
+	}
+
+	team, err := u.getString("team")
+	if err != nil {
+		return uri, err
+	}
+	vault, err := u.getString("vault name")
+	if err != nil {
+		return uri, err
+	}
+	uri.Path = "/vaults/" + url.PathEscape(team) + "/" + url.PathEscape(vault)
+
+	token, err := u.promptPassword(promptColor.Sprint("token: "))
+	if err != nil {
+		return uri, err
+	}
+	u.store.DB.Set(uuid, blobformat.KeyToken, token)
+
+	return uri, nil
+}
+
 func addSCPEntry(u *uiContext, uuid string) (uri url.URL, err error) {
 	user, err := u.getString("user")
 	if err != nil {
@@ -468,8 +698,13 @@ func addSCPEntry(u *uiContext, uuid string) (uri url.URL, err error) {
 	return uri, nil
 }
 
-func (u *uiContext) addNewInterruptible(name string) error {
-	err := u.addNew(name)
+func (u *uiContext) addNewInterruptible(name, template string) error {
+	var err error
+	if len(template) != 0 {
+		err = u.addFromTemplate(name, template)
+	} else {
+		err = u.addNew(name)
+	}
 	switch err {
 	case nil:
 		return nil
@@ -523,86 +758,285 @@ func (u *uiContext) addNew(name string) (err error) {
 	})
 }
 
-func (u *uiContext) rename(src, dst string) error {
-	oldUUID, _, err := u.store.FindByName(src)
+func (u *uiContext) addFromTemplate(name, template string) (err error) {
+	return u.store.Do(func() error {
+		t, err := u.store.Template(template)
+		if err == blobformat.ErrTemplateNotFound {
+			errColor.Printf("template %q does not exist\n", template)
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		uuid, err := u.store.NewFromTemplate(template, name)
+		if err != nil {
+			if err == blobformat.ErrNameNotUnique {
+				errColor.Printf("%q already exists\n", name)
+				return nil
+			}
+			return err
+		}
+
+		for _, k := range t.Keys {
+			switch k {
+			case blobformat.KeyPass:
+				pass, err := u.getPassword()
+				if err != nil {
+					return err
+				}
+				u.store.DB.Set(uuid, k, pass)
+			case blobformat.KeyTwoFactor:
+				totp, err := u.prompt(promptColor.Sprintf("%s: ", k))
+				if err != nil {
+					return err
+				}
+				if len(totp) == 0 {
+					continue
+				}
+				if err = u.store.SetTwofactor(uuid, totp); err != nil {
+					errColor.Println(err)
+				}
+			default:
+				prompt := promptColor.Sprintf("%s: ", k)
+				if def := t.Defaults[k]; len(def) != 0 {
+					prompt = promptColor.Sprintf("%s [%s]: ", k, def)
+				}
+
+				val, err := u.prompt(prompt)
+				if err != nil {
+					return err
+				}
+				// Use raw sets here to avoid creating history spam based on
+				// timestamp additions
+				if len(val) != 0 {
+					u.store.DB.Set(uuid, k, val)
+				}
+			}
+		}
+
+		return nil
+	})
+}
+
+func (u *uiContext) listTemplates() error {
+	names, err := u.store.Templates()
 	if err != nil {
 		return err
 	}
-	if len(oldUUID) == 0 {
-		errColor.Println(src, "does not exist")
-		return nil
+
+	for _, name := range names {
+		t, err := u.store.Template(name)
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(u.out, "%s %s\n", keyColor.Sprint(name+":"), strings.Join(t.Keys, ", "))
 	}
 
-	if err := u.store.Rename(oldUUID, dst); err == blobformat.ErrNameNotUnique {
-		errColor.Println(dst, "already exists")
+	return nil
+}
+
+func (u *uiContext) newTemplate(name string, keys []string) error {
+	_, err := u.store.NewTemplate(name, keys...)
+	if err == blobformat.ErrNameNotUnique {
+		errColor.Printf("template %q already exists\n", name)
 		return nil
 	} else if err != nil {
 		return err
 	}
 
-	infoColor.Printf("moved %q => %q\n", src, dst)
+	infoColor.Printf("created template %q, set values on the entry to use as defaults\n", name)
 	return nil
 }
 
-func (u *uiContext) deleteEntry(name string) error {
-	uuid, _, err := u.store.FindByName(name)
+func (u *uiContext) listSavedSearches() error {
+	searches, err := u.store.SavedSearches()
 	if err != nil {
 		return err
 	}
-	if len(uuid) == 0 {
-		errColor.Printf("%q not found\n", name)
+	if len(searches) == 0 {
+		errColor.Println("No saved searches, add some with savesearch <name> <query>")
 		return nil
 	}
 
-	deleteSelf := false
-	if username := blobformat.SplitUsername(name); len(username) > 0 && username == u.user {
-		deleteSelf = true
-		// We're trying to delete ourselves!
-		// Disallow this unless we're the last user
-		users, err := u.store.Users()
-		if err != nil {
-			return err
-		}
-
-		if len(users) > 1 {
-			errColor.Println("cannot delete yourself while there are other users in the file")
-			return nil
-		}
+	names := make([]string, 0, len(searches))
+	for name := range searches {
+		names = append(names, name)
 	}
-
-	errColor.Printf("WARNING: This will delete all data associated with %q\n", name)
-	errColor.Println("Including ALL history irrecoverably, are you sure you wish to proceed?")
-	fmt.Println()
-
-	line, err := u.prompt(promptColor.Sprintf("type %q to proceed: ", name))
-	if err != nil && err != ErrEnd {
-		return err
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(u.out, "%s %s\n", keyColor.Sprint(name+":"), searches[name])
 	}
 
-	if line != name {
-		errColor.Println("Aborted")
-		return nil
-	}
+	return nil
+}
 
-	if deleteSelf {
-		// We are always the last user and so we must should clear the master
-		// key and IVM to ensure that we are not encrypted as a multi-user file
-		u.master = nil
-		u.ivm = nil
+func (u *uiContext) saveSearch(name, query string) error {
+	if _, err := u.store.SaveSearch(name, query); err != nil {
+		errColor.Println(err)
+		return nil
 	}
 
-	u.store.Delete(uuid)
-	errColor.Printf("DELETED: %q\n", name)
-
+	infoColor.Printf("saved search %q, list it with search %s\n", name, name)
 	return nil
 }
 
-func (u *uiContext) deleteKey(search, key string) error {
-	uuid, err := u.findOne(search)
-	if err != nil {
-		return err
-	}
-	if len(uuid) == 0 {
+// savedSearch lists the entries found by a saved search
+func (u *uiContext) savedSearch(name string) error {
+	results, err := u.store.SavedSearch(name)
+	switch {
+	case err == blobformat.ErrSearchNotFound:
+		errColor.Printf("no saved search named %q\n", name)
+		return nil
+	case err != nil:
+		errColor.Println(err)
+		return nil
+	}
+	if len(results) == 0 {
+		errColor.Println("No entries found")
+		return nil
+	}
+
+	for _, uuid := range results.Page(0, 0) {
+		fmt.Println(results[uuid])
+	}
+	return nil
+}
+
+func (u *uiContext) rename(src, dst string) error {
+	oldUUID, _, err := u.store.FindByName(src)
+	if err != nil {
+		return err
+	}
+	if len(oldUUID) == 0 {
+		errColor.Println(src, "does not exist")
+		return nil
+	}
+
+	if err := u.store.Rename(oldUUID, dst); err == blobformat.ErrNameNotUnique {
+		errColor.Println(dst, "already exists")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	infoColor.Printf("moved %q => %q\n", src, dst)
+	return nil
+}
+
+func (u *uiContext) clone(search, dst string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	withTwoFactor := false
+	if len(blob[blobformat.KeyTwoFactor]) != 0 || len(blob[blobformat.KeyTwoFactors]) != 0 {
+		withTwoFactor, err = u.getYesNo("copy totp too?")
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = u.store.Clone(uuid, dst, withTwoFactor)
+	switch err {
+	case nil:
+	case blobformat.ErrNameNotUnique:
+		errColor.Println(dst, "already exists")
+		return nil
+	case blobformat.ErrCloneUser:
+		errColor.Println(err)
+		return nil
+	default:
+		return err
+	}
+
+	infoColor.Printf("cloned %q => %q\n", blob.Name(), dst)
+	return nil
+}
+
+func (u *uiContext) deleteEntry(name string) error {
+	uuid, _, err := u.store.FindByName(name)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		errColor.Printf("%q not found\n", name)
+		return nil
+	}
+
+	if !blobformat.IsUserEntry(name) && !blobformat.IsTrashEntry(name) {
+		if err = u.store.MoveToTrash(uuid); err != nil {
+			return err
+		}
+		infoColor.Printf("moved %q to the trash, use restore to undo\n", name)
+		return nil
+	}
+
+	if blobformat.IsUserEntry(name) {
+		if ok, err := u.requireAdmin("remove users"); err != nil || !ok {
+			return err
+		}
+	}
+
+	deleteSelf := false
+	if username := blobformat.SplitUsername(name); len(username) > 0 && username == u.user {
+		deleteSelf = true
+		// We're trying to delete ourselves!
+		// Disallow this unless we're the last user
+		users, err := u.store.Users()
+		if err != nil {
+			return err
+		}
+
+		if len(users) > 1 {
+			errColor.Println("cannot delete yourself while there are other users in the file")
+			return nil
+		}
+	}
+
+	errColor.Printf("WARNING: This will delete all data associated with %q\n", name)
+	errColor.Println("Including ALL history irrecoverably, are you sure you wish to proceed?")
+	fmt.Println()
+
+	line, err := u.prompt(promptColor.Sprintf("type %q to proceed: ", name))
+	if err != nil && err != ErrEnd {
+		return err
+	}
+
+	if line != name {
+		errColor.Println("Aborted")
+		return nil
+	}
+
+	if deleteSelf {
+		// We are always the last user and so we must should clear the master
+		// key and IVM to ensure that we are not encrypted as a multi-user file
+		u.master = nil
+		u.ivm = nil
+	}
+
+	if err = u.store.Delete(uuid); err != nil {
+		return err
+	}
+	errColor.Printf("DELETED: %q\n", name)
+
+	return nil
+}
+
+func (u *uiContext) deleteKey(search, key string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
 		return nil
 	}
 
@@ -624,38 +1058,180 @@ func (u *uiContext) deleteKey(search, key string) error {
 	return nil
 }
 
-func (u *uiContext) list(search string) error {
-	entries, err := u.store.Search(search)
+func (u *uiContext) markKey(search, key, flag string) error {
+	switch flag {
+	case "sensitive", "hidden", "none", "fullhistory", "hashhistory", "nohistory", "text", "number", "bool":
+	default:
+		errColor.Println("flag must be one of: sensitive, hidden, none, fullhistory, hashhistory, nohistory, text, number, bool")
+		return nil
+	}
+
+	uuid, err := u.findOne(search)
 	if err != nil {
 		return err
 	}
-	if len(entries) == 0 {
-		fmt.Println("No entries found")
+	if len(uuid) == 0 {
 		return nil
 	}
-	names := entries.Names()
-	sort.Strings(names)
-	fmt.Println(strings.Join(names, "\n"))
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	meta, err := blob.FieldMeta(key)
+	if err != nil {
+		return err
+	}
+
+	// Display flags replace each other, history flags are separate
+	switch flag {
+	case "sensitive":
+		meta.Sensitive, meta.Hidden = true, false
+	case "hidden":
+		meta.Sensitive, meta.Hidden = false, true
+	case "none":
+		meta.Sensitive, meta.Hidden = false, false
+	case "fullhistory":
+		meta.History = blobformat.HistoryFull
+	case "hashhistory":
+		meta.History = blobformat.HistoryHash
+	case "nohistory":
+		meta.History = blobformat.HistoryNone
+	case "text":
+		meta.Type = blobformat.TypeString
+	case "number":
+		meta.Type = blobformat.TypeNumber
+	case "bool":
+		meta.Type = blobformat.TypeBool
+	}
+
+	if err = u.store.SetFieldMeta(uuid, key, meta); errors.Is(err, blobformat.ErrWrongType) {
+		errColor.Println(err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	infoColor.Printf("marked %s as %s\n", key, flag)
 	return nil
 }
 
-func (u *uiContext) listByLabels(wantLabels []string) error {
-	results, err := u.store.SearchLabels(wantLabels...)
+func (u *uiContext) tree(prefix string) error {
+	root, err := u.store.Tree()
 	if err != nil {
 		return err
 	}
-	if len(results) == 0 {
+
+	dir := root
+	for _, part := range strings.Split(strings.Trim(prefix, "/"), "/") {
+		if len(part) == 0 {
+			continue
+		}
+
+		var next *blobformat.Dir
+		for _, d := range dir.Dirs {
+			if d.Name == part {
+				next = d
+				break
+			}
+		}
+		if next == nil {
+			errColor.Println("No such directory")
+			return nil
+		}
+		dir = next
+	}
+
+	showDir(u, dir, 0)
+	return nil
+}
+
+func showDir(u *uiContext, dir *blobformat.Dir, indent int) {
+	ind := strings.Repeat("  ", indent)
+	for _, d := range dir.Dirs {
+		fmt.Fprintf(u.out, "%s%s\n", ind, keyColor.Sprint(d.Name+"/"))
+		showDir(u, d, indent+1)
+	}
+
+	names := dir.Entries.Names()
+	sort.Strings(names)
+	for _, n := range names {
+		fmt.Fprintf(u.out, "%s%s\n", ind, n[strings.LastIndexByte(n, '/')+1:])
+	}
+}
+
+func (u *uiContext) moveDir(oldPrefix, newPrefix string) error {
+	renames, err := u.store.MoveDir(oldPrefix, newPrefix)
+	switch err {
+	case nil:
+	case blobformat.ErrNameNotUnique:
+		errColor.Println("an entry in the destination already has the same name, nothing was moved")
+		return nil
+	case blobformat.ErrDirNotAllowed:
+		errColor.Println(err)
+		return nil
+	default:
+		return err
+	}
+
+	if len(renames) == 0 {
 		errColor.Println("No entries found")
 		return nil
 	}
 
-	names := results.Names()
-	sort.Strings(names)
-	fmt.Println(strings.Join(names, "\n"))
+	infoColor.Printf("moved %d entries\n", len(renames))
 	return nil
 }
 
-func (u *uiContext) get(search, key string, index int, copy bool) error {
+func (u *uiContext) keyHistory(search, key string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	changes, err := u.store.KeyHistory(uuid, key)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		errColor.Printf("%s.%s has no history\n", blob.Name(), key)
+		return nil
+	}
+
+	meta, err := blob.FieldMeta(key)
+	if err != nil {
+		return err
+	}
+	hide := key == blobformat.KeyPass || meta.Sensitive
+
+	for _, c := range changes {
+		val := c.Value
+		switch {
+		case c.Deleted:
+			val = infoColor.Sprint("(deleted)")
+		case hide:
+			val = hideColor.Sprint(val)
+		case strings.ContainsRune(val, '\n'):
+			val = strings.ReplaceAll(val, "\n", `\n`)
+		}
+
+		fmt.Fprintf(u.out, "%s %s\n", keyColor.Sprint(c.Time.Format(time.RFC3339)), val)
+	}
+
+	return nil
+}
+
+// diff shows the keys that changed in an entry between two snapshots (see
+// show), from 1 to 0 is the last change made to it.
+func (u *uiContext) diff(search string, from, to int) error {
 	uuid, err := u.findOne(search)
 	if err != nil {
 		return err
@@ -669,9 +1245,685 @@ func (u *uiContext) get(search, key string, index int, copy bool) error {
 		return err
 	}
 
+	d, err := u.store.DiffSnapshot(uuid, from, to)
+	if err != nil {
+		errColor.Println(err)
+		return nil
+	}
+
+	return u.showDiff(blob, d, from, to)
+}
+
+// showDiff prints a diff between two snapshots of blob, masking secrets
+func (u *uiContext) showDiff(blob blobformat.Blob, d blobformat.Diff, from, to int) error {
+	meta, err := blob.AllFieldMeta()
+	if err != nil {
+		return err
+	}
+
+	lines := diffLines(meta, d, false)
+	for _, l := range lines {
+		fmt.Fprintln(u.out, l)
+	}
+	if len(lines) == 0 {
+		infoColor.Printf("%s is the same in snapshots %d and %d\n", blob.Name(), from, to)
+	}
+
+	return nil
+}
+
+// diffLines formats a diff one key per line prefixed with + for added, - for
+// removed and ~ for changed keys. Secret values are masked unless reveal is
+// set. Keys that change on every write are left out.
+func diffLines(meta map[string]blobformat.FieldMeta, d blobformat.Diff, reveal bool) []string {
+	format := func(key, val string) string {
+		if !reveal && (key == blobformat.KeyPass || key == blobformat.KeyTwoFactor || key == blobformat.KeyTwoFactors || meta[key].Sensitive) {
+			return hideColor.Sprint(val)
+		}
+		return strings.ReplaceAll(val, "\n", `\n`)
+	}
+
+	var lines []string
+	add := func(list []blobformat.KeyDiff, prefix string) {
+		for _, k := range list {
+			switch k.Key {
+			case blobformat.KeyUpdated, blobformat.KeyAccessed:
+				// Changes on every write, only noise here
+				continue
+			}
+
+			var line string
+			switch prefix {
+			case "+":
+				line = fmt.Sprintf("%s %s %s", infoColor.Sprint(prefix), keyColor.Sprint(k.Key+":"), format(k.Key, k.New))
+			case "-":
+				line = fmt.Sprintf("%s %s %s", errColor.Sprint(prefix), keyColor.Sprint(k.Key+":"), format(k.Key, k.Old))
+			default:
+				line = fmt.Sprintf("%s %s %s -> %s", prefix, keyColor.Sprint(k.Key+":"), format(k.Key, k.Old), format(k.Key, k.New))
+			}
+			lines = append(lines, line)
+		}
+	}
+	add(d.Added, "+")
+	add(d.Removed, "-")
+	add(d.Changed, "~")
+
+	return lines
+}
+
+// undoStep undoes (or redoes) the last command that changed something
+func (u *uiContext) undoStep(redo bool) error {
+	var name string
+	var err error
+	if redo {
+		name, err = u.undo.Redo(u.store)
+	} else {
+		name, err = u.undo.Undo(u.store)
+	}
+
+	switch err {
+	case nil:
+	case blobformat.ErrNothingToUndo, blobformat.ErrNothingToRedo:
+		errColor.Println(err)
+		return nil
+	case blobformat.ErrNotFound:
+		errColor.Println("the entry no longer exists, can't change it back")
+		return nil
+	default:
+		return err
+	}
+
+	if redo {
+		infoColor.Println("redid:", name)
+	} else {
+		infoColor.Println("undid:", name)
+	}
+	return nil
+}
+
+// revert restores an entry to a snapshot after showing what would change
+func (u *uiContext) revert(search string, snapshot int) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	d, err := u.store.DiffSnapshot(uuid, 0, snapshot)
+	if err != nil {
+		errColor.Println(err)
+		return nil
+	}
+	if err = u.showDiff(blob, d, 0, snapshot); err != nil {
+		return err
+	}
+	ok, err := u.getYesNo(fmt.Sprintf("revert %s to snapshot %d?", blob.Name(), snapshot))
+	if err != nil || !ok {
+		return err
+	}
+
+	notKept, err := u.store.RestoreSnapshot(uuid, snapshot)
+	switch {
+	case err == blobformat.ErrProtected || err == blobformat.ErrNoSnapshotEntry || err == blobformat.ErrNameNotUnique:
+		errColor.Println(err)
+		return nil
+	case err != nil:
+		return err
+	}
+
+	for _, k := range notKept {
+		errColor.Printf("%s.%s was not kept in the history, left it as is\n", blob.Name(), k)
+	}
+	infoColor.Printf("reverted %s to snapshot %d\n", blob.Name(), snapshot)
+	return nil
+}
+
+func (u *uiContext) list(search string) error {
+	entries, err := u.store.Search(search)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		fmt.Println("No entries found")
+		return nil
+	}
+
+	// Favorites are listed first
+	favs := make(blobformat.SearchResults)
+	for uuid, name := range entries {
+		if blobformat.Blob(u.store.Snapshot[uuid]).IsFavorite() {
+			favs[uuid] = name
+			delete(entries, uuid)
+		}
+	}
+	for _, name := range u.withAliases(favs) {
+		fmt.Println(keyColor.Sprint("* ") + name)
+	}
+	if len(entries) != 0 {
+		fmt.Println(strings.Join(u.withAliases(entries), "\n"))
+	}
+	return nil
+}
+
+func (u *uiContext) share(search, recipient string) error {
+	uuid, err := u.findResolved(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	if err = u.store.RecordShare(uuid, recipient); err != nil {
+		return err
+	}
+	infoColor.Printf("recorded %s was shared with %s\n", blobformat.Blob(u.store.Snapshot[uuid]).Name(), recipient)
+	return nil
+}
+
+func (u *uiContext) recall(search string) error {
+	uuid, err := u.findResolved(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	name := blobformat.Blob(u.store.Snapshot[uuid]).Name()
+	ok, err := u.getYesNo(fmt.Sprintf("recall %s and flag it for rotation?", name))
+	if err != nil || !ok {
+		return err
+	}
+
+	recalled, err := u.store.Recall(uuid)
+	if err != nil {
+		return err
+	}
+
+	infoColor.Printf("%s is flagged for rotation (see expired), change the credentials then clear it with: set %s expires never\n", name, name)
+	if len(recalled) == 0 {
+		infoColor.Println("it was not shared with anyone")
+		return nil
+	}
+
+	infoColor.Println("let these recipients know it's being invalidated:")
+	for _, r := range recalled {
+		fmt.Printf("  %s (shared %s)\n", r.Recipient, r.Time.Format("2006-01-02"))
+	}
+	notify("bpass", "%s recalled from %d recipients", name, len(recalled))
+	return nil
+}
+
+func (u *uiContext) listFavorites() error {
+	results, err := u.store.Favorites()
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		errColor.Println("No favorites, add some with fav <query>")
+		return nil
+	}
+
+	fmt.Println(strings.Join(u.withAliases(results), "\n"))
+	return nil
+}
+
+func (u *uiContext) favorite(search string, favorite bool) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	if err = u.store.SetFavorite(uuid, favorite); err != nil {
+		return err
+	}
+
+	name := blobformat.Blob(u.store.Snapshot[uuid]).Name()
+	if favorite {
+		infoColor.Println("pinned", name)
+	} else {
+		infoColor.Println("unpinned", name)
+	}
+	return nil
+}
+
+func (u *uiContext) protect(search string, protect bool) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	if err = u.store.SetProtected(uuid, protect); err != nil {
+		return err
+	}
+
+	name := blobformat.Blob(u.store.Snapshot[uuid]).Name()
+	if protect {
+		infoColor.Println("protected", name)
+	} else {
+		infoColor.Println("unprotected", name)
+	}
+	return nil
+}
+
+// snapshotCap sets the most snapshots an entry keeps, 0 removes the cap
+func (u *uiContext) snapshotCap(search string, max int) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	if err = u.store.SetSnapshotCap(uuid, max); err != nil {
+		return err
+	}
+
+	name := blobformat.Blob(u.store.Snapshot[uuid]).Name()
+	if max == 0 {
+		infoColor.Println("keeping all snapshots of", name)
+	} else {
+		infoColor.Printf("keeping the last %d snapshots of %s, older ones are dropped when saving\n", max, name)
+	}
+	return nil
+}
+
+func (u *uiContext) listByLabels(wantLabels []string) error {
+	results, err := u.store.FindByLabel(wantLabels...)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		errColor.Println("No entries found")
+		return nil
+	}
+
+	names := results.Names()
+	sort.Strings(names)
+	fmt.Println(strings.Join(names, "\n"))
+	return nil
+}
+
+// listFilter narrows down the entries listed by listFiltered, empty fields
+// don't filter anything. The dates are parsed by parseAge.
+type listFilter struct {
+	// Query is given to blobformat.Query
+	Query string
+	// Saved is the name of a saved search whose query is ANDed with Query
+	Saved string
+	// Scope is which entries are listed, active ones by default
+	Scope blobformat.Scope
+
+	// Offset skips the first entries and Limit caps how many are listed (0
+	// for all of them), for paging through large files
+	Offset int
+	Limit  int
+
+	UpdatedAfter  string
+	UpdatedBefore string
+	CreatedAfter  string
+	CreatedBefore string
+}
+
+// listFiltered lists the entries matching every part of filter
+func (u *uiContext) listFiltered(filter listFilter) error {
+	if len(filter.Saved) != 0 {
+		searches, err := u.store.SavedSearches()
+		if err != nil {
+			return err
+		}
+		saved, ok := searches[filter.Saved]
+		if !ok {
+			errColor.Printf("no saved search named %q\n", filter.Saved)
+			return nil
+		}
+
+		if len(filter.Query) == 0 {
+			filter.Query = saved
+		} else {
+			filter.Query = fmt.Sprintf("(%s) AND (%s)", saved, filter.Query)
+		}
+	}
+
+	var results blobformat.SearchResults
+	var err error
+	if len(filter.Query) == 0 {
+		results, err = u.store.SearchScoped("", filter.Scope)
+	} else {
+		results, err = u.store.QueryScoped(filter.Query, filter.Scope)
+	}
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	ranges := []struct {
+		After, Before string
+		Find          func(from, to time.Time) (blobformat.SearchResults, error)
+	}{
+		{filter.UpdatedAfter, filter.UpdatedBefore, u.store.UpdatedBetween},
+		{filter.CreatedAfter, filter.CreatedBefore, u.store.CreatedBetween},
+	}
+	for _, r := range ranges {
+		if len(r.After) == 0 && len(r.Before) == 0 {
+			continue
+		}
+
+		from, ok := parseAgeOrZero(r.After, now)
+		if !ok {
+			errColor.Printf("could not understand %q, use a duration (90d, 2w, 6m, 1y) or a date (2006-01-02)\n", r.After)
+			return nil
+		}
+		to, ok := parseAgeOrZero(r.Before, now)
+		if !ok {
+			errColor.Printf("could not understand %q, use a duration (90d, 2w, 6m, 1y) or a date (2006-01-02)\n", r.Before)
+			return nil
+		}
+
+		within, err := r.Find(from, to)
+		if err != nil {
+			return err
+		}
+		for uuid := range results {
+			if _, ok := within[uuid]; !ok {
+				delete(results, uuid)
+			}
+		}
+	}
+
+	if len(results) == 0 {
+		errColor.Println("No entries found")
+		return nil
+	}
+
+	for _, uuid := range results.Page(filter.Offset, filter.Limit) {
+		fmt.Println(results[uuid])
+	}
+	return nil
+}
+
+func (u *uiContext) listExpired() error {
+	results, err := u.store.Expired(time.Now())
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		infoColor.Println("No entries have expired")
+		return nil
+	}
+
+	names := results.Names()
+	sort.Strings(names)
+	fmt.Println(strings.Join(names, "\n"))
+	return nil
+}
+
+// listUntouched lists entries that haven't been created, updated or accessed
+// within age (see parseAge for the format).
+func (u *uiContext) listUntouched(age string) error {
+	t, ok := parseAge(age, time.Now())
+	if !ok {
+		errColor.Printf("could not understand age %q, use a duration (90d, 2w, 6m, 1y) or a date (2006-01-02)\n", age)
+		return nil
+	}
+
+	results, err := u.store.Untouched(t)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		infoColor.Println("No entries untouched since", t.Format("2006-01-02"))
+		return nil
+	}
+
+	names := results.Names()
+	sort.Strings(names)
+	fmt.Println(strings.Join(names, "\n"))
+	return nil
+}
+
+// listRecent prints the n entries whose secrets were read most recently
+func (u *uiContext) listRecent(n int) error {
+	uuids, err := u.store.Recent(n)
+	if err != nil {
+		return err
+	}
+	if len(uuids) == 0 {
+		errColor.Println("No recently used entries, reads are recorded with --track-access")
+		return nil
+	}
+
+	for _, uuid := range uuids {
+		blob := blobformat.Blob(u.store.Snapshot[uuid])
+		accessed, err := blob.Accessed()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", accessed.Format("2006-01-02 15:04"), blob.Name())
+	}
+	return nil
+}
+
+// grepNotes prints the lines of notes that contain search
+func (u *uiContext) grepNotes(search string) error {
+	matches, err := u.store.SearchNotes(search)
+	if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		errColor.Println("No notes found")
+		return nil
+	}
+
+	for _, m := range matches {
+		fmt.Printf("%s %s %s\n", keyColor.Sprint(m.Name), infoColor.Sprintf("note %d:", m.Note+1), strings.TrimSpace(m.Text))
+	}
+	return nil
+}
+
+// listDuplicates lists the entries that reuse passwords
+func (u *uiContext) listDuplicates() error {
+	dupes, err := u.store.Duplicates()
+	if err != nil {
+		return err
+	}
+	if len(dupes) == 0 {
+		infoColor.Println("No passwords are reused")
+		return nil
+	}
+
+	for _, d := range dupes {
+		shared := "a password"
+		if d.Kind == blobformat.DuplicateUserPass {
+			shared = "a user and password"
+		}
+		names := d.Entries.Names()
+		sort.Strings(names)
+		errColor.Printf("%d entries share %s:\n", len(names), shared)
+		fmt.Println("  " + strings.Join(names, "\n  "))
+	}
+	return nil
+}
+
+// changelog lists the changes made to the file within age, oldest first
+func (u *uiContext) changelog(age string) error {
+	t, ok := parseAge(age, time.Now())
+	if !ok {
+		errColor.Printf("could not understand age %q, use a duration (90d, 2w, 6m, 1y) or a date (2006-01-02)\n", age)
+		return nil
+	}
+
+	changes := u.store.Changelog(t)
+	if len(changes) == 0 {
+		infoColor.Println("No changes since", t.Format("2006-01-02"))
+		return nil
+	}
+
+	for _, c := range changes {
+		line := fmt.Sprintf("%s %s %s", infoColor.Sprint(c.Time.Format(historyLayout)), keyColor.Sprint(c.Name), c.Op)
+		if len(c.Keys) != 0 {
+			line += ": " + strings.Join(c.Keys, ", ")
+		}
+		if len(c.Device) != 0 {
+			line += fmt.Sprintf(" (%s)", c.Device)
+		}
+		fmt.Fprintln(u.out, line)
+	}
+	return nil
+}
+
+// expiryReminder lets the user know if there's credentials that are due to
+// be rotated.
+func (u *uiContext) expiryReminder() error {
+	results, err := u.store.Expired(time.Now())
+	if err != nil {
+		return err
+	}
+
+	switch len(results) {
+	case 0:
+	case 1:
+		errColor.Printf("%s has expired and should be rotated\n", results.Names()[0])
+	default:
+		errColor.Printf("%d entries have expired and should be rotated, see the %q command\n", len(results), "expired")
+	}
+
+	return nil
+}
+
+func (u *uiContext) listImported(source string) error {
+	results, err := u.store.ImportedFrom(source)
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		errColor.Println("No imported entries found")
+		return nil
+	}
+
+	names := results.Names()
+	sort.Strings(names)
+	fmt.Println(strings.Join(names, "\n"))
+	return nil
+}
+
+// twoFactorQR shows the two factor uri of an entry as a QR code, or writes it
+// to file as a png if one is given
+func (u *uiContext) twoFactorQR(search, file string) error {
+	uuid, err := u.findResolved(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+	if ok, err := u.checkWindow(uuid); err != nil || !ok {
+		return err
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	if len(file) == 0 {
+		code, err := blob.TwoFactorANSI()
+		if err == blobformat.ErrNoTwoFactor {
+			errColor.Println("totp is not set for", blob.Name())
+			return nil
+		} else if err == blobformat.ErrYubiKeySecret {
+			errColor.Println(err)
+			return nil
+		} else if err != nil {
+			return err
+		}
+		u.trackAccess(uuid)
+		fmt.Fprint(u.out, code)
+		return nil
+	}
+
+	png, err := blob.TwoFactorPNG(qrPNGSize)
+	if err == blobformat.ErrNoTwoFactor {
+		errColor.Println("totp is not set for", blob.Name())
+		return nil
+	} else if err == blobformat.ErrYubiKeySecret {
+		errColor.Println(err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	u.trackAccess(uuid)
+	if err = ioutil.WriteFile(file, png, 0600); err != nil {
+		return err
+	}
+
+	infoColor.Printf("wrote the totp qr code for %s to %s\n", blob.Name(), file)
+	return nil
+}
+
+// listByURL lists the entries for a site, best match first
+func (u *uiContext) listByURL(rawURL string) error {
+	matches, err := u.store.MatchDomain(rawURL)
+	if err == blobformat.ErrInvalidURL {
+		errColor.Println(rawURL, "is not a valid url")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if len(matches) == 0 {
+		errColor.Println("No entries found")
+		return nil
+	}
+
+	for _, m := range matches {
+		fmt.Println(m.Name)
+	}
+	return nil
+}
+
+func (u *uiContext) get(search, key string, index int, copy bool) error {
+	uuid, err := u.findResolved(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+	if ok, err := u.checkWindow(uuid); err != nil || !ok {
+		return err
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	// totp:<label> keys are the labelled two factor keys
+	label, isTwoFactor := twoFactorLabel(key)
+	if isTwoFactor {
+		key = blobformat.KeyTwoFactor
+	}
+	if key == blobformat.KeyPass || key == blobformat.KeyTwoFactor {
+		u.trackAccess(uuid)
+	}
+
 	switch key {
 	case blobformat.KeyTwoFactor:
-		val, err := blob.TwoFactor()
+		val, remaining, err := u.twoFactor(uuid, label)
 		if err != nil {
 			errColor.Println(err)
 			return nil
@@ -682,18 +1934,77 @@ func (u *uiContext) get(search, key string, index int, copy bool) error {
 		}
 
 		if copy {
-			copyToClipboard(blobformat.KeyTwoFactor, val)
+			copyToClipboard(blobformat.KeyTwoFactor, val, true)
+		} else {
+			fmt.Println(val)
+		}
+		if remaining != 0 {
+			infoColor.Printf("valid for %ds\n", int(remaining.Seconds()))
+		}
+	case blobformat.KeyNotes:
+		notes := blob.Notes()
+		if len(notes) == 0 {
+			errColor.Printf("%s.%s is not set\n", blob.Name(), key)
+			return nil
+		}
+
+		val := noteLines(notes)
+		if copy {
+			copyToClipboard(key, val, false)
 		} else {
 			fmt.Println(val)
 		}
-	case blobformat.KeyUpdated:
-		value, err := blob.Updated()
+	case blobformat.KeyQuestions:
+		questions, err := blob.Questions()
+		if err != nil {
+			errColor.Println(err)
+			return nil
+		}
+		if len(questions) == 0 {
+			errColor.Printf("%s has no security questions\n", blob.Name())
+			return nil
+		}
+
+		// Without an index only the questions are shown
+		if index < 0 {
+			fmt.Println(questionLines(questions, false))
+			return nil
+		}
+		if index < 1 || index > len(questions) {
+			errColor.Printf("%s has %d security questions\n", blob.Name(), len(questions))
+			return nil
+		}
+
+		u.trackAccess(uuid)
+		answer := questions[index-1].Answer
+		if copy {
+			copyToClipboard("answer", answer, true)
+		} else {
+			fmt.Println(answer)
+		}
+	case blobformat.KeyCreated, blobformat.KeyUpdated, blobformat.KeyAccessed, blobformat.KeyExpires:
+		var value time.Time
+		switch key {
+		case blobformat.KeyCreated:
+			value, err = blob.Created()
+		case blobformat.KeyUpdated:
+			value, err = blob.Updated()
+		case blobformat.KeyAccessed:
+			value, err = blob.Accessed()
+		case blobformat.KeyExpires:
+			value, err = blob.Expires()
+		}
 		if err != nil {
 			return err
 		}
+		if value.IsZero() {
+			errColor.Printf("%s.%s is not set\n", blob.Name(), key)
+			return nil
+		}
+
 		val := value.Format(time.RFC3339)
 		if copy {
-			copyToClipboard(blobformat.KeyUpdated, val)
+			copyToClipboard(key, val, false)
 		} else {
 			fmt.Println(val)
 		}
@@ -703,8 +2014,16 @@ func (u *uiContext) get(search, key string, index int, copy bool) error {
 			errColor.Printf("%s.%s is not set", blob.Name(), key)
 		}
 
+		meta, err := blob.FieldMeta(key)
+		if err != nil {
+			return err
+		} else if meta.Sensitive && !copy {
+			errColor.Printf("%s.%s is sensitive, use cp to copy it instead\n", blob.Name(), key)
+			return nil
+		}
+
 		if copy {
-			copyToClipboard(key, value)
+			copyToClipboard(key, value, key == blobformat.KeyPass || meta.Sensitive)
 		} else {
 			fmt.Println(value)
 		}
@@ -714,18 +2033,22 @@ func (u *uiContext) get(search, key string, index int, copy bool) error {
 }
 
 func (u *uiContext) login(search string) error {
-	uuid, err := u.findOne(search)
+	uuid, err := u.findResolved(search)
 	if err != nil {
 		return err
 	}
 	if len(uuid) == 0 {
 		return nil
 	}
+	if ok, err := u.checkWindow(uuid); err != nil || !ok {
+		return err
+	}
 
 	blob, err := u.store.Find(uuid)
 	if err != nil {
 		return err
 	}
+	u.trackAccess(uuid)
 
 	type keyVal struct {
 		Key string
@@ -744,18 +2067,19 @@ func (u *uiContext) login(search string) error {
 	for _, k := range keys {
 		value, ok := blob[k]
 		if ok {
-			if k == blobformat.KeyTwoFactor {
-				value, err = blob.TwoFactor()
-				if err != nil {
-					return err
-				}
-			}
 			keyVals = append(keyVals, keyVal{Key: k, Val: value})
 		}
 	}
 
 	for i, kv := range keyVals {
-		copyToClipboard(kv.Key, kv.Val)
+		if kv.Key == blobformat.KeyTwoFactor {
+			// Generated last so it's fresh when it's pasted
+			kv.Val, _, err = u.twoFactor(uuid, "")
+			if err != nil {
+				return err
+			}
+		}
+		copyToClipboard(kv.Key, kv.Val, kv.Key == blobformat.KeyPass || kv.Key == blobformat.KeyTwoFactor)
 		if i < len(keyVals)-1 {
 			_, err = u.prompt(infoColor.Sprint("press enter for next"))
 			if err != nil {
@@ -767,6 +2091,93 @@ func (u *uiContext) login(search string) error {
 	return nil
 }
 
+// upcomingCodes prints the next n totp codes of an entry and when each is
+// valid, for when there'll be no way to get at the file for a while.
+func (u *uiContext) upcomingCodes(search string, n int) error {
+	uuid, err := u.findResolved(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+	if ok, err := u.checkWindow(uuid); err != nil || !ok {
+		return err
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	codes, err := blob.UpcomingTwoFactors(n)
+	switch err {
+	case nil:
+	case blobformat.ErrNoTwoFactor:
+		errColor.Println("totp is not set for", blob.Name())
+		return nil
+	case blobformat.ErrHOTP, blobformat.ErrYubiKeySecret:
+		errColor.Println(err)
+		return nil
+	default:
+		return err
+	}
+	u.trackAccess(uuid)
+
+	for _, c := range codes {
+		fmt.Fprintf(u.out, "%s  %s - %s\n", c.Code, c.From.Format("15:04:05"), c.Until.Format("15:04:05"))
+	}
+	return nil
+}
+
+// twoStep copies the password of an entry and then, once enter is pressed or
+// timeout passes, a freshly generated totp code. It's the usual two step login
+// where the code is asked for on a second page.
+func (u *uiContext) twoStep(search string, timeout time.Duration) error {
+	uuid, err := u.findResolved(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+	if ok, err := u.checkWindow(uuid); err != nil || !ok {
+		return err
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	if len(blob[blobformat.KeyPass]) == 0 {
+		errColor.Printf("%s.%s is not set\n", blob.Name(), blobformat.KeyPass)
+		return nil
+	}
+	u.trackAccess(uuid)
+
+	copyToClipboard(blobformat.KeyPass, blob.Get(blobformat.KeyPass), true)
+	if len(blob[blobformat.KeyTwoFactor]) == 0 {
+		infoColor.Println("totp is not set for", blob.Name())
+		return nil
+	}
+
+	prompt := infoColor.Sprintf("press enter for the totp code (or wait %ds)", int(timeout.Seconds()))
+	if _, _, err = u.in.LineTimeout(prompt, timeout); err != nil {
+		return err
+	}
+
+	code, remaining, err := u.twoFactor(uuid, "")
+	if err != nil {
+		errColor.Println(err)
+		return nil
+	}
+	copyToClipboard(blobformat.KeyTwoFactor, code, true)
+	if remaining != 0 {
+		infoColor.Printf("valid for %ds\n", int(remaining.Seconds()))
+	}
+	return nil
+}
+
 func (u *uiContext) set(search, key, value string) error {
 	uuid, err := u.findOne(search)
 	if err != nil {
@@ -776,8 +2187,17 @@ func (u *uiContext) set(search, key, value string) error {
 		return nil
 	}
 
+	label, isTwoFactor := twoFactorLabel(key)
+	if isTwoFactor {
+		key = blobformat.KeyTwoFactor
+	}
+
 	switch key {
 	case blobformat.KeyPass:
+		if ok, err := u.checkCheckout(uuid); err != nil || !ok {
+			return err
+		}
+
 		if len(value) == 0 {
 			// if pass was not provided, generate one
 			value, err = u.getPassword()
@@ -786,9 +2206,12 @@ func (u *uiContext) set(search, key, value string) error {
 			}
 		}
 
-		u.store.Set(uuid, key, value)
+		if err = u.store.Set(uuid, key, value); err != nil {
+			return err
+		}
 	case blobformat.KeyTwoFactor:
-		if err := u.store.SetTwofactor(uuid, value); err != nil {
+		// An empty value removes a labelled key
+		if err := u.store.SetTwofactorNamed(uuid, label, value); err != nil {
 			errColor.Println(err)
 			return nil
 		}
@@ -802,7 +2225,70 @@ func (u *uiContext) set(search, key, value string) error {
 			return nil
 		}
 
-		u.store.Set(uuid, key, value)
+		if err = u.store.Set(uuid, key, value); err != nil {
+			return err
+		}
+	case blobformat.KeyWindow:
+		if err := u.store.SetWindows(uuid, value); err != nil {
+			errColor.Println(err)
+			return nil
+		}
+	case blobformat.KeyNotes:
+		if len(value) == 0 {
+			value, err = u.promptMultiline(promptColor.Sprint("> "))
+			if err != nil {
+				return err
+			}
+		}
+		if len(strings.TrimSpace(value)) == 0 {
+			errColor.Println("note is empty, not adding it")
+			return nil
+		}
+
+		if err = u.store.AddNote(uuid, value); err != nil {
+			return err
+		}
+		infoColor.Println("added note")
+		return nil
+	case blobformat.KeyAlias:
+		target := ""
+		if len(value) != 0 {
+			if target, err = u.findOne(value); err != nil || len(target) == 0 {
+				return err
+			}
+			value = blobformat.Blob(u.store.Snapshot[target]).Name()
+		}
+
+		if err = u.store.SetAlias(uuid, target); err != nil {
+			errColor.Println(err)
+			return nil
+		}
+		if len(target) == 0 {
+			infoColor.Println("removed alias")
+			return nil
+		}
+	case blobformat.KeyIcon:
+		if err = u.setIcon(uuid, value); err != nil {
+			errColor.Println(err)
+			return nil
+		}
+		infoColor.Println("set icon")
+		return nil
+	case blobformat.KeyExpires:
+		expires, err := parseExpires(value, time.Now())
+		if err != nil {
+			errColor.Println(err)
+			return nil
+		}
+
+		if err = u.store.SetExpires(uuid, expires); err != nil {
+			return err
+		}
+		if expires.IsZero() {
+			infoColor.Println("removed expiry")
+			return nil
+		}
+		value = expires.Format(time.RFC3339)
 	default:
 		// no known key was provided,  setting custom key
 
@@ -814,7 +2300,15 @@ func (u *uiContext) set(search, key, value string) error {
 			}
 		}
 
-		u.store.Set(uuid, key, value)
+		if err = u.store.Set(uuid, key, value); blobformat.IsKeyNotAllowed(err) {
+			errColor.Println(key, "may not be set directly")
+			return nil
+		} else if errors.Is(err, blobformat.ErrWrongType) {
+			errColor.Println(err)
+			return nil
+		} else if err != nil {
+			return err
+		}
 	}
 
 	infoColor.Printf("set %s = %s\n", key, value)
@@ -822,7 +2316,70 @@ func (u *uiContext) set(search, key, value string) error {
 	return nil
 }
 
+// parseAge parses a point in the past given as a duration ago (90d, 2w, 6m,
+// 1y) or a date, see parseExpires. ok is false if it could not be understood.
+func parseAge(age string, now time.Time) (t time.Time, ok bool) {
+	t, err := parseExpires(age, now)
+	if err != nil || t.IsZero() {
+		return time.Time{}, false
+	}
+	// Durations are given as time from now, we want time ago
+	if t.After(now) {
+		t = now.Add(-t.Sub(now))
+	}
+	return t, true
+}
+
+// parseAgeOrZero is parseAge but an empty age is the zero time
+func parseAgeOrZero(age string, now time.Time) (time.Time, bool) {
+	if len(age) == 0 {
+		return time.Time{}, true
+	}
+	return parseAge(age, now)
+}
+
+// parseExpires understands dates (2006-01-02), RFC3339 timestamps, durations
+// from now in days, weeks, months or years (90d, 2w, 6m, 1y) and "never"
+// which returns the zero time.
+func parseExpires(value string, now time.Time) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	if len(value) == 0 || value == "never" {
+		return time.Time{}, nil
+	}
+
+	if t, err := time.ParseInLocation("2006-01-02", value, time.Local); err == nil {
+		return t, nil
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+
+	unit := value[len(value)-1]
+	n, err := strconv.Atoi(strings.TrimPrefix(value[:len(value)-1], "+"))
+	if err != nil || n <= 0 {
+		return time.Time{}, fmt.Errorf("could not understand expiry %q, use a date (2006-01-02), a duration (90d, 2w, 6m, 1y) or never", value)
+	}
+
+	switch unit {
+	case 'd':
+		return now.AddDate(0, 0, n), nil
+	case 'w':
+		return now.AddDate(0, 0, n*7), nil
+	case 'm':
+		return now.AddDate(0, n, 0), nil
+	case 'y':
+		return now.AddDate(n, 0, 0), nil
+	}
+
+	return time.Time{}, fmt.Errorf("unknown unit %q in expiry, use one of d, w, m, y", unit)
+}
+
 func (u *uiContext) edit(search, key string) error {
+	if key == blobformat.KeyNotes {
+		errColor.Println("notes are changed with note and rmnote")
+		return nil
+	}
+
 	uuid, err := u.findOne(search)
 	if err != nil {
 		return err
@@ -904,37 +2461,149 @@ func (u *uiContext) edit(search, key string) error {
 
 	tmp, err = os.OpenFile(fname, os.O_RDWR, 0600)
 	if err != nil {
-		errColor.Println("failed to open tmp file to edit value:", err)
+		errColor.Println("failed to open tmp file to edit value:", err)
+		return nil
+	}
+
+	if editExit != 0 {
+		errColor.Printf("editor exit non-zero (%d), not saving value\n", editExit)
+		return nil
+	}
+
+	newValue, err := ioutil.ReadAll(tmp)
+	if err != nil {
+		errColor.Println("failed to read from tmp file:", err)
+		return nil
+	}
+
+	if len(newValue) > maxLen {
+		maxLen = len(newValue)
+	}
+
+	if len(newValue) == 0 {
+		infoColor.Println("erasing value")
+		u.store.DeleteKey(uuid, key)
+	} else {
+		infoColor.Printf("set %s\n", key)
+		u.store.Set(uuid, key, string(newValue))
+	}
+
+	return nil
+}
+
+func (u *uiContext) addLabels(search string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	labelVal := blob[blobformat.KeyLabels]
+	var labels []string
+	if len(labelVal) != 0 {
+		labels = strings.Split(labelVal, ",")
+	}
+
+	infoColor.Println("Enter labels, blank line, ctrl-d, or . to stop")
+	changed := false
+	for {
+		line, err := u.prompt(promptColor.Sprint("> "))
+		if err == ErrEnd {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		if len(line) == 0 || line == "." {
+			break
+		}
+
+		if !validateLabel(labels, line) {
+			continue
+		}
+
+		changed = true
+		labels = append(labels, line)
+	}
+
+	if changed {
+		u.store.Set(uuid, blobformat.KeyLabels, strings.Join(labels, ","))
+		infoColor.Println("Updated labels for", blob.Name())
+	}
+	return nil
+}
+
+func (u *uiContext) deleteNote(search string, index int) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
 		return nil
 	}
 
-	if editExit != 0 {
-		errColor.Printf("editor exit non-zero (%d), not saving value\n", editExit)
+	if err = u.store.RemoveNote(uuid, index-1); err != nil {
+		errColor.Println(err)
 		return nil
 	}
+	infoColor.Println("removed note", index)
+	return nil
+}
 
-	newValue, err := ioutil.ReadAll(tmp)
+// addQuestion adds a security question to an entry, the answer is generated
+// unless the user would rather type one in.
+func (u *uiContext) addQuestion(search, question string) error {
+	uuid, err := u.findOne(search)
 	if err != nil {
-		errColor.Println("failed to read from tmp file:", err)
+		return err
+	}
+	if len(uuid) == 0 {
 		return nil
 	}
 
-	if len(newValue) > maxLen {
-		maxLen = len(newValue)
+	if len(question) == 0 {
+		if question, err = u.getString("question"); err != nil {
+			return err
+		}
 	}
 
-	if len(newValue) == 0 {
-		infoColor.Println("erasing value")
-		u.store.DeleteKey(uuid, key)
-	} else {
-		infoColor.Printf("set %s\n", key)
-		u.store.Set(uuid, key, string(newValue))
+	q := blobformat.Question{Question: question}
+	generate, err := u.getYesNo("generate a random answer (truthful answers can be found out)?")
+	if err != nil {
+		return err
+	}
+	if generate {
+		if q.Answer, err = genAnswer(); err != nil {
+			return err
+		}
+		q.Generated = true
+	} else if q.Answer, err = u.getString("answer"); err != nil {
+		return err
+	}
+
+	if err = u.store.AddQuestion(uuid, q); err != nil {
+		if err == blobformat.ErrNoQuestion || err == blobformat.ErrProtected {
+			errColor.Println(err)
+			return nil
+		}
+		return err
 	}
 
+	if generate {
+		infoColor.Println("answer:", hideColor.Sprint(q.Answer))
+	}
+	infoColor.Println("added security question")
 	return nil
 }
 
-func (u *uiContext) addLabels(search string) error {
+func (u *uiContext) deleteQuestion(search string, index int) error {
 	uuid, err := u.findOne(search)
 	if err != nil {
 		return err
@@ -943,46 +2612,107 @@ func (u *uiContext) addLabels(search string) error {
 		return nil
 	}
 
-	blob, err := u.store.MustFind(uuid)
+	if err = u.store.RemoveQuestion(uuid, index-1); err != nil {
+		errColor.Println(err)
+		return nil
+	}
+	infoColor.Println("removed security question", index)
+	return nil
+}
+
+// questionLines formats security questions numbered from 1, answers are
+// masked when shown.
+func questionLines(questions []blobformat.Question, answers bool) string {
+	var lines []string
+	for i, q := range questions {
+		line := fmt.Sprintf("%d. %s", i+1, q.Question)
+		if answers {
+			line += " " + hideColor.Sprint(q.Answer)
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.Join(lines, "\n")
+}
+
+func (u *uiContext) setRecoveryCodes(search string, codes []string) error {
+	uuid, err := u.findOne(search)
 	if err != nil {
 		return err
 	}
-
-	labelVal := blob[blobformat.KeyLabels]
-	var labels []string
-	if len(labelVal) != 0 {
-		labels = strings.Split(labelVal, ",")
+	if len(uuid) == 0 {
+		return nil
 	}
 
-	infoColor.Println("Enter labels, blank line, ctrl-d, or . to stop")
-	changed := false
-	for {
-		line, err := u.prompt(promptColor.Sprint("> "))
-		if err == ErrEnd {
-			break
-		} else if err != nil {
+	if len(codes) == 0 {
+		text, err := u.promptMultiline(promptColor.Sprint("> "))
+		if err != nil {
 			return err
 		}
+		codes = strings.Fields(text)
+	}
+	if len(codes) == 0 {
+		errColor.Println("no codes given, not replacing them")
+		return nil
+	}
 
-		if len(line) == 0 || line == "." {
-			break
+	if err = u.store.SetRecoveryCodes(uuid, codes); err != nil {
+		if err == blobformat.ErrProtected {
+			errColor.Println(err)
+			return nil
 		}
+		return err
+	}
+	infoColor.Printf("saved %d recovery codes\n", len(codes))
+	return nil
+}
 
-		if !validateLabel(labels, line) {
-			continue
-		}
+// useRecoveryCode copies the next unused recovery code of an entry, it's
+// marked used so it's never handed out again.
+func (u *uiContext) useRecoveryCode(search string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
 
-		changed = true
-		labels = append(labels, line)
+	code, left, err := u.store.UseRecoveryCode(uuid)
+	switch err {
+	case nil:
+	case blobformat.ErrNoRecoveryCodes, blobformat.ErrProtected:
+		errColor.Println(err)
+		return nil
+	default:
+		return err
 	}
 
-	if changed {
-		u.store.Set(uuid, blobformat.KeyLabels, strings.Join(labels, ","))
-		infoColor.Println("Updated labels for", blob.Name())
+	u.trackAccess(uuid)
+	copyToClipboard("recovery code", code, true)
+	if left <= 2 {
+		errColor.Printf("%d recovery codes left, generate new ones soon\n", left)
+	} else {
+		infoColor.Printf("%d recovery codes left\n", left)
 	}
 	return nil
 }
 
+// noteLines formats notes numbered from 1 with the date they were created
+func noteLines(notes []blobformat.Note) string {
+	var lines []string
+	for i, n := range notes {
+		date := "(no date)"
+		if !n.Created.IsZero() {
+			date = n.Created.Format("2006-01-02 15:04")
+		}
+		text := strings.ReplaceAll(strings.TrimSpace(n.Text), "\n", "\n   ")
+		lines = append(lines, fmt.Sprintf("%d. %s\n   %s", i+1, date, text))
+	}
+
+	return strings.Join(lines, "\n")
+}
+
 func (u *uiContext) deleteLabel(search string, label string) error {
 	uuid, err := u.findOne(search)
 	if err != nil {
@@ -1024,7 +2754,28 @@ func (u *uiContext) deleteLabel(search string, label string) error {
 	return nil
 }
 
-func (u *uiContext) show(search string, snapshot int) error {
+func (u *uiContext) checkout(search, reason string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	err = u.store.CheckOut(uuid, u.holderName(), reason)
+	if blobformat.IsCheckedOut(err) {
+		errColor.Println(err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	infoColor.Println("checked out, remember to checkin when finished")
+	return nil
+}
+
+func (u *uiContext) checkin(search string) error {
 	uuid, err := u.findOne(search)
 	if err != nil {
 		return err
@@ -1033,6 +2784,164 @@ func (u *uiContext) show(search string, snapshot int) error {
 		return nil
 	}
 
+	err = u.store.CheckIn(uuid, u.holderName(), false)
+	if blobformat.IsCheckedOut(err) {
+		errColor.Println(err)
+		yes, err := u.getYesNo("force check in?")
+		if err != nil || !yes {
+			return err
+		}
+
+		err = u.store.CheckIn(uuid, u.holderName(), true)
+	}
+	if err != nil {
+		return err
+	}
+
+	infoColor.Println("checked in")
+	return nil
+}
+
+// checkCheckout warns the user if the entry is checked out by someone else
+// and asks if they want to continue anyway.
+func (u *uiContext) checkCheckout(uuid string) (bool, error) {
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return false, err
+	}
+
+	c, ok, err := blob.Checkout()
+	if err != nil {
+		return false, err
+	}
+	if !ok || c.Holder == u.holderName() || c.Stale(time.Now()) {
+		return true, nil
+	}
+
+	errColor.Printf("%s is %v\n", blob.Name(), blobformat.CheckedOutError{Checkout: c})
+	return u.getYesNo("continue anyway?")
+}
+
+// checkWindow checks if the entry may be revealed right now. If it's outside
+// of the entry's access windows the user may override it by confirming and
+// giving a reason which is recorded in the entry's history.
+func (u *uiContext) checkWindow(uuid string) (bool, error) {
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return false, err
+	}
+
+	in, err := blob.InWindow(time.Now())
+	if err != nil {
+		errColor.Println(err)
+		return false, nil
+	}
+	if in {
+		return true, nil
+	}
+
+	errColor.Printf("%s may only be revealed during: %s\n", blob.Name(), blob[blobformat.KeyWindow])
+	if u.readOnly {
+		errColor.Println("cannot override in read-only mode")
+		return false, nil
+	}
+
+	yes, err := u.getYesNo("override (this will be recorded)?")
+	if err != nil || !yes {
+		return false, err
+	}
+
+	reason, err := u.prompt(promptColor.Sprint("reason: "))
+	if err != nil {
+		return false, err
+	}
+	reason = strings.TrimSpace(reason)
+	if len(reason) == 0 {
+		errColor.Println("a reason is required to override")
+		return false, nil
+	}
+
+	u.store.RecordOverride(uuid, u.holderName(), reason)
+	return true, nil
+}
+
+// trackAccess records that the secrets of an entry were read if access
+// tracking is turned on
+func (u *uiContext) trackAccess(uuid string) {
+	if flagTrackAccess && !u.readOnly {
+		u.store.TouchAccessed(uuid)
+	}
+}
+
+// twoFactor returns a code for one of an entry's two factor keys (an empty
+// label is the main one) and how long it's valid for. TOTP codes about to expire aren't handed out, it waits for the next
+// one instead. HOTP keys move their counter along which can't be saved in
+// read-only mode.
+func (u *uiContext) twoFactor(uuid, label string) (code string, remaining time.Duration, err error) {
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return "", 0, err
+	}
+
+	code, remaining, err = blob.TwoFactorNamedWithExpiry(label)
+	if err == blobformat.ErrHOTP {
+		if u.readOnly {
+			return "", 0, errors.New("hotp codes can't be generated in read-only mode")
+		}
+		code, err = u.store.NextTwoFactorNamed(uuid, label)
+		return code, 0, err
+	}
+	if err != nil || len(code) == 0 || remaining >= totpMinValidity {
+		return code, remaining, err
+	}
+
+	infoColor.Printf("code expires in %ds, waiting for the next one\n", int(remaining.Seconds()+0.5))
+	time.Sleep(remaining)
+	return blob.TwoFactorNamedWithExpiry(label)
+}
+
+// twoFactorLabel checks if key names a two factor key, either totp or
+// totp:<label> for one of the labelled keys (see SetTwofactorNamed)
+func twoFactorLabel(key string) (label string, ok bool) {
+	if key == blobformat.KeyTwoFactor {
+		return "", true
+	}
+	if strings.HasPrefix(key, blobformat.KeyTwoFactor+":") {
+		return strings.TrimPrefix(key, blobformat.KeyTwoFactor+":"), true
+	}
+	return "", false
+}
+
+// holderName is who we are for the purposes of checkouts, in multi-user files
+// it's our username, otherwise it's user@host
+func (u *uiContext) holderName() string {
+	if len(u.user) != 0 {
+		return u.user
+	}
+
+	name := "unknown"
+	if current, err := user.Current(); err == nil {
+		name = current.Username
+	}
+	if host, err := os.Hostname(); err == nil {
+		name += "@" + host
+	}
+
+	return name
+}
+
+func (u *uiContext) show(search string, snapshot int) error {
+	uuid, err := u.findResolved(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+	if ok, err := u.checkWindow(uuid); err != nil || !ok {
+		return err
+	}
+
 	blob, err := u.store.MustFind(uuid)
 	if err != nil {
 		return err
@@ -1045,13 +2954,20 @@ func (u *uiContext) show(search string, snapshot int) error {
 			return nil
 		}
 
-		entry, err := u.store.EntrySnapshotAt(uuid, snapshot)
+		info, err := u.store.SnapshotInfo(uuid, snapshot)
 		if err != nil {
 			errColor.Println(err)
 			return nil
 		}
 
-		blob = blobformat.Blob(entry)
+		blob = info.Blob
+		if !info.Time.IsZero() {
+			infoColor.Printf("snapshot %d from %s", snapshot, info.Time.Format(time.RFC3339))
+			if len(info.Reason) != 0 {
+				infoColor.Printf(" (%s)", info.Reason)
+			}
+			fmt.Fprintln(u.out)
+		}
 	}
 
 	if len(blob) == 0 {
@@ -1059,6 +2975,11 @@ func (u *uiContext) show(search string, snapshot int) error {
 		return nil
 	}
 
+	fieldMeta, err := blob.AllFieldMeta()
+	if err != nil {
+		errColor.Println(err)
+	}
+
 	// Figure out the max width of the key names
 	width := 8
 	keys := blob.Keys()
@@ -1067,6 +2988,13 @@ func (u *uiContext) show(search string, snapshot int) error {
 			width = len(k) + 1 // +1 for : character
 		}
 	}
+	// Labelled two factor keys are shown as totp:<label>
+	labels, _ := blob.TwoFactorLabels()
+	for _, label := range labels {
+		if k := blobformat.KeyTwoFactor + ":" + label; len(k) > width {
+			width = len(k) + 1
+		}
+	}
 	width *= -1
 	indent := 2
 
@@ -1077,8 +3005,11 @@ func (u *uiContext) show(search string, snapshot int) error {
 		blobformat.KeyEmail,
 		blobformat.KeyPass,
 		blobformat.KeyTwoFactor,
+		blobformat.KeyTwoFactors,
 		blobformat.KeyLabels,
 		blobformat.KeyNotes,
+		blobformat.KeyExpires,
+		blobformat.KeyCheckout,
 	}
 
 	// Delete the ordering ones out of keys
@@ -1095,8 +3026,14 @@ func (u *uiContext) show(search string, snapshot int) error {
 	keys = append(ordering, keys...)
 
 	for _, k := range keys {
-		if k == blobformat.KeyUpdated {
-			// Special case, this one shows up at the end
+		switch k {
+		case blobformat.KeyCreated, blobformat.KeyUpdated, blobformat.KeyAccessed, blobformat.KeyCheckoutReason, blobformat.KeyCheckoutTime, blobformat.KeyFieldMeta,
+			blobformat.KeyImportID, blobformat.KeyImported:
+			// Special cases, these show up elsewhere
+			continue
+		}
+
+		if fieldMeta[k].Hidden {
 			continue
 		}
 
@@ -1111,14 +3048,115 @@ func (u *uiContext) show(search string, snapshot int) error {
 		case blobformat.KeyLabels:
 			showKeyValue(u, k, strings.ReplaceAll(val, ",", ", "), width, indent)
 		case blobformat.KeyTwoFactor:
-			t, err := blob.TwoFactor()
-			if err != nil {
+			if account, ok := blob.YubiKeyAccount(); ok {
+				// Asking the device may need a touch, don't for show
+				showKeyValue(u, blobformat.KeyTwoFactor, fmt.Sprintf("yubikey (%s)", account), width, indent)
+				continue
+			}
+			t, remaining, err := blob.TwoFactorWithExpiry()
+			if err == blobformat.ErrHOTP {
+				// Showing a code would use it up, show the counter instead
+				if counter, err := blob.HOTPCounter(); err == nil {
+					showKeyValue(u, blobformat.KeyTwoFactor, fmt.Sprintf("hotp (counter %d)", counter), width, indent)
+				}
+			} else if err != nil {
 				fmt.Println("Error retrieving two factor:", err)
 			} else if len(t) != 0 {
-				showKeyValue(u, blobformat.KeyTwoFactor, t, width, indent)
+				showKeyValue(u, blobformat.KeyTwoFactor, fmt.Sprintf("%s (%ds left)", t, int(remaining.Seconds())), width, indent)
+			}
+		case blobformat.KeyTwoFactors:
+			labels, err := blob.TwoFactorLabels()
+			if err != nil {
+				fmt.Println("Error retrieving two factor:", err)
+				continue
+			}
+			for _, label := range labels {
+				key := blobformat.KeyTwoFactor + ":" + label
+				t, remaining, err := blob.TwoFactorNamedWithExpiry(label)
+				if err == blobformat.ErrHOTP {
+					showKeyValue(u, key, "hotp", width, indent)
+				} else if err != nil {
+					fmt.Println("Error retrieving two factor:", err)
+				} else {
+					showKeyValue(u, key, fmt.Sprintf("%s (%ds left)", t, int(remaining.Seconds())), width, indent)
+				}
+			}
+		case blobformat.KeyExpires:
+			expires, err := blob.Expires()
+			if err != nil {
+				fmt.Println("Error retrieving expiry:", err)
+			} else if !expires.IsZero() {
+				val = expires.Format(time.RFC3339)
+				if !expires.After(time.Now()) {
+					val += " " + errColor.Sprint("[expired]")
+				}
+				showKeyValue(u, k, val, width, indent)
+			}
+		case blobformat.KeyCheckout:
+			c, ok, err := blob.Checkout()
+			if err != nil {
+				fmt.Println("Error retrieving checkout:", err)
+			} else if ok {
+				val = fmt.Sprintf("%s since %s", c.Holder, c.Time.Format(time.RFC3339))
+				if len(c.Reason) != 0 {
+					val += " (" + c.Reason + ")"
+				}
+				if c.Stale(time.Now()) {
+					val += " [stale]"
+				}
+				showKeyValue(u, k, val, width, indent)
+			}
+		case blobformat.KeyNotes:
+			showMultiline(u, k, noteLines(blob.Notes()), width, indent)
+		case blobformat.KeyQuestions:
+			questions, err := blob.Questions()
+			if err != nil {
+				fmt.Println("Error retrieving security questions:", err)
+			} else {
+				showMultiline(u, k, questionLines(questions, true), width, indent)
+			}
+		case blobformat.KeyRecoveryCodes:
+			left, total, err := blob.RecoveryCodesLeft()
+			if err != nil {
+				fmt.Println("Error retrieving recovery codes:", err)
+			} else {
+				showKeyValue(u, k, fmt.Sprintf("%d of %d left", left, total), width, indent)
+			}
+		case blobformat.KeyFavorite, blobformat.KeyProtected:
+			showKeyValue(u, k, "yes", width, indent)
+		case blobformat.KeyIcon:
+			mimeType, data, err := blob.Icon()
+			if err != nil {
+				fmt.Println("Error retrieving icon:", err)
+			} else if data != nil {
+				showKeyValue(u, k, fmt.Sprintf("%s (%d bytes)", mimeType, len(data)), width, indent)
+			}
+		case blobformat.KeyShares:
+			shares, err := blob.Shares()
+			if err != nil {
+				fmt.Println("Error retrieving shares:", err)
+				continue
+			}
+			var lines []string
+			for _, sh := range shares {
+				line := fmt.Sprintf("%s on %s", sh.Recipient, sh.Time.Format("2006-01-02"))
+				if !sh.Recalled.IsZero() {
+					line += fmt.Sprintf(" (recalled %s)", sh.Recalled.Format("2006-01-02"))
+				}
+				lines = append(lines, line)
+			}
+			showMultiline(u, "shared", strings.Join(lines, "\n"), width, indent)
+		case blobformat.KeyImportSource:
+			p, err := blob.Provenance()
+			if err != nil {
+				fmt.Println("Error retrieving provenance:", err)
+			} else {
+				showKeyValue(u, "imported", p.String(), width, indent)
 			}
 		default:
-			if strings.ContainsRune(val, '\n') {
+			if fieldMeta[k].Sensitive {
+				showHidden(u, k, val, width, indent)
+			} else if strings.ContainsRune(val, '\n') {
 				showMultiline(u, k, val, width, indent)
 			} else {
 				showKeyValue(u, k, val, width, indent)
@@ -1126,15 +3164,26 @@ func (u *uiContext) show(search string, snapshot int) error {
 		}
 	}
 
+	if created, err := blob.Created(); err != nil {
+		return err
+	} else if !created.IsZero() {
+		showKeyValue(u, "created", created.Format(time.RFC3339), width, indent)
+	}
 	if update, err := blob.Updated(); err != nil {
 		return err
 	} else if !update.IsZero() {
 		showKeyValue(u, "updated", update.Format(time.RFC3339), width, indent)
 	}
+	if accessed, err := blob.Accessed(); err != nil {
+		return err
+	} else if !accessed.IsZero() {
+		showKeyValue(u, "accessed", accessed.Format(time.RFC3339), width, indent)
+	}
 
 	if snaps > 0 && snapshot == 0 {
 		showKeyValue(u, "snaps", strconv.Itoa(snaps), width, indent)
 	}
+	showKeyValue(u, "uuid", uuid, width, indent)
 
 	return nil
 }
@@ -1164,7 +3213,7 @@ func showMultiline(u *uiContext, key string, val string, width, indent int) {
 }
 
 func (u *uiContext) openurl(search string) error {
-	uuid, err := u.findOne(search)
+	uuid, err := u.findResolved(search)
 	if err != nil {
 		return nil
 	}
@@ -1236,6 +3285,9 @@ func validateLabel(labels []string, label string) bool {
 		if unicode.IsSpace(c) {
 			errColor.Println("Labels cannot contain spaces")
 			return false
+		} else if c == '|' || c == ',' {
+			errColor.Println("Labels cannot contain | or ,")
+			return false
 		} else if unicode.IsUpper(c) {
 			errColor.Println("Labels cannot contain uppercase")
 			return false
@@ -1252,13 +3304,31 @@ func validateLabel(labels []string, label string) bool {
 	return true
 }
 
-func copyToClipboard(kind string, txt string) {
+// copyToClipboard copies txt, if it's a secret clipboard managers are checked
+// for first (see guardClipboard)
+// copiedSecret is set once a secret has been copied so we can let the user
+// know when it's cleared
+var copiedSecret bool
+
+func copyToClipboard(kind string, txt string, secret bool) {
+	if secret {
+		ok, done := guardClipboard(flagStrictClip)
+		if !ok {
+			return
+		}
+		defer done()
+	}
+
 	err := clipboard.WriteAll(txt)
 	if err != nil {
 		errColor.Printf("Failed to copy %s to clipboard", kind)
 		return
 	}
 
+	if secret {
+		copiedSecret = true
+	}
+
 	infoColor.Print("Copied ")
 	keyColor.Print(kind)
 	infoColor.Println(" to clipboard")
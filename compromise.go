@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+)
+
+var compromiseBlurb = `This walks you through recovering from a leaked master passphrase:
+  1. the file is rekeyed so the old passphrase no longer opens it
+  2. every entry with a secret is flagged as possibly leaked
+  3. you rotate them one at a time, most sensitive first
+
+Copies of the file encrypted with the old passphrase (backups, synced
+copies, archives) can still be opened by whoever has it, the rotation is
+what makes them worthless. Run compromise-response again at any time to
+continue where you left off.
+`
+
+// compromiseResponse starts or continues recovering from a compromised
+// master passphrase.
+func (u *uiContext) compromiseResponse() error {
+	queue, flagged, err := u.store.RotationQueue()
+	if err != nil {
+		return err
+	}
+
+	if flagged == 0 {
+		errColor.Println(compromiseBlurb)
+		ok, err := u.getYesNo("start now?")
+		if err != nil || !ok {
+			return err
+		}
+
+		infoColor.Println("\nstep 1: rekey the file")
+		if len(u.master) != 0 {
+			if err = u.rekeyAll(); err != nil {
+				return err
+			}
+		} else if err = u.passwd(""); err != nil {
+			return err
+		}
+
+		infoColor.Println("\nstep 2: flag every entry for rotation")
+		var n int
+		err = u.store.DB.Because("compromise response", func() (err error) {
+			n, err = u.store.FlagCompromised(time.Now())
+			return err
+		})
+		if err != nil {
+			return err
+		}
+		infoColor.Printf("flagged %d entries\n", n)
+
+		if queue, flagged, err = u.store.RotationQueue(); err != nil {
+			return err
+		}
+		infoColor.Println("\nstep 3: rotate them")
+	}
+
+	for i, r := range queue {
+		infoColor.Printf("\n%s rotated\n", compromiseProgress(flagged-len(queue)+i, flagged))
+		fmt.Fprintf(u.out, "next: %s", keyColor.Sprint(r.Name))
+		if len(r.Reasons) != 0 {
+			fmt.Fprintf(u.out, " (%s)", strings.Join(r.Reasons, ", "))
+		}
+		fmt.Fprintln(u.out)
+
+		choice, err := u.prompt(promptColor.Sprint("[r]otate, [s]kip or [q]uit: "))
+		if err != nil {
+			return err
+		}
+		switch choice {
+		case "r":
+		case "q":
+			infoColor.Println("run compromise-response again to continue")
+			return nil
+		default:
+			continue
+		}
+
+		blob, err := u.store.MustFind(r.UUID)
+		if err != nil {
+			return err
+		}
+		if len(blob[blobformat.KeyPass]) != 0 {
+			if err = u.rotate(r.UUID); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Keys and tokens can only be revoked where they're used
+		errColor.Printf("revoke the old %s where it's used, create a new one and set it with:\n",
+			secretName(blob))
+		fmt.Fprintf(u.out, "  set %s %s\n", r.Name, secretName(blob))
+	}
+
+	if queue, flagged, err = u.store.RotationQueue(); err != nil {
+		return err
+	}
+	if len(queue) != 0 {
+		infoColor.Printf("\n%s rotated, run compromise-response again to continue\n", compromiseProgress(flagged-len(queue), flagged))
+		return nil
+	}
+
+	if err = u.store.EndCompromise(); err != nil {
+		return err
+	}
+	infoColor.Printf("\nall %d entries have been rotated\n", flagged)
+	return nil
+}
+
+// compromiseProgress is n/total as a bar
+func compromiseProgress(n, total int) string {
+	const width = 20
+	done := width
+	if total != 0 {
+		done = n * width / total
+	}
+	return fmt.Sprintf("[%s%s] %d/%d", strings.Repeat("#", done), strings.Repeat("-", width-done), n, total)
+}
+
+// secretName is the name of the key holding the secret of an entry without
+// a password
+func secretName(blob blobformat.Blob) string {
+	if len(blob[blobformat.KeyPriv]) != 0 {
+		return blobformat.KeyPriv
+	}
+	return blobformat.KeyToken
+}
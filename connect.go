@@ -0,0 +1,136 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/aarondl/bpass/blobformat"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+)
+
+// agentKeyLifetime is how long the private key is kept in the agent we give
+// ssh, it only needs it to log in.
+const agentKeyLifetime = 60
+
+// connect runs ssh to the host described by an entry (see the infra
+// template). If the entry has a private key it's given to ssh through an
+// agent that only lives as long as the connection so it never touches the
+// disk, otherwise the password is copied to the clipboard.
+func (u *uiContext) connect(search string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	target, err := blob.SSHTarget()
+	var verr blobformat.ValidationError
+	if err == blobformat.ErrNoHost || errors.As(err, &verr) {
+		errColor.Println(err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	sshPath, err := exec.LookPath("ssh")
+	if err != nil {
+		errColor.Println("could not find ssh:", err)
+		return nil
+	}
+
+	cmd := exec.Command(sshPath, target.Args()...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	if privKey := blob[blobformat.KeyPriv]; len(privKey) != 0 {
+		sock, stop, err := serveAgent(privKey)
+		if err != nil {
+			errColor.Println("could not load the private key into an agent:", err)
+			return nil
+		}
+		defer stop()
+
+		cmd.Env = append(os.Environ(), "SSH_AUTH_SOCK="+sock)
+	} else if pass := blob.Get(blobformat.KeyPass); len(pass) != 0 {
+		copyToClipboard(blobformat.KeyPass, pass, true)
+	}
+
+	infoColor.Println("ssh", strings.Join(target.Args(), " "))
+	if err = cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			errColor.Println("ssh exited with:", exitErr)
+			return nil
+		}
+		return err
+	}
+
+	return nil
+}
+
+// serveAgent starts an ssh agent holding only the given private key on a
+// unix socket in a private temp dir. stop shuts it down and removes the
+// socket.
+func serveAgent(privKey string) (sock string, stop func(), err error) {
+	key, err := ssh.ParseRawPrivateKey([]byte(privKey))
+	if err != nil {
+		return "", nil, err
+	}
+
+	keyring := agent.NewKeyring()
+	err = keyring.Add(agent.AddedKey{
+		PrivateKey:   key,
+		Comment:      "bpass",
+		LifetimeSecs: agentKeyLifetime,
+	})
+	if err != nil {
+		return "", nil, err
+	}
+
+	dir, err := ioutil.TempDir("", "bpass-agent")
+	if err != nil {
+		return "", nil, err
+	}
+	sock = filepath.Join(dir, "agent.sock")
+
+	listener, err := net.Listen("unix", sock)
+	if err != nil {
+		_ = os.RemoveAll(dir)
+		return "", nil, err
+	}
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				_ = agent.ServeAgent(keyring, conn)
+				_ = conn.Close()
+			}()
+		}
+	}()
+
+	stop = func() {
+		_ = listener.Close()
+		_ = keyring.RemoveAll()
+		_ = os.RemoveAll(dir)
+	}
+	return sock, stop, nil
+}
@@ -11,6 +11,7 @@ import (
 
 	"github.com/enceve/crypto/camellia"
 	"golang.org/x/crypto/cast5"
+	"golang.org/x/crypto/chacha20poly1305"
 )
 
 // Error returns from decoding
@@ -19,6 +20,10 @@ var (
 	ErrNeedUser          = errors.New("need user")
 	ErrUnknownUser       = errors.New("unknown user")
 	ErrInvalidFileFormat = errors.New("file format invalid")
+	// ErrCorrupt is returned when a user's key opens the file but the
+	// payload fails authentication, it was changed or damaged after it was
+	// written
+	ErrCorrupt = errors.New("file is corrupt")
 )
 
 // Error returns from encoding
@@ -44,11 +49,21 @@ var v0Header = []byte{
 // config represents a configuration for the encryption/decryption/keygen
 // behavior.
 type config struct {
-	version   int
-	algs      []string
-	saltSize  int
-	keySize   int
+	version  int
+	algs     []string
+	saltSize int
+	keySize  int
+	// blockSize is the size of the ivs, for aead versions it's the nonce size
 	blockSize int
+	// overhead is what an aead adds to what it seals, 0 for the cipher
+	// cascade versions
+	overhead int
+	// tokens is set when the header has a block of tokens (see Token)
+	tokens bool
+	// descriptor is set when the magic string is followed by a Descriptor,
+	// kdf is the key derivation it names when writing
+	descriptor bool
+	kdf        int
 
 	// these functions must be set for the config to be able to do anything
 	encrypt    encryptFn
@@ -56,6 +71,8 @@ type config struct {
 	decrypt    decryptFn
 	keygen     keyFn
 	mkeygen    mkeyFn
+	// saltgen is optional, salts are random bytes if it's nil
+	saltgen saltFn
 }
 
 type cipherAlg struct {
@@ -74,6 +91,7 @@ type (
 	decryptFn     func(c config, user, passphrase, key, salt, encrypted []byte) (p Params, pt []byte, err error)
 	keyFn         func(c config, passphrase, salt []byte) (key []byte, err error)
 	mkeyFn        func(c config) (master, iv []byte, err error)
+	saltFn        func(c config, cost KeyCost) (salt []byte, err error)
 )
 
 var (
@@ -88,6 +106,34 @@ var (
 func init() {
 	// Create all the versioned configurations
 	makeVersion(1, encryptV1, encryptMasterKeyV1, decryptV1, deriveKeyV1, newMasterKeyV1, 32, "AES", "Camellia", "CAST5")
+	versions[2] = config{
+		version:    2,
+		algs:       []string{"XChaCha20-Poly1305"},
+		saltSize:   32,
+		keySize:    chacha20poly1305.KeySize,
+		blockSize:  chacha20poly1305.NonceSizeX,
+		overhead:   16, // the Poly1305 tag
+		encrypt:    encryptV2,
+		encryptKey: encryptMasterKeyV2,
+		decrypt:    decryptV2,
+		keygen:     deriveKeyV1,
+		mkeygen:    newMasterKeyV1,
+	}
+	v3 := versions[2]
+	v3.version = 3
+	v3.saltSize = keyCostLen + 32
+	v3.keygen = deriveKeyV3
+	v3.saltgen = newSaltV3
+	versions[3] = v3
+	v4 := v3
+	v4.version = 4
+	v4.tokens = true
+	versions[4] = v4
+	v5 := v4
+	v5.version = 5
+	v5.descriptor = true
+	v5.kdf = KDFArgon2id
+	versions[5] = v5
 }
 
 // makeVersion is a helper for calculating block and key size from the
@@ -199,7 +245,7 @@ func Decrypt(user, passphrase, key, salt, encrypted []byte) (version int, p Para
 
 	c, err := getVersion(version)
 	if err != nil {
-		return 0, p, nil, fmt.Errorf("unknown version %d, try upgrading bpass", version)
+		return 0, p, nil, fmt.Errorf("%w: unknown version %d", ErrUnsupported, version)
 	}
 
 	p, pt, err = c.decrypt(c, user, passphrase, key, salt, encrypted)
@@ -239,16 +285,32 @@ func IsMultiUser(encrypted []byte) (ok bool, err error) {
 // computer on which its run and so if a rekey is necessary it should
 // probably occur after a save, or early in the lifecycle due to the
 // likelihood of crashing the program given the high resource usages.
+//
+// From version 3 on the salt starts with the DefaultKeyCost the key was
+// derived with (see SaltKeyCost) so it can be changed without breaking
+// older keys.
 func DeriveKey(version int, passphrase []byte) (key, salt []byte, err error) {
+	return DeriveKeyCost(version, passphrase, DefaultKeyCost)
+}
+
+// DeriveKeyCost is DeriveKey with the given cost instead of DefaultKeyCost,
+// versions before 3 have no cost and ignore it.
+func DeriveKeyCost(version int, passphrase []byte, cost KeyCost) (key, salt []byte, err error) {
 	c, err := getVersion(version)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	// Secure random salt for passphrase derivation
-	salt = make([]byte, c.saltSize)
-	if n, err := rand.Read(salt); n != c.saltSize || err != nil {
-		return nil, nil, fmt.Errorf("failed to get randomness for salt: %w", err)
+	if c.saltgen != nil {
+		if salt, err = c.saltgen(c, cost); err != nil {
+			return nil, nil, err
+		}
+	} else {
+		// Secure random salt for passphrase derivation
+		salt = make([]byte, c.saltSize)
+		if n, err := rand.Read(salt); n != c.saltSize || err != nil {
+			return nil, nil, fmt.Errorf("failed to get randomness for salt: %w", err)
+		}
 	}
 
 	key, err = c.keygen(c, passphrase, salt)
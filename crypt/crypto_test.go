@@ -3,8 +3,10 @@ package crypt
 import (
 	"bytes"
 	"crypto/sha256"
+	"errors"
 	"sort"
 	"testing"
+	"time"
 )
 
 func TestCrypt(t *testing.T) {
@@ -85,10 +87,6 @@ func TestCryptMulti(t *testing.T) {
 	passphrase1 := []byte("hunter42?")
 	passphrase2 := []byte("hunter42!")
 	plaintext := []byte("plaintext goes here")
-	master, miv, err := NewMasterKey(1)
-	if err != nil {
-		t.Fatal(err)
-	}
 
 	var versionNumbers []int
 	for v := range versions {
@@ -98,6 +96,11 @@ func TestCryptMulti(t *testing.T) {
 	sort.Ints(versionNumbers)
 
 	for _, v := range versionNumbers {
+		master, miv, err := NewMasterKey(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+
 		key1, salt1, err := DeriveKey(v, passphrase1)
 		if err != nil {
 			t.Errorf("%d) failed to derive key: %v", v, err)
@@ -107,11 +110,11 @@ func TestCryptMulti(t *testing.T) {
 			t.Errorf("%d) failed to derive key: %v", v, err)
 		}
 
-		mkey1, iv1, err := EncryptMasterKey(1, key1, master)
+		mkey1, iv1, err := EncryptMasterKey(v, key1, master)
 		if err != nil {
 			t.Fatal(err)
 		}
-		mkey2, iv2, err := EncryptMasterKey(1, key2, master)
+		mkey2, iv2, err := EncryptMasterKey(v, key2, master)
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -206,6 +209,93 @@ func TestCryptMulti(t *testing.T) {
 		if !bytes.Equal(plaintext, gotPlaintext) {
 			t.Errorf("want: %s, got: %s", plaintext, gotPlaintext)
 		}
+
+		if v < 2 {
+			continue
+		}
+		// The master key still opens so damage is told apart from a bad
+		// passphrase
+		bad := append([]byte(nil), ciphertext...)
+		bad[len(bad)-1] ^= 1
+		if _, _, _, err = Decrypt([]byte("user2"), nil, key2, salt2, bad); err != ErrCorrupt {
+			t.Errorf("%d) expected corrupt: %v", v, err)
+		}
+	}
+}
+
+func TestReadHeader(t *testing.T) {
+	t.Parallel()
+
+	c, err := getVersion(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p Params
+	p.Keys = [][]byte{make([]byte, c.keySize)}
+	p.Salts = [][]byte{make([]byte, c.saltSize)}
+	ciphertext, err := Encrypt(1, &p, []byte("plaintext goes here"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ReadHeader(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != 1 || h.NUsers != 0 {
+		t.Error("header was wrong:", h)
+	}
+
+	bad := [][]byte{
+		ciphertext[:10],
+		ciphertext[:len(ciphertext)-1],
+		ciphertext[:magicLen+c.saltSize+c.blockSize],
+		append([]byte("blobpass99990000"), ciphertext[magicLen:]...),
+		append([]byte("blobpass0001000x"), ciphertext[magicLen:]...),
+		append([]byte("blobpass00010002"), ciphertext[magicLen:]...),
+	}
+
+	for i, b := range bad {
+		if _, err = ReadHeader(b); !errors.Is(err, ErrInvalidFileFormat) {
+			t.Errorf("%d) expected invalid file format: %v", i, err)
+		}
+	}
+}
+
+func TestCryptV2Tampering(t *testing.T) {
+	t.Parallel()
+
+	c, err := getVersion(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, c.keySize)
+	salt := make([]byte, c.saltSize)
+	var p Params
+	p.Keys = [][]byte{key}
+	p.Salts = [][]byte{salt}
+	ciphertext, err := Encrypt(2, &p, []byte("plaintext goes here"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := Encrypt(2, &p, []byte("plaintext goes here"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(ciphertext, again) {
+		t.Error("nonce should be new every time")
+	}
+
+	// Flip a bit in the salt, the nonce and the sealed data, the salt is
+	// swapped back in for the fast path so only authentication can catch it
+	for _, i := range []int{magicLen, magicLen + c.saltSize, len(ciphertext) - 1} {
+		bad := append([]byte(nil), ciphertext...)
+		bad[i] ^= 1
+		if _, _, _, err = Decrypt(nil, nil, key, bad[magicLen:magicLen+c.saltSize], bad); err != ErrWrongPassphrase {
+			t.Errorf("%d) expected wrong passphrase: %v", i, err)
+		}
 	}
 }
 
@@ -287,3 +377,154 @@ func TestKeyDerivation(t *testing.T) {
 		t.Errorf("key was not equal: %#v", key)
 	}
 }
+
+func TestKeyDerivationV3(t *testing.T) {
+	t.Parallel()
+
+	c, err := getVersion(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cost := KeyCost{Time: 1, Memory: 64, Threads: 1}
+	salt := []byte{0, 0, 0, 1, 0, 0, 0, 64, 1}
+	salt = append(salt, bytes.Repeat([]byte{'s'}, 32)...)
+
+	if got, ok := SaltKeyCost(salt); !ok || got != cost {
+		t.Error("cost was wrong:", got, ok)
+	}
+	if _, ok := SaltKeyCost(salt[:32]); ok {
+		t.Error("a version 1 salt has no cost")
+	}
+
+	key, err := deriveKeyV3(c, []byte("hunter42"), salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(key) != c.keySize {
+		t.Error("keysize was wrong:", len(key))
+	}
+
+	again, err := deriveKeyV3(c, []byte("hunter42"), salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(key, again) {
+		t.Error("key should be the same for the same salt")
+	}
+
+	// The cost is part of the salt so changing it changes the key
+	salt[3] = 2
+	costlier, err := deriveKeyV3(c, []byte("hunter42"), salt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(key, costlier) {
+		t.Error("key should change with the cost")
+	}
+
+	salt[3] = 0
+	if _, err = deriveKeyV3(c, []byte("hunter42"), salt); !errors.Is(err, ErrInvalidFileFormat) {
+		t.Error("expected invalid file format for a zero cost:", err)
+	}
+	salt[3], salt[5] = 1, 0xff
+	if _, err = deriveKeyV3(c, []byte("hunter42"), salt); !errors.Is(err, ErrInvalidFileFormat) {
+		t.Error("expected invalid file format for too much memory:", err)
+	}
+
+	if _, salt, err = DeriveKeyCost(3, []byte("hunter42"), cost); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := SaltKeyCost(salt); got != cost {
+		t.Error("new salt should have the cost it was derived with:", got)
+	}
+}
+
+func TestCalibrate(t *testing.T) {
+	t.Parallel()
+
+	if testing.Short() {
+		t.Skip("skipping long test")
+	}
+
+	cost := Calibrate(DefaultKeyCost, time.Nanosecond)
+	if cost.Time != 1 || cost.Memory != DefaultKeyCost.Memory || cost.Threads != DefaultKeyCost.Threads {
+		t.Error("cost was wrong:", cost)
+	}
+}
+
+func TestDescriptor(t *testing.T) {
+	t.Parallel()
+
+	c, err := getVersion(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, c.keySize)
+	salt := make([]byte, c.saltSize)
+	var p Params
+	p.Keys = [][]byte{key}
+	p.Salts = [][]byte{salt}
+	plaintext := bytes.Repeat([]byte("plaintext goes here"), 100)
+	ciphertext, err := Encrypt(5, &p, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ReadHeader(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Descriptor{KDF: KDFArgon2id, Cipher: CipherXChaCha20Poly1305, Flags: FlagCompressed}
+	if h.Descriptor != want {
+		t.Errorf("descriptor was wrong: %#v", h.Descriptor)
+	}
+	if h.PayloadLen >= len(plaintext) {
+		t.Error("payload should have been compressed:", h.PayloadLen)
+	}
+
+	_, _, pt, err := Decrypt(nil, nil, key, salt, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pt, plaintext) {
+		t.Error("plaintext was wrong")
+	}
+
+	// Things this version doesn't know are refused before anything is
+	// decrypted
+	kdf, cipher, flags := magicLen+1, magicLen+2, magicLen+3
+	for _, i := range []int{kdf, cipher, flags} {
+		bad := append([]byte(nil), ciphertext...)
+		bad[i] = 0x80
+		if _, err = ReadHeader(bad); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%d) expected unsupported: %v", i, err)
+		}
+		if _, _, _, err = Decrypt(nil, nil, key, salt, bad); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%d) expected unsupported: %v", i, err)
+		}
+	}
+
+	// Fields from a later version are skipped
+	longer := append([]byte(nil), ciphertext[:magicLen]...)
+	longer = append(longer, descriptorFields+1, KDFArgon2id, CipherXChaCha20Poly1305, 0, 7)
+	longer = append(longer, ciphertext[magicLen+1+descriptorFields:]...)
+	got, err := ReadHeader(longer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Descriptor.KDF != KDFArgon2id || got.PayloadLen != h.PayloadLen {
+		t.Errorf("header was wrong: %#v", got)
+	}
+
+	// And versions it doesn't know are too
+	future := append([]byte(nil), ciphertext...)
+	copy(future[magicLen/2:], "9999")
+	if _, err = ReadHeader(future); !errors.Is(err, ErrUnsupported) {
+		t.Error("expected unsupported:", err)
+	}
+	if _, _, _, err = Decrypt(nil, nil, key, salt, future); !errors.Is(err, ErrUnsupported) {
+		t.Error("expected unsupported:", err)
+	}
+}
@@ -0,0 +1,243 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/chacha20poly1305"
+)
+
+// encryptV2 creates this format:
+// 8:magic|4:version|4:0|32:passphraseSalt|24:nonce|(data|16:tag)
+// or in the multi-user case:
+// 8:magic|4:version|4:nusers|32:u1|32:s1|24:n1|48:(mk)|32:u2|32:s2|24:n2|48:(mk)|24:noncem|(data|16:tag)
+// where data is sealed with XChaCha20-Poly1305 and everything before it is
+// authenticated along with it. Version 3 is the same format with salts that
+// carry the cost of the key (see newSaltV3). Version 4 adds the tokens (see
+// encodeTokens) before the payload's nonce. Version 5 adds a Descriptor after
+// the magic string and may deflate the data before it's sealed.
+//
+// Unlike the iv in version 1 the payload's nonce can't be reused with the same
+// key so a new one is made every time, in multi-user files params.IVM is
+// only used to decrypt.
+func encryptV2(c config, p *Params, plaintext []byte) (encrypted []byte, err error) {
+	var descriptor []byte
+	if c.descriptor {
+		d := Descriptor{KDF: c.kdf, Cipher: CipherXChaCha20Poly1305}
+		var compressed bool
+		if plaintext, compressed, err = compress(plaintext); err != nil {
+			return nil, err
+		}
+		if compressed {
+			d.Flags |= FlagCompressed
+		}
+		descriptor = d.encode()
+	}
+
+	var header []byte
+	var key []byte
+	if p.NUsers == 0 {
+		if len(p.Keys[0]) != c.keySize {
+			return nil, ErrInvalidKey
+		}
+		if len(p.Salts[0]) != c.saltSize {
+			return nil, ErrInvalidSalt
+		}
+
+		header = make([]byte, magicLen, magicLen+len(descriptor)+c.saltSize+c.blockSize)
+		copy(header, fmt.Sprintf("%s%04d%04d", magicStr, c.version, 0))
+		header = append(header, descriptor...)
+		header = append(header, p.Salts[0]...)
+		key = p.Keys[0]
+	} else {
+		userSize := sha256.Size + c.saltSize + c.blockSize + c.keySize + c.overhead
+		header = make([]byte, magicLen, magicLen+len(descriptor)+userSize*p.NUsers+c.blockSize)
+		copy(header, fmt.Sprintf("%s%04d%04d", magicStr, c.version, p.NUsers))
+		header = append(header, descriptor...)
+
+		for i := 0; i < p.NUsers; i++ {
+			if len(p.Keys[i]) != 0 && len(p.Keys[i]) != c.keySize {
+				return nil, ErrInvalidKey
+			}
+			if len(p.Salts[i]) != c.saltSize {
+				return nil, ErrInvalidSalt
+			}
+
+			header = append(header, p.Users[i]...)
+			header = append(header, p.Salts[i]...)
+			header = append(header, p.IVs[i]...)
+			header = append(header, p.MKeys[i]...)
+		}
+		key = p.Master
+	}
+
+	if c.tokens {
+		header = append(header, encodeTokens(p.Tokens)...)
+	}
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, c.blockSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, fmt.Errorf("failed to get randomness for nonce: %w", err)
+	}
+	header = append(header, nonce...)
+
+	return aead.Seal(header, nonce, plaintext, header), nil
+}
+
+// encryptMasterKeyV2 seals the master key with the user's key, the nonce is
+// returned as the iv.
+func encryptMasterKeyV2(c config, userKey []byte, master []byte) (cryptedMaster, iv []byte, err error) {
+	if len(master) != c.keySize {
+		return nil, nil, fmt.Errorf("master key must be %d bytes", c.keySize)
+	}
+
+	aead, err := chacha20poly1305.NewX(userKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	iv = make([]byte, c.blockSize)
+	if _, err := io.ReadFull(rand.Reader, iv); err != nil {
+		return nil, nil, fmt.Errorf("error generating randomness for nonce: %w", err)
+	}
+
+	return aead.Seal(nil, iv, master, nil), iv, nil
+}
+
+func decryptV2(c config, user, passphrase, key, salt, encrypted []byte) (p Params, plaintext []byte, err error) {
+	h, err := ReadHeader(encrypted)
+	if err != nil {
+		return p, nil, err
+	}
+	c, _, start, err := negotiate(c, encrypted)
+	if err != nil {
+		return p, nil, err
+	}
+	if h.NUsers != 0 && len(user) == 0 {
+		return p, nil, ErrNeedUser
+	}
+
+	headerLen := len(encrypted) - h.PayloadLen
+	header := encrypted[:headerLen]
+	nonce := header[headerLen-c.blockSize:]
+	defer func() { p.Tokens = h.Tokens }()
+
+	var payloadKey []byte
+	if h.NUsers == 0 {
+		newSalt := header[start : start+c.saltSize]
+		if key, err = v2UserKey(c, passphrase, key, salt, newSalt); err != nil {
+			return p, nil, err
+		}
+
+		p.Keys = [][]byte{key}
+		p.Salts = [][]byte{append([]byte(nil), newSalt...)}
+		p.IVs = [][]byte{append([]byte(nil), nonce...)}
+		payloadKey = key
+	} else {
+		p, err = decryptV2Master(c, h, user, passphrase, key, salt, header[start:])
+		if err != nil {
+			return p, nil, err
+		}
+		p.IVM = append([]byte(nil), nonce...)
+		payloadKey = p.Master
+	}
+
+	aead, err := chacha20poly1305.NewX(payloadKey)
+	if err != nil {
+		return p, nil, err
+	}
+	plaintext, err = aead.Open(nil, nonce, encrypted[headerLen:], header)
+	if err != nil {
+		// The master key is authenticated on its own so if it opened the
+		// passphrase was right and something else changed
+		if h.NUsers != 0 {
+			return p, nil, ErrCorrupt
+		}
+		return p, nil, ErrWrongPassphrase
+	}
+
+	if h.Descriptor.Flags&FlagCompressed != 0 {
+		if plaintext, err = decompress(plaintext); err != nil {
+			return p, nil, err
+		}
+	}
+
+	return p, plaintext, nil
+}
+
+// decryptV2Master reads the users out of the header of a multi-user file and
+// opens the master key with the user's key, users is the header from the
+// first user on
+func decryptV2Master(c config, h Header, user, passphrase, key, salt, users []byte) (p Params, err error) {
+	p.NUsers = h.NUsers
+	p.User = -1
+	p.Users = h.Users
+
+	s := sha256.Sum256(user)
+	userHash := s[:]
+
+	offset := 0
+	for i := 0; i < h.NUsers; i++ {
+		offset += sha256.Size
+
+		if p.User < 0 && bytes.Equal(p.Users[i], userHash) {
+			p.User = i
+		}
+
+		p.Salts = append(p.Salts, append([]byte(nil), users[offset:offset+c.saltSize]...))
+		offset += c.saltSize
+		p.IVs = append(p.IVs, append([]byte(nil), users[offset:offset+c.blockSize]...))
+		offset += c.blockSize
+		p.MKeys = append(p.MKeys, append([]byte(nil), users[offset:offset+c.keySize+c.overhead]...))
+		offset += c.keySize + c.overhead
+	}
+
+	if p.User < 0 {
+		// Like version 1 the unknown user isn't reported, the key just
+		// won't open anything
+		p.Users = append(p.Users, userHash)
+		p.Salts = append(p.Salts, make([]byte, c.saltSize))
+		p.IVs = append(p.IVs, make([]byte, c.blockSize))
+		p.MKeys = append(p.MKeys, make([]byte, c.keySize+c.overhead))
+		p.User = p.NUsers
+		p.NUsers++
+	}
+
+	if key, err = v2UserKey(c, passphrase, key, salt, p.Salts[p.User]); err != nil {
+		return p, err
+	}
+	p.Keys = make([][]byte, p.NUsers)
+	p.Keys[p.User] = key
+
+	aead, err := chacha20poly1305.NewX(key)
+	if err != nil {
+		return p, err
+	}
+	p.Master, err = aead.Open(nil, p.IVs[p.User], p.MKeys[p.User], nil)
+	if err != nil {
+		return p, ErrWrongPassphrase
+	}
+
+	return p, nil
+}
+
+// v2UserKey returns key if it was derived with fileSalt, otherwise it derives
+// one from the passphrase
+func v2UserKey(c config, passphrase, key, salt, fileSalt []byte) ([]byte, error) {
+	if len(key) == c.keySize && bytes.Equal(salt, fileSalt) {
+		return key, nil
+	}
+	if len(passphrase) == 0 {
+		return nil, ErrWrongPassphrase
+	}
+
+	return c.keygen(c, passphrase, fileSalt)
+}
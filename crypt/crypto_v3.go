@@ -0,0 +1,134 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"time"
+
+	"golang.org/x/crypto/argon2"
+)
+
+// KeyCost is how expensive deriving a key from a passphrase with Argon2id is,
+// it's stored in front of the salt (see DeriveKey) so every key in a file can
+// have its own.
+type KeyCost struct {
+	// Time is the number of passes over the memory
+	Time uint32
+	// Memory is in KiB
+	Memory uint32
+	// Threads changes the key so it can't be lowered for slower machines
+	// without a rekey
+	Threads uint8
+}
+
+// DefaultKeyCost is the cost DeriveKey uses for new keys from version 3 on,
+// see Calibrate to pick one for the current machine.
+var DefaultKeyCost = KeyCost{Time: 3, Memory: 64 * 1024, Threads: 4}
+
+const (
+	// keyCostLen is 4:time|4:memory|1:threads
+	keyCostLen = 9
+	// These bound what a file can ask for so that a corrupt or malicious
+	// header can't hang the machine
+	maxKeyTime   = 1000
+	maxKeyMemory = 4 * 1024 * 1024
+)
+
+// String formats the cost for people
+func (k KeyCost) String() string {
+	return fmt.Sprintf("argon2id t=%d m=%dMiB p=%d", k.Time, k.Memory/1024, k.Threads)
+}
+
+func (k KeyCost) validate() error {
+	if k.Time < 1 || k.Time > maxKeyTime {
+		return fmt.Errorf("key cost time %d must be between 1 and %d", k.Time, maxKeyTime)
+	}
+	if k.Threads < 1 {
+		return fmt.Errorf("key cost threads must be at least 1")
+	}
+	if k.Memory < 8*uint32(k.Threads) || k.Memory > maxKeyMemory {
+		return fmt.Errorf("key cost memory %dKiB must be between %dKiB and %dKiB", k.Memory, 8*uint32(k.Threads), maxKeyMemory)
+	}
+	return nil
+}
+
+// SaltKeyCost returns the cost stored in a salt, ok is false if the salt is
+// from a version that doesn't store one.
+func SaltKeyCost(salt []byte) (cost KeyCost, ok bool) {
+	if len(salt) != versions[3].saltSize {
+		return cost, false
+	}
+
+	cost.Time = binary.BigEndian.Uint32(salt)
+	cost.Memory = binary.BigEndian.Uint32(salt[4:])
+	cost.Threads = salt[8]
+	return cost, true
+}
+
+// Calibrate returns cost with the number of passes raised until deriving a
+// key takes at least target on this machine. Memory and threads are left
+// alone since they're limited by the slowest machine the file is opened on,
+// not this one.
+func Calibrate(cost KeyCost, target time.Duration) KeyCost {
+	cost.Time = 1
+
+	salt := make([]byte, 32)
+	for {
+		start := time.Now()
+		argon2.IDKey([]byte("calibrate"), salt, cost.Time, cost.Memory, cost.Threads, 32)
+		elapsed := time.Since(start)
+
+		if elapsed >= target || cost.Time >= maxKeyTime {
+			return cost
+		}
+
+		// Jump straight to where the target should be, at least one pass
+		// more than last time
+		next := uint32(float64(cost.Time) * float64(target) / float64(elapsed))
+		if next <= cost.Time {
+			next = cost.Time + 1
+		}
+		if next > maxKeyTime {
+			next = maxKeyTime
+		}
+		cost.Time = next
+	}
+}
+
+// newSaltV3 creates this salt:
+// 4:time|4:memory|1:threads|32:random
+// with the given cost
+func newSaltV3(c config, cost KeyCost) ([]byte, error) {
+	if err := cost.validate(); err != nil {
+		return nil, err
+	}
+
+	salt := make([]byte, c.saltSize)
+	binary.BigEndian.PutUint32(salt, cost.Time)
+	binary.BigEndian.PutUint32(salt[4:], cost.Memory)
+	salt[8] = cost.Threads
+	if _, err := io.ReadFull(rand.Reader, salt[keyCostLen:]); err != nil {
+		return nil, fmt.Errorf("failed to get randomness for salt: %w", err)
+	}
+
+	return salt, nil
+}
+
+// deriveKeyV3 uses Argon2id with the cost stored in the salt, salts without
+// a cost are for recipients and the passphrase is an identity
+func deriveKeyV3(c config, passphrase, salt []byte) ([]byte, error) {
+	cost, ok := SaltKeyCost(salt)
+	if !ok {
+		return nil, ErrInvalidSalt
+	}
+	if cost == (KeyCost{}) {
+		return identityKey(c, passphrase, salt)
+	}
+	if err := cost.validate(); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidFileFormat, err)
+	}
+
+	return argon2.IDKey(passphrase, salt[keyCostLen:], cost.Time, cost.Memory, cost.Threads, uint32(c.keySize)), nil
+}
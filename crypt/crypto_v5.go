@@ -0,0 +1,153 @@
+package crypt
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io/ioutil"
+)
+
+// ErrUnsupported is returned (wrapped with what wasn't understood) for files
+// written by a newer bpass, they're left alone rather than misread. It wraps
+// ErrInvalidFileFormat since the file can't be read either way.
+var ErrUnsupported = fmt.Errorf("%w: written by a newer bpass", ErrInvalidFileFormat)
+
+// KDFs a descriptor can name, the key cost of an Argon2id key is at the
+// front of its salt (see SaltKeyCost)
+const (
+	KDFScrypt   = 1
+	KDFArgon2id = 2
+)
+
+// Ciphers a descriptor can name
+const (
+	CipherXChaCha20Poly1305 = 1
+)
+
+// Flags a descriptor can have
+const (
+	// FlagCompressed is set when the payload was deflated before it was
+	// sealed
+	FlagCompressed = 1 << 0
+
+	knownFlags = FlagCompressed
+)
+
+// descriptorFields is how many fields this version of bpass writes
+const descriptorFields = 3
+
+// Descriptor says how a file was made, from version 5 on it follows the magic
+// string so a file can be read by looking at what it says rather than
+// knowing which algorithms each version used:
+// 1:length|1:kdf|1:cipher|1:flags
+// where length is the number of bytes after it. Fields added later go on the
+// end and are skipped by readers that don't know them, anything a reader
+// doesn't have is refused with ErrUnsupported.
+type Descriptor struct {
+	KDF    int
+	Cipher int
+	Flags  int
+}
+
+// String formats the descriptor for people
+func (d Descriptor) String() string {
+	var kdf, cipher string
+	switch d.KDF {
+	case KDFScrypt:
+		kdf = "scrypt"
+	case KDFArgon2id:
+		kdf = "argon2id"
+	default:
+		kdf = fmt.Sprintf("kdf %d", d.KDF)
+	}
+	switch d.Cipher {
+	case CipherXChaCha20Poly1305:
+		cipher = "XChaCha20-Poly1305"
+	default:
+		cipher = fmt.Sprintf("cipher %d", d.Cipher)
+	}
+
+	s := kdf + ", " + cipher
+	if d.Flags&FlagCompressed != 0 {
+		s += ", compressed"
+	}
+	return s
+}
+
+func (d Descriptor) encode() []byte {
+	return []byte{descriptorFields, byte(d.KDF), byte(d.Cipher), byte(d.Flags)}
+}
+
+// negotiate reads the descriptor of a file and returns the config that reads
+// it along with where the rest of the header starts. Versions without a
+// descriptor are returned as they are.
+func negotiate(c config, encrypted []byte) (nc config, d Descriptor, start int, err error) {
+	if !c.descriptor {
+		return c, d, magicLen, nil
+	}
+
+	if len(encrypted) < magicLen+1 {
+		return c, d, 0, fmt.Errorf("%w: file is too short to contain a descriptor", ErrInvalidFileFormat)
+	}
+	length := int(encrypted[magicLen])
+	start = magicLen + 1 + length
+	if length < descriptorFields || len(encrypted) < start {
+		return c, d, 0, fmt.Errorf("%w: descriptor is truncated", ErrInvalidFileFormat)
+	}
+	fields := encrypted[magicLen+1 : start]
+	d.KDF, d.Cipher, d.Flags = int(fields[0]), int(fields[1]), int(fields[2])
+
+	switch d.KDF {
+	case KDFScrypt:
+		c.keygen = deriveKeyV1
+		c.saltgen = nil
+		c.saltSize = 32
+	case KDFArgon2id:
+		c.keygen = deriveKeyV3
+		c.saltgen = newSaltV3
+		c.saltSize = keyCostLen + 32
+	default:
+		return c, d, 0, fmt.Errorf("%w: unknown key derivation %d", ErrUnsupported, d.KDF)
+	}
+	if d.Cipher != CipherXChaCha20Poly1305 {
+		return c, d, 0, fmt.Errorf("%w: unknown cipher %d", ErrUnsupported, d.Cipher)
+	}
+	if d.Flags&^knownFlags != 0 {
+		return c, d, 0, fmt.Errorf("%w: unknown flags %#x", ErrUnsupported, d.Flags&^knownFlags)
+	}
+
+	return c, d, start, nil
+}
+
+// compress deflates the plaintext, compressed is false if that didn't make
+// it any smaller in which case it's returned as it was
+func compress(plaintext []byte) (out []byte, compressed bool, err error) {
+	var buf bytes.Buffer
+	w, err := flate.NewWriter(&buf, flate.BestCompression)
+	if err != nil {
+		return nil, false, err
+	}
+	if _, err = w.Write(plaintext); err != nil {
+		return nil, false, err
+	}
+	if err = w.Close(); err != nil {
+		return nil, false, err
+	}
+
+	if buf.Len() >= len(plaintext) {
+		return plaintext, false, nil
+	}
+	return buf.Bytes(), true, nil
+}
+
+// decompress inflates a payload that was sealed with FlagCompressed
+func decompress(in []byte) ([]byte, error) {
+	r := flate.NewReader(bytes.NewReader(in))
+	defer r.Close()
+
+	out, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: payload failed to decompress: %v", ErrInvalidFileFormat, err)
+	}
+	return out, nil
+}
@@ -0,0 +1,77 @@
+package crypt
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// Save encrypts plaintext (see Encrypt) and writes it to filename. The
+// encrypted data is written to a temporary file next to filename and renamed
+// over it once it's complete so a crash can't leave a half written file
+// behind, the plaintext is never written anywhere. Both the file and the
+// directory are synced so the rename survives a power loss too.
+func Save(filename string, version int, p *Params, plaintext []byte) (encrypted []byte, err error) {
+	encrypted, err = Encrypt(version, p, plaintext)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, base := filepath.Split(filename)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	f, err := ioutil.TempFile(dir, "."+base+".tmp*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	tmp := f.Name()
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp)
+		}
+	}()
+
+	if _, err = f.Write(encrypted); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err = f.Sync(); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+	if err = f.Close(); err != nil {
+		return nil, err
+	}
+	if err = os.Rename(tmp, filename); err != nil {
+		return nil, err
+	}
+	syncDir(dir)
+
+	return encrypted, nil
+}
+
+// syncDir flushes a directory's entries to disk. It's best effort since not
+// every platform can (windows can't open directories for writing).
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	_ = d.Sync()
+	_ = d.Close()
+}
+
+// Load reads filename and decrypts it, see Decrypt for the arguments.
+func Load(filename string, user, passphrase, key, salt []byte) (version int, p Params, pt []byte, err error) {
+	encrypted, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return 0, p, nil, err
+	}
+	if len(encrypted) < magicLen {
+		return 0, p, nil, ErrInvalidFileFormat
+	}
+
+	return Decrypt(user, passphrase, key, salt, encrypted)
+}
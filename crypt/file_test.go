@@ -0,0 +1,62 @@
+package crypt
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoad(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := getVersion(2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p Params
+	p.Keys = [][]byte{make([]byte, c.keySize)}
+	p.Salts = [][]byte{make([]byte, c.saltSize)}
+	plaintext := []byte("plaintext goes here")
+
+	filename := filepath.Join(dir, "test.blob")
+	encrypted, err := Save(filename, 2, &p, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	onDisk, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(onDisk, encrypted) {
+		t.Error("file contents were wrong")
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 {
+		t.Error("temporary file was left behind:", len(files))
+	}
+
+	version, _, pt, err := Load(filename, nil, nil, p.Keys[0], p.Salts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != 2 {
+		t.Error("version was wrong:", version)
+	}
+	if !bytes.Equal(pt, plaintext) {
+		t.Errorf("want: %s, got: %s", plaintext, pt)
+	}
+}
@@ -0,0 +1,116 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strconv"
+)
+
+// Header is the information about an encrypted file that can be read without
+// a passphrase.
+type Header struct {
+	Version int
+	// NUsers is 0 in a single user file
+	NUsers int
+	// Users is the sha256 of each user's name in a multi-user file
+	Users [][]byte
+	// Tokens are the hardware tokens users' keys need (version 4 on)
+	Tokens []Token
+	// Descriptor is how the file was made (version 5 on)
+	Descriptor Descriptor
+	// PayloadLen is the length of the encrypted payload following the header
+	PayloadLen int
+}
+
+// ReadHeader parses and validates the plaintext portions of an encrypted
+// file. It checks everything that can be checked without the passphrase,
+// the magic string, the version, user count and that the payload is sized
+// in a way that the cipher suite could have produced. The payload's integrity
+// hash is encrypted along with it so it can only be checked by Decrypt.
+//
+// Returns ErrInvalidFileFormat (possibly wrapped with a reason) if the file
+// is not a valid bpass file, or ErrUnsupported if it was written by a newer
+// bpass.
+func ReadHeader(encrypted []byte) (h Header, err error) {
+	if len(encrypted) < magicLen {
+		return h, fmt.Errorf("%w: file is too short to contain a header", ErrInvalidFileFormat)
+	}
+
+	if bytes.Equal(v0Header, encrypted[:len(v0Header)]) {
+		h.PayloadLen = len(encrypted) - len(v0Header)
+		return h, nil
+	}
+
+	h.Version, err = verifyMagic(encrypted)
+	if err != nil {
+		return h, err
+	}
+
+	c, err := getVersion(h.Version)
+	if err != nil {
+		return h, fmt.Errorf("%w: %v", ErrUnsupported, err)
+	}
+	var start int
+	c, h.Descriptor, start, err = negotiate(c, encrypted)
+	if err != nil {
+		return h, err
+	}
+
+	nUsers, err := strconv.ParseInt(string(encrypted[magicLen-4:magicLen]), 10, 32)
+	if err != nil || nUsers < 0 {
+		return h, fmt.Errorf("%w: user count is not a number", ErrInvalidFileFormat)
+	}
+	h.NUsers = int(nUsers)
+
+	headerLen := start + c.saltSize + c.blockSize
+	if h.NUsers != 0 {
+		userSize := sha256.Size + c.saltSize + c.blockSize + c.keySize + c.overhead
+		headerLen = start + userSize*h.NUsers + c.blockSize
+
+		if len(encrypted) >= headerLen {
+			offset := start
+			for i := 0; i < h.NUsers; i++ {
+				h.Users = append(h.Users, append([]byte(nil), encrypted[offset:offset+sha256.Size]...))
+				offset += userSize
+			}
+		}
+	}
+
+	if c.tokens && len(encrypted) >= headerLen {
+		tokensAt := headerLen - c.blockSize
+		tokens, n, err := decodeTokens(encrypted[tokensAt:], h.NUsers)
+		if err != nil {
+			return h, fmt.Errorf("%w: %v", ErrInvalidFileFormat, err)
+		}
+		h.Tokens = tokens
+		headerLen += n
+	}
+
+	if len(encrypted) < headerLen {
+		return h, fmt.Errorf("%w: file is truncated, header needs %d bytes but file is %d", ErrInvalidFileFormat, headerLen, len(encrypted))
+	}
+
+	h.PayloadLen = len(encrypted) - headerLen
+
+	// An aead payload has at least its tag
+	if c.overhead != 0 {
+		if h.PayloadLen < c.overhead {
+			return h, fmt.Errorf("%w: payload length %d is too short to be sealed", ErrInvalidFileFormat, h.PayloadLen)
+		}
+		return h, nil
+	}
+
+	// The last cipher in the cascade pads to its block size and the payload
+	// always contains at least an integrity hash.
+	suite, err := cipherSuite(c)
+	if err != nil {
+		return h, err
+	}
+	lastBlockSize := suite[len(suite)-1].BlockSize
+	if h.PayloadLen == 0 || h.PayloadLen%lastBlockSize != 0 {
+		return h, fmt.Errorf("%w: payload length %d is not a multiple of the block size %d", ErrInvalidFileFormat, h.PayloadLen, lastBlockSize)
+	}
+
+	return h, nil
+}
@@ -48,6 +48,16 @@ type Params struct {
 	// Master is the master key, decrypted from one of the master key blocks
 	// If the master key is nil, it will be generated.
 	Master []byte
+
+	// Tokens are kept in the header from version 4 on, Decrypt returns the
+	// file's so they can be given back to Encrypt
+	Tokens []Token
+}
+
+// Version returns the version of the file the params were decrypted from, 0
+// for params that weren't made by Decrypt.
+func (p Params) Version() int {
+	return p.version
 }
 
 // validate the encryption params for encrypting
@@ -69,6 +79,18 @@ func (p Params) validate(c config) error {
 		}
 	}
 
+	if len(p.Tokens) != 0 && !c.tokens {
+		return fmt.Errorf("version %d can't store tokens", c.version)
+	}
+	if len(p.Tokens) > 255 {
+		return errors.New("can't store more than 255 tokens")
+	}
+	for i, t := range p.Tokens {
+		if err := t.validate(p.NUsers); err != nil {
+			return fmt.Errorf("tokens[%d]: %w", i, err)
+		}
+	}
+
 	if p.NUsers == 0 {
 		return nil
 	}
@@ -104,8 +126,8 @@ func (p Params) validate(c config) error {
 		return errors.New("mkeys must be the same length as nusers")
 	}
 	for i, mkey := range p.MKeys {
-		if len(mkey) != c.keySize {
-			return fmt.Errorf("mkeys[%d] must be %d bytes", i, c.keySize)
+		if len(mkey) != c.keySize+c.overhead {
+			return fmt.Errorf("mkeys[%d] must be %d bytes", i, c.keySize+c.overhead)
 		}
 	}
 
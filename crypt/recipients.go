@@ -0,0 +1,175 @@
+package crypt
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Recipients are X25519 public keys in the format age uses
+// (https://age-encryption.org) so keys made with age-keygen work too. In a
+// multi-user file the master key can be sealed to a recipient in place of a
+// user's passphrase, the recipient string is the user's name and the
+// identity (private key) is the passphrase given to Decrypt.
+//
+// Recipients take up a user's slot in the header. Their salt has no key cost
+// (it's all zeros) and is followed by the ephemeral public key the master
+// key was sealed with, so only versions with key costs (3 on) support them.
+
+const (
+	recipientHRP = "age"
+	identityHRP  = "age-secret-key-"
+
+	recipientInfo = "bpass/x25519"
+)
+
+// ErrRecipientsUnsupported is returned when sealing to a recipient in a
+// version that can't store them
+var ErrRecipientsUnsupported = errors.New("recipients need file format version 3 or later")
+
+// GenerateIdentity creates a new X25519 identity and returns it along with
+// its recipient.
+func GenerateIdentity() (identity, recipient string, err error) {
+	var priv [32]byte
+	if _, err = io.ReadFull(rand.Reader, priv[:]); err != nil {
+		return "", "", fmt.Errorf("failed to get randomness for identity: %w", err)
+	}
+
+	identity, err = bech32Encode(identityHRP, priv[:])
+	if err != nil {
+		return "", "", err
+	}
+	identity = strings.ToUpper(identity)
+
+	recipient, err = IdentityRecipient(identity)
+	if err != nil {
+		return "", "", err
+	}
+
+	return identity, recipient, nil
+}
+
+// IdentityRecipient returns the recipient of an identity, it's what's used as
+// the user's name when opening a file with the identity.
+func IdentityRecipient(identity string) (recipient string, err error) {
+	priv, err := parseIdentity(identity)
+	if err != nil {
+		return "", err
+	}
+
+	var pub [32]byte
+	curve25519.ScalarBaseMult(&pub, &priv)
+	return bech32Encode(recipientHRP, pub[:])
+}
+
+// IsRecipient checks if a user's name is a recipient
+func IsRecipient(name string) bool {
+	_, err := parseRecipient(name)
+	return err == nil
+}
+
+// EncryptMasterKeyTo seals a master key to a recipient. It returns the salt,
+// iv and encrypted master key for the recipient's slot in the file along with
+// the key it was sealed with, it's the key Decrypt returns for the recipient.
+func EncryptMasterKeyTo(version int, recipient string, master []byte) (key, salt, iv, cryptedMaster []byte, err error) {
+	c, err := getVersion(version)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+	if c.version < 3 {
+		return nil, nil, nil, nil, ErrRecipientsUnsupported
+	}
+
+	pub, err := parseRecipient(recipient)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	var ephemeral, share [32]byte
+	if _, err = io.ReadFull(rand.Reader, ephemeral[:]); err != nil {
+		return nil, nil, nil, nil, fmt.Errorf("failed to get randomness for ephemeral key: %w", err)
+	}
+	curve25519.ScalarBaseMult(&share, &ephemeral)
+
+	key, err = recipientKey(c, ephemeral, pub, share, pub)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	cryptedMaster, iv, err = c.encryptKey(c, key, master)
+	if err != nil {
+		return nil, nil, nil, nil, err
+	}
+
+	salt = make([]byte, c.saltSize)
+	copy(salt[keyCostLen:], share[:])
+	return key, salt, iv, cryptedMaster, nil
+}
+
+// identityKey derives the key a recipient's slot was sealed with from the
+// identity and the ephemeral public key stored after the (empty) key cost
+func identityKey(c config, identity []byte, salt []byte) ([]byte, error) {
+	priv, err := parseIdentity(string(identity))
+	if err != nil {
+		// Whatever was typed can't open this slot
+		return nil, ErrWrongPassphrase
+	}
+
+	var share, pub [32]byte
+	copy(share[:], salt[keyCostLen:])
+	curve25519.ScalarBaseMult(&pub, &priv)
+
+	return recipientKey(c, priv, share, share, pub)
+}
+
+// recipientKey does the X25519 exchange between priv and peer and derives a
+// key from it bound to both public keys
+func recipientKey(c config, priv, peer, share, recipient [32]byte) ([]byte, error) {
+	var shared, zero [32]byte
+	curve25519.ScalarMult(&shared, &priv, &peer)
+	if shared == zero {
+		return nil, errors.New("recipient is a low order point")
+	}
+
+	salt := make([]byte, 0, 64)
+	salt = append(salt, share[:]...)
+	salt = append(salt, recipient[:]...)
+
+	key := make([]byte, c.keySize)
+	if _, err := io.ReadFull(hkdf.New(sha256.New, shared[:], salt, []byte(recipientInfo)), key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func parseRecipient(recipient string) (pub [32]byte, err error) {
+	hrp, data, err := bech32Decode(recipient)
+	if err != nil {
+		return pub, fmt.Errorf("invalid recipient: %w", err)
+	}
+	if hrp != recipientHRP || len(data) != len(pub) {
+		return pub, errors.New("invalid recipient: not an X25519 recipient")
+	}
+
+	copy(pub[:], data)
+	return pub, nil
+}
+
+func parseIdentity(identity string) (priv [32]byte, err error) {
+	hrp, data, err := bech32Decode(strings.TrimSpace(identity))
+	if err != nil {
+		return priv, fmt.Errorf("invalid identity: %w", err)
+	}
+	if hrp != identityHRP || len(data) != len(priv) {
+		return priv, errors.New("invalid identity: not an X25519 identity")
+	}
+
+	copy(priv[:], data)
+	return priv, nil
+}
@@ -0,0 +1,106 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"testing"
+)
+
+func TestIdentityRecipient(t *testing.T) {
+	t.Parallel()
+
+	// The private key is 0x42 repeated, same as in age's tests
+	recipient, err := IdentityRecipient("AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recipient != "age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj" {
+		t.Error("recipient was wrong:", recipient)
+	}
+	if !IsRecipient(recipient) {
+		t.Error("should be a recipient")
+	}
+
+	bad := []string{
+		"",
+		"age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwq",
+		"Age1zvkyg2lqzraa2lnjvqej32nkuu0ues2s82hzrye869xeexvn73equnujwj",
+		"AGE-SECRET-KEY-1GFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPYYSJZGFPQ4EGAEX",
+		"username",
+	}
+	for i, b := range bad {
+		if IsRecipient(b) {
+			t.Errorf("%d) should not be a recipient", i)
+		}
+	}
+}
+
+func TestCryptRecipients(t *testing.T) {
+	t.Parallel()
+
+	identity1, recipient1, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	identity2, recipient2, err := GenerateIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	master, ivm, err := NewMasterKey(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var p Params
+	p.NUsers = 2
+	p.Master, p.IVM = master, ivm
+	p.Keys = make([][]byte, 2)
+	var keys [][]byte
+	for _, r := range []string{recipient1, recipient2} {
+		key, salt, iv, mkey, err := EncryptMasterKeyTo(3, r, master)
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		user := sha256.Sum256([]byte(r))
+		p.Users = append(p.Users, user[:])
+		p.Salts = append(p.Salts, salt)
+		p.IVs = append(p.IVs, iv)
+		p.MKeys = append(p.MKeys, mkey)
+	}
+
+	plaintext := []byte("plaintext goes here")
+	ciphertext, err := Encrypt(3, &p, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, id := range []string{identity1, identity2} {
+		recipient, err := IdentityRecipient(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, params, pt, err := Decrypt([]byte(recipient), []byte(id), nil, nil, ciphertext)
+		if err != nil {
+			t.Fatalf("%d) %v", i, err)
+		}
+		if !bytes.Equal(pt, plaintext) {
+			t.Errorf("%d) want: %s, got: %s", i, plaintext, pt)
+		}
+		if params.User != i || !bytes.Equal(params.Keys[i], keys[i]) {
+			t.Errorf("%d) user or key was wrong: %d", i, params.User)
+		}
+	}
+
+	if _, _, _, err = Decrypt([]byte(recipient1), []byte(identity2), nil, nil, ciphertext); err != ErrWrongPassphrase {
+		t.Error("expected wrong passphrase for another identity, got:", err)
+	}
+	if _, _, _, err = Decrypt([]byte("someone"), []byte("hunter42"), nil, nil, ciphertext); err != ErrWrongPassphrase {
+		t.Error("expected wrong passphrase for an unknown user, got:", err)
+	}
+
+	if _, _, _, _, err = EncryptMasterKeyTo(2, recipient1, master); err != ErrRecipientsUnsupported {
+		t.Error("expected recipients to be unsupported, got:", err)
+	}
+}
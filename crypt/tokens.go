@@ -0,0 +1,162 @@
+package crypt
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Token is a hardware security key (FIDO2 with the hmac-secret extension)
+// that a user's key is derived from along with (or instead of) their
+// passphrase. The token gives back a secret for the salt and credential it
+// was registered with, those have to be readable before the file can be
+// decrypted so from version 4 on they're kept in the header (see
+// ReadHeader), after the users and before the payload's nonce.
+type Token struct {
+	// User is the sha256 of the user's name, nil in a single user file
+	User []byte
+	// Salt is given to the token to get the secret back
+	Salt []byte
+	// CredentialID identifies the credential on the token
+	CredentialID []byte
+	// NoPassphrase is set when the secret is used instead of a passphrase
+	NoPassphrase bool
+}
+
+const (
+	tokenSaltSize = 32
+	// tokenFixedLen is 32:user|32:salt|1:flags|1:credlen
+	tokenFixedLen = sha256.Size + tokenSaltSize + 2
+
+	tokenNoPassphrase = 1
+)
+
+// NewToken creates a token with a new salt for a credential registered on a
+// hardware token, user is empty in a single user file.
+func NewToken(user, credentialID []byte, noPassphrase bool) (t Token, err error) {
+	t.User = tokenUser(user)
+	t.CredentialID = credentialID
+	t.NoPassphrase = noPassphrase
+
+	t.Salt = make([]byte, tokenSaltSize)
+	if _, err = io.ReadFull(rand.Reader, t.Salt); err != nil {
+		return t, fmt.Errorf("failed to get randomness for token salt: %w", err)
+	}
+	return t, nil
+}
+
+// TokenFor returns the token of a user (nil for a single user file)
+func (h Header) TokenFor(user []byte) (t Token, ok bool) {
+	return FindToken(h.Tokens, user)
+}
+
+// FindToken returns the token of a user (nil for a single user file)
+func FindToken(tokens []Token, user []byte) (t Token, ok bool) {
+	hash := tokenUser(user)
+	for _, t := range tokens {
+		if bytes.Equal(t.User, hash) {
+			return t, true
+		}
+	}
+	return t, false
+}
+
+// RemoveToken returns the tokens without the user's
+func RemoveToken(tokens []Token, user []byte) []Token {
+	hash := tokenUser(user)
+	var kept []Token
+	for _, t := range tokens {
+		if !bytes.Equal(t.User, hash) {
+			kept = append(kept, t)
+		}
+	}
+	return kept
+}
+
+func tokenUser(user []byte) []byte {
+	if len(user) == 0 {
+		return nil
+	}
+	s := sha256.Sum256(user)
+	return s[:]
+}
+
+func (t Token) validate(nUsers int) error {
+	if nUsers == 0 && len(t.User) != 0 {
+		return errors.New("tokens in single user files can't have a user")
+	} else if nUsers != 0 && len(t.User) != sha256.Size {
+		return fmt.Errorf("token users must be %d bytes", sha256.Size)
+	}
+	if len(t.Salt) != tokenSaltSize {
+		return fmt.Errorf("token salts must be %d bytes", tokenSaltSize)
+	}
+	if len(t.CredentialID) == 0 || len(t.CredentialID) > 255 {
+		return errors.New("token credential ids must be 1 to 255 bytes")
+	}
+	return nil
+}
+
+// encodeTokens creates this format:
+// 1:ntokens|32:user|32:salt|1:flags|1:credlen|credlen:credential id|...
+// where the user is all zeros in a single user file
+func encodeTokens(tokens []Token) []byte {
+	out := []byte{byte(len(tokens))}
+	for _, t := range tokens {
+		user := make([]byte, sha256.Size)
+		copy(user, t.User)
+		out = append(out, user...)
+		out = append(out, t.Salt...)
+
+		var flags byte
+		if t.NoPassphrase {
+			flags |= tokenNoPassphrase
+		}
+		out = append(out, flags, byte(len(t.CredentialID)))
+		out = append(out, t.CredentialID...)
+	}
+
+	return out
+}
+
+// decodeTokens reads the tokens at the start of b and returns how many bytes
+// they took up
+func decodeTokens(b []byte, nUsers int) (tokens []Token, n int, err error) {
+	if len(b) < 1 {
+		return nil, 0, errors.New("missing token count")
+	}
+
+	count := int(b[0])
+	n = 1
+	for i := 0; i < count; i++ {
+		if len(b) < n+tokenFixedLen {
+			return nil, 0, fmt.Errorf("token %d is truncated", i)
+		}
+
+		var t Token
+		if nUsers != 0 {
+			t.User = append([]byte(nil), b[n:n+sha256.Size]...)
+		}
+		n += sha256.Size
+		t.Salt = append([]byte(nil), b[n:n+tokenSaltSize]...)
+		n += tokenSaltSize
+		t.NoPassphrase = b[n]&tokenNoPassphrase != 0
+		credLen := int(b[n+1])
+		n += 2
+
+		if len(b) < n+credLen {
+			return nil, 0, fmt.Errorf("token %d is truncated", i)
+		}
+		t.CredentialID = append([]byte(nil), b[n:n+credLen]...)
+		n += credLen
+
+		if err = t.validate(nUsers); err != nil {
+			return nil, 0, err
+		}
+		tokens = append(tokens, t)
+	}
+
+	return tokens, n, nil
+}
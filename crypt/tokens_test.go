@@ -0,0 +1,109 @@
+package crypt
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestCryptTokens(t *testing.T) {
+	t.Parallel()
+
+	c, err := getVersion(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := NewToken(nil, []byte("credential"), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	key := make([]byte, c.keySize)
+	salt := make([]byte, c.saltSize)
+	var p Params
+	p.Keys = [][]byte{key}
+	p.Salts = [][]byte{salt}
+	p.Tokens = []Token{token}
+	plaintext := []byte("plaintext goes here")
+	ciphertext, err := Encrypt(4, &p, plaintext)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h, err := ReadHeader(ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, ok := h.TokenFor(nil)
+	if !ok {
+		t.Fatal("token was missing from the header")
+	}
+	if !bytes.Equal(got.Salt, token.Salt) || !bytes.Equal(got.CredentialID, token.CredentialID) || !got.NoPassphrase {
+		t.Errorf("token was wrong: %#v", got)
+	}
+
+	_, params, pt, err := Decrypt(nil, nil, key, salt, ciphertext)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(pt, plaintext) {
+		t.Errorf("want: %s, got: %s", plaintext, pt)
+	}
+	if len(params.Tokens) != 1 {
+		t.Error("tokens were not returned:", params.Tokens)
+	}
+
+	// The tokens are authenticated along with the rest of the header
+	bad := append([]byte(nil), ciphertext...)
+	bad[magicLen+c.saltSize+1+len(token.User)+tokenSaltSize+2] ^= 1
+	if _, _, _, err = Decrypt(nil, nil, key, salt, bad); err != ErrWrongPassphrase {
+		t.Error("expected wrong passphrase, got:", err)
+	}
+
+	// A token count past the end of the file
+	bad = append([]byte(nil), ciphertext[:magicLen+c.saltSize]...)
+	bad = append(bad, 5)
+	if _, err = ReadHeader(bad); !errors.Is(err, ErrInvalidFileFormat) {
+		t.Error("expected invalid file format, got:", err)
+	}
+
+	if _, err = Encrypt(3, &p, plaintext); err == nil {
+		t.Error("expected an error storing tokens in version 3")
+	}
+}
+
+func TestFindToken(t *testing.T) {
+	t.Parallel()
+
+	alice, err := NewToken([]byte("alice"), []byte("a"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := NewToken([]byte("bob"), []byte("b"), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := []Token{alice, bob}
+	encoded := encodeTokens(tokens)
+	decoded, n, err := decodeTokens(append(encoded, "rest"...), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(encoded) {
+		t.Errorf("read %d bytes, want %d", n, len(encoded))
+	}
+
+	if got, ok := FindToken(decoded, []byte("bob")); !ok || !bytes.Equal(got.CredentialID, []byte("b")) {
+		t.Error("bob's token was wrong:", got, ok)
+	}
+	if _, ok := FindToken(decoded, []byte("carol")); ok {
+		t.Error("carol should not have a token")
+	}
+
+	decoded = RemoveToken(decoded, []byte("alice"))
+	if len(decoded) != 1 || !bytes.Equal(decoded[0].CredentialID, []byte("b")) {
+		t.Error("only alice's token should have been removed:", decoded)
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/osutil"
+)
+
+var errDoctorFailed = errors.New("doctor found problems")
+
+// maxClockSkew is how far off the clock can be before totp codes start to
+// fail, codes are valid for 30s and most servers accept one step either way.
+const maxClockSkew = 15 * time.Second
+
+// timeURL is asked for the time via the Date header
+const timeURL = "https://www.google.com"
+
+// diagnosis is the result of a single doctor check. An empty problem means
+// the check passed, fix describes how to solve the problem.
+type diagnosis struct {
+	Name    string
+	OK      string
+	Problem string
+	Fix     string
+	Skipped bool
+}
+
+// doctor checks the environment bpass is running in for things that could
+// leak secrets or stop it from working properly.
+func (u *uiContext) doctor(filename string, offline bool) error {
+	checks := []func() diagnosis{
+		func() diagnosis { return checkFilePerms(filename) },
+		checkCoreDumps,
+		checkSwap,
+		checkClipboard,
+	}
+	if !offline {
+		checks = append(checks, checkClock)
+	}
+
+	failed := false
+	for _, check := range checks {
+		d := check()
+		switch {
+		case d.Skipped:
+			fmt.Printf("%s %s: %s\n", infoColor.Sprint("skip"), d.Name, d.Problem)
+		case len(d.Problem) == 0:
+			fmt.Printf("%s   %s: %s\n", infoColor.Sprint("ok"), d.Name, d.OK)
+		default:
+			failed = true
+			fmt.Printf("%s %s: %s\n", errColor.Sprint("warn"), d.Name, d.Problem)
+			if len(d.Fix) != 0 {
+				fmt.Printf("     fix: %s\n", d.Fix)
+			}
+		}
+	}
+
+	if failed {
+		return errDoctorFailed
+	}
+	return nil
+}
+
+func checkFilePerms(filename string) diagnosis {
+	d := diagnosis{Name: "file permissions"}
+	if runtime.GOOS == "windows" {
+		d.Skipped = true
+		d.Problem = "not supported on windows"
+		return d
+	}
+
+	info, err := os.Stat(filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			d.Skipped = true
+			d.Problem = filename + " does not exist yet"
+			return d
+		}
+		d.Problem = err.Error()
+		return d
+	}
+
+	if perm := info.Mode().Perm(); perm&0077 != 0 {
+		d.Problem = fmt.Sprintf("%s is accessible by other users (%04o)", filename, perm)
+		d.Fix = "chmod 600 " + filename
+		return d
+	}
+
+	d.OK = filename + " is only accessible by you"
+	return d
+}
+
+func checkCoreDumps() diagnosis {
+	d := diagnosis{Name: "core dumps"}
+	enabled, err := osutil.CoreDumpsEnabled()
+	switch {
+	case err != nil:
+		d.Skipped = true
+		d.Problem = err.Error()
+	case enabled:
+		d.Problem = "a crash would write memory (including decrypted secrets) to disk"
+		d.Fix = "run ulimit -c 0 in your shell profile"
+	default:
+		d.OK = "disabled"
+	}
+	return d
+}
+
+func checkSwap() diagnosis {
+	d := diagnosis{Name: "swap"}
+	encrypted, err := osutil.SwapEncrypted()
+	switch {
+	case err != nil:
+		d.Skipped = true
+		d.Problem = err.Error()
+	case !encrypted:
+		d.Problem = "swap is not encrypted, secrets in memory may be written to disk"
+		switch runtime.GOOS {
+		case "windows":
+			d.Fix = "fsutil behavior set encryptpagingfile 1 (as administrator)"
+		case "darwin":
+			d.Fix = "sudo sysctl vm.swapusage should report (encrypted), check FileVault"
+		default:
+			d.Fix = "use encrypted swap (dm-crypt) or zram instead of a plain swap partition or file"
+		}
+	default:
+		d.OK = "encrypted or not in use"
+	}
+	return d
+}
+
+func checkClipboard() diagnosis {
+	d := diagnosis{Name: "clipboard"}
+	tool, err := osutil.ClipboardTool()
+	if err != nil {
+		d.Problem = "copying will not work, " + err.Error()
+		d.Fix = "install one of them with your package manager"
+		return d
+	}
+
+	var managers []string
+	for _, m := range runningClipManagers() {
+		if len(m.Pause) == 0 {
+			managers = append(managers, m.Name)
+		}
+	}
+	if len(managers) != 0 {
+		d.Problem = "clipboard history will keep copied secrets: " + strings.Join(managers, ", ")
+		d.Fix = "exclude bpass in their settings, stop them, or run bpass with --strict-clip"
+		return d
+	}
+
+	d.OK = "using " + tool
+	return d
+}
+
+func checkClock() diagnosis {
+	d := diagnosis{Name: "clock"}
+
+	client := http.Client{Timeout: 5 * time.Second}
+	start := time.Now()
+	resp, err := client.Head(timeURL)
+	if err != nil {
+		d.Skipped = true
+		d.Problem = "could not reach " + timeURL
+		return d
+	}
+	_ = resp.Body.Close()
+	// The Date header has second precision and was made somewhere between
+	// sending the request and getting the response
+	local := start.Add(time.Since(start) / 2)
+
+	remote, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		d.Skipped = true
+		d.Problem = "no usable Date header from " + timeURL
+		return d
+	}
+
+	skew := local.Sub(remote)
+	if skew < 0 {
+		skew = -skew
+	}
+	if skew > maxClockSkew {
+		d.Problem = fmt.Sprintf("clock is off by %s, totp codes will be rejected", skew.Round(time.Second))
+		d.Fix = "enable time synchronization (ntp) for your system"
+		return d
+	}
+
+	d.OK = fmt.Sprintf("within %s", maxClockSkew)
+	return d
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/hkdf"
+)
+
+const (
+	// entropyInfo is the HKDF info string, it's versioned so that the
+	// derivation can be changed later without ambiguity.
+	entropyInfo = "bpass user entropy v1"
+	// systemEntropyLen is how many bytes we pull from crypto/rand for every
+	// generation that has user entropy mixed into it.
+	systemEntropyLen = 64
+	// maxEntropyFileLen is how much of a regular file we're willing to read
+	maxEntropyFileLen = 1 << 20
+	// deviceEntropyLen is how much we read from a character device like
+	// /dev/hwrng since they never end.
+	deviceEntropyLen = 64
+	// minDiceRolls is roughly 128 bits worth of d6 rolls, less than that and
+	// we warn the user that it's not doing them much good.
+	minDiceRolls = 50
+)
+
+var (
+	errNoEntropy = errors.New("no entropy was provided")
+)
+
+// mixEntropy returns a reader whose output is derived from both the system's
+// random number generator and user supplied entropy, so that a weakness in
+// either one alone does not determine the output.
+//
+// The derivation is HKDF-SHA512 (RFC 5869) with no salt:
+//   ikm  = 64 bytes read from system || user
+//   info = "bpass user entropy v1"
+//
+// Given the same system bytes and the same user entropy the output is always
+// identical which allows the derivation to be audited independently.
+func mixEntropy(system io.Reader, user []byte) (io.Reader, error) {
+	if len(user) == 0 {
+		return nil, errNoEntropy
+	}
+
+	ikm := make([]byte, systemEntropyLen+len(user))
+	if _, err := io.ReadFull(system, ikm[:systemEntropyLen]); err != nil {
+		return nil, fmt.Errorf("failed to read system entropy: %w", err)
+	}
+	copy(ikm[systemEntropyLen:], user)
+
+	return hkdf.New(sha512.New, ikm, nil, []byte(entropyInfo)), nil
+}
+
+// readEntropyFile reads entropy from a regular file or a device like
+// /dev/hwrng. Regular files are read in full (up to a limit), devices
+// have a fixed amount read from them.
+func readEntropyFile(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return nil, fmt.Errorf("%s is a directory", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if info.Mode()&os.ModeDevice != 0 {
+		buf := make([]byte, deviceEntropyLen)
+		if _, err = io.ReadFull(f, buf); err != nil {
+			return nil, fmt.Errorf("failed to read from device %s: %w", path, err)
+		}
+		return buf, nil
+	}
+
+	if info.Size() > maxEntropyFileLen {
+		return nil, fmt.Errorf("%s is too large to use as entropy (max %d bytes)", path, maxEntropyFileLen)
+	}
+
+	buf, err := ioutil.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	if len(buf) == 0 {
+		return nil, errNoEntropy
+	}
+
+	return buf, nil
+}
+
+// parseDiceRolls takes a string of d6 rolls (whitespace is ignored) and
+// returns them as bytes.
+func parseDiceRolls(rolls string) ([]byte, error) {
+	var b bytes.Buffer
+	for _, r := range rolls {
+		switch {
+		case unicode.IsSpace(r) || r == ',':
+			continue
+		case r >= '1' && r <= '6':
+			b.WriteRune(r)
+		default:
+			return nil, fmt.Errorf("%q is not a valid dice roll (1-6)", r)
+		}
+	}
+
+	if b.Len() == 0 {
+		return nil, errNoEntropy
+	}
+
+	return b.Bytes(), nil
+}
+
+// diceBits is how many bits of entropy n rolls of a d6 provide
+func diceBits(n int) float64 {
+	return float64(n) * math.Log2(6)
+}
+
+// entropyFingerprint is a short hash of the entropy so that a user can verify
+// what was mixed in without it being shown on screen.
+func entropyFingerprint(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:8])
+}
+
+// passwordEntropy returns the entropy source that should be used for the
+// next password generation.
+func (u *uiContext) passwordEntropy() (io.Reader, error) {
+	if len(u.entropy) == 0 {
+		return rand.Reader, nil
+	}
+
+	return mixEntropy(rand.Reader, u.entropy)
+}
+
+// addEntropy adds user entropy to the context and prints an audit line so
+// the user can see what's being used.
+func (u *uiContext) addEntropy(source string, b []byte) {
+	u.entropy = append(u.entropy, b...)
+	infoColor.Printf("mixing %d bytes from %s (sha256: %s) with %d bytes of system entropy via HKDF-SHA512\n",
+		len(b), source, entropyFingerprint(b), systemEntropyLen)
+}
+
+// promptEntropy asks the user for either dice rolls or a file to read
+// entropy from (prefixed with @).
+func (u *uiContext) promptEntropy() error {
+	line, err := u.prompt(promptColor.Sprint("dice rolls or @file: "))
+	if err != nil {
+		return err
+	}
+
+	line = strings.TrimSpace(line)
+	if strings.HasPrefix(line, "@") {
+		path := line[1:]
+		b, err := readEntropyFile(path)
+		if err != nil {
+			errColor.Println("failed to read entropy:", err)
+			return nil
+		}
+
+		u.addEntropy(path, b)
+		return nil
+	}
+
+	b, err := parseDiceRolls(line)
+	if err != nil {
+		errColor.Println(err)
+		return nil
+	}
+
+	if len(b) < minDiceRolls {
+		errColor.Printf("warning: %d rolls is only ~%.0f bits, %d or more rolls are recommended\n",
+			len(b), diceBits(len(b)), minDiceRolls)
+	}
+
+	u.addEntropy(fmt.Sprintf("%d dice rolls", len(b)), b)
+	return nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestMixEntropy(t *testing.T) {
+	t.Parallel()
+
+	system := bytes.Repeat([]byte{0x42}, systemEntropyLen)
+
+	read := func(user []byte) []byte {
+		r, err := mixEntropy(bytes.NewReader(system), user)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := make([]byte, 32)
+		if _, err = io.ReadFull(r, out); err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	a := read([]byte("123456"))
+	b := read([]byte("123456"))
+	c := read([]byte("654321"))
+
+	if !bytes.Equal(a, b) {
+		t.Error("derivation should be deterministic given the same inputs")
+	}
+	if bytes.Equal(a, c) {
+		t.Error("different user entropy should produce different output")
+	}
+	if bytes.Equal(a[:len(system)/2], system[:len(system)/2]) {
+		t.Error("output should not be the system entropy")
+	}
+
+	if _, err := mixEntropy(bytes.NewReader(system), nil); err != errNoEntropy {
+		t.Error("expected an error with no user entropy:", err)
+	}
+	if _, err := mixEntropy(bytes.NewReader(nil), []byte("1")); err == nil {
+		t.Error("expected an error when system entropy runs dry")
+	}
+}
+
+func TestParseDiceRolls(t *testing.T) {
+	t.Parallel()
+
+	b, err := parseDiceRolls("1 2 3,4\n56")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "123456" {
+		t.Error("rolls were wrong:", string(b))
+	}
+
+	if _, err = parseDiceRolls("1237"); err == nil {
+		t.Error("7 is not a valid d6 roll")
+	}
+	if _, err = parseDiceRolls("   "); err != errNoEntropy {
+		t.Error("expected no entropy error:", err)
+	}
+}
+
+func TestGenPasswdFrom(t *testing.T) {
+	t.Parallel()
+
+	r, err := mixEntropy(bytes.NewReader(make([]byte, systemEntropyLen)), []byte("3141592653"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := genPasswordFrom(r, 20, 0, 0, 0, 0, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p) != 20 {
+		t.Error("it should be 20 characters long")
+	}
+}
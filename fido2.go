@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aarondl/bpass/crypt"
+)
+
+// fido2RelyingParty is the relying party credentials are registered for, it's
+// not a domain since nothing but bpass ever asks for them
+const fido2RelyingParty = "bpass"
+
+var errNoFido2 = errors.New("fido2-token, fido2-cred and fido2-assert are needed for hardware tokens, install libfido2's tools")
+
+// fido2Device returns the first FIDO2 device fido2-token can find
+func fido2Device() (string, error) {
+	token, err := exec.LookPath("fido2-token")
+	if err != nil {
+		return "", errNoFido2
+	}
+
+	out, err := exec.Command(token, "-L").Output()
+	if err != nil {
+		return "", fmt.Errorf("fido2-token failed to list devices: %w", err)
+	}
+
+	// Lines look like: /dev/hidraw0: vendor=0x1050, product=0x0407 (...)
+	line := strings.SplitN(string(bytes.TrimSpace(out)), "\n", 2)[0]
+	i := strings.Index(line, ": ")
+	if i <= 0 {
+		return "", errors.New("no hardware token found, is it plugged in?")
+	}
+	return line[:i], nil
+}
+
+// fido2Run feeds the input lines to one of libfido2's tools and returns the
+// lines it prints. The tools ask for the token's pin on the terminal and
+// wait for a touch so stderr is passed through.
+func fido2Run(tool string, input []string, args ...string) ([]string, error) {
+	path, err := exec.LookPath(tool)
+	if err != nil {
+		return nil, errNoFido2
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = strings.NewReader(strings.Join(input, "\n") + "\n")
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("%s failed: %w", tool, err)
+	}
+
+	return strings.Split(string(bytes.TrimSpace(out)), "\n"), nil
+}
+
+// fido2ClientDataHash is random since nothing checks the signatures the
+// tools make, only the credential and the secret are used
+func fido2ClientDataHash() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(b), nil
+}
+
+// fido2Register creates a credential with the hmac-secret extension on the
+// token and returns its id
+func fido2Register(user string) ([]byte, error) {
+	device, err := fido2Device()
+	if err != nil {
+		return nil, err
+	}
+	cdh, err := fido2ClientDataHash()
+	if err != nil {
+		return nil, err
+	}
+	userID := make([]byte, 32)
+	if _, err = rand.Read(userID); err != nil {
+		return nil, err
+	}
+	if len(user) == 0 {
+		user = fido2RelyingParty
+	}
+
+	infoColor.Println("touch your token to register it...")
+	lines, err := fido2Run("fido2-cred", []string{
+		cdh, fido2RelyingParty, user, base64.StdEncoding.EncodeToString(userID),
+	}, "-M", "-h", device)
+	if err != nil {
+		return nil, err
+	}
+
+	// client data hash, relying party, format, auth data, credential id...
+	if len(lines) < 5 {
+		return nil, errors.New("fido2-cred gave unexpected output")
+	}
+	id, err := base64.StdEncoding.DecodeString(lines[4])
+	if err != nil || len(id) == 0 || len(id) > 255 {
+		return nil, errors.New("fido2-cred gave an unexpected credential id")
+	}
+	return id, nil
+}
+
+// fido2Secret asks the token for the hmac-secret of a token's credential
+// and salt, it's the same every time for the same token.
+func fido2Secret(t crypt.Token) ([]byte, error) {
+	device, err := fido2Device()
+	if err != nil {
+		return nil, err
+	}
+	cdh, err := fido2ClientDataHash()
+	if err != nil {
+		return nil, err
+	}
+
+	infoColor.Println("touch your token...")
+	lines, err := fido2Run("fido2-assert", []string{
+		cdh, fido2RelyingParty,
+		base64.StdEncoding.EncodeToString(t.CredentialID),
+		base64.StdEncoding.EncodeToString(t.Salt),
+	}, "-G", "-h", device)
+	if err != nil {
+		return nil, err
+	}
+
+	// The secret is always printed last
+	secret, err := base64.StdEncoding.DecodeString(lines[len(lines)-1])
+	if err != nil || len(secret) != 32 {
+		return nil, errors.New("fido2-assert gave an unexpected hmac-secret")
+	}
+	return secret, nil
+}
+
+// unlockToken gets the secret from the user's token if they have one in the
+// header, passphrase is false when the token is all that's needed.
+func (u *uiContext) unlockToken(h crypt.Header, user string) (passphrase bool, err error) {
+	u.tokenSecret = nil
+
+	t, ok := h.TokenFor([]byte(user))
+	if !ok {
+		return true, nil
+	}
+
+	u.tokenSecret, err = fido2Secret(t)
+	if err != nil {
+		return false, err
+	}
+	return !t.NoPassphrase, nil
+}
+
+// tokenOnly is true when the current user unlocks with their token alone
+func (u *uiContext) tokenOnly() bool {
+	t, ok := crypt.FindToken(u.tokens, u.tokenUser())
+	return ok && t.NoPassphrase
+}
+
+// tokenUser is what a token's user is for the current user
+func (u *uiContext) tokenUser() []byte {
+	if len(u.master) == 0 {
+		return nil
+	}
+	return []byte(u.user)
+}
+
+// addToken registers a hardware token and rekeys the current user with its
+// secret, with only set the passphrase is no longer needed. Everything is
+// saved with the new key right away (see rekeyEverything).
+func (u *uiContext) addToken(only bool) error {
+	if u.keyFromCache("add a token") {
+		return nil
+	}
+	if u.version < 4 {
+		errColor.Println("the file's format is too old for tokens, upgrade it with rekeyall first")
+		return nil
+	}
+	if crypt.IsRecipient(u.user) {
+		errColor.Println("recipients can't have tokens, their identity is the key")
+		return nil
+	}
+	if _, ok := crypt.FindToken(u.tokens, u.tokenUser()); ok {
+		errColor.Println("you already have a token, remove it with rmtoken first")
+		return nil
+	}
+	if only {
+		yes, err := u.getYesNo("the file will only open with this token, are you sure?")
+		if err != nil || !yes {
+			return err
+		}
+	}
+
+	id, err := fido2Register(u.user)
+	if err != nil {
+		return err
+	}
+	token, err := crypt.NewToken(u.tokenUser(), id, only)
+	if err != nil {
+		return err
+	}
+	secret, err := fido2Secret(token)
+	if err != nil {
+		return err
+	}
+
+	oldTokens, oldSecret, oldPass := u.tokens, u.tokenSecret, u.pass
+	changed, err := u.rekeyEverything(func() error {
+		u.tokens = append(append([]crypt.Token(nil), u.tokens...), token)
+		u.tokenSecret = secret
+		if only {
+			u.pass = ""
+		}
+		return u.rekey("")
+	})
+	if !changed {
+		u.tokens, u.tokenSecret, u.pass = oldTokens, oldSecret, oldPass
+	}
+	if err != nil || !changed {
+		return err
+	}
+
+	infoColor.Println("token added, it's needed to open the file from now on")
+	return nil
+}
+
+// rmToken stops using the current user's token, a passphrase is asked for
+// if the token was all that was needed.
+func (u *uiContext) rmToken() error {
+	user := u.tokenUser()
+	if _, ok := crypt.FindToken(u.tokens, user); !ok {
+		errColor.Println("you have no token")
+		return nil
+	}
+	if u.keyFromCache("remove the token") {
+		return nil
+	}
+
+	oldTokens, oldSecret, oldPass := u.tokens, u.tokenSecret, u.pass
+	pass := u.pass
+	if u.tokenOnly() {
+		infoColor.Println("the token was all that was needed, a passphrase is needed instead")
+		var err error
+		if pass, err = u.getPassword(); err != nil {
+			return err
+		}
+		if len(pass) == 0 {
+			errColor.Println("refusing to use empty password")
+			return nil
+		}
+	}
+
+	changed, err := u.rekeyEverything(func() error {
+		u.pass = pass
+		u.tokens = crypt.RemoveToken(u.tokens, user)
+		u.tokenSecret = nil
+		return u.rekey("")
+	})
+	if !changed {
+		u.tokens, u.tokenSecret, u.pass = oldTokens, oldSecret, oldPass
+	}
+	if err != nil || !changed {
+		return err
+	}
+
+	infoColor.Println("token removed, it's no longer needed")
+	return nil
+}
+
+// tokenToUser gives a single user file's token to the user it's made into
+// when the file becomes multi-user, their key stays the same
+func (u *uiContext) tokenToUser(user string) {
+	sum := sha256.Sum256([]byte(user))
+	tokens := make([]crypt.Token, len(u.tokens))
+	for i, t := range u.tokens {
+		if len(t.User) == 0 {
+			t.User = sum[:]
+		}
+		tokens[i] = t
+	}
+	u.tokens = tokens
+}
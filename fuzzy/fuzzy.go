@@ -42,3 +42,76 @@ Search:
 func MatchFold(s string, search string) bool {
 	return Match(strings.ToLower(s), strings.ToLower(search))
 }
+
+// Scores given by Score
+const (
+	// scoreChar is for each character of search that matched
+	scoreChar = 1
+	// scoreStart is for a match at the start of s or of a word in it
+	scoreStart = 8
+	// scoreRun is for a match right after the previous one
+	scoreRun = 5
+	// scoreSkip is for each character of s skipped over before or between
+	// matches
+	scoreSkip = -1
+	// scoreExact is for s being the same as search
+	scoreExact = 100
+)
+
+// Score performs the same match as Match and scores how well s matches
+// search, a higher score is a better match. Matches at the start of s or of a
+// word in it (after a separator or a change to uppercase) and runs of
+// consecutive matches score higher, characters skipped over score lower.
+func Score(s string, search string) (score int, ok bool) {
+	if !Match(s, search) {
+		return 0, false
+	}
+	if s == search {
+		return scoreExact + len(search)*(scoreChar+scoreRun), true
+	}
+
+	want := []rune(search)
+	matched, last := 0, -2
+	prev := rune(0)
+	for i, char := range []rune(s) {
+		if matched == len(want) {
+			break
+		}
+
+		if want[matched] == char || want[matched] == unicode.ToLower(char) {
+			score += scoreChar
+			if i == 0 || isSeparator(prev) || (unicode.IsUpper(char) && unicode.IsLower(prev)) {
+				score += scoreStart
+			}
+			if last == i-1 {
+				score += scoreRun
+			}
+			last = i
+			matched++
+		} else {
+			score += scoreSkip
+		}
+		prev = char
+	}
+
+	return score, true
+}
+
+// ScoreFold is a case insensitive Score
+func ScoreFold(s string, search string) (score int, ok bool) {
+	if strings.EqualFold(s, search) {
+		return scoreExact + len(search)*(scoreChar+scoreRun), true
+	}
+
+	// Starts of words are found from the case in s so it's kept
+	if !MatchFold(s, search) {
+		return 0, false
+	}
+	score, _ = Score(s, strings.ToLower(search))
+	return score, true
+}
+
+// isSeparator checks if r separates words in a name
+func isSeparator(r rune) bool {
+	return r == '/' || r == '-' || r == '_' || r == '.' || r == '@' || unicode.IsSpace(r)
+}
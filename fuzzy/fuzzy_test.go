@@ -82,3 +82,56 @@ func TestFuzzyFold(t *testing.T) {
 		}
 	}
 }
+
+func TestScore(t *testing.T) {
+	// Each search should rank the strings in the order given
+	tests := []struct {
+		Search  string
+		Ranking []string
+	}{
+		{"git", []string{"git", "github", "work/gitlab", "digital"}},
+		{"gh", []string{"GitHub", "github", "light"}},
+		{"ws", []string{"web/socket", "webs", "awkward/s"}},
+		{"aws", []string{"aws", "aws-prod", "work/aws", "always"}},
+	}
+
+	for i, test := range tests {
+		prev := 0
+		for j, s := range test.Ranking {
+			score, ok := Score(s, test.Search)
+			if !ok {
+				t.Errorf("%d) %q should match %q", i, s, test.Search)
+				continue
+			}
+			if j != 0 && score >= prev {
+				t.Errorf("%d) %q (%d) should score lower than %q (%d)",
+					i, s, score, test.Ranking[j-1], prev)
+			}
+			prev = score
+		}
+	}
+
+	if _, ok := Score("abc", "d"); ok {
+		t.Error("should not match")
+	}
+	if _, ok := Score("abc", "A"); ok {
+		t.Error("uppercase should not match lowercase")
+	}
+}
+
+func TestScoreFold(t *testing.T) {
+	exact, ok := ScoreFold("GitHub", "github")
+	if !ok {
+		t.Fatal("should match")
+	}
+	partial, ok := ScoreFold("GitHub", "GH")
+	if !ok {
+		t.Fatal("should match")
+	}
+	if partial >= exact {
+		t.Errorf("partial match (%d) should score lower than exact (%d)", partial, exact)
+	}
+	if _, ok := ScoreFold("abc", "D"); ok {
+		t.Error("should not match")
+	}
+}
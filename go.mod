@@ -6,6 +6,7 @@ require (
 	github.com/aarondl/color v0.0.0-20191031162153-2a82c25a0dcf
 	github.com/aarondl/readline v0.0.1
 	github.com/atotto/clipboard v0.1.2
+	github.com/boombuler/barcode v1.0.1-0.20190219062509-6c824513bacc
 	github.com/davecgh/go-spew v1.1.1 // indirect
 	github.com/enceve/crypto v0.0.0-20160707101852-34d48bb93815
 	github.com/gofrs/uuid v3.2.0+incompatible
@@ -13,5 +14,7 @@ require (
 	github.com/mattn/go-colorable v0.1.4
 	github.com/pquerna/otp v1.2.0
 	golang.org/x/crypto v0.0.0-20191002192127-34f69633bfdc
+	golang.org/x/net v0.0.0-20190404232315-eb5bcb51f2a3
 	golang.org/x/sys v0.0.0-20191010194322-b09406accb47
+	golang.org/x/text v0.3.0
 )
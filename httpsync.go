@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/syncserver"
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// httpVersions remembers the version vector of each https remote between
+// pulling and pushing, the server refuses pushes that are not based on the
+// latest version it has.
+var httpVersions = make(map[string]syncserver.Vector)
+
+var httpClient = http.Client{Timeout: 30 * time.Second}
+
+func httpPull(uuid string, entry txlogs.Entry) ([]byte, error) {
+	req, err := httpRequest(http.MethodGet, entry, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		httpVersions[uuid] = make(syncserver.Vector)
+		return nil, errNotFound
+	default:
+		return nil, httpError(resp)
+	}
+
+	vector, err := syncserver.ParseVector(resp.Header.Get(syncserver.VersionHeader))
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	httpVersions[uuid] = vector
+	return ct, nil
+}
+
+func httpPush(u *uiContext, uuid string, entry txlogs.Entry, payload []byte) error {
+	req, err := httpRequest(http.MethodPut, entry, payload)
+	if err != nil {
+		return err
+	}
+
+	vector := httpVersions[uuid].Next(syncDevice(u))
+	req.Header.Set(syncserver.VersionHeader, vector.String())
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusNoContent:
+		httpVersions[uuid] = vector
+		return nil
+	case http.StatusConflict:
+		return fmt.Errorf("someone else pushed during the sync, sync again to merge their changes")
+	default:
+		return httpError(resp)
+	}
+}
+
+func httpRequest(method string, entry txlogs.Entry, body []byte) (*http.Request, error) {
+	req, err := http.NewRequest(method, entry[blobformat.KeyURL], bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+entry[blobformat.KeyToken])
+	return req, nil
+}
+
+func httpError(resp *http.Response) error {
+	msg, _ := ioutil.ReadAll(resp.Body)
+	return fmt.Errorf("server responded %s: %s", resp.Status, strings.TrimSpace(string(msg)))
+}
+
+// syncDevice names this device in version vectors
+func syncDevice(u *uiContext) string {
+	host, err := os.Hostname()
+	if err != nil || len(host) == 0 {
+		host = "bpass"
+	}
+
+	if len(u.user) != 0 {
+		return u.user + "@" + host
+	}
+	return host
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+)
+
+var (
+	// linkTagRgx finds <link> tags in a page, iconRelRgx and hrefRgx pick
+	// the parts we care about out of them.
+	linkTagRgx = regexp.MustCompile(`(?i)<link\s[^>]*>`)
+	iconRelRgx = regexp.MustCompile(`(?i)\brel\s*=\s*["']?[^"'>]*\bicon\b`)
+	hrefRgx    = regexp.MustCompile(`(?i)\bhref\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s>]+))`)
+)
+
+// fetchIcon downloads the favicon of the site the url belongs to. The page
+// is checked for a <link rel="icon"> first, falling back to /favicon.ico.
+func fetchIcon(rawURL string) ([]byte, error) {
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	site, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if len(site.Host) == 0 {
+		return nil, blobformat.ErrInvalidURL
+	}
+	site.Path, site.RawQuery, site.Fragment = "/", "", ""
+
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	candidates := []string{}
+	if page, err := httpGet(client, site.String(), 512*1024); err == nil {
+		candidates = append(candidates, iconLinks(site, page)...)
+	}
+	candidates = append(candidates, site.ResolveReference(&url.URL{Path: "/favicon.ico"}).String())
+
+	var lastErr error
+	for _, c := range candidates {
+		icon, err := httpGet(client, c, blobformat.MaxIconSize+1)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if len(icon) > blobformat.MaxIconSize {
+			lastErr = blobformat.ErrIconTooLarge
+			continue
+		}
+		if !strings.HasPrefix(http.DetectContentType(icon), "image/") {
+			lastErr = blobformat.ErrIconNotImage
+			continue
+		}
+
+		return icon, nil
+	}
+
+	return nil, lastErr
+}
+
+// iconLinks returns the absolute urls of all the icons linked in a page
+func iconLinks(base *url.URL, page []byte) []string {
+	var links []string
+	for _, tag := range linkTagRgx.FindAll(page, -1) {
+		if !iconRelRgx.Match(tag) {
+			continue
+		}
+		m := hrefRgx.FindSubmatch(tag)
+		if m == nil {
+			continue
+		}
+
+		href := string(m[1]) + string(m[2]) + string(m[3])
+		ref, err := url.Parse(strings.TrimSpace(href))
+		if err != nil {
+			continue
+		}
+		links = append(links, base.ResolveReference(ref).String())
+	}
+
+	return links
+}
+
+// httpGet returns at most limit bytes of the body at the url
+func httpGet(client *http.Client, rawURL string, limit int64) ([]byte, error) {
+	resp, err := client.Get(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", rawURL, resp.Status)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, limit))
+}
+
+// setIcon fetches the icon for the entry from rawURL, or the entry's url key
+// if rawURL is empty, and stores it in the entry.
+func (u *uiContext) setIcon(uuid, rawURL string) error {
+	if len(rawURL) == 0 {
+		blob, err := u.store.MustFind(uuid)
+		if err != nil {
+			return err
+		}
+		urls := blob.URLs()
+		if len(urls) == 0 {
+			return errors.New("entry has no url to fetch an icon from, give one: set <query> icon <url>")
+		}
+		rawURL = urls[0]
+	}
+
+	infoColor.Println("fetching icon from", rawURL)
+	icon, err := fetchIcon(rawURL)
+	if err != nil {
+		return fmt.Errorf("could not fetch an icon: %w", err)
+	}
+
+	return u.store.SetIcon(uuid, icon)
+}
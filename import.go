@@ -11,6 +11,11 @@ import (
 	"github.com/aarondl/bpass/blobformat"
 )
 
+const (
+	lastpassSource = "lastpass"
+	lastpassFields = "id,url,username,password,extra,name,grouping,fav"
+)
+
 func importLastpass(u *uiContext) error {
 	if !u.created {
 		infoColor.Println("this is not a new file")
@@ -30,7 +35,7 @@ func importLastpass(u *uiContext) error {
 	}
 
 	// get data from lpass command line client
-	lpassCmd := exec.Command("lpass", "export", "--color=never")
+	lpassCmd := exec.Command("lpass", "export", "--color=never", "--fields="+lastpassFields)
 	out, err := lpassCmd.CombinedOutput()
 	if err != nil {
 		return err
@@ -48,40 +53,53 @@ func importLastpass(u *uiContext) error {
 		}
 
 		if i == 0 {
-			if strings.Join(record, ",") != "url,username,password,extra,name,grouping,fav" {
+			if strings.Join(record, ",") != lastpassFields {
 				return errors.New("lastpass csv format not recognized")
 			}
+			continue
 		}
 
 		// Fields:
-		//  0    1         2       3     4    5        6
-		// url,username,password,extra,name,grouping,fav
-
-		// Create the
-		var uuid string
-
-		// Create the new entry, make sure the name is unique
-		oldName := strings.ReplaceAll(strings.ToLower(record[4]), " ", "_")
-		newName := oldName
-		for {
-			uuid, err = u.store.New(newName)
-			if err != nil {
-				if err == blobformat.ErrNameNotUnique {
-					newName += "1"
-					continue
-				}
+		//  0  1    2         3       4     5    6        7
+		// id,url,username,password,extra,name,grouping,fav
 
-				return err
-			}
+		// Entries imported before update rather than duplicate
+		uuid, existing, err := u.store.FindByProvenance(lastpassSource, record[0])
+		if err != nil {
+			return err
+		}
+
+		if existing != nil {
+			infoColor.Println("updating:", existing.Name())
+		} else {
+			// Create the new entry, make sure the name is unique
+			oldName := strings.ReplaceAll(strings.ToLower(record[5]), " ", "_")
+			newName := oldName
+			for {
+				uuid, err = u.store.New(newName)
+				if err != nil {
+					if err == blobformat.ErrNameNotUnique {
+						newName += "1"
+						continue
+					}
+
+					return err
+				}
 
-			if oldName == newName {
-				infoColor.Println("importing:", oldName)
-			} else {
-				infoColor.Printf("importing: %s => %s\n", oldName, newName)
+				if oldName == newName {
+					infoColor.Println("importing:", oldName)
+				} else {
+					infoColor.Printf("importing: %s => %s\n", oldName, newName)
+				}
+				break
 			}
-			break
 		}
 
+		u.store.SetProvenance(uuid, lastpassSource, record[0])
+
+		// Drop the id, the rest are the fields of lastpass's default export
+		record = record[1:]
+
 		if len(record[1]) != 0 {
 			u.store.DB.Set(uuid, blobformat.KeyUser, record[1])
 		}
@@ -91,8 +109,10 @@ func importLastpass(u *uiContext) error {
 		if len(record[0]) != 0 {
 			u.store.DB.Set(uuid, blobformat.KeyURL, record[0])
 		}
-		if len(record[3]) != 0 {
-			u.store.DB.Set(uuid, blobformat.KeyNotes, record[3])
+		if len(record[3]) != 0 && !hasNote(existing, record[3]) {
+			if err = u.store.AddNote(uuid, record[3]); err != nil {
+				return err
+			}
 		}
 
 		var labels []string
@@ -111,3 +131,14 @@ func importLastpass(u *uiContext) error {
 
 	return nil
 }
+
+// hasNote checks if the entry already has a note with the text so re-imports
+// don't add it again
+func hasNote(blob blobformat.Blob, text string) bool {
+	for _, n := range blob.Notes() {
+		if n.Text == text {
+			return true
+		}
+	}
+	return false
+}
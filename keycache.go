@@ -0,0 +1,117 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/crypt"
+	"github.com/aarondl/bpass/osutil"
+)
+
+// keyCacheService is what cached keys are stored under in the OS keychain
+const keyCacheService = "bpass"
+
+// keyCacheAccount is the keychain account a file's key is stored under, the
+// hash of its path so it never needs quoting
+func keyCacheAccount(filename string) string {
+	sum := sha256.Sum256([]byte(filename))
+	return hex.EncodeToString(sum[:])
+}
+
+// cacheKey stores the current user's key in the OS keychain so the file can
+// be opened again without a passphrase until ttl passes. The keychain
+// doesn't expire anything so the time is stored along with the key:
+// unix expiry|hex user|hex key|hex salt
+func (u *uiContext) cacheKey(ttl time.Duration) error {
+	value := strings.Join([]string{
+		strconv.FormatInt(time.Now().Add(ttl).Unix(), 10),
+		hex.EncodeToString([]byte(u.user)),
+		hex.EncodeToString(u.key),
+		hex.EncodeToString(u.salt),
+	}, "|")
+
+	return osutil.KeychainSet(keyCacheService, keyCacheAccount(u.filename), value)
+}
+
+// cachedKey returns the key cached for the file, ok is false if there isn't
+// one or it has expired (it's removed then).
+func (u *uiContext) cachedKey() (user string, key, salt []byte, ok bool, err error) {
+	value, err := osutil.KeychainGet(keyCacheService, keyCacheAccount(u.filename))
+	if err == osutil.ErrKeychainItemNotFound {
+		return "", nil, nil, false, nil
+	} else if err != nil {
+		return "", nil, nil, false, err
+	}
+
+	parts := strings.Split(strings.TrimSpace(value), "|")
+	if len(parts) != 4 {
+		return "", nil, nil, false, errors.New("cached key is malformed")
+	}
+
+	expires, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return "", nil, nil, false, errors.New("cached key has a bad expiry")
+	}
+	if time.Now().Unix() >= expires {
+		return "", nil, nil, false, u.forgetKey()
+	}
+
+	userBytes, err := hex.DecodeString(parts[1])
+	if err != nil {
+		return "", nil, nil, false, errors.New("cached key has a bad user")
+	}
+	if key, err = hex.DecodeString(parts[2]); err != nil {
+		return "", nil, nil, false, errors.New("cached key has a bad key")
+	}
+	if salt, err = hex.DecodeString(parts[3]); err != nil {
+		return "", nil, nil, false, errors.New("cached key has a bad salt")
+	}
+
+	return string(userBytes), key, salt, true, nil
+}
+
+// decryptCached decrypts the file with its cached key, ok is false if there
+// isn't one that works so the user has to be asked.
+func (u *uiContext) decryptCached(payload []byte) (user string, version int, params crypt.Params, pt []byte, ok bool) {
+	user, key, salt, ok, err := u.cachedKey()
+	if err != nil {
+		errColor.Println("failed to read the cached key:", err)
+		return "", 0, params, nil, false
+	} else if !ok {
+		return "", 0, params, nil, false
+	}
+
+	version, params, pt, err = crypt.Decrypt([]byte(user), nil, key, salt, payload)
+	if err != nil {
+		// It was most likely rekeyed since
+		errColor.Println("the cached key no longer opens the file:", err)
+		if err = u.forgetKey(); err != nil {
+			errColor.Println("failed to remove the cached key:", err)
+		}
+		return "", 0, params, nil, false
+	}
+
+	infoColor.Println("opened with the key cached in the keychain")
+	return user, version, params, pt, true
+}
+
+// forgetKey removes the file's cached key from the keychain
+func (u *uiContext) forgetKey() error {
+	return osutil.KeychainDelete(keyCacheService, keyCacheAccount(u.filename))
+}
+
+// keyFromCache refuses to change the current user's key when the file was
+// opened with a cached key, the passphrase (and keyfile or token) the key is
+// derived from aren't known.
+func (u *uiContext) keyFromCache(action string) bool {
+	if !u.keyCached {
+		return false
+	}
+
+	errColor.Printf("the file was opened with a cached key, run forgetkey and reopen it with your passphrase to %s\n", action)
+	return true
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// keyfileSize is how many random bytes generated keyfiles have
+const keyfileSize = 64
+
+// readKeyfile returns the hash of a keyfile's contents, any file can be used
+// as a keyfile as long as it never changes.
+func readKeyfile(filename string) ([]byte, error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return nil, errors.New("keyfile is empty")
+	}
+
+	sum := sha256.Sum256(b)
+	return sum[:], nil
+}
+
+// unlockPass is what the current user's key is derived from, the passphrase
+// combined with the keyfile and the token's secret if they're used so the
+// file can't be opened with the passphrase alone. Other users' passphrases
+// are used as they are.
+func (u *uiContext) unlockPass(pass string) string {
+	if len(u.keyfile) != 0 {
+		pass += "\x00" + hex.EncodeToString(u.keyfile)
+	}
+	if len(u.tokenSecret) != 0 {
+		pass += "\x01" + hex.EncodeToString(u.tokenSecret)
+	}
+	return pass
+}
+
+// newKeyfile writes a new keyfile full of random bytes and rekeys the current
+// user with it, the file, its archive and backups are saved with the new key
+// right away so the keyfile in use (if any) stops working.
+func (u *uiContext) newKeyfile(filename string) error {
+	if u.keyFromCache("use a keyfile") {
+		return nil
+	}
+	if len(u.pass) == 0 {
+		errColor.Println("cannot use a keyfile without a passphrase")
+		return nil
+	}
+
+	b := make([]byte, keyfileSize)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+	if os.IsExist(err) {
+		errColor.Printf("%s already exists, refusing to overwrite a keyfile that may be in use\n", filename)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if _, err = f.Write(b); err != nil {
+		_ = f.Close()
+		return err
+	}
+	if err = f.Close(); err != nil {
+		return err
+	}
+
+	sum := sha256.Sum256(b)
+	old := u.keyfile
+	changed, err := u.rekeyEverything(func() error {
+		u.keyfile = sum[:]
+		return u.rekey("")
+	})
+	if !changed {
+		u.keyfile = old
+	}
+	if err != nil || !changed {
+		return err
+	}
+
+	if abs, err := filepath.Abs(filename); err == nil {
+		filename = abs
+	}
+	infoColor.Printf("keyfile written to %s, from now on open with: --keyfile %s\n", filename, filename)
+	infoColor.Println("keep a copy somewhere safe, the file can't be opened without it")
+	return nil
+}
+
+// genKeyfile starts using a keyfile along with the passphrase
+func (u *uiContext) genKeyfile(filename string) error {
+	if len(u.keyfile) != 0 {
+		errColor.Println("a keyfile is already in use, see rotatekeyfile")
+		return nil
+	}
+
+	return u.newKeyfile(filename)
+}
+
+// rotateKeyfile replaces the keyfile in use with a new one, the new one has to
+// be written somewhere else first since the old one is needed until the file
+// has been saved.
+func (u *uiContext) rotateKeyfile(filename string) error {
+	if len(u.keyfile) == 0 {
+		errColor.Println("no keyfile is in use, see genkeyfile")
+		return nil
+	}
+
+	return u.newKeyfile(filename)
+}
+
+// rmKeyfile stops using a keyfile, only the passphrase is needed from then on
+func (u *uiContext) rmKeyfile() error {
+	if len(u.keyfile) == 0 {
+		errColor.Println("no keyfile is in use")
+		return nil
+	}
+	if u.keyFromCache("remove the keyfile") {
+		return nil
+	}
+
+	yes, err := u.getYesNo("the file will only be protected by the passphrase, are you sure?")
+	if err != nil || !yes {
+		return err
+	}
+
+	old := u.keyfile
+	changed, err := u.rekeyEverything(func() error {
+		u.keyfile = nil
+		return u.rekey("")
+	})
+	if !changed {
+		u.keyfile = old
+	}
+	if err != nil || !changed {
+		return err
+	}
+
+	infoColor.Println("keyfile removed, it's no longer needed")
+	return nil
+}
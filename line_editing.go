@@ -3,6 +3,7 @@ package main
 import (
 	"errors"
 	"io"
+	"time"
 )
 
 // Handle-able error codes that arise from line editors
@@ -19,6 +20,9 @@ type LineEditor interface {
 	// LineHidden returns a line of text as read from the user, but does not
 	// show what's typed to the user.
 	LineHidden(prompt string) (string, error)
+	// LineTimeout is Line but gives up waiting after timeout, timedOut is
+	// true if it did.
+	LineTimeout(prompt string, timeout time.Duration) (line string, timedOut bool, err error)
 
 	// AddHistory puts line into the history. It should be called when a valid
 	// command has occurred.
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/osutil"
+)
+
+// lockInfo is who holds the lock on a file, it's written to the lock file as
+// pid|host|unix time|random id
+type lockInfo struct {
+	PID   int
+	Host  string
+	Since time.Time
+	// ID tells locks apart even when everything else is the same
+	ID string
+}
+
+// lockedError is returned when another process has the file open
+type lockedError struct {
+	filename string
+	holder   lockInfo
+}
+
+func (l lockedError) Error() string {
+	return fmt.Sprintf("%s is locked by pid %d on %s since %s, if it's no longer open there use --steal-lock",
+		l.filename, l.holder.PID, l.holder.Host, l.holder.Since.Format(historyLayout))
+}
+
+// lockFilename is the lock file of filename
+func lockFilename(filename string) string {
+	return filename + ".lock"
+}
+
+func (l lockInfo) String() string {
+	return fmt.Sprintf("%d|%s|%d|%s\n", l.PID, l.Host, l.Since.Unix(), l.ID)
+}
+
+func (l lockInfo) same(o lockInfo) bool {
+	return l.PID == o.PID && l.Host == o.Host && l.Since.Equal(o.Since) && l.ID == o.ID
+}
+
+// sameLock is true when two reads of a lock file are the same lock, a
+// malformed one has to be unchanged
+func sameLock(a, b []byte) bool {
+	la, errA := parseLock(a)
+	lb, errB := parseLock(b)
+	if errA != nil || errB != nil {
+		return bytes.Equal(a, b)
+	}
+	return la.same(lb)
+}
+
+func parseLock(b []byte) (l lockInfo, err error) {
+	parts := strings.Split(strings.TrimSpace(string(b)), "|")
+	if len(parts) != 4 {
+		return l, errors.New("lock file is malformed")
+	}
+
+	if l.PID, err = strconv.Atoi(parts[0]); err != nil {
+		return l, errors.New("lock file has a bad pid")
+	}
+	l.Host = parts[1]
+	since, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return l, errors.New("lock file has a bad time")
+	}
+	l.Since = time.Unix(since, 0)
+	l.ID = parts[3]
+
+	return l, nil
+}
+
+// lock takes the lock on the file so another bpass can't open it for
+// writing at the same time. A lock left behind by a process on this machine
+// that's no longer running is taken over, others only with steal.
+func (u *uiContext) lock(steal bool) error {
+	host, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	id := make([]byte, 8)
+	if _, err = rand.Read(id); err != nil {
+		return err
+	}
+	mine := lockInfo{PID: os.Getpid(), Host: host, Since: time.Unix(time.Now().Unix(), 0), ID: hex.EncodeToString(id)}
+	lockFile := lockFilename(u.filename)
+
+	for {
+		f, err := os.OpenFile(lockFile, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.WriteString(mine.String())
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(lockFile)
+				return err
+			}
+			u.lockHeld = mine
+			return nil
+		} else if !os.IsExist(err) {
+			return err
+		}
+
+		b, err := ioutil.ReadFile(lockFile)
+		if os.IsNotExist(err) {
+			// Released while we looked
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		holder, err := parseLock(b)
+		switch {
+		case steal:
+			infoColor.Println("stealing the lock on", u.shortFilename)
+		case err != nil:
+			return fmt.Errorf("%s.lock can't be read (%v), if it's not open anywhere use --steal-lock", u.shortFilename, err)
+		case holder.Host == host && !osutil.ProcessRunning(holder.PID):
+			infoColor.Printf("taking over the lock on %s left by pid %d\n", u.shortFilename, holder.PID)
+		default:
+			return lockedError{filename: u.shortFilename, holder: holder}
+		}
+
+		// Another bpass may have taken the lock over since it was read, only
+		// the lock that was looked at is removed
+		again, err := ioutil.ReadFile(lockFile)
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return err
+		}
+		if !sameLock(again, b) {
+			continue
+		}
+
+		if err = os.Remove(lockFile); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		steal = false
+	}
+}
+
+// unlock releases the lock on the file unless someone else has taken it
+// since, their changes will be noticed when saving (see checkDisk).
+func (u *uiContext) unlock() {
+	if u.lockHeld.PID == 0 {
+		return
+	}
+
+	lockFile := lockFilename(u.filename)
+	if b, err := ioutil.ReadFile(lockFile); err == nil {
+		if holder, err := parseLock(b); err == nil && holder.same(u.lockHeld) {
+			_ = os.Remove(lockFile)
+		}
+	}
+	u.lockHeld = lockInfo{}
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLock(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "bpass")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "file.blob")
+	first := &uiContext{filename: filename, shortFilename: "file.blob"}
+	if err = first.lock(false); err != nil {
+		t.Fatal(err)
+	}
+
+	// Our own pid is running so the lock isn't stale
+	second := &uiContext{filename: filename, shortFilename: "file.blob"}
+	if err = second.lock(false); err == nil {
+		t.Fatal("expected the file to be locked")
+	} else if _, ok := err.(lockedError); !ok {
+		t.Fatal("expected a locked error, got:", err)
+	}
+
+	if err = second.lock(true); err != nil {
+		t.Fatal(err)
+	}
+	// The lock was stolen, it must be left alone
+	first.unlock()
+	if _, err = os.Stat(lockFilename(filename)); err != nil {
+		t.Error("the stolen lock was removed:", err)
+	}
+	second.unlock()
+	if _, err = os.Stat(lockFilename(filename)); !os.IsNotExist(err) {
+		t.Error("the lock should have been removed:", err)
+	}
+
+	// Another host's lock is never stale
+	other := lockInfo{PID: 1, Host: "elsewhere", Since: time.Unix(1, 0), ID: "x"}
+	if err = ioutil.WriteFile(lockFilename(filename), []byte(other.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err = first.lock(false); err == nil {
+		t.Error("expected another host's lock to be kept")
+	}
+}
+
+func TestSameLock(t *testing.T) {
+	t.Parallel()
+
+	stale := lockInfo{PID: 1, Host: "here", Since: time.Unix(1, 0), ID: "a"}
+	taken := lockInfo{PID: 2, Host: "here", Since: time.Unix(2, 0), ID: "b"}
+
+	if !sameLock([]byte(stale.String()), []byte(stale.String())) {
+		t.Error("a lock should be the same as itself")
+	}
+	if sameLock([]byte(taken.String()), []byte(stale.String())) {
+		t.Error("a lock taken over since should not be the same")
+	}
+	if sameLock([]byte(taken.String()), []byte("garbage")) {
+		t.Error("a lock replacing a malformed one should not be the same")
+	}
+	if !sameLock([]byte("garbage"), []byte("garbage")) {
+		t.Error("an unchanged malformed lock should be the same")
+	}
+}
@@ -19,7 +19,7 @@ import (
 
 var (
 	version      = "unknown"
-	cryptVersion = 1
+	cryptVersion = 5
 )
 
 func main() {
@@ -45,6 +45,23 @@ func main() {
 	if !historyTime.IsZero() {
 		ctx.readOnly = true
 	}
+	blobformat.YubiKeyCode = ykmanCode
+	if len(flagKeyfile) != 0 {
+		if ctx.keyfile, err = readKeyfile(flagKeyfile); err != nil {
+			fmt.Printf("failed to read keyfile: %v\n", err)
+			os.Exit(1)
+		}
+	}
+	if len(flagIdentity) != 0 {
+		if len(flagKeyfile) != 0 {
+			fmt.Println("--identity and --keyfile cannot be used together")
+			os.Exit(1)
+		}
+		if ctx.identity, err = readIdentity(flagIdentity); err != nil {
+			fmt.Printf("failed to read identity: %v\n", err)
+			os.Exit(1)
+		}
+	}
 
 	// setup readline needs to have the filenames parsed and ready
 	// to use from above
@@ -54,6 +71,21 @@ func main() {
 	}
 
 	if genCmd.Used {
+		if len(flagEntropyFile) != 0 {
+			b, err := readEntropyFile(flagEntropyFile)
+			if err != nil {
+				fmt.Printf("failed to read entropy: %v\n", err)
+				os.Exit(1)
+			}
+			ctx.addEntropy(flagEntropyFile, b)
+		}
+		if flagDice {
+			if err := ctx.promptEntropy(); err != nil {
+				fmt.Printf("failed to read dice rolls: %v\n", err)
+				os.Exit(1)
+			}
+		}
+
 		passwd, err := ctx.getPassword()
 		if err != nil {
 			fmt.Printf("failed to get a password: %v\n", err)
@@ -64,6 +96,38 @@ func main() {
 		return
 	}
 
+	if verifyCmd.Used {
+		if err := ctx.verifyFile(flagVerifyFile, flagVerifyFull, flagVerifyUser, flagVerifyPassphraseFile); err != nil {
+			if err != errVerifyFailed {
+				fmt.Printf("failed to verify: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	if doctorCmd.Used {
+		if err := ctx.doctor(flagFile, flagDoctorOffline); err != nil {
+			if err != errDoctorFailed {
+				fmt.Printf("failed to run doctor: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
+	if reportCmd.Used && len(flagReportVerify) != 0 {
+		if err := verifyReport(flagReportVerify); err != nil {
+			if err == errReportInvalid {
+				errColor.Println(err)
+			} else {
+				fmt.Printf("failed to verify report: %v\n", err)
+			}
+			os.Exit(1)
+		}
+		return
+	}
+
 	ctx.filename, err = filepath.Abs(flagFile)
 	if err != nil {
 		fmt.Printf("failed to find the absolute path to: %q\n", flagFile)
@@ -79,12 +143,180 @@ func main() {
 	}
 
 	switch {
+	case mvVaultCmd.Used:
+		if ctx.readOnly {
+			errColor.Println("cannot move entries in read-only mode")
+			goto Exit
+		}
+		if len(flagMoveTo) == 0 {
+			errColor.Println("mv-vault requires --to")
+			goto Exit
+		}
+		if err = ctx.moveToVault(flagMoveEntry, flagMoveTo); err != nil {
+			fmt.Printf("error occurred: %+v\nexiting without saving\n", err)
+			goto Exit
+		}
+	case migrateCmd.Used:
+		if flagMigrateDryRun || ctx.readOnly {
+			if err = ctx.migrate(true); err != nil {
+				fmt.Printf("error occurred: %+v\n", err)
+			}
+			goto Exit
+		}
+		if err = ctx.migrate(false); err != nil {
+			fmt.Printf("error occurred: %+v\nexiting without saving\n", err)
+			goto Exit
+		}
+	case normalizeCmd.Used:
+		if flagNormalizeDryRun || ctx.readOnly {
+			if err = ctx.normalizeNames(true); err != nil {
+				fmt.Printf("error occurred: %+v\n", err)
+			}
+			goto Exit
+		}
+		if err = ctx.normalizeNames(false); err != nil {
+			fmt.Printf("error occurred: %+v\nexiting without saving\n", err)
+			goto Exit
+		}
+	case archiveCmd.Used:
+		if ctx.readOnly {
+			errColor.Println("cannot archive in read-only mode")
+			goto Exit
+		}
+		if err = ctx.archive(flagArchiveMonths); err != nil {
+			fmt.Printf("error occurred: %+v\nexiting without saving\n", err)
+			goto Exit
+		}
+	case unarchiveCmd.Used:
+		if ctx.readOnly {
+			errColor.Println("cannot unarchive in read-only mode")
+			goto Exit
+		}
+		// Saves the file itself
+		if err = ctx.unarchive(); err != nil {
+			fmt.Printf("error occurred: %+v\n", err)
+		}
+		goto Exit
+	case historyCmd.Used:
+		if err = ctx.history(flagHistoryEntry, flagHistoryArchive, flagHistoryReveal); err != nil {
+			fmt.Printf("error occurred: %+v\n", err)
+		}
+		goto Exit
+	case rotateCmd.Used:
+		if ctx.readOnly {
+			errColor.Println("cannot rotate in read-only mode")
+			goto Exit
+		}
+		if err = ctx.rotate(flagRotateEntry); err != nil {
+			if err == ErrInterrupt {
+				fmt.Println("exiting, did not save file")
+			} else {
+				fmt.Printf("error occurred: %+v\nexiting without saving\n", err)
+			}
+			goto Exit
+		}
+		if ctx.startTx != len(ctx.store.DB.Log) && !flagNoAutoSync {
+			if err = ctx.sync("", true, true); err != nil {
+				fmt.Println("failed to synchronize:", err)
+				goto Exit
+			}
+		}
+	case backupsCmd.Used:
+		if err = ctx.listBackups(); err != nil {
+			fmt.Printf("error occurred: %+v\n", err)
+		}
+		goto Exit
+	case restoreBackupCmd.Used:
+		if len(flagRestoreTo) == 0 {
+			errColor.Println("restore-backup requires --to")
+			goto Exit
+		}
+		if err = ctx.restoreBackup(flagRestoreID, flagRestoreTo); err != nil {
+			fmt.Printf("error occurred: %+v\n", err)
+		}
+		goto Exit
+	case reportCmd.Used:
+		// Not skipping the save, in multi-user files opening it may have
+		// created the signing key the report was signed with
+		if err = ctx.report(flagReportFormat, flagReportOut, flagReportMaxAge); err != nil {
+			fmt.Printf("error occurred: %+v\n", err)
+			goto Exit
+		}
+	case compromiseCmd.Used:
+		if ctx.readOnly {
+			errColor.Println("cannot respond to a compromise in read-only mode")
+			goto Exit
+		}
+		if err = ctx.compromiseResponse(); err != nil {
+			if err == ErrInterrupt {
+				fmt.Println("exiting, did not save file")
+			} else {
+				fmt.Printf("error occurred: %+v\nexiting without saving\n", err)
+			}
+			goto Exit
+		}
+	case purgeCmd.Used:
+		if ctx.readOnly {
+			errColor.Println("cannot purge history in read-only mode")
+			goto Exit
+		}
+		// Saves the file itself
+		if err = ctx.purgeHistory(flagPurgeEntry); err != nil {
+			fmt.Printf("error occurred: %+v\n", err)
+		}
+		goto Exit
+	case rekeyCmd.Used:
+		if ctx.readOnly {
+			errColor.Println("cannot rekey in read-only mode")
+			goto Exit
+		}
+		cost, err := ctx.rekeyCost(flagRekeyCalibrate, flagRekeyTime, flagRekeyMemory, flagRekeyThreads)
+		if err != nil {
+			errColor.Println(err)
+			goto Exit
+		}
+		// Saves the file itself
+		if err = ctx.rekeyFile(!flagRekeyKeepPass, cost); err != nil {
+			fmt.Printf("error occurred: %+v\n", err)
+		}
+		goto Exit
+	case listCmd.Used:
+		filter := listFilter{
+			Query:         flagListFilter,
+			Saved:         flagListSaved,
+			UpdatedAfter:  flagListUpdatedAfter,
+			UpdatedBefore: flagListUpdatedBefore,
+			CreatedAfter:  flagListCreatedAfter,
+			CreatedBefore: flagListCreatedBefore,
+			Offset:        flagListOffset,
+			Limit:         flagListLimit,
+		}
+		switch {
+		case flagListAll:
+			filter.Scope = blobformat.ScopeAll
+		case flagListTrash:
+			filter.Scope = blobformat.ScopeTrash
+		}
+		if err = ctx.listFiltered(filter); err != nil {
+			fmt.Printf("error occurred: %+v\n", err)
+		}
+		goto Exit
 	case lpassImportCmd.Used:
-		if err = importLastpass(ctx); err != nil {
+		err = ctx.store.DB.Because("import lastpass", func() error {
+			return importLastpass(ctx)
+		})
+		if err != nil {
 			fmt.Printf("error occurred: %+v\nexiting without saving", err)
 			goto Exit
 		}
 	default:
+		if len(flagVaults) != 0 {
+			if err = ctx.openVaults(flagVaults); err != nil {
+				fmt.Println("failed to open vaults:", err)
+				goto Exit
+			}
+		}
+
 		if !ctx.readOnly && !flagNoAutoSync {
 			if err = ctx.sync("", true, true); err != nil {
 				fmt.Println("failed to synchronize:", err)
@@ -92,6 +324,11 @@ func main() {
 			}
 		}
 
+		if err = ctx.expiryReminder(); err != nil {
+			fmt.Println("failed to check expiry dates:", err)
+			goto Exit
+		}
+
 		if err = r.run(); err != nil {
 			if err == ErrInterrupt {
 				fmt.Println("exiting, did not save file")
@@ -115,11 +352,20 @@ func main() {
 		fmt.Printf("failed to save file: %+v\n", err)
 		goto Exit
 	}
+	if err = ctx.saveVaults(); err != nil {
+		fmt.Println(err)
+		goto Exit
+	}
 
 Exit:
+	ctx.unlockVaults()
+	ctx.unlock()
+	resumeClipManagers()
 	if !flagNoClearClip {
 		if err = clipboard.WriteAll(""); err != nil {
 			fmt.Println("failed to clear the clipboard")
+		} else if copiedSecret {
+			notify("bpass", "clipboard cleared")
 		}
 	}
 
@@ -134,7 +380,7 @@ Exit:
 
 func (u *uiContext) loadBlob() error {
 	// Check the file exists and it's a file
-	check, err := os.Stat(flagFile)
+	check, err := os.Stat(u.filename)
 	if err != nil {
 		if os.IsNotExist(err) {
 			u.created = true
@@ -145,12 +391,22 @@ func (u *uiContext) loadBlob() error {
 		return errors.New("given file name is a directory")
 	}
 
+	if !u.readOnly {
+		if err = u.lock(flagStealLock); err != nil {
+			return err
+		}
+	}
+
 	if u.created {
 		infoColor.Printf("Creating new file: %s\n", u.filename)
 	}
 
 	var pwd string
 	if u.created {
+		if len(u.identity) != 0 {
+			return errors.New("cannot create a file with an identity, add recipients to it once it's multi-user")
+		}
+
 		pwd, err = u.promptPassword(promptColor.Sprint("passphrase: "))
 		if err != nil {
 			return err
@@ -170,39 +426,69 @@ func (u *uiContext) loadBlob() error {
 		}
 
 		// Derive a new key from the password for later encryption
-		key, salt, err := crypt.DeriveKey(cryptVersion, []byte(pwd))
+		key, salt, err := u.deriveKey(cryptVersion, []byte(u.unlockPass(pwd)))
 		if err != nil {
 			return err
 		}
 
 		u.key = key
 		u.salt = salt
+		u.version = cryptVersion
 	} else {
 		// Read in the file, decrypt it, parse the blob data.
-		payload, err := ioutil.ReadFile(flagFile)
+		payload, err := ioutil.ReadFile(u.filename)
 		if err != nil {
 			return err
 		}
+		u.rememberDisk(payload)
 
 		var user string
-		var ok bool
-		if ok, err = crypt.IsMultiUser(payload); err != nil {
-			return err
-		} else if ok {
-			user, err = u.prompt(promptColor.Sprintf("%s user: ", u.shortFilename))
+		var version int
+		var params crypt.Params
+		var pt []byte
+		if keyCacheTTL > 0 {
+			user, version, params, pt, u.keyCached = u.decryptCached(payload)
+		}
+
+		if !u.keyCached {
+			var header crypt.Header
+			header, err = crypt.ReadHeader(payload)
 			if err != nil {
 				return err
+			} else if len(u.identity) != 0 {
+				// The recipient is the user and the identity its passphrase
+				if header.NUsers == 0 {
+					return errors.New("only multi-user files can be opened with an identity")
+				}
+				if user, err = crypt.IdentityRecipient(u.identity); err != nil {
+					return err
+				}
+				pwd = u.identity
+			} else if header.NUsers != 0 {
+				user, err = u.prompt(promptColor.Sprintf("%s user: ", u.shortFilename))
+				if err != nil {
+					return err
+				}
 			}
-		}
 
-		pwd, err = u.promptPassword(promptColor.Sprintf("%s passphrase: ", u.shortFilename))
-		if err != nil {
-			return err
-		}
+			passphrase := true
+			if len(u.identity) == 0 {
+				if passphrase, err = u.unlockToken(header, user); err != nil {
+					return err
+				}
+			}
 
-		_, params, pt, err := crypt.Decrypt([]byte(user), []byte(pwd), nil, nil, payload)
-		if err != nil {
-			return err
+			if len(pwd) == 0 && passphrase {
+				pwd, err = u.promptPassword(promptColor.Sprintf("%s passphrase: ", u.shortFilename))
+				if err != nil {
+					return err
+				}
+			}
+
+			version, params, pt, err = crypt.Decrypt([]byte(user), []byte(u.unlockPass(pwd)), nil, nil, payload)
+			if err != nil {
+				return err
+			}
 		}
 
 		u.user = user
@@ -211,6 +497,20 @@ func (u *uiContext) loadBlob() error {
 		u.salt = params.Salts[params.User]
 		u.master = params.Master
 		u.ivm = params.IVM
+		u.version = version
+		u.tokens = params.Tokens
+
+		if keyCacheTTL > 0 && !u.keyCached {
+			if err = u.cacheKey(keyCacheTTL); err != nil {
+				errColor.Println("failed to cache the key:", err)
+			}
+		}
+
+		// Keep new keys as costly as the one the file was opened with,
+		// recipients' salts have no cost since their identity is the key
+		if cost, ok := crypt.SaltKeyCost(u.salt); ok && cost != (crypt.KeyCost{}) {
+			u.keyCost = cost
+		}
 
 		store, err := txlogs.New(pt)
 		if err != nil {
@@ -222,7 +522,7 @@ func (u *uiContext) loadBlob() error {
 
 	// It's possible the store was empty/null even on a load, just create it
 	if u.store.DB == nil {
-		u.store = blobformat.Blobs{DB: new(txlogs.DB)}
+		u.store = blobformat.Blobs{DB: &txlogs.DB{Schema: blobformat.SchemaVersion}}
 	} else if u.readOnly {
 		infoColor.Println("opened file in read-only mode at:", historyTime.Format("January 02, 2006 - 15:04:05"))
 		u.store.DB.ResetSnapshot()
@@ -238,10 +538,40 @@ func (u *uiContext) loadBlob() error {
 		}
 	}
 
+	u.store.FoldNames = flagFoldNames
+	u.store.NameRules = nameRules
+	u.store.Index = blobformat.NewSearchIndex()
+	u.store.DB.SetDevice(syncDevice(u))
+	u.setHistoryKey()
+	if err := checkHistory(u.shortFilename, u.store); err != nil {
+		return err
+	}
+
+	// Single user files only need a new key to move to the current version,
+	// multi-user files need everyone rekeyed (see rekeyall). It's done after
+	// the history was checked with the old one.
+	if u.version < cryptVersion && len(u.master) == 0 && !u.readOnly && !u.keyCached {
+		key, salt, err := u.deriveKey(cryptVersion, []byte(u.unlockPass(u.pass)))
+		if err != nil {
+			return err
+		}
+		u.key, u.salt, u.version = key, salt, cryptVersion
+		u.setHistoryKey()
+		infoColor.Printf("file will be upgraded to format version %d when saved\n", cryptVersion)
+	}
+
 	// Save this to know if we've actually edited the database in some way
 	u.startTx = len(u.store.DB.Log)
 
-	return nil
+	// Bring older files up to date, the migrate command does this itself so
+	// it can report what changed (or would change)
+	if !u.readOnly && !migrateCmd.Used && u.store.NeedsMigration() {
+		if err := u.migrate(false); err != nil {
+			return err
+		}
+	}
+
+	return u.ensureSigningKey()
 }
 
 func (u *uiContext) saveBlob() error {
@@ -249,6 +579,19 @@ func (u *uiContext) saveBlob() error {
 		return nil
 	}
 
+	if err := u.checkDisk(); err != nil {
+		return err
+	}
+
+	// Syncing may have brought back values that were redacted here
+	if _, err := u.store.RedactHistory(); err != nil {
+		return err
+	}
+	if _, err := u.store.CapSnapshots(); err != nil {
+		return err
+	}
+	u.setHistoryKey()
+
 	data, err := u.store.Save()
 	if err != nil {
 		return err
@@ -259,12 +602,26 @@ func (u *uiContext) saveBlob() error {
 		return err
 	}
 
-	data, err = crypt.Encrypt(cryptVersion, params, data)
+	changed := u.created || u.startTx != len(u.store.DB.Log)
+	if flagCopies > 0 && changed {
+		if err = keepCopy(u.filename, flagCopies); err != nil {
+			return fmt.Errorf("refusing to save, failed to keep a copy: %w", err)
+		}
+	}
+
+	ct, err := crypt.Save(u.filename, u.version, params, data)
 	if err != nil {
 		return err
 	}
+	u.rememberDisk(ct)
 
-	return ioutil.WriteFile(flagFile, data, 0600)
+	if flagBackups > 0 && changed {
+		if err = u.backup(data, flagBackups); err != nil {
+			return fmt.Errorf("saved but failed to back up: %w", err)
+		}
+	}
+
+	return nil
 }
 
 func shortPath(filename string) string {
@@ -6,6 +6,7 @@ import (
 	"time"
 
 	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/crypt"
 	"github.com/aarondl/bpass/txlogs"
 )
 
@@ -13,6 +14,8 @@ type mergeResult struct {
 	User, Pass  string
 	Key, Salt   []byte
 	Master, IVM []byte
+	Version     int
+	Tokens      []crypt.Token
 	Log         []txlogs.Tx
 }
 
@@ -66,7 +69,9 @@ func mergeBlobs(u *uiContext, remotes []blobParts) (m mergeResult, err error) {
 		User: u.user, Pass: u.pass,
 		Key: u.key, Salt: u.salt,
 		Master: u.master, IVM: u.ivm,
-		Log: make([]txlogs.Tx, len(u.store.Log)),
+		Version: u.version,
+		Tokens:  u.tokens,
+		Log:     make([]txlogs.Tx, len(u.store.Log)),
 	}
 	copy(m.Log, u.store.Log)
 
@@ -194,6 +199,8 @@ func mergeBlobs(u *uiContext, remotes []blobParts) (m mergeResult, err error) {
 			m.User, m.Pass = r.Creds.User, r.Creds.Pass
 			m.Key, m.Salt = r.Params.Keys[r.Params.User], r.Params.Salts[r.Params.User]
 			m.Master, m.IVM = r.Params.Master, r.Params.IVM
+			m.Version = r.Params.Version()
+			m.Tokens = r.Params.Tokens
 		}
 
 		m.Log = merged
@@ -222,6 +229,7 @@ func mergeLogs(u *uiContext, local []txlogs.Tx, remote []txlogs.Tx) ([]txlogs.Tx
 		}
 
 		infoColor.Println(len(conflicts), "conflicts occurred during syncing!")
+		notify("bpass sync", "%d conflicts need to be resolved", len(conflicts))
 
 		for i, c := range conflicts {
 			switch c.Kind {
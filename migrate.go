@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aarondl/bpass/blobformat"
+)
+
+// migrate upgrades the open file to the current schema version, or with
+// dryRun only reports what would change.
+func (u *uiContext) migrate(dryRun bool) error {
+	if !u.store.NeedsMigration() {
+		infoColor.Printf("%s is up to date (version %d)\n", u.shortFilename, u.store.DB.Schema)
+		return nil
+	}
+
+	from := u.store.DB.Schema
+	changes, err := u.store.Migrate(dryRun)
+	if err != nil {
+		return err
+	}
+
+	verb := "migrated"
+	if dryRun {
+		verb = "would migrate"
+	}
+	infoColor.Printf("%s %s from version %d to %d\n", verb, u.shortFilename, from, blobformat.SchemaVersion)
+	for _, c := range changes {
+		fmt.Println("  " + c)
+	}
+
+	return nil
+}
+
+// normalizeNames renames entries to follow --name-rules, or with dryRun only
+// reports what would be renamed.
+func (u *uiContext) normalizeNames(dryRun bool) error {
+	if u.store.NameRules == 0 {
+		errColor.Println("no --name-rules given, nothing to normalize")
+		return nil
+	}
+
+	changes, err := u.store.NormalizeNames(dryRun)
+	if err != nil {
+		return err
+	}
+	if len(changes) == 0 {
+		infoColor.Printf("all names already follow %s\n", u.store.NameRules)
+		return nil
+	}
+
+	verb := "renamed"
+	if dryRun {
+		verb = "would rename"
+	}
+	conflicts := 0
+	for _, c := range changes {
+		if c.Conflict {
+			conflicts++
+			fmt.Printf("  %s %s -> %s: name is taken\n", errColor.Sprint("skip"), c.Old, c.New)
+			continue
+		}
+		fmt.Printf("  %s %s -> %s\n", verb, c.Old, c.New)
+	}
+
+	if conflicts != 0 {
+		errColor.Printf("%d entries were not renamed, rename or merge them by hand\n", conflicts)
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"reflect"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// moveToVault moves an entry and all of its history into another file.
+//
+// The entry's transactions are copied into the other file's log and the
+// resulting entry is compared to the one in this file before the other file
+// is saved. Only then is the entry deleted here. If something goes wrong part
+// way the entry can end up in both files, but never in neither.
+func (u *uiContext) moveToVault(search, otherFile string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return errors.New("entry not found")
+	}
+
+	other, err := u.openOther(otherFile)
+	if err != nil {
+		return err
+	}
+	defer other.unlock()
+
+	return u.transferEntry(uuid, other, true)
+}
+
+// openOther opens another file, it's unlocked with the same keyfile as this
+// one.
+func (u *uiContext) openOther(filename string) (*uiContext, error) {
+	other := &uiContext{in: u.in, out: u.out, keyfile: u.keyfile}
+
+	var err error
+	other.filename, err = filepath.Abs(filename)
+	if err != nil {
+		return nil, err
+	}
+	if other.filename == u.filename {
+		return nil, errors.New("cannot open the same file twice")
+	}
+	other.shortFilename = shortPath(other.filename)
+
+	if err = other.loadBlob(); err != nil {
+		other.unlock()
+		return nil, fmt.Errorf("failed to open %s: %w", other.shortFilename, err)
+	}
+
+	return other, nil
+}
+
+// transferEntry copies an entry and all of its history into another open
+// file, with move it's deleted here once the other file has been saved.
+func (u *uiContext) transferEntry(uuid string, other *uiContext, move bool) error {
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	name := blob.Name()
+
+	existingUUID, _, err := other.store.FindByName(name)
+	if err != nil {
+		return err
+	}
+	if len(existingUUID) != 0 {
+		return fmt.Errorf("%s already has an entry named %s", other.shortFilename, name)
+	}
+	if _, ok := other.store.Snapshot[uuid]; ok {
+		return fmt.Errorf("%s already has an entry with this entry's uuid", other.shortFilename)
+	}
+
+	var history []txlogs.Tx
+	for _, tx := range u.store.Log {
+		if tx.UUID == uuid {
+			history = append(history, tx)
+		}
+	}
+
+	// The history goes where it happened so the log stays in time order, and
+	// is chained with the other file's key
+	other.store.ResetSnapshot()
+	other.store.Log = txlogs.Union(other.store.Log, history)
+	other.store.Rechain(uuid)
+	moved, err := other.store.Find(uuid)
+	if err != nil {
+		return fmt.Errorf("failed to copy history: %w", err)
+	}
+	if !reflect.DeepEqual(moved, blob) {
+		return errors.New("entry in destination did not match after copying history")
+	}
+
+	if !move {
+		infoColor.Printf("copied %s (%d changes) to %s\n", name, len(history), other.shortFilename)
+		return nil
+	}
+
+	if err = other.saveBlob(); err != nil {
+		return fmt.Errorf("failed to save %s: %w", other.shortFilename, err)
+	}
+
+	if err = u.store.Delete(uuid); err != nil {
+		return err
+	}
+
+	infoColor.Printf("moved %s (%d changes) to %s\n", name, len(history), other.shortFilename)
+	return nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/txlogs"
+)
+
+func TestTransferEntry(t *testing.T) {
+	t.Parallel()
+
+	newVault := func(name, key string) *uiContext {
+		u := &uiContext{
+			shortFilename: name,
+			store:         blobformat.Blobs{DB: &txlogs.DB{Schema: blobformat.SchemaVersion}},
+		}
+		u.store.DB.SetChainKey([]byte(key))
+		return u
+	}
+	from := newVault("from", "one")
+	to := newVault("to", "two")
+
+	// Interleave the histories so the copied one lands in the middle
+	uuid, err := from.store.New("moved")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = to.store.New("stays"); err != nil {
+		t.Fatal(err)
+	}
+	if err = from.store.Set(uuid, blobformat.KeyPass, "pass"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = from.transferEntry(uuid, to, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if !sort.SliceIsSorted(to.store.Log, func(i, j int) bool { return to.store.Log[i].Time < to.store.Log[j].Time }) {
+		t.Error("log is out of order")
+	}
+	broken, err := to.store.VerifyHistory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(broken) != 0 {
+		t.Error("copied history should be chained with the destination's key:", broken)
+	}
+
+	blob, err := to.store.MustFind(uuid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.Get(blobformat.KeyPass) != "pass" {
+		t.Error("wrong password:", blob.Get(blobformat.KeyPass))
+	}
+}
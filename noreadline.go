@@ -9,6 +9,7 @@ import (
 	"io"
 	"os"
 	"strings"
+	"time"
 	"unicode/utf16"
 
 	"golang.org/x/sys/windows"
@@ -47,6 +48,13 @@ func (s *scanEditor) Line(prompt string) (string, error) {
 	return s.Scanner.Text(), nil
 }
 
+// LineTimeout implements LineEditor.LineTimeout, a read from the console
+// can't be stopped so this waits for the line regardless of timeout.
+func (s *scanEditor) LineTimeout(prompt string, timeout time.Duration) (string, bool, error) {
+	line, err := s.Line(prompt)
+	return line, false, err
+}
+
 // LineHidden implements LineEditor.LineHidden
 func (s *scanEditor) LineHidden(prompt string) (string, error) {
 	stdinHandle, err := windows.GetStdHandle(stdInputHandle)
@@ -0,0 +1,17 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/aarondl/bpass/osutil"
+)
+
+// notify shows a desktop notification if they're turned on. Failing to
+// notify is never fatal, the same information is always printed.
+func notify(title, format string, args ...interface{}) {
+	if !flagNotify {
+		return
+	}
+
+	_ = osutil.Notify(title, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,7 @@
+package osutil
+
+import "errors"
+
+// ErrKeychainItemNotFound is returned by KeychainGet when there's nothing
+// stored for the service and account
+var ErrKeychainItemNotFound = errors.New("item not found in keychain")
@@ -5,6 +5,8 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
+	"syscall"
 )
 
 // OpenURL uses the open program on darwin
@@ -44,3 +46,110 @@ func RunEditor(filename string) error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// RunningProcesses returns the names of all running processes
+func RunningProcesses() ([]string, error) {
+	out, err := exec.Command("ps", "-axco", "comm=").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimSpace(line); len(line) != 0 {
+			names = append(names, line)
+		}
+	}
+
+	return names, nil
+}
+
+// ClipboardHistoryEnabled is always false on darwin, there's no system
+// clipboard history only third party clipboard managers.
+func ClipboardHistoryEnabled() bool {
+	return false
+}
+
+// CoreDumpsEnabled checks if the process is allowed to write core dumps which
+// would put decrypted secrets on disk if we crash.
+func CoreDumpsEnabled() (bool, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &limit); err != nil {
+		return false, err
+	}
+
+	return limit.Cur != 0, nil
+}
+
+// SwapEncrypted checks if darwin is encrypting its swap, it has by default
+// since 10.7.
+func SwapEncrypted() (bool, error) {
+	out, err := exec.Command("sysctl", "-n", "vm.swapusage").Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to query swap: %w", err)
+	}
+
+	return strings.Contains(string(out), "(encrypted)"), nil
+}
+
+// ClipboardTool returns the program used to access the clipboard
+func ClipboardTool() (string, error) {
+	if _, err := exec.LookPath("pbcopy"); err != nil {
+		return "", errors.New("pbcopy is not in path")
+	}
+	return "pbcopy", nil
+}
+
+// Notify shows a desktop notification using osascript
+func Notify(title, message string) error {
+	script := fmt.Sprintf("display notification %s with title %s", appleScriptQuote(message), appleScriptQuote(title))
+	return exec.Command("osascript", "-e", script).Run()
+}
+
+func appleScriptQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// securityNotFound is the exit code security uses when there's no such item
+const securityNotFound = 44
+
+// KeychainSet stores a secret in the login keychain using security, its
+// commands are given on stdin so the secret never shows up in the process
+// list. The service, account and secret must not need quoting.
+func KeychainSet(service, account, secret string) error {
+	cmd := exec.Command("security", "-i")
+	cmd.Stdin = strings.NewReader(fmt.Sprintf("add-generic-password -U -s %s -a %s -w %s\n", service, account, secret))
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("security failed to store: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// KeychainGet looks up a secret in the login keychain using security
+func KeychainGet(service, account string) (string, error) {
+	out, err := exec.Command("security", "find-generic-password", "-s", service, "-a", account, "-w").Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == securityNotFound {
+		return "", ErrKeychainItemNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("security failed to look up: %w", err)
+	}
+
+	return strings.TrimSuffix(string(out), "\n"), nil
+}
+
+// KeychainDelete removes a secret from the login keychain using security
+func KeychainDelete(service, account string) error {
+	err := exec.Command("security", "delete-generic-password", "-s", service, "-a", account).Run()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == securityNotFound {
+		return nil
+	}
+	return err
+}
+
+// ProcessRunning checks if a process exists, signal 0 does nothing but
+// check that it could be sent
+func ProcessRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
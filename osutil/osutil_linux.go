@@ -3,8 +3,11 @@ package osutil
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
 	"os/exec"
+	"path/filepath"
+	"strings"
 	"syscall"
 )
 
@@ -53,3 +56,156 @@ func RunEditor(filename string) error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// RunningProcesses returns the names of all running processes
+func RunningProcesses() ([]string, error) {
+	comms, err := filepath.Glob("/proc/[0-9]*/comm")
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, c := range comms {
+		b, err := ioutil.ReadFile(c)
+		if err != nil {
+			// Processes come and go while we're looking
+			continue
+		}
+		names = append(names, strings.TrimSpace(string(b)))
+	}
+
+	return names, nil
+}
+
+// ClipboardHistoryEnabled is always false on linux, there's no system
+// clipboard history only third party clipboard managers.
+func ClipboardHistoryEnabled() bool {
+	return false
+}
+
+// CoreDumpsEnabled checks if the process is allowed to write core dumps which
+// would put decrypted secrets on disk if we crash.
+func CoreDumpsEnabled() (bool, error) {
+	var limit syscall.Rlimit
+	if err := syscall.Getrlimit(syscall.RLIMIT_CORE, &limit); err != nil {
+		return false, err
+	}
+
+	return limit.Cur != 0, nil
+}
+
+// SwapEncrypted checks that every swap device is either a dm-crypt device or
+// zram (which never hits the disk). It's true if there is no swap at all.
+func SwapEncrypted() (bool, error) {
+	b, err := ioutil.ReadFile("/proc/swaps")
+	if err != nil {
+		return false, err
+	}
+
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	for _, line := range lines[1:] {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		dev, err := filepath.EvalSymlinks(fields[0])
+		if err != nil {
+			dev = fields[0]
+		}
+		base := filepath.Base(dev)
+
+		if strings.HasPrefix(base, "zram") {
+			continue
+		}
+		if !strings.HasPrefix(base, "dm-") {
+			return false, nil
+		}
+
+		uuid, err := ioutil.ReadFile(filepath.Join("/sys/block", base, "dm/uuid"))
+		if err != nil || !strings.HasPrefix(string(uuid), "CRYPT-") {
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+// ClipboardTool returns the program used to access the clipboard, an error
+// if none are installed.
+func ClipboardTool() (string, error) {
+	tools := []string{"xsel", "xclip"}
+	if len(os.Getenv("WAYLAND_DISPLAY")) != 0 {
+		tools = append([]string{"wl-copy"}, tools...)
+	}
+
+	for _, t := range tools {
+		if _, err := exec.LookPath(t); err == nil {
+			return t, nil
+		}
+	}
+
+	return "", fmt.Errorf("none of %s are installed", strings.Join(tools, ", "))
+}
+
+// Notify shows a desktop notification using notify-send (libnotify)
+func Notify(title, message string) error {
+	command, err := exec.LookPath("notify-send")
+	if err != nil {
+		return errors.New("could not find notify-send in path")
+	}
+
+	return exec.Command(command, "--app-name=bpass", title, message).Run()
+}
+
+// KeychainSet stores a secret in the Secret Service using secret-tool
+// (libsecret), the secret is passed on stdin so it never shows up in the
+// process list.
+func KeychainSet(service, account, secret string) error {
+	command, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return errors.New("could not find secret-tool in path")
+	}
+
+	cmd := exec.Command(command, "store", "--label="+service, "service", service, "account", account)
+	cmd.Stdin = strings.NewReader(secret)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("secret-tool failed to store: %w: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// KeychainGet looks up a secret in the Secret Service using secret-tool
+func KeychainGet(service, account string) (string, error) {
+	command, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return "", errors.New("could not find secret-tool in path")
+	}
+
+	out, err := exec.Command(command, "lookup", "service", service, "account", account).Output()
+	if _, ok := err.(*exec.ExitError); ok && len(out) == 0 {
+		// lookup fails quietly when nothing matches
+		return "", ErrKeychainItemNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("secret-tool failed to look up: %w", err)
+	}
+
+	return string(out), nil
+}
+
+// KeychainDelete removes a secret from the Secret Service using secret-tool
+func KeychainDelete(service, account string) error {
+	command, err := exec.LookPath("secret-tool")
+	if err != nil {
+		return errors.New("could not find secret-tool in path")
+	}
+
+	return exec.Command(command, "clear", "service", service, "account", account).Run()
+}
+
+// ProcessRunning checks if a process exists, signal 0 does nothing but
+// check that it could be sent
+func ProcessRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || err == syscall.EPERM
+}
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"os/exec"
+	"strings"
 )
 
 // OpenURL uses cmd.exe's start on linux
@@ -49,3 +50,132 @@ func RunEditor(filename string) error {
 	cmd.Stderr = os.Stderr
 	return cmd.Run()
 }
+
+// RunningProcesses returns the names of all running processes
+func RunningProcesses() ([]string, error) {
+	out, err := exec.Command("tasklist", "/fo", "csv", "/nh").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	var names []string
+	for _, line := range strings.Split(string(out), "\n") {
+		// "name.exe","pid",...
+		fields := strings.SplitN(strings.TrimSpace(line), ",", 2)
+		if name := strings.Trim(fields[0], `"`); len(name) != 0 {
+			names = append(names, strings.TrimSuffix(name, ".exe"))
+		}
+	}
+
+	return names, nil
+}
+
+// ClipboardHistoryEnabled checks if windows' own clipboard history (win+v)
+// is turned on.
+func ClipboardHistoryEnabled() bool {
+	out, err := exec.Command("reg", "query", `HKCU\Software\Microsoft\Clipboard`, "/v", "EnableClipboardHistory").Output()
+	if err != nil {
+		return false
+	}
+
+	return strings.Contains(string(out), "0x1")
+}
+
+// CoreDumpsEnabled is always false on windows, crash dumps are handled by
+// windows error reporting which doesn't use core limits.
+func CoreDumpsEnabled() (bool, error) {
+	return false, nil
+}
+
+// SwapEncrypted checks if the paging file is encrypted
+func SwapEncrypted() (bool, error) {
+	out, err := exec.Command("fsutil", "behavior", "query", "encryptpagingfile").Output()
+	if err != nil {
+		return false, fmt.Errorf("failed to query paging file: %w", err)
+	}
+
+	return strings.Contains(string(out), "= 1"), nil
+}
+
+// ClipboardTool returns the program used to access the clipboard, windows
+// uses the api directly.
+func ClipboardTool() (string, error) {
+	return "win32", nil
+}
+
+// toastScript shows a toast notification through the WinRT api, the title and
+// message are passed as environment variables to avoid quoting issues.
+const toastScript = `[Windows.UI.Notifications.ToastNotificationManager, Windows.UI.Notifications, ContentType = WindowsRuntime] > $null
+$xml = [Windows.UI.Notifications.ToastNotificationManager]::GetTemplateContent([Windows.UI.Notifications.ToastTemplateType]::ToastText02)
+$text = $xml.GetElementsByTagName('text')
+$text.Item(0).AppendChild($xml.CreateTextNode($env:BPASS_TITLE)) > $null
+$text.Item(1).AppendChild($xml.CreateTextNode($env:BPASS_MESSAGE)) > $null
+$toast = [Windows.UI.Notifications.ToastNotification]::new($xml)
+[Windows.UI.Notifications.ToastNotificationManager]::CreateToastNotifier('bpass').Show($toast)`
+
+// Notify shows a toast notification using powershell
+func Notify(title, message string) error {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", toastScript)
+	cmd.Env = append(os.Environ(), "BPASS_TITLE="+title, "BPASS_MESSAGE="+message)
+	return cmd.Run()
+}
+
+// vaultScript loads the WinRT PasswordVault (the web credentials in the
+// Credential Manager), like toastScript everything is passed as environment
+// variables.
+const vaultScript = `[Windows.Security.Credentials.PasswordVault, Windows.Security.Credentials, ContentType = WindowsRuntime] > $null
+$vault = [Windows.Security.Credentials.PasswordVault]::new()
+`
+
+// vaultNotFound is the exit code the scripts use when there's no such item
+const vaultNotFound = 2
+
+// KeychainSet stores a secret in the Credential Manager using powershell
+func KeychainSet(service, account, secret string) error {
+	return vaultRun(service, account, secret, `$vault.Add([Windows.Security.Credentials.PasswordCredential]::new($env:BPASS_SERVICE, $env:BPASS_ACCOUNT, $env:BPASS_SECRET))`)
+}
+
+// KeychainGet looks up a secret in the Credential Manager using powershell
+func KeychainGet(service, account string) (string, error) {
+	cmd := vaultCommand(service, account, "", `try { $c = $vault.Retrieve($env:BPASS_SERVICE, $env:BPASS_ACCOUNT) } catch { exit 2 }
+$c.RetrievePassword()
+[Console]::Out.Write($c.Password)`)
+	out, err := cmd.Output()
+	if exitErr, ok := err.(*exec.ExitError); ok && exitErr.ExitCode() == vaultNotFound {
+		return "", ErrKeychainItemNotFound
+	} else if err != nil {
+		return "", fmt.Errorf("failed to look up credential: %w", err)
+	}
+
+	return string(out), nil
+}
+
+// KeychainDelete removes a secret from the Credential Manager using
+// powershell
+func KeychainDelete(service, account string) error {
+	return vaultRun(service, account, "", `try { $vault.Remove($vault.Retrieve($env:BPASS_SERVICE, $env:BPASS_ACCOUNT)) } catch { }`)
+}
+
+func vaultRun(service, account, secret, script string) error {
+	if err := vaultCommand(service, account, secret, script).Run(); err != nil {
+		return fmt.Errorf("failed to update credential: %w", err)
+	}
+	return nil
+}
+
+func vaultCommand(service, account, secret, script string) *exec.Cmd {
+	cmd := exec.Command("powershell", "-NoProfile", "-NonInteractive", "-Command", vaultScript+script)
+	cmd.Env = append(os.Environ(), "BPASS_SERVICE="+service, "BPASS_ACCOUNT="+account, "BPASS_SECRET="+secret)
+	return cmd
+}
+
+// ProcessRunning checks if a process exists, finding it on windows opens a
+// handle to it which fails if it's gone
+func ProcessRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	_ = p.Release()
+	return true
+}
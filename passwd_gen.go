@@ -3,6 +3,8 @@ package main
 import (
 	"crypto/rand"
 	"errors"
+	"io"
+	"strings"
 )
 
 var (
@@ -17,7 +19,35 @@ var (
 	errPasswordImpossible = errors.New("password cannot be generated")
 )
 
+// answerGroups and answerGroupLen are how answers to security questions are
+// generated: groups of lowercase letters that are easy to read out over the
+// phone (about 75 bits).
+const (
+	answerGroups   = 4
+	answerGroupLen = 4
+)
+
+// genAnswer generates a random answer to a security question
+func genAnswer() (string, error) {
+	letters, err := genPassword(answerGroups*answerGroupLen, -1, 0, -1, -1, -1)
+	if err != nil {
+		return "", err
+	}
+
+	groups := make([]string, 0, answerGroups)
+	for i := 0; i < len(letters); i += answerGroupLen {
+		groups = append(groups, letters[i:i+answerGroupLen])
+	}
+	return strings.Join(groups, " "), nil
+}
+
 func genPassword(length, upper, lower, numbers, basic, extra int) (string, error) {
+	return genPasswordFrom(rand.Reader, length, upper, lower, numbers, basic, extra)
+}
+
+// genPasswordFrom is genPassword but it pulls its entropy from r instead of
+// always going straight to crypto/rand.
+func genPasswordFrom(r io.Reader, length, upper, lower, numbers, basic, extra int) (string, error) {
 	needLen := 0
 	for _, i := range []int{upper, lower, numbers, basic, extra} {
 		if i > 0 {
@@ -37,7 +67,7 @@ func genPassword(length, upper, lower, numbers, basic, extra int) (string, error
 	eOffset := 0
 	password := make([]byte, length)
 	entropy := make([]byte, needLen+(randomPicks*2)+length)
-	n, err := rand.Read(entropy)
+	n, err := io.ReadFull(r, entropy)
 	if err != nil {
 		return "", err
 	} else if n != len(entropy) {
@@ -53,3 +53,22 @@ func TestGenPasswd(t *testing.T) {
 		}
 	}
 }
+
+func TestGenAnswer(t *testing.T) {
+	t.Parallel()
+
+	a, err := genAnswer()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	groups := strings.Split(a, " ")
+	if len(groups) != answerGroups {
+		t.Error("wrong number of groups:", a)
+	}
+	for _, g := range groups {
+		if len(g) != answerGroupLen || strings.Trim(g, alphabetLowercase) != "" {
+			t.Error("groups should be lowercase letters:", a)
+		}
+	}
+}
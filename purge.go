@@ -0,0 +1,143 @@
+package main
+
+import (
+	"crypto/rand"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// purgeHistory destroys the history of an entry (for when a secret was put
+// in the wrong key for example) and rewrites the file, its archive and
+// optionally its backups so the old values aren't left behind in them.
+func (u *uiContext) purgeHistory(search string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+
+	errColor.Printf("this permanently destroys every previous value of %s, only its current keys are kept\n", blob.Name())
+	if ok, err := u.getYesNo("purge its history?"); err != nil || !ok {
+		return err
+	}
+
+	n, err := u.store.PurgeSnapshots(uuid)
+	if err != nil {
+		return err
+	}
+
+	archived, err := u.loadArchive()
+	if err != nil {
+		return err
+	}
+	kept := make([]txlogs.Tx, 0, len(archived))
+	for _, tx := range archived {
+		// Everything archived was overwritten so none of it is current
+		if tx.UUID != uuid {
+			kept = append(kept, tx)
+		}
+	}
+	if len(kept) != len(archived) {
+		n += len(archived) - len(kept)
+		err = replaceShredded(archiveFilename(u.filename), func() error {
+			return u.writeArchive(kept)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if err = replaceShredded(u.filename, u.saveBlob); err != nil {
+		return err
+	}
+	infoColor.Printf("purged %d changes from %s\n", n, blob.Name())
+
+	if _, err = os.Stat(backupDir(u.filename)); err == nil {
+		errColor.Println("backups of the file still have the old values")
+		if ok, err := u.getYesNo("destroy all backups?"); err != nil {
+			return err
+		} else if ok {
+			if err = shredDir(backupDir(u.filename)); err != nil {
+				return err
+			}
+			infoColor.Println("destroyed backups")
+		}
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	if err = u.shredCopies("still have the old values"); err != nil {
+		return err
+	}
+
+	infoColor.Println("synced copies keep the old values until they sync with this file")
+	return nil
+}
+
+// replaceShredded moves filename aside while write makes a new one and only
+// shreds the old one once that's worked so there's always one of them, if
+// write fails the old one is put back.
+func replaceShredded(filename string, write func() error) error {
+	old := filename + ".purge"
+	if err := os.Rename(filename, old); err != nil {
+		return err
+	}
+	if err := write(); err != nil {
+		if renameErr := os.Rename(old, filename); renameErr != nil {
+			errColor.Printf("failed to write %s, the previous one is at %s\n", shortPath(filename), old)
+		}
+		return err
+	}
+
+	return shredFile(old)
+}
+
+// shredFile overwrites a file with random data before removing it. Journaling
+// and copy-on-write filesystems or ssds may keep the old data elsewhere so
+// this is a best effort.
+func shredFile(filename string) error {
+	f, err := os.OpenFile(filename, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err == nil {
+		_, err = io.CopyN(f, rand.Reader, info.Size())
+	}
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+
+	return os.Remove(filename)
+}
+
+// shredDir shreds every file in a directory then removes it
+func shredDir(dir string) error {
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		return shredFile(path)
+	})
+	if err != nil {
+		return err
+	}
+
+	return os.RemoveAll(dir)
+}
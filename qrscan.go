@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/aarondl/bpass/blobformat"
+)
+
+var (
+	errNoZbar = errors.New("zbarimg is needed to read qr codes, install zbar (zbar-tools on debian)")
+	errNoOTP  = errors.New("no two factor qr code (otpauth://) found in the image")
+)
+
+// decodeQR reads the otpauth (or otpauth-migration) uri from a qr code in an
+// image (png, jpeg and anything else zbarimg understands). zbarimg from the zbar project does the
+// decoding.
+func decodeQR(file string) (string, error) {
+	if _, err := os.Stat(file); err != nil {
+		return "", err
+	}
+
+	zbar, err := exec.LookPath("zbarimg")
+	if err != nil {
+		return "", errNoZbar
+	}
+
+	// zbarimg exits with 4 if it found no codes, that's reported below
+	out, err := exec.Command(zbar, "--quiet", "--raw", file).Output()
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 4) {
+		return "", fmt.Errorf("zbarimg failed: %w", err)
+	}
+
+	for _, line := range strings.Split(string(out), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "otpauth://") || strings.HasPrefix(line, blobformat.OTPMigrationPrefix) {
+			return line, nil
+		}
+	}
+
+	return "", errNoOTP
+}
+
+// scanQR sets the two factor key of an entry from a screenshot of the qr code
+// a site gives to enroll an authenticator app.
+func (u *uiContext) scanQR(search, file string) error {
+	uuid, err := u.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	uri, err := decodeQR(file)
+	if err != nil {
+		errColor.Println(err)
+		return nil
+	}
+	if strings.HasPrefix(uri, blobformat.OTPMigrationPrefix) {
+		errColor.Println("this is a google authenticator export, use otpimport to import it")
+		return nil
+	}
+
+	if err = u.store.SetTwofactor(uuid, uri); err != nil {
+		errColor.Println(err)
+		return nil
+	}
+
+	infoColor.Println("set totp for", blobformat.Blob(u.store.Snapshot[uuid]).Name())
+	return nil
+}
+
+// importOTPMigration sets the two factor keys of the accounts in a Google
+// Authenticator export, given as the otpauth-migration uri or a screenshot of
+// its qr code.
+func (u *uiContext) importOTPMigration(uriOrFile string) error {
+	uri := uriOrFile
+	if !strings.HasPrefix(uri, blobformat.OTPMigrationPrefix) {
+		var err error
+		if uri, err = decodeQR(uriOrFile); err != nil {
+			errColor.Println(err)
+			return nil
+		}
+	}
+
+	created, updated, err := u.store.ImportOTPMigration(uri)
+	for _, name := range created {
+		infoColor.Println("added", name)
+	}
+	for _, name := range updated {
+		infoColor.Println("set totp for", name)
+	}
+	if err != nil {
+		errColor.Println(err)
+	}
+	return nil
+}
@@ -7,6 +7,7 @@ import (
 	"io"
 	"os"
 	"sort"
+	"time"
 
 	"github.com/aarondl/readline"
 )
@@ -83,6 +84,21 @@ func (r readlineEditor) Line(prompt string) (string, error) {
 	}
 }
 
+// LineTimeout implements LineEditor.LineTimeout, the line being read is ended
+// by typing a newline for the user.
+func (r readlineEditor) LineTimeout(prompt string, timeout time.Duration) (string, bool, error) {
+	timer := time.AfterFunc(timeout, func() {
+		_, _ = r.instance.WriteStdin([]byte("\n"))
+	})
+
+	s, err := r.Line(prompt)
+	if !timer.Stop() {
+		// Whatever was typed before the timeout wasn't meant as an answer
+		return "", true, err
+	}
+	return s, false, err
+}
+
 // LineHidden implements LineEditor.LineHidden
 func (r readlineEditor) LineHidden(prompt string) (string, error) {
 	byt, err := r.instance.ReadPassword(prompt)
@@ -135,13 +151,45 @@ func readlineAutocompleter(entryCompleter func(string) []string) readline.AutoCo
 		readline.PcItem("passwd"),
 		readline.PcItem("help"),
 		readline.PcItem("exit"),
+		readline.PcItem("undo"),
+		readline.PcItem("redo"),
 		readline.PcItem("add"),
+		readline.PcItem("templates"),
+		readline.PcItem("newtemplate"),
+		readline.PcItem("searches"),
+		readline.PcItem("savesearch"),
+		readline.PcItem("search"),
 		readline.PcItem("rm", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("clone", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("mv", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("ls"),
+		readline.PcItem("tree"),
+		readline.PcItem("mvdir"),
 		readline.PcItem("cd", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("labels"),
+		readline.PcItem("site"),
+		readline.PcItem("expired"),
+		readline.PcItem("recent"),
+		readline.PcItem("untouched"),
+		readline.PcItem("changelog"),
+		readline.PcItem("dupes"),
+		readline.PcItem("grep"),
+		readline.PcItem("trash"),
+		readline.PcItem("restore"),
+		readline.PcItem("emptytrash"),
+		readline.PcItem("deleted"),
+		readline.PcItem("undelete"),
+		readline.PcItem("favs"),
+		readline.PcItem("fav", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("unfav", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("imported", readline.PcItem(lastpassSource)),
 		readline.PcItem("show", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("nextcodes", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("qr", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("qrscan", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("otpimport"),
+		readline.PcItem("recoverycodes", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("usecode", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("set",
 			readline.PcItemDynamic(entryCompleter,
 				readline.PcItem("email"),
@@ -149,6 +197,9 @@ func readlineAutocompleter(entryCompleter func(string) []string) readline.AutoCo
 				readline.PcItem("pass"),
 				readline.PcItem("totp"),
 				readline.PcItem("notes"),
+				readline.PcItem("expires"),
+				readline.PcItem("window"),
+				readline.PcItem("nevermatch"),
 			),
 		),
 		readline.PcItem("get",
@@ -188,16 +239,45 @@ func readlineAutocompleter(entryCompleter func(string) []string) readline.AutoCo
 				readline.PcItem("notes"),
 			),
 		),
+		readline.PcItem("mark", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("keyhist", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("snapcap", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("label", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("checkout", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("checkin", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("alias", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("share", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("recall", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("rotate", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("rmlabel", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("note", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("rmnote", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("pass", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("user", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("email", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("totp", readline.PcItemDynamic(entryCompleter)),
+		readline.PcItem("twostep", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("sync", readline.PcItemDynamic(entryCompleter)),
 		readline.PcItem("addsync"),
 		readline.PcItem("adduser"),
 		readline.PcItem("rekey"),
+		readline.PcItem("calibrate"),
+		readline.PcItem("genkeyfile"),
+		readline.PcItem("rotatekeyfile"),
+		readline.PcItem("rmkeyfile"),
+		readline.PcItem("addrecipient"),
+		readline.PcItem("genidentity"),
+		readline.PcItem("addtoken"),
+		readline.PcItem("rmtoken"),
+		readline.PcItem("forgetkey"),
+		readline.PcItem("openvault"),
+		readline.PcItem("closevault"),
+		readline.PcItem("vaults"),
+		readline.PcItem("mvv"),
+		readline.PcItem("cpv"),
+		readline.PcItem("enableroles"),
+		readline.PcItem("roles"),
+		readline.PcItem("role"),
 	)
 }
 
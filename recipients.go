@@ -0,0 +1,138 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/crypt"
+)
+
+// readIdentity reads an age identity file (from age-keygen or genidentity),
+// the first line that isn't a comment is the identity.
+func readIdentity(filename string) (identity string, err error) {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", err
+	}
+
+	for _, line := range strings.Split(string(b), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if _, err = crypt.IdentityRecipient(line); err != nil {
+			return "", err
+		}
+		return line, nil
+	}
+
+	return "", errors.New("no identity found in file")
+}
+
+// addRecipient seals the master key to an X25519 recipient (an age public
+// key) so the file can be opened with its identity. The recipient is a user
+// named after itself. If save is not nil it's called once the recipient is
+// known to work, before it's added.
+func (u *uiContext) addRecipient(recipient string, save func() error) error {
+	if len(u.master) == 0 {
+		errColor.Println("recipients need a multi-user file, add yourself with adduser first")
+		return nil
+	}
+	if !crypt.IsRecipient(recipient) {
+		errColor.Println("not a recipient, they look like: age1...")
+		return nil
+	}
+	if ok, err := u.requireAdmin("add recipients"); err != nil || !ok {
+		return err
+	}
+
+	key, salt, iv, mkey, err := crypt.EncryptMasterKeyTo(u.version, recipient, u.master)
+	if err == crypt.ErrRecipientsUnsupported {
+		errColor.Println("the file's format is too old for recipients, upgrade it with rekeyall first")
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	if existing, _, err := u.store.FindUser(recipient); err != nil {
+		return err
+	} else if len(existing) != 0 {
+		errColor.Println("recipient already exists")
+		return nil
+	}
+	if save != nil {
+		if err = save(); err != nil {
+			return err
+		}
+	}
+
+	uuid, err := u.store.NewUser(recipient)
+	if err != nil {
+		return err
+	}
+
+	u.store.DB.Set(uuid, blobformat.KeySalt, hex.EncodeToString(salt))
+	u.store.DB.Set(uuid, blobformat.KeyIV, hex.EncodeToString(iv))
+	u.store.DB.Set(uuid, blobformat.KeyMKey, hex.EncodeToString(mkey))
+
+	if err = u.newSigningKey(recipient, key); err != nil {
+		return err
+	}
+	if enabled, err := u.store.RolesEnabled(); err != nil {
+		return err
+	} else if enabled {
+		priv, err := u.signingKey()
+		if err != nil {
+			return err
+		}
+		if err = u.store.AssignRole(recipient, blobformat.RoleUser, u.user, priv); err != nil {
+			return err
+		}
+	}
+
+	infoColor.Printf("added recipient %s, open with: --identity <file>\n", recipient)
+	return nil
+}
+
+// genIdentity writes a new identity to a file and adds its recipient, for
+// keeping a recovery key somewhere safe
+func (u *uiContext) genIdentity(filename string) error {
+	if _, err := os.Stat(filename); err == nil {
+		errColor.Printf("%s already exists, refusing to overwrite it\n", filename)
+		return nil
+	}
+
+	identity, recipient, err := crypt.GenerateIdentity()
+	if err != nil {
+		return err
+	}
+
+	return u.addRecipient(recipient, func() error {
+		f, err := os.OpenFile(filename, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0400)
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintf(f, "# created: %s\n# public key: %s\n%s\n", time.Now().Format(time.RFC3339), recipient, identity)
+		if err != nil {
+			_ = f.Close()
+			return err
+		}
+		if err = f.Close(); err != nil {
+			return err
+		}
+
+		if abs, err := filepath.Abs(filename); err == nil {
+			filename = abs
+		}
+		infoColor.Println("identity written to", filename)
+		return nil
+	})
+}
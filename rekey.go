@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/aarondl/bpass/crypt"
+)
+
+// rekeyCost is the key cost asked for on the command line, it starts from the
+// cost of the file's current key
+func (u *uiContext) rekeyCost(calibrate, passes, memoryMiB, threads int) (crypt.KeyCost, error) {
+	if calibrate < 0 || passes < 0 || memoryMiB < 0 || threads < 0 || threads > 255 {
+		return crypt.KeyCost{}, errors.New("key cost must be positive and threads at most 255")
+	}
+
+	cost := u.currentKeyCost()
+	if calibrate > 0 {
+		infoColor.Printf("calibrating key cost to take %ds...\n", calibrate)
+		cost = crypt.Calibrate(cost, time.Duration(calibrate)*time.Second)
+	}
+	if passes != 0 {
+		cost.Time = uint32(passes)
+	}
+	if memoryMiB != 0 {
+		cost.Memory = uint32(memoryMiB) * 1024
+	}
+	if threads != 0 {
+		cost.Threads = uint8(threads)
+	}
+
+	return cost, nil
+}
+
+// rekeyFile changes the current user's passphrase (or only their salt and
+// key cost when newPass is false) and rewrites everything encrypted with it,
+// see rekeyEverything.
+func (u *uiContext) rekeyFile(newPass bool, cost crypt.KeyCost) error {
+	oldCost := u.keyCost
+	u.keyCost = cost
+
+	changed, err := u.rekeyEverything(func() error {
+		if newPass {
+			return u.passwd("")
+		}
+		return u.rekey("")
+	})
+	if !changed {
+		u.keyCost = oldCost
+	}
+	if err != nil || !changed {
+		return err
+	}
+
+	if _, ok := crypt.SaltKeyCost(u.salt); ok {
+		infoColor.Printf("rekeyed %s with %s\n", u.shortFilename, cost)
+	} else {
+		infoColor.Println("rekeyed", u.shortFilename)
+	}
+	return nil
+}
+
+// rekeyEverything changes the current user's key with change and rewrites
+// everything encrypted with it: the file, its archive and the key of its
+// backups. All of them are decrypted before anything changes and each is
+// replaced whole so a failure part way leaves files that open with either
+// the old or the new key, never a broken one. The copies kept of the file
+// can't be rekeyed so destroying them is offered. changed is false when
+// change failed or left the key as it was.
+func (u *uiContext) rekeyEverything(change func() error) (changed bool, err error) {
+	archived, err := u.loadArchive()
+	if err != nil {
+		return false, err
+	}
+	backupKey, err := u.backupKey(false)
+	if err != nil {
+		return false, err
+	}
+
+	oldKey := u.key
+	if err = change(); err != nil {
+		return false, err
+	}
+	if bytes.Equal(oldKey, u.key) {
+		return false, nil
+	}
+
+	if err = u.saveBlob(); err != nil {
+		return true, err
+	}
+	if archived != nil {
+		if err = u.writeArchive(archived); err != nil {
+			return true, fmt.Errorf("saved but failed to rewrite the archive, it still opens with the old key: %w", err)
+		}
+	}
+	if backupKey != nil {
+		if err = u.writeBackupKey(backupKey); err != nil {
+			return true, fmt.Errorf("saved but failed to rewrite the backup key, it still opens with the old key: %w", err)
+		}
+	}
+	if err = u.shredCopies("still open with the old key"); err != nil {
+		return true, err
+	}
+
+	return true, nil
+}
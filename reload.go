@@ -0,0 +1,192 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/crypt"
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// errDiskChanged is returned when saving would overwrite changes made to the
+// file on disk and the user chose not to.
+var errDiskChanged = errors.New("file was changed on disk, not overwriting it")
+
+// diskState is what the file looked like on disk when we last loaded or
+// saved it.
+type diskState struct {
+	modTime time.Time
+	size    int64
+	hash    [sha256.Size]byte
+}
+
+// rememberDisk records the contents of the file as we last saw them
+func (u *uiContext) rememberDisk(payload []byte) {
+	u.disk.hash = sha256.Sum256(payload)
+	u.disk.modTime, u.disk.size = time.Time{}, 0
+	if info, err := os.Stat(u.filename); err == nil {
+		u.disk.modTime, u.disk.size = info.ModTime(), info.Size()
+	}
+}
+
+// diskChanged returns the contents of the file if something else changed it
+// since we last loaded or saved it.
+func (u *uiContext) diskChanged() ([]byte, error) {
+	info, err := os.Stat(u.filename)
+	if os.IsNotExist(err) {
+		// Saving will put it back
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if info.ModTime().Equal(u.disk.modTime) && info.Size() == u.disk.size {
+		return nil, nil
+	}
+
+	payload, err := ioutil.ReadFile(u.filename)
+	if err != nil {
+		return nil, err
+	}
+	if sha256.Sum256(payload) == u.disk.hash {
+		// Only touched
+		u.disk.modTime, u.disk.size = info.ModTime(), info.Size()
+		return nil, nil
+	}
+
+	return payload, nil
+}
+
+// checkDisk looks for changes made to the file on disk (by another bpass or
+// a tool that syncs files) since it was loaded or last saved. If there are
+// any they're checked for integrity and the user can merge them in, reload
+// the file or overwrite them when saving.
+func (u *uiContext) checkDisk() error {
+	if u.readOnly {
+		return nil
+	}
+
+	payload, err := u.diskChanged()
+	if err != nil || payload == nil {
+		return err
+	}
+
+	errColor.Printf("%s was changed on disk since it was opened\n", u.shortFilename)
+
+	params, creds, db, err := u.readDisk(payload)
+	if err != nil {
+		errColor.Println("the changed file can't be used:", err)
+		overwrite, err := u.getYesNo("overwrite it with your copy when saving?")
+		if err != nil {
+			return err
+		}
+		if !overwrite {
+			return errDiskChanged
+		}
+
+		u.rememberDisk(payload)
+		return nil
+	}
+
+	changed := u.startTx != len(u.store.DB.Log)
+	choice := "r"
+	if changed {
+		for {
+			choice, err = u.prompt(promptColor.Sprint("[m]erge, [r]eload (lose your changes) or [o]verwrite (lose theirs): "))
+			if err != nil {
+				return err
+			}
+			if choice == "m" || choice == "r" || choice == "o" {
+				break
+			}
+			errColor.Println("invalid choice, enter m, r or o")
+		}
+	}
+
+	switch choice {
+	case "m":
+		remote := blobformat.Blobs{DB: db}
+		remote.DB.SetChainKey(paramsHistoryKey(params))
+		if err = checkHistory(u.shortFilename, remote); err != nil {
+			return err
+		}
+
+		out, err := mergeBlobs(u, []blobParts{{
+			Name:   u.shortFilename,
+			Creds:  creds,
+			Params: params,
+			Log:    db.Log,
+		}})
+		if err != nil {
+			return fmt.Errorf("failed to merge: %w", err)
+		}
+
+		u.user, u.pass = out.User, out.Pass
+		u.key, u.salt = out.Key, out.Salt
+		u.master, u.ivm = out.Master, out.IVM
+		u.version = out.Version
+		u.tokens = out.Tokens
+
+		u.store.ResetSnapshot()
+		u.store.Log = out.Log
+		u.undo.Clear()
+		u.setHistoryKey()
+		u.store.Rechain()
+		if err = u.store.UpdateSnapshot(); err != nil {
+			return err
+		}
+		if _, err = u.store.ReapplyPurges(); err != nil {
+			return err
+		}
+		infoColor.Println("merged changes from", u.shortFilename)
+	case "r":
+		u.user, u.pass = creds.User, creds.Pass
+		u.key, u.salt = params.Keys[params.User], params.Salts[params.User]
+		u.master, u.ivm = params.Master, params.IVM
+		u.version = params.Version()
+		u.tokens = params.Tokens
+
+		u.store.DB = db
+		u.store.DB.SetDevice(syncDevice(u))
+		u.setHistoryKey()
+		if err = checkHistory(u.shortFilename, u.store); err != nil {
+			return err
+		}
+		u.startTx = len(db.Log)
+		u.undo.Clear()
+		infoColor.Println("reloaded", u.shortFilename)
+	case "o":
+		infoColor.Println("their changes will be overwritten when saving")
+	}
+
+	u.rememberDisk(payload)
+	return nil
+}
+
+// readDisk decrypts the file and checks that its log is sound
+func (u *uiContext) readDisk(payload []byte) (crypt.Params, credentials, *txlogs.DB, error) {
+	params, creds, pt, err := decryptBlob(u, u.shortFilename, payload)
+	if err != nil {
+		return params, creds, nil, err
+	} else if len(pt) == 0 {
+		return params, creds, nil, errors.New("could not decrypt it")
+	}
+
+	db, err := txlogs.New(pt)
+	if err != nil {
+		return params, creds, nil, err
+	}
+	if len(db.Log) == 0 {
+		return params, creds, nil, errors.New("it's empty")
+	}
+	if problems := db.Check(); len(problems) != 0 {
+		return params, creds, nil, fmt.Errorf("it failed integrity checks: %v (and %d more)", problems[0], len(problems)-1)
+	}
+
+	return params, creds, db, nil
+}
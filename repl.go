@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aarondl/bpass/blobformat"
 	"github.com/aarondl/color"
@@ -18,15 +19,52 @@ the entry name as a query in the key commands below.
 General Commands:
  passwd       - Change the file's password for current user
  help [topic] - This help (how did you find this without seeing this help?)
+ undo         - Undo the last command that changed something in this session
+ redo         - Redo the last undone command
  exit         - Exit the repl
 
 Entry Commands (manage entries in the file):
  add <name>      - Add a new entry
- rm  <name>      - Delete an entry
+ rm  <name>      - Move an entry to the trash (entries in the trash and users are deleted)
  mv  <old> <new> - Rename an entry
  ls  [query]     - Lists entries, query restricts entries to a fuzzy match
+ tree [folder]   - Show entries as a tree of pseudo-folders
  cd  [query]     - "cd" into an entry, omit argument to return to root
- labels <lbl...> - List entries by labels (entry must have all given labels)
+ labels <lbl...> - List entries by labels (entry must have all given labels, a|b means either)
+ site   <url>    - List entries with a url on the same site, best match first (url and urls keys,
+                   hosts in an entry's nevermatch key are left out)
+ expired         - List entries whose expires date has passed
+ favs            - List favorite (pinned) entries, ls lists them first
+ fav   <query>   - Pin an entry as a favorite
+ unfav <query>   - Unpin a favorite
+ recent [n]      - List the n (default 10) entries whose password or totp was read last
+ untouched [age] - List entries not created, updated or accessed within age (default 1y)
+ changelog [age] - List changes made to all entries within age (default 1w)
+ dupes           - List entries that share a password (or a user and password)
+ grep <text>     - Search the notes of all entries for lines containing text
+ imported [src]  - List entries that were imported (optionally only from src, eg. lastpass)
+
+ add         <name> <template> - Add a new entry using a template's keys
+ templates                     - List templates and their keys
+ newtemplate <name> <key...>   - Create a template (stored as template/<name>)
+ searches                      - List saved searches and their queries
+ savesearch  <name> <query>    - Save a query (see list --filter) as search/<name>
+ search      <name>            - List the entries found by a saved search
+ mvdir       <old> <new>       - Move all entries in a pseudo-folder to another
+ clone       <query> <new>     - Copy an entry's keys (not its history) to a new entry
+ checkout    <query> [reason]  - Check out an entry so others know you're changing it
+ checkin     <query>           - Release an entry that was checked out
+ alias       <query> [target]  - Make an entry resolve to another, omit target to remove
+ share       <query> <who>     - Record that an entry's credentials were given to someone
+ recall      <query>           - Recall all shares of an entry and flag it for rotation
+ rotate      <query>           - Walk through changing an entry's password step by step
+ trash                         - List entries in the trash
+ restore     <query>           - Restore an entry from the trash
+ emptytrash  [age]             - Delete entries in the trash longer than age (default all)
+ deleted                       - List deleted entries that can still be undeleted
+ undelete    <name>            - Bring back a deleted entry as a new entry with its last keys
+ protect     <query>           - Refuse changes to an entry unless forced (force <command>)
+ unprotect   <query>           - Allow changes to a protected entry again
 
 Key commands (manage keys in entries, use "cd" command to omit query from these commands):
  show <query> [snapshot]    - Show all keys for an entry (optionally at a specific snapshot)
@@ -35,10 +73,35 @@ Key commands (manage keys in entries, use "cd" command to omit query from these
  cp   <query> <key>         - Copy a specific key of an entry to the clipboard
  edit <query> <key>         - Open $EDITOR to edit an existing value
  open <query>               - Launch browser using value in url key
+ nextcodes <query> [n]      - Show the next n (default 5) totp codes and when they're valid
+ qr   <query> [file]        - Show the totp key as a QR code to enroll it in an app (or save it as a png)
+ qrscan <query> <image>     - Set the totp key from a screenshot of a QR code (needs zbarimg)
+ otpimport <uri|image>      - Add the totp keys of a Google Authenticator export (otpauth-migration://)
+ connect <query>            - ssh to the entry's hostname/ip and port, privkey is given to ssh
+                              through a temporary agent (alias: ssh)
  rmk  <query> <key>         - Delete a key from an entry
+ keyhist <query> [key]      - Show all previous values of a key (defaults to pass)
+ diff <query> [from] [to]   - Show keys changed between snapshots (defaults to the last change)
+ revert <query> <snapshot>  - Restore an entry's keys to a snapshot (the revert can itself be reverted)
+ snapcap <query> [max]      - Keep at most max snapshots of an entry, omit max to keep all
+ mark <query> <key> <flag>  - Flag a key as sensitive (masked, copy only), hidden or none
+                              also fullhistory, hashhistory or nohistory for old values
+                              and text, number or bool for the type of value
+ set  <query> icon [url]    - Fetch the site's favicon as the entry's icon (defaults to its url)
+ set  <query> totp:<label>  - Add another totp key under a label, get or cp totp:<label> for its
+                              codes (set it to nothing to remove it)
+ set  <query> totp yubikey:<account>
+                            - Get totp codes from an OATH account on a YubiKey (needs ykman)
 
  label   <query>            - Add labels in an easier way than with set
  rmlabel <query> <label>    - Remove labels in an easier way than with edit
+ note    <query> [text]     - Add a note (omit text for multi-line)
+ rmnote  <query> <index>    - Remove a note
+ question   <query> [text]  - Add a security question, the answer is randomly generated or typed in
+ rmquestion <query> <index> - Remove a security question
+ answer     <query> <index> - Copy the answer to a security question to the clipboard
+ recoverycodes <query>      - Replace the recovery codes, typed in or given after the query
+ usecode    <query>         - Copy the next unused recovery code, it's marked used
 
 Clipboard copy shortcuts (alias of cp <query> <key>):
  pass  <query>       - Copy password to clipboard
@@ -46,9 +109,11 @@ Clipboard copy shortcuts (alias of cp <query> <key>):
  email <query>       - Copy email to clipboard
  totp  <query>       - Copy twofactor to clipboard
  login <query>       - Copy username, email, password and totp one after another
+ twostep <query> [seconds]
+                     - Copy password, then a fresh totp on enter or after seconds (default 15)
 
 Other help topics (use help <topic>):
- sync, users, other
+ sync, users, vaults, other
 
 Common Arguments:
   name:   a fully qualified name
@@ -69,7 +134,11 @@ Additionally if the "sync" key of an entry is set to "true" then this entry
 will be automatically synchronized when an auto-sync occurs (usually
 when opening/closing the file, or running "sync" with no arguments)
 
-Types of sync: scp, file
+Types of sync: scp, file, https
+
+An https sync entry uses a bpass-server (included with bpass) that keeps
+versions of the file for a team. Its token key holds the token the server
+administrator created for the team.
 
 Example of values in an auto-sync scp account:
  url: scp://myuser@localhost.com:22/folder/filename.blob
@@ -100,6 +169,44 @@ User/Password Commands:
  passwd  [user] - Change the file's password for current user, or a specific user
  rekey   [user] - Rekey the file (change salt) for current user, or a specific user
  rekeyall       - Nuclear button, change all passwords & master key for all users
+ calibrate [seconds]
+                - Rekey yourself with a key that takes seconds (default 1) to derive here
+ genkeyfile <file>
+                - Write a new keyfile and require it along with your passphrase (see --keyfile)
+ rotatekeyfile <file>
+                - Replace your keyfile with a new one, the old one stops working right away
+ rmkeyfile      - Stop requiring a keyfile, only your passphrase will be needed
+ addrecipient <age1...>
+                - Let an age X25519 key open the file (see --identity), remove with rm
+ genidentity <file>
+                - Write a new identity (eg. a recovery key) and add it as a recipient
+ addtoken [only]
+                - Require a FIDO2 hardware token too (or instead of your passphrase with only)
+ rmtoken        - Stop requiring a hardware token
+ forgetkey      - Remove the key cached in the OS keychain by --cache-key
+
+Roles separate admins (add and remove users, assign roles, rekey others) from
+users (read and write entries). Each assignment is signed by an admin and
+checked by bpass itself so they can't be forged by whoever stores the file.
+The user who enables roles is the root admin all signatures lead back to.
+
+Role Commands:
+ enableroles        - Enable roles with yourself as the root admin
+ roles              - List users' roles and whether their signatures are valid
+ role <user> <role> - Assign a role (admin or user) to a user
+`
+
+var vaultsHelp = `Other files can be opened along with the one bpass was started
+with, each under a name. Commands run in another vault when the entry they're
+given starts with its name and a colon (eg. show work:github or ls work:), the
+file bpass was started with is called main. Open vaults are saved on exit.
+
+Vault Commands:
+ openvault  <name> <file>  - Open another file as a vault (also --vaults name=file,...)
+ closevault <name>         - Save and close a vault
+ vaults                    - List the open vaults
+ mvv        <query> <name> - Move an entry and its history to another vault
+ cpv        <query> <name> - Copy an entry and its history to another vault
 `
 
 var otherHelp = `Debug commands:
@@ -148,11 +255,21 @@ func (r *repl) run() error {
 			continue
 		}
 
+		// force <command> runs the command allowing it to change protected
+		// entries
+		cmdLine := line
+		force := false
+		if args[0] == "force" && len(args) > 1 {
+			force = true
+			cmdLine = strings.TrimSpace(strings.TrimPrefix(line, "force"))
+			args = args[1:]
+		}
+
 		cmd := args[0]
 		// Special case this thing, no commands care about additional space
 		// except set
 		if cmd == "set" {
-			args = strings.Split(line, " ")
+			args = strings.Split(cmdLine, " ")
 		}
 		args = args[1:]
 
@@ -162,13 +279,62 @@ func (r *repl) run() error {
 			continue
 		}
 
+		// Commands run in another open vault when their first argument is
+		// prefixed with its name (vault:entry)
+		mainCtx, mainEntry, mainPrompt := r.ctx, r.ctxEntry, r.prompt
+		restore := func() {
+			if r.ctx != mainCtx {
+				r.ctx, r.ctxEntry, r.prompt = mainCtx, mainEntry, mainPrompt
+			}
+		}
+		if len(args) > 0 && !replCommand.Vaults {
+			if vault, entry, ok := r.ctx.splitVault(args[0]); ok {
+				if vault != r.ctx {
+					r.ctx, r.ctxEntry = vault, ""
+				}
+				if args[0] = entry; len(entry) == 0 {
+					args = args[1:]
+				}
+			}
+		}
+
 		if r.ctx.readOnly && !replCommand.ReadOnly {
 			errColor.Println("cannot use write commands in read-only mode")
+			restore()
 			continue
 		}
 
-		err = replCommand.Run(r, cmd, args)
-		if err == errExit {
+		if err = r.ctx.checkDisk(); err == errDiskChanged {
+			errColor.Println(err)
+		} else if err != nil {
+			restore()
+			return err
+		}
+
+		reason := r.reason(cmd, args)
+		run := func() error {
+			return r.ctx.store.DB.Because(reason, func() error {
+				if !force {
+					return replCommand.Run(r, cmd, args)
+				}
+
+				store := r.ctx.store
+				r.ctx.store = store.Force()
+				err := replCommand.Run(r, cmd, args)
+				r.ctx.store = store
+				return err
+			})
+		}
+		if replCommand.ReadOnly || replCommand.NoUndo {
+			err = run()
+		} else {
+			err = r.ctx.undo.Record(r.ctx.store, reason, run)
+		}
+		restore()
+
+		if errors.Is(err, blobformat.ErrProtected) {
+			errColor.Println(`entry is protected, use "unprotect" or "force <command>"`)
+		} else if err == errExit {
 			return nil
 		} else if err != nil {
 			return err
@@ -178,13 +344,42 @@ func (r *repl) run() error {
 	}
 }
 
+// reason is what's recorded as the reason for changes a command makes, it's
+// the command along with the key for commands that change a single key.
+// Values are never included since they may be secret.
+func (r *repl) reason(cmd string, args []string) string {
+	switch cmd {
+	case "set", "edit", "rmk":
+	default:
+		return cmd
+	}
+
+	if len(r.ctxEntry) == 0 {
+		if len(args) == 0 {
+			return cmd
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 || len(args[0]) == 0 {
+		return cmd
+	}
+
+	return cmd + " " + args[0]
+}
+
 type replCmd struct {
 	ReadOnly bool
-	Run      func(r *repl, cmd string, args []string) error
+	// NoUndo commands are not recorded as steps that can be undone
+	NoUndo bool
+	// Vaults commands take vault names themselves instead of running in the
+	// vault their first argument names
+	Vaults bool
+	Run    func(r *repl, cmd string, args []string) error
 }
 
 var replCmds = map[string]replCmd{
 	"passwd": {
+		NoUndo: true,
 		Run: func(r *repl, cmd string, args []string) error {
 			var user string
 			if len(args) > 0 {
@@ -195,7 +390,22 @@ var replCmds = map[string]replCmd{
 		},
 	},
 
+	"undo": {
+		NoUndo: true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.undoStep(false)
+		},
+	},
+
+	"redo": {
+		NoUndo: true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.undoStep(true)
+		},
+	},
+
 	"adduser": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
 			if len(args) == 0 {
 				errColor.Println("syntax: adduser <user>")
@@ -207,6 +417,7 @@ var replCmds = map[string]replCmd{
 	},
 
 	"rekey": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
 			var user string
 			if len(args) > 0 {
@@ -217,187 +428,250 @@ var replCmds = map[string]replCmd{
 		},
 	},
 
+	"enableroles": {
+		NoUndo: true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.enableRoles()
+		},
+	},
+
+	"roles": {
+		ReadOnly: true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.listRoles()
+		},
+	},
+
+	"role": {
+		NoUndo: true,
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 2 {
+				errColor.Println("syntax: role <user> <admin|user>")
+				return nil
+			}
+
+			return r.ctx.assignRole(args[0], args[1])
+		},
+	},
+
 	"rekeyall": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
 			return r.ctx.rekeyAll()
 		},
 	},
 
-	"add": {
+	"genkeyfile": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
 			if len(args) < 1 {
-				errColor.Println("syntax: add <name>")
+				errColor.Println("syntax: genkeyfile <file>")
 				return nil
 			}
-			return r.ctx.addNewInterruptible(args[0])
+
+			return r.ctx.genKeyfile(args[0])
 		},
 	},
 
-	"mv": {
+	"rotatekeyfile": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
-			if len(args) < 2 {
-				errColor.Println("syntax: mv <old> <new>")
+			if len(args) < 1 {
+				errColor.Println("syntax: rotatekeyfile <file>")
 				return nil
 			}
 
-			return r.ctx.rename(args[0], args[1])
+			return r.ctx.rotateKeyfile(args[0])
 		},
 	},
 
-	"rm": {
+	"rmkeyfile": {
+		NoUndo: true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.rmKeyfile()
+		},
+	},
+
+	"addrecipient": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
 			if len(args) < 1 {
-				errColor.Println("syntax: rm <name>")
+				errColor.Println("syntax: addrecipient <recipient>")
 				return nil
 			}
-			name := args[0]
-			err := r.ctx.deleteEntry(name)
 
-			if err == nil && r.ctxEntry == name {
-				r.ctxEntry = ""
-				r.prompt = mainPromptColor.Sprintf(normalPrompt, r.ctx.shortFilename)
+			return r.ctx.addRecipient(args[0], nil)
+		},
+	},
+
+	"genidentity": {
+		NoUndo: true,
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 1 {
+				errColor.Println("syntax: genidentity <file>")
+				return nil
 			}
 
-			return err
+			return r.ctx.genIdentity(args[0])
 		},
 	},
 
-	"rmk": {
+	"addtoken": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
-			name := r.ctxEntry
-			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
-				errColor.Println("syntax: rmk <query> <key>")
+			only := len(args) > 0 && args[0] == "only"
+			if len(args) > 0 && !only {
+				errColor.Println("syntax: addtoken [only]")
 				return nil
 			}
 
-			if len(name) == 0 {
-				name = args[0]
-				args = args[1:]
-			}
+			return r.ctx.addToken(only)
+		},
+	},
 
-			return r.ctx.deleteKey(name, args[0])
+	"rmtoken": {
+		NoUndo: true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.rmToken()
 		},
 	},
 
-	"ls": {
-		ReadOnly: true,
+	"forgetkey": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
-			query := ""
-			if len(args) != 0 {
-				query = args[0]
+			if err := r.ctx.forgetKey(); err != nil {
+				return err
 			}
-			return r.ctx.list(query)
+			infoColor.Println("cached key removed, the passphrase is needed to open the file again")
+			return nil
 		},
 	},
 
-	"cd": {
-		ReadOnly: true,
+	"calibrate": {
+		NoUndo: true,
 		Run: func(r *repl, _ string, args []string) error {
-			switch len(args) {
-			case 0:
-				r.ctxEntry = ""
-				r.prompt = mainPromptColor.Sprintf(normalPrompt, r.ctx.shortFilename)
-			case 1:
-				var uuid string
-				var err error
-				uuid, err = r.ctx.findOne(args[0])
-				if err != nil {
-					return err
-				}
-				if len(uuid) == 0 {
+			target := time.Second
+			if len(args) > 0 {
+				seconds, err := strconv.ParseFloat(args[0], 64)
+				if err != nil || seconds <= 0 {
+					errColor.Println("syntax: calibrate [seconds]")
 					return nil
 				}
-
-				blob, err := r.ctx.store.MustFind(uuid)
-				if err != nil {
-					return err
-				}
-
-				r.ctxEntry = blob.Name()
-				r.prompt = mainPromptColor.Sprintf(dirPrompt, r.ctx.shortFilename, r.ctxEntry)
-			default:
-				fmt.Println("cd needs an argument")
+				target = time.Duration(seconds * float64(time.Second))
 			}
 
-			return nil
+			return r.ctx.calibrate(target)
 		},
 	},
 
-	"cp":                    {ReadOnly: true, Run: getCopy},
-	"get":                   {ReadOnly: true, Run: getCopy},
-	blobformat.KeyUser:      {ReadOnly: true, Run: quickCopy},
-	blobformat.KeyPass:      {ReadOnly: true, Run: quickCopy},
-	blobformat.KeyEmail:     {ReadOnly: true, Run: quickCopy},
-	blobformat.KeyTwoFactor: {ReadOnly: true, Run: quickCopy},
+	"add": {
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 1 {
+				errColor.Println("syntax: add <name> [template]")
+				return nil
+			}
 
-	"login": {
-		Run: func(r *repl, cmd string, args []string) error {
-			name := r.ctxEntry
-			if len(args) >= 1 {
-				name = args[0]
+			template := ""
+			if len(args) > 1 {
+				template = args[1]
 			}
+			return r.ctx.addNewInterruptible(args[0], template)
+		},
+	},
 
-			if len(name) == 0 {
-				errColor.Println("syntax: login <query>")
+	"templates": {
+		ReadOnly: true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.listTemplates()
+		},
+	},
+
+	"newtemplate": {
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 2 {
+				errColor.Println("syntax: newtemplate <name> <key...>")
 				return nil
 			}
 
-			return r.ctx.login(name)
+			return r.ctx.newTemplate(args[0], args[1:])
 		},
 	},
 
-	"set": {
-		Run: func(r *repl, cmd string, args []string) error {
-			name := r.ctxEntry
-			var key, value string
+	"searches": {
+		ReadOnly: true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.listSavedSearches()
+		},
+	},
 
-			// with context:
-			// set key
-			// set key val
-			// without context:
-			// set name key
-			// set name key value
+	"savesearch": {
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 2 {
+				errColor.Println("syntax: savesearch <name> <query>")
+				return nil
+			}
 
-			// Set's args are a special case, they are given from
-			// strings.Split not strings.Fields which means there are
-			// potentially empty string arguments lurking around.
+			return r.ctx.saveSearch(args[0], strings.Join(args[1:], " "))
+		},
+	},
 
-			syntaxErr := func() error {
-				errColor.Println("syntax: set <query> <key> [value]")
+	"search": {
+		ReadOnly: true,
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) != 1 {
+				errColor.Println("syntax: search <name>")
 				return nil
 			}
 
-			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
-				return syntaxErr()
+			return r.ctx.savedSearch(args[0])
+		},
+	},
+
+	"mv": {
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 2 {
+				errColor.Println("syntax: mv <old> <new>")
+				return nil
 			}
 
-			if len(name) == 0 {
-				name = args[0]
-				args = args[1:]
+			return r.ctx.rename(args[0], args[1])
+		},
+	},
+
+	"clone": {
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 2 {
+				errColor.Println("syntax: clone <query> <new>")
+				return nil
 			}
 
-			key = args[0]
-			args = args[1:]
+			return r.ctx.clone(args[0], args[1])
+		},
+	},
 
-			if len(name) == 0 || len(key) == 0 {
-				return syntaxErr()
+	"rm": {
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 1 {
+				errColor.Println("syntax: rm <name>")
+				return nil
 			}
+			name := args[0]
+			err := r.ctx.deleteEntry(name)
 
-			if len(args) == 1 {
-				value = args[0]
-			} else if len(args) > 1 {
-				value = strings.Join(args, " ")
+			if err == nil && r.ctxEntry == name {
+				r.ctxEntry = ""
+				r.prompt = mainPromptColor.Sprintf(normalPrompt, r.ctx.shortFilename)
 			}
 
-			return r.ctx.set(name, key, value)
+			return err
 		},
 	},
 
-	"edit": {
-		Run: func(r *repl, cmd string, args []string) error {
+	"rmk": {
+		Run: func(r *repl, _ string, args []string) error {
 			name := r.ctxEntry
 			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
-				errColor.Println("syntax: edit <query> <key>")
+				errColor.Println("syntax: rmk <query> <key>")
 				return nil
 			}
 
@@ -406,43 +680,554 @@ var replCmds = map[string]replCmd{
 				args = args[1:]
 			}
 
-			key := args[0]
-			return r.ctx.edit(name, key)
+			return r.ctx.deleteKey(name, args[0])
 		},
 	},
 
-	"open": {
+	"keyhist": {
 		ReadOnly: true,
-		Run: func(r *repl, cmd string, args []string) error {
+		Run: func(r *repl, _ string, args []string) error {
 			name := r.ctxEntry
 			if len(name) == 0 {
 				if len(args) == 0 {
-					errColor.Println("syntax: open <query>")
+					errColor.Println("syntax: keyhist <query> [key]")
 					return nil
 				}
 				name = args[0]
+				args = args[1:]
 			}
 
-			return r.ctx.openurl(name)
+			key := blobformat.KeyPass
+			if len(args) != 0 {
+				key = args[0]
+			}
+
+			return r.ctx.keyHistory(name, key)
 		},
 	},
 
-	"label": {
-		Run: func(r *repl, cmd string, args []string) error {
+	"diff": {
+		ReadOnly: true,
+		Run: func(r *repl, _ string, args []string) error {
 			name := r.ctxEntry
 			if len(name) == 0 {
 				if len(args) == 0 {
-					errColor.Println("syntax: label <query>")
+					errColor.Println("syntax: diff <query> [from] [to]")
 					return nil
 				}
 				name = args[0]
+				args = args[1:]
+			}
+			if len(args) > 2 {
+				errColor.Println("syntax: diff <query> [from] [to]")
+				return nil
 			}
 
-			return r.ctx.addLabels(name)
+			snaps := []int{1, 0}
+			for i, a := range args {
+				n, err := strconv.Atoi(a)
+				if err != nil || n < 0 {
+					errColor.Println("snapshot must be a number:", a)
+					return nil
+				}
+				snaps[i] = n
+			}
+
+			return r.ctx.diff(name, snaps[0], snaps[1])
 		},
 	},
 
-	"rmlabel": {
+	"revert": {
+		Run: func(r *repl, _ string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: revert <query> <snapshot>")
+					return nil
+				}
+				name = args[0]
+				args = args[1:]
+			}
+			if len(args) != 1 {
+				errColor.Println("syntax: revert <query> <snapshot>")
+				return nil
+			}
+
+			snapshot, err := strconv.Atoi(args[0])
+			if err != nil || snapshot < 1 {
+				errColor.Println("snapshot must be a number above 0:", args[0])
+				return nil
+			}
+
+			return r.ctx.revert(name, snapshot)
+		},
+	},
+
+	"snapcap": {
+		Run: func(r *repl, _ string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: snapcap <query> [max]")
+					return nil
+				}
+				name = args[0]
+				args = args[1:]
+			}
+
+			max := 0
+			if len(args) != 0 {
+				var err error
+				if max, err = strconv.Atoi(args[0]); err != nil || max < 0 {
+					errColor.Println("max must be a positive number:", args[0])
+					return nil
+				}
+			}
+
+			return r.ctx.snapshotCap(name, max)
+		},
+	},
+
+	"mark": {
+		Run: func(r *repl, _ string, args []string) error {
+			name := r.ctxEntry
+			if len(args) < 2 || (len(name) == 0 && len(args) < 3) {
+				errColor.Println("syntax: mark <query> <key> <sensitive|hidden|none|fullhistory|hashhistory|nohistory|text|number|bool>")
+				return nil
+			}
+
+			if len(name) == 0 {
+				name = args[0]
+				args = args[1:]
+			}
+
+			return r.ctx.markKey(name, args[0], args[1])
+		},
+	},
+
+	"tree": {
+		ReadOnly: true,
+		Run: func(r *repl, _ string, args []string) error {
+			prefix := ""
+			if len(args) != 0 {
+				prefix = args[0]
+			}
+
+			return r.ctx.tree(prefix)
+		},
+	},
+
+	"mvdir": {
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) != 2 {
+				errColor.Println("syntax: mvdir <old> <new>")
+				return nil
+			}
+
+			return r.ctx.moveDir(args[0], args[1])
+		},
+	},
+
+	"ls": {
+		ReadOnly: true,
+		Run: func(r *repl, _ string, args []string) error {
+			query := ""
+			if len(args) != 0 {
+				query = args[0]
+			}
+			return r.ctx.list(query)
+		},
+	},
+
+	"cd": {
+		ReadOnly: true,
+		Run: func(r *repl, _ string, args []string) error {
+			switch len(args) {
+			case 0:
+				r.ctxEntry = ""
+				r.prompt = mainPromptColor.Sprintf(normalPrompt, r.ctx.shortFilename)
+			case 1:
+				var uuid string
+				var err error
+				uuid, err = r.ctx.findOne(args[0])
+				if err != nil {
+					return err
+				}
+				if len(uuid) == 0 {
+					return nil
+				}
+
+				blob, err := r.ctx.store.MustFind(uuid)
+				if err != nil {
+					return err
+				}
+
+				r.ctxEntry = blob.Name()
+				r.prompt = mainPromptColor.Sprintf(dirPrompt, r.ctx.shortFilename, r.ctxEntry)
+			default:
+				fmt.Println("cd needs an argument")
+			}
+
+			return nil
+		},
+	},
+
+	"cp":                    {ReadOnly: true, Run: getCopy},
+	"get":                   {ReadOnly: true, Run: getCopy},
+	blobformat.KeyUser:      {ReadOnly: true, Run: quickCopy},
+	blobformat.KeyPass:      {ReadOnly: true, Run: quickCopy},
+	blobformat.KeyEmail:     {ReadOnly: true, Run: quickCopy},
+	blobformat.KeyTwoFactor: {ReadOnly: true, Run: quickCopy},
+
+	"nextcodes": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: nextcodes <query> [n]")
+					return nil
+				}
+				name = args[0]
+				args = args[1:]
+			}
+
+			n := 5
+			if len(args) != 0 {
+				var err error
+				if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+					errColor.Println("n must be a number above 0")
+					return nil
+				}
+			}
+
+			return r.ctx.upcomingCodes(name, n)
+		},
+	},
+
+	"twostep": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: twostep <query> [seconds]")
+					return nil
+				}
+				name = args[0]
+				args = args[1:]
+			}
+
+			timeout := twoStepTimeout
+			if len(args) != 0 {
+				seconds, err := strconv.Atoi(args[0])
+				if err != nil || seconds < 1 {
+					errColor.Println("seconds must be a number above 0")
+					return nil
+				}
+				timeout = time.Duration(seconds) * time.Second
+			}
+
+			return r.ctx.twoStep(name, timeout)
+		},
+	},
+
+	"login": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(args) >= 1 {
+				name = args[0]
+			}
+
+			if len(name) == 0 {
+				errColor.Println("syntax: login <query>")
+				return nil
+			}
+
+			return r.ctx.login(name)
+		},
+	},
+
+	"set": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			var key, value string
+
+			// with context:
+			// set key
+			// set key val
+			// without context:
+			// set name key
+			// set name key value
+
+			// Set's args are a special case, they are given from
+			// strings.Split not strings.Fields which means there are
+			// potentially empty string arguments lurking around.
+
+			syntaxErr := func() error {
+				errColor.Println("syntax: set <query> <key> [value]")
+				return nil
+			}
+
+			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
+				return syntaxErr()
+			}
+
+			if len(name) == 0 {
+				name = args[0]
+				args = args[1:]
+			}
+
+			key = args[0]
+			args = args[1:]
+
+			if len(name) == 0 || len(key) == 0 {
+				return syntaxErr()
+			}
+
+			if len(args) == 1 {
+				value = args[0]
+			} else if len(args) > 1 {
+				value = strings.Join(args, " ")
+			}
+
+			return r.ctx.set(name, key, value)
+		},
+	},
+
+	"edit": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
+				errColor.Println("syntax: edit <query> <key>")
+				return nil
+			}
+
+			if len(name) == 0 {
+				name = args[0]
+				args = args[1:]
+			}
+
+			key := args[0]
+			return r.ctx.edit(name, key)
+		},
+	},
+
+	"open": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: open <query>")
+					return nil
+				}
+				name = args[0]
+			}
+
+			return r.ctx.openurl(name)
+		},
+	},
+
+	"qr": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: qr <query> [file]")
+					return nil
+				}
+				name, args = args[0], args[1:]
+			}
+
+			file := ""
+			if len(args) != 0 {
+				file = args[0]
+			}
+			return r.ctx.twoFactorQR(name, file)
+		},
+	},
+
+	"qrscan": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: qrscan <query> <image>")
+					return nil
+				}
+				name, args = args[0], args[1:]
+			}
+			if len(args) == 0 {
+				errColor.Println("syntax: qrscan <query> <image>")
+				return nil
+			}
+
+			return r.ctx.scanQR(name, args[0])
+		},
+	},
+
+	"otpimport": {
+		Run: func(r *repl, cmd string, args []string) error {
+			if len(args) != 1 {
+				errColor.Println("syntax: otpimport <uri|image>")
+				return nil
+			}
+
+			return r.ctx.importOTPMigration(args[0])
+		},
+	},
+
+	"label": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: label <query>")
+					return nil
+				}
+				name = args[0]
+			}
+
+			return r.ctx.addLabels(name)
+		},
+	},
+
+	"note": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: note <query> [text]")
+					return nil
+				}
+				name = args[0]
+				args = args[1:]
+			}
+
+			return r.ctx.set(name, blobformat.KeyNotes, strings.Join(args, " "))
+		},
+	},
+
+	"rmnote": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
+				errColor.Println("syntax: rmnote <query> <index>")
+				return nil
+			}
+
+			if len(name) == 0 {
+				name = args[0]
+				args = args[1:]
+			}
+
+			index, err := strconv.Atoi(args[0])
+			if err != nil || index < 1 {
+				errColor.Println("index must be a number starting at 1")
+				return nil
+			}
+
+			return r.ctx.deleteNote(name, index)
+		},
+	},
+
+	"question": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: question <query> [question]")
+					return nil
+				}
+				name = args[0]
+				args = args[1:]
+			}
+
+			return r.ctx.addQuestion(name, strings.Join(args, " "))
+		},
+	},
+
+	"rmquestion": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
+				errColor.Println("syntax: rmquestion <query> <index>")
+				return nil
+			}
+
+			if len(name) == 0 {
+				name = args[0]
+				args = args[1:]
+			}
+
+			index, err := strconv.Atoi(args[0])
+			if err != nil || index < 1 {
+				errColor.Println("index must be a number starting at 1")
+				return nil
+			}
+
+			return r.ctx.deleteQuestion(name, index)
+		},
+	},
+
+	"recoverycodes": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: recoverycodes <query> [codes...]")
+					return nil
+				}
+				name = args[0]
+				args = args[1:]
+			}
+
+			return r.ctx.setRecoveryCodes(name, args)
+		},
+	},
+
+	"usecode": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: usecode <query>")
+					return nil
+				}
+				name = args[0]
+			}
+
+			return r.ctx.useRecoveryCode(name)
+		},
+	},
+
+	"answer": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
+				errColor.Println("syntax: answer <query> <index>")
+				return nil
+			}
+
+			if len(name) == 0 {
+				name = args[0]
+				args = args[1:]
+			}
+
+			index, err := strconv.Atoi(args[0])
+			if err != nil || index < 1 {
+				errColor.Println("index must be a number starting at 1")
+				return nil
+			}
+
+			return r.ctx.get(name, blobformat.KeyQuestions, index, true)
+		},
+	},
+
+	"rmlabel": {
 		Run: func(r *repl, cmd string, args []string) error {
 			name := r.ctxEntry
 			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
@@ -463,7 +1248,7 @@ var replCmds = map[string]replCmd{
 		ReadOnly: true,
 		Run: func(r *repl, cmd string, args []string) error {
 			if len(args) == 0 {
-				errColor.Println("syntax: labels <label...>")
+				errColor.Println("syntax: labels <label|alternative...>")
 				return nil
 			}
 
@@ -471,6 +1256,246 @@ var replCmds = map[string]replCmd{
 		},
 	},
 
+	"expired": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			return r.ctx.listExpired()
+		},
+	},
+
+	"favs": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			return r.ctx.listFavorites()
+		},
+	},
+
+	"fav":   {Run: favorite},
+	"unfav": {Run: favorite},
+
+	"protect":   {Run: protect},
+	"unprotect": {Run: protect},
+
+	"connect": {Run: connect},
+	"ssh":     {Run: connect},
+
+	"recent": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			n := 10
+			if len(args) != 0 {
+				var err error
+				if n, err = strconv.Atoi(args[0]); err != nil || n < 1 {
+					errColor.Println("syntax: recent [n]")
+					return nil
+				}
+			}
+			return r.ctx.listRecent(n)
+		},
+	},
+
+	"untouched": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			age := "1y"
+			if len(args) != 0 {
+				age = args[0]
+			}
+			return r.ctx.listUntouched(age)
+		},
+	},
+
+	"grep": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			if len(args) == 0 {
+				errColor.Println("syntax: grep <text>")
+				return nil
+			}
+
+			return r.ctx.grepNotes(strings.Join(args, " "))
+		},
+	},
+
+	"dupes": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			return r.ctx.listDuplicates()
+		},
+	},
+
+	"changelog": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			age := "1w"
+			if len(args) != 0 {
+				age = args[0]
+			}
+			return r.ctx.changelog(age)
+		},
+	},
+
+	"trash": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			return r.ctx.listTrash()
+		},
+	},
+
+	"restore": {
+		Run: func(r *repl, cmd string, args []string) error {
+			if len(args) < 1 {
+				errColor.Println("syntax: restore <query>")
+				return nil
+			}
+			return r.ctx.restore(args[0])
+		},
+	},
+
+	"deleted": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			return r.ctx.listDeleted()
+		},
+	},
+
+	"undelete": {
+		Run: func(r *repl, cmd string, args []string) error {
+			if len(args) < 1 {
+				errColor.Println("syntax: undelete <name>")
+				return nil
+			}
+			return r.ctx.undelete(args[0])
+		},
+	},
+
+	"emptytrash": {
+		Run: func(r *repl, cmd string, args []string) error {
+			age := ""
+			if len(args) != 0 {
+				age = args[0]
+			}
+			return r.ctx.emptyTrash(age)
+		},
+	},
+
+	"imported": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			source := ""
+			if len(args) != 0 {
+				source = args[0]
+			}
+			return r.ctx.listImported(source)
+		},
+	},
+
+	"site": {
+		ReadOnly: true,
+		Run: func(r *repl, cmd string, args []string) error {
+			if len(args) != 1 {
+				errColor.Println("syntax: site <url>")
+				return nil
+			}
+
+			return r.ctx.listByURL(args[0])
+		},
+	},
+
+	"checkout": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: checkout <query> [reason]")
+					return nil
+				}
+				name = args[0]
+				args = args[1:]
+			}
+
+			return r.ctx.checkout(name, strings.Join(args, " "))
+		},
+	},
+
+	"checkin": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: checkin <query>")
+					return nil
+				}
+				name = args[0]
+			}
+
+			return r.ctx.checkin(name)
+		},
+	},
+
+	"share": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(args) < 1 || (len(name) == 0 && len(args) < 2) {
+				errColor.Println("syntax: share <query> <who>")
+				return nil
+			}
+
+			if len(name) == 0 {
+				name = args[0]
+				args = args[1:]
+			}
+
+			return r.ctx.share(name, strings.Join(args, " "))
+		},
+	},
+
+	"recall": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: recall <query>")
+					return nil
+				}
+				name = args[0]
+			}
+
+			return r.ctx.recall(name)
+		},
+	},
+
+	"rotate": {
+		Run: func(r *repl, cmd string, args []string) error {
+			name := r.ctxEntry
+			if len(name) == 0 {
+				if len(args) == 0 {
+					errColor.Println("syntax: rotate <query>")
+					return nil
+				}
+				name = args[0]
+			}
+
+			return r.ctx.rotate(name)
+		},
+	},
+
+	"alias": {
+		Run: func(r *repl, cmd string, args []string) error {
+			if len(args) == 0 || len(args) > 2 {
+				errColor.Println("syntax: alias <query> [target]")
+				return nil
+			}
+
+			target := ""
+			if len(args) == 2 {
+				target = args[1]
+			}
+
+			return r.ctx.set(args[0], blobformat.KeyAlias, target)
+		},
+	},
+
 	"show": {
 		ReadOnly: true,
 		Run: func(r *repl, cmd string, args []string) error {
@@ -499,6 +1524,7 @@ var replCmds = map[string]replCmd{
 	},
 
 	"sync": {
+		NoUndo: true,
 		Run: func(r *repl, cmd string, args []string) error {
 			var name string
 			if len(args) > 0 {
@@ -551,6 +1577,8 @@ var replCmds = map[string]replCmd{
 				fmt.Print(syncHelp)
 			} else if args[0] == "users" {
 				fmt.Print(usersHelp)
+			} else if args[0] == "vaults" {
+				fmt.Print(vaultsHelp)
 			} else if args[0] == "other" {
 				fmt.Print(otherHelp)
 			}
@@ -558,6 +1586,66 @@ var replCmds = map[string]replCmd{
 		},
 	},
 
+	"openvault": {
+		ReadOnly: true,
+		NoUndo:   true,
+		Vaults:   true,
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 2 {
+				errColor.Println("syntax: openvault <name> <file>")
+				return nil
+			}
+
+			return r.ctx.openVault(args[0], args[1])
+		},
+	},
+
+	"closevault": {
+		ReadOnly: true,
+		NoUndo:   true,
+		Vaults:   true,
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 1 {
+				errColor.Println("syntax: closevault <name>")
+				return nil
+			}
+
+			return r.ctx.closeVault(args[0])
+		},
+	},
+
+	"vaults": {
+		ReadOnly: true,
+		Vaults:   true,
+		Run: func(r *repl, _ string, args []string) error {
+			return r.ctx.listVaults()
+		},
+	},
+
+	"mvv": {
+		Vaults: true,
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 2 {
+				errColor.Println("syntax: mvv <query> <vault>")
+				return nil
+			}
+
+			return r.ctx.transferToVault(args[0], args[1], true)
+		},
+	},
+
+	"cpv": {
+		Vaults: true,
+		Run: func(r *repl, _ string, args []string) error {
+			if len(args) < 2 {
+				errColor.Println("syntax: cpv <query> <vault>")
+				return nil
+			}
+
+			return r.ctx.transferToVault(args[0], args[1], false)
+		},
+	},
+
 	"exit": {
 		ReadOnly: true,
 		Run: func(r *repl, cmd string, args []string) error {
@@ -566,6 +1654,45 @@ var replCmds = map[string]replCmd{
 	},
 }
 
+func favorite(r *repl, cmd string, args []string) error {
+	name := r.ctxEntry
+	if len(name) == 0 {
+		if len(args) == 0 {
+			errColor.Printf("syntax: %s <query>\n", cmd)
+			return nil
+		}
+		name = args[0]
+	}
+
+	return r.ctx.favorite(name, cmd == "fav")
+}
+
+func connect(r *repl, cmd string, args []string) error {
+	name := r.ctxEntry
+	if len(name) == 0 {
+		if len(args) == 0 {
+			errColor.Printf("syntax: %s <query>\n", cmd)
+			return nil
+		}
+		name = args[0]
+	}
+
+	return r.ctx.connect(name)
+}
+
+func protect(r *repl, cmd string, args []string) error {
+	name := r.ctxEntry
+	if len(name) == 0 {
+		if len(args) == 0 {
+			errColor.Printf("syntax: %s <query>\n", cmd)
+			return nil
+		}
+		name = args[0]
+	}
+
+	return r.ctx.protect(name, cmd == "protect")
+}
+
 func getCopy(r *repl, cmd string, args []string) error {
 	name := r.ctxEntry
 	if len(args) < 1 || (len(args) < 2 && len(name) == 0) {
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+)
+
+var errReportInvalid = errors.New("report signature is not valid")
+
+// signedReport is a report along with a signature over its compact json so
+// that it can't be edited after the fact. The public key identifies who
+// created it, it's the user's role signing key in multi-user files and
+// derived from their key otherwise so it stays the same across reports.
+type signedReport struct {
+	Report    json.RawMessage `json:"report"`
+	PublicKey string          `json:"publicKey"`
+	Signature string          `json:"signature"`
+}
+
+// report writes a signed compliance report in json, html or pdf to out
+// (stdout if empty).
+func (u *uiContext) report(format, out string, maxAgeDays int) error {
+	switch format {
+	case "json", "html", "pdf":
+	default:
+		return fmt.Errorf("unknown report format %q, use json, html or pdf", format)
+	}
+
+	r, err := u.store.Report(time.Now(), time.Duration(maxAgeDays)*24*time.Hour)
+	if err != nil {
+		return err
+	}
+
+	signed, err := u.signReport(r)
+	if err != nil {
+		return err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "json":
+		err = writeReportJSON(&buf, signed)
+	case "html":
+		err = writeReportHTML(&buf, r, signed)
+	case "pdf":
+		err = writePDF(&buf, reportLines(r, signed))
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(out) == 0 {
+		_, err = os.Stdout.Write(buf.Bytes())
+		return err
+	}
+	if err = ioutil.WriteFile(out, buf.Bytes(), 0600); err != nil {
+		return err
+	}
+	infoColor.Printf("wrote report to %s, compliance score: %d%%\n", out, r.Score)
+	return nil
+}
+
+func (u *uiContext) signReport(r blobformat.Report) (signedReport, error) {
+	payload, err := json.Marshal(r)
+	if err != nil {
+		return signedReport{}, err
+	}
+
+	priv, err := u.reportKey()
+	if err != nil {
+		return signedReport{}, err
+	}
+
+	return signedReport{
+		Report:    payload,
+		PublicKey: hex.EncodeToString(priv.Public().(ed25519.PublicKey)),
+		Signature: hex.EncodeToString(ed25519.Sign(priv, payload)),
+	}, nil
+}
+
+// reportKey returns the key reports are signed with
+func (u *uiContext) reportKey() (ed25519.PrivateKey, error) {
+	if len(u.master) != 0 {
+		priv, err := u.signingKey()
+		if err != blobformat.ErrNoSigningKey {
+			return priv, err
+		}
+	}
+
+	seed := sha256.Sum256(append([]byte("bpass-report-key"), u.key...))
+	return ed25519.NewKeyFromSeed(seed[:]), nil
+}
+
+// verifyReport checks the signature of a json report and prints who signed
+// it, the key should be compared against one known to belong to them.
+func verifyReport(filename string) error {
+	b, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	var signed signedReport
+	if err = json.Unmarshal(b, &signed); err != nil {
+		return fmt.Errorf("failed to parse report: %w", err)
+	}
+
+	pub, err := hex.DecodeString(signed.PublicKey)
+	if err != nil || len(pub) != ed25519.PublicKeySize {
+		return errReportInvalid
+	}
+	// The signature is over the compact json, it's indented in the file
+	var payload bytes.Buffer
+	if err = json.Compact(&payload, signed.Report); err != nil {
+		return errReportInvalid
+	}
+	sig, err := hex.DecodeString(signed.Signature)
+	if err != nil || !ed25519.Verify(pub, payload.Bytes(), sig) {
+		return errReportInvalid
+	}
+
+	infoColor.Println("report signature is valid")
+	fmt.Println("signed by:", signed.PublicKey)
+	return nil
+}
+
+func writeReportJSON(w io.Writer, signed signedReport) error {
+	b, err := json.MarshalIndent(signed, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", b)
+	return err
+}
+
+var reportHTML = template.Must(template.New("report").Funcs(template.FuncMap{
+	"label": labelName,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>bpass credential report</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+table { border-collapse: collapse; margin-bottom: 1em; }
+th, td { border: 1px solid #ccc; padding: 0.3em 0.8em; text-align: right; }
+th:first-child, td:first-child { text-align: left; }
+pre { white-space: pre-wrap; word-break: break-all; font-size: 0.8em; }
+</style>
+</head>
+<body>
+<h1>Credential report</h1>
+<p>Generated {{.Report.Generated.Format "2006-01-02 15:04 MST"}}, passwords must be rotated every {{.Report.MaxAgeDays}} days.</p>
+<h2>Compliance score: {{.Report.Score}}%</h2>
+<table>
+<tr><td>Entries</td><td>{{.Report.Entries}}</td></tr>
+<tr><td>With a password</td><td>{{.Report.Passwords}}</td></tr>
+<tr><td>With two factor</td><td>{{.Report.TwoFactor}}</td></tr>
+<tr><td>Compliant</td><td>{{.Report.Compliant}}</td></tr>
+<tr><td>Shorter than {{.MinLen}} characters</td><td>{{.Report.Short}}</td></tr>
+<tr><td>Reused</td><td>{{.Report.Reused}}</td></tr>
+<tr><td>Expired</td><td>{{.Report.Expired}}</td></tr>
+<tr><td>Overdue for rotation</td><td>{{.Report.Overdue}}</td></tr>
+</table>
+<h2>Rotation by label</h2>
+<table>
+<tr><th>Label</th><th>Entries</th><th>Passwords</th><th>Overdue</th><th>Compliant</th><th>Score</th></tr>
+{{range .Report.Labels}}<tr><td>{{label .Label}}</td><td>{{.Entries}}</td><td>{{.Passwords}}</td><td>{{.Overdue}}</td><td>{{.Compliant}}</td><td>{{.Score}}%</td></tr>
+{{end}}</table>
+<h2>Signature</h2>
+<p>The report below is signed with ed25519, verify it with <code>bpass report --verify</code> on the json version.</p>
+<p>Public key: <code>{{.Signed.PublicKey}}</code><br>Signature: <code>{{.Signed.Signature}}</code></p>
+<pre>{{printf "%s" .Signed.Report}}</pre>
+</body>
+</html>
+`))
+
+func writeReportHTML(w io.Writer, r blobformat.Report, signed signedReport) error {
+	return reportHTML.Execute(w, struct {
+		Report blobformat.Report
+		Signed signedReport
+		MinLen int
+	}{r, signed, blobformat.ReportMinPassLen})
+}
+
+// reportLines is the report as plain text for the pdf
+func reportLines(r blobformat.Report, signed signedReport) []string {
+	lines := []string{
+		"Credential report",
+		"",
+		fmt.Sprintf("Generated %s, passwords must be rotated every %d days.", r.Generated.Format("2006-01-02 15:04 MST"), r.MaxAgeDays),
+		"",
+		fmt.Sprintf("Compliance score: %d%%", r.Score),
+		"",
+		fmt.Sprintf("%-36s %d", "Entries", r.Entries),
+		fmt.Sprintf("%-36s %d", "With a password", r.Passwords),
+		fmt.Sprintf("%-36s %d", "With two factor", r.TwoFactor),
+		fmt.Sprintf("%-36s %d", "Compliant", r.Compliant),
+		fmt.Sprintf("%-36s %d", fmt.Sprintf("Shorter than %d characters", blobformat.ReportMinPassLen), r.Short),
+		fmt.Sprintf("%-36s %d", "Reused", r.Reused),
+		fmt.Sprintf("%-36s %d", "Expired", r.Expired),
+		fmt.Sprintf("%-36s %d", "Overdue for rotation", r.Overdue),
+		"",
+		"Rotation by label",
+		"",
+		fmt.Sprintf("%-24s %8s %10s %8s %10s %6s", "Label", "Entries", "Passwords", "Overdue", "Compliant", "Score"),
+	}
+	for _, l := range r.Labels {
+		lines = append(lines, fmt.Sprintf("%-24s %8d %10d %8d %10d %5d%%", labelName(l.Label), l.Entries, l.Passwords, l.Overdue, l.Compliant, l.Score))
+	}
+
+	lines = append(lines,
+		"",
+		"Signature (ed25519 over the json below, verify with bpass report --verify)",
+		"",
+		"Public key: "+signed.PublicKey,
+		"Signature:",
+	)
+	lines = append(lines, wrapText(signed.Signature, pdfLineLen)...)
+	lines = append(lines, "")
+	lines = append(lines, wrapText(string(signed.Report), pdfLineLen)...)
+
+	return lines
+}
+
+// labelName is how entries without labels are shown in reports
+func labelName(label string) string {
+	if len(label) == 0 {
+		return "(no label)"
+	}
+	return label
+}
+
+func wrapText(s string, n int) []string {
+	var lines []string
+	for len(s) > n {
+		lines = append(lines, s[:n])
+		s = s[n:]
+	}
+	return append(lines, s)
+}
+
+const (
+	// pdfLineLen is how many characters of the monospace font fit on a line
+	pdfLineLen = 90
+	// pdfPageLines is how many lines fit on a page
+	pdfPageLines = 60
+)
+
+// writePDF writes lines of text as a minimal letter sized pdf in a standard
+// monospace font. Characters outside of ascii are replaced with ?.
+func writePDF(w io.Writer, lines []string) error {
+	var pages [][]string
+	for len(lines) > pdfPageLines {
+		pages = append(pages, lines[:pdfPageLines])
+		lines = lines[pdfPageLines:]
+	}
+	pages = append(pages, lines)
+
+	var buf bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, buf.Len())
+		fmt.Fprintf(&buf, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	buf.WriteString("%PDF-1.4\n")
+
+	// 1 catalog, 2 pages, 3 font then a page and its contents for each page
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 4+i*2)
+	}
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier >>")
+
+	for i, page := range pages {
+		var content bytes.Buffer
+		content.WriteString("BT /F1 9 Tf 11 TL 40 750 Td\n")
+		for _, line := range page {
+			fmt.Fprintf(&content, "(%s) Tj T*\n", pdfEscape(line))
+		}
+		content.WriteString("ET")
+
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 612 792] /Resources << /Font << /F1 3 0 R >> >> /Contents %d 0 R >>", 5+i*2))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", content.Len(), content.String()))
+	}
+
+	xref := buf.Len()
+	fmt.Fprintf(&buf, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&buf, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&buf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+func pdfEscape(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
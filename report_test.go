@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/txlogs"
+)
+
+func TestReportSignature(t *testing.T) {
+	t.Parallel()
+
+	u := &uiContext{
+		store: blobformat.Blobs{DB: new(txlogs.DB)},
+		key:   []byte("key"),
+	}
+	r, err := u.store.Report(time.Now(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := u.signReport(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := u.signReport(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if signed.PublicKey != again.PublicKey {
+		t.Error("the same key should sign every report")
+	}
+
+	write := func(s signedReport) string {
+		f, err := ioutil.TempFile("", "bpass-report")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if err = writeReportJSON(f, s); err != nil {
+			t.Fatal(err)
+		}
+		return f.Name()
+	}
+
+	good := write(signed)
+	defer os.Remove(good)
+	if err = verifyReport(good); err != nil {
+		t.Error(err)
+	}
+
+	signed.Report = bytes.Replace(signed.Report, []byte(`"score":100`), []byte(`"score":99`), 1)
+	bad := write(signed)
+	defer os.Remove(bad)
+	if err = verifyReport(bad); err != errReportInvalid {
+		t.Error("expected an invalid signature, got:", err)
+	}
+}
+
+func TestWritePDF(t *testing.T) {
+	t.Parallel()
+
+	lines := make([]string, pdfPageLines+1)
+	lines[0] = `a (tricky) \line`
+	lines[1] = "caf\u00e9"
+
+	var buf bytes.Buffer
+	if err := writePDF(&buf, lines); err != nil {
+		t.Fatal(err)
+	}
+
+	pdf := buf.String()
+	if !strings.HasPrefix(pdf, "%PDF-") || !strings.HasSuffix(pdf, "%%EOF\n") {
+		t.Error("not a pdf")
+	}
+	if !strings.Contains(pdf, "/Count 2") {
+		t.Error("should have two pages")
+	}
+	if !strings.Contains(pdf, `(a \(tricky\) \\line)`) || !strings.Contains(pdf, "(caf?)") {
+		t.Error("text was not escaped")
+	}
+
+	// The xref offsets must point at the objects
+	xref := pdf[strings.Index(pdf, "xref\n"):]
+	for i, line := range strings.Split(xref, "\n")[3:8] {
+		offset, err := strconv.Atoi(line[:10])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := strconv.Itoa(i+1) + " 0 obj"; !strings.HasPrefix(pdf[offset:], want) {
+			t.Errorf("xref entry %d points at %q", i+1, pdf[offset:offset+10])
+		}
+	}
+}
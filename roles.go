@@ -0,0 +1,280 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/aarondl/bpass/blobformat"
+)
+
+// sealSigningKey encrypts a user's private signing key with their key so
+// that other users of the file can't sign as them.
+func sealSigningKey(key []byte, priv ed25519.PrivateKey) (string, error) {
+	aead, err := signingAEAD(key)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(aead.Seal(nonce, nonce, priv.Seed(), nil)), nil
+}
+
+func openSigningKey(key []byte, sealed string) (ed25519.PrivateKey, error) {
+	aead, err := signingAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+
+	ct, err := hex.DecodeString(sealed)
+	if err != nil || len(ct) < aead.NonceSize() {
+		return nil, errors.New("malformed signing key")
+	}
+
+	n := aead.NonceSize()
+	seed, err := aead.Open(nil, ct[:n], ct[n:], nil)
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, errors.New("could not decrypt signing key")
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func signingAEAD(key []byte) (cipher.AEAD, error) {
+	sum := sha256.Sum256(append([]byte("bpass-signing-key"), key...))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// newSigningKey creates a signing key for a user sealed with their key
+func (u *uiContext) newSigningKey(username string, key []byte) error {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return err
+	}
+
+	sealed, err := sealSigningKey(key, priv)
+	if err != nil {
+		return err
+	}
+
+	return u.store.SetSigningKey(username, pub, sealed)
+}
+
+// signingKey returns the current user's private signing key
+func (u *uiContext) signingKey() (ed25519.PrivateKey, error) {
+	_, sealed, err := u.store.SigningKey(u.user)
+	if err != nil {
+		return nil, err
+	}
+
+	return openSigningKey(u.key, sealed)
+}
+
+// ensureSigningKey creates a signing key for the current user of a multi-user
+// file if they don't have one yet. Admins can only be assigned to users that
+// have one.
+func (u *uiContext) ensureSigningKey() error {
+	if len(u.master) == 0 || u.readOnly {
+		return nil
+	}
+
+	_, _, err := u.store.SigningKey(u.user)
+	if err != blobformat.ErrNoSigningKey {
+		return err
+	}
+
+	return u.newSigningKey(u.user, u.key)
+}
+
+// resealSigningKey re-encrypts the current user's signing key after their
+// key changed from oldKey to u.key.
+func (u *uiContext) resealSigningKey(oldKey []byte) error {
+	if len(u.master) == 0 {
+		return nil
+	}
+
+	pub, sealed, err := u.store.SigningKey(u.user)
+	if err == blobformat.ErrNoSigningKey {
+		return u.newSigningKey(u.user, u.key)
+	} else if err != nil {
+		return err
+	}
+
+	priv, err := openSigningKey(oldKey, sealed)
+	if err != nil {
+		return err
+	}
+	if sealed, err = sealSigningKey(u.key, priv); err != nil {
+		return err
+	}
+
+	return u.store.SetSigningKey(u.user, pub, sealed)
+}
+
+// restoreRoles signs the roles that were valid before an admin replaced
+// other users' signing keys again. Replacing a key invalidates the user's own
+// assignment and the ones they signed.
+func (u *uiContext) restoreRoles(before []blobformat.RoleAssignment) error {
+	after, err := u.store.Roles()
+	if err != nil {
+		return err
+	}
+
+	valid := make(map[string]bool)
+	for _, a := range after {
+		valid[a.User] = a.Valid
+	}
+
+	var priv ed25519.PrivateKey
+	for _, a := range before {
+		if !a.Valid || valid[a.User] {
+			continue
+		}
+
+		if priv == nil {
+			if priv, err = u.signingKey(); err != nil {
+				return err
+			}
+		}
+		if err = u.store.AssignRole(a.User, a.Role, u.user, priv); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// requireAdmin returns false (and says why) if roles are enabled and the
+// current user is not an admin.
+func (u *uiContext) requireAdmin(action string) (bool, error) {
+	enabled, err := u.store.RolesEnabled()
+	if err != nil || !enabled {
+		return err == nil, err
+	}
+
+	role, err := u.store.RoleOf(u.user)
+	if err != nil {
+		return false, err
+	}
+	if role != blobformat.RoleAdmin {
+		errColor.Printf("only admins can %s\n", action)
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// rootAdminCheck refuses changes to another user's key when they're the root
+// admin since roles can't be verified if the root's signing key changes.
+func (u *uiContext) rootAdminCheck(username string) (bool, error) {
+	assignments, err := u.store.Roles()
+	if err != nil {
+		return false, err
+	}
+
+	for _, a := range assignments {
+		if a.User == username && a.Signer == username {
+			errColor.Printf("%s is the root admin and can only rekey themselves\n", username)
+			return false, nil
+		}
+	}
+
+	return true, nil
+}
+
+func (u *uiContext) enableRoles() error {
+	if len(u.master) == 0 {
+		errColor.Println("roles are for multi-user files, see adduser")
+		return nil
+	}
+
+	if err := u.ensureSigningKey(); err != nil {
+		return err
+	}
+	priv, err := u.signingKey()
+	if err != nil {
+		return err
+	}
+
+	if err = u.store.EnableRoles(u.user, priv); err == blobformat.ErrRolesEnabled {
+		errColor.Println(err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	infoColor.Printf("roles enabled, %s is the root admin\n", u.user)
+	return nil
+}
+
+func (u *uiContext) assignRole(username, role string) error {
+	if ok, err := u.requireAdmin("assign roles"); err != nil || !ok {
+		return err
+	}
+
+	if enabled, err := u.store.RolesEnabled(); err != nil {
+		return err
+	} else if !enabled {
+		errColor.Println("roles are not enabled, see enableroles")
+		return nil
+	}
+
+	priv, err := u.signingKey()
+	if err != nil {
+		return err
+	}
+
+	err = u.store.AssignRole(username, role, u.user, priv)
+	switch err {
+	case nil:
+	case blobformat.ErrNoSigningKey:
+		errColor.Printf("%s has no signing key yet, they must open the file once first\n", username)
+		return nil
+	case blobformat.ErrNotFound:
+		errColor.Printf("user %s not found\n", username)
+		return nil
+	case blobformat.ErrUnknownRole, blobformat.ErrNotAdmin:
+		errColor.Println(err)
+		return nil
+	default:
+		return err
+	}
+
+	infoColor.Printf("%s is now: %s\n", username, role)
+	return nil
+}
+
+func (u *uiContext) listRoles() error {
+	assignments, err := u.store.Roles()
+	if err != nil {
+		return err
+	}
+	if assignments == nil {
+		infoColor.Println("roles are not enabled, see enableroles")
+		return nil
+	}
+
+	sort.Slice(assignments, func(i, j int) bool { return assignments[i].User < assignments[j].User })
+	for _, a := range assignments {
+		if !a.Valid {
+			fmt.Printf("%s %s\n", a.User, errColor.Sprintf("%s (INVALID signature from %s)", a.Role, a.Signer))
+			continue
+		}
+		fmt.Printf("%s %s %s\n", a.User, keyColor.Sprint(a.Role), hideColor.Sprintf("(signed by %s)", a.Signer))
+	}
+	return nil
+}
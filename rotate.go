@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/osutil"
+)
+
+// rotate walks the user through changing the password of an entry: it
+// generates the new password, copies the old then the new one at the right
+// times, saves it with a note about the rotation and flags other entries
+// that used the same password as needing rotation.
+func (u *uiContext) rotate(search string) error {
+	uuid, err := u.findResolved(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+	if ok, err := u.checkWindow(uuid); err != nil || !ok {
+		return err
+	}
+	if ok, err := u.checkCheckout(uuid); err != nil || !ok {
+		return err
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	name := blob.Name()
+	oldPass := blob[blobformat.KeyPass]
+
+	// Anything sharing the old password will be the weak link after this
+	same, err := u.store.SamePassword(uuid)
+	if err != nil {
+		return err
+	}
+
+	infoColor.Printf("rotating the password for %s\n\n", name)
+
+	infoColor.Println("step 1: generate the new password")
+	newPass, err := u.getPassword()
+	if err != nil {
+		return err
+	}
+
+	infoColor.Println("\nstep 2: open the change password page")
+	if url := blob[blobformat.KeyURL]; len(url) != 0 {
+		if ok, err := u.getYesNo("open " + url + "?"); err != nil {
+			return err
+		} else if ok {
+			if err = osutil.OpenURL(url); err != nil {
+				errColor.Println("failed to open url:", err)
+			}
+		}
+	}
+
+	if len(oldPass) != 0 {
+		infoColor.Println("\nstep 3: enter the current password")
+		copyToClipboard("old "+blobformat.KeyPass, oldPass, true)
+		if _, err = u.prompt(infoColor.Sprint("press enter to copy the new password")); err != nil {
+			return err
+		}
+	}
+
+	infoColor.Println("\nstep 4: enter the new password")
+	copyToClipboard("new "+blobformat.KeyPass, newPass, true)
+	ok, err := u.getYesNo("was the password changed successfully?")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		errColor.Println("rotation aborted, the entry was not changed")
+		return nil
+	}
+
+	message, err := u.prompt(promptColor.Sprint("rotation note (optional): "))
+	if err != nil {
+		return err
+	}
+
+	err = u.store.DB.Because("rotate password", func() error {
+		u.store.Set(uuid, blobformat.KeyPass, newPass)
+		note := "rotated password"
+		if message = strings.TrimSpace(message); len(message) != 0 {
+			note += ": " + message
+		}
+		if err := u.store.AddNote(uuid, note); err != nil {
+			return err
+		}
+		if expires, err := blob.Expires(); err != nil {
+			return err
+		} else if !expires.IsZero() {
+			// A rotation was what the expiry was asking for
+			return u.store.SetExpires(uuid, time.Time{})
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	infoColor.Printf("\nupdated %s\n", name)
+
+	if len(same) == 0 {
+		return nil
+	}
+
+	names := same.Names()
+	sort.Strings(names)
+	errColor.Printf("these entries used the same password:\n  %s\n", strings.Join(names, "\n  "))
+	if ok, err = u.getYesNo("flag them as needing rotation?"); err != nil || !ok {
+		return err
+	}
+
+	now := time.Now()
+	for otherUUID := range same {
+		if err = u.store.SetExpires(otherUUID, now); err != nil {
+			return err
+		}
+		if err = u.store.AddNote(otherUUID, fmt.Sprintf("needs rotation: shared a password with %s", name)); err != nil {
+			return err
+		}
+	}
+	infoColor.Println("flagged, they show up in expired")
+
+	return nil
+}
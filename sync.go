@@ -109,12 +109,19 @@ Syncs:
 			continue
 		}
 
-		log, err := txlogs.NewLog(pt)
+		db, err := txlogs.New(pt)
 		if err != nil {
 			errColor.Printf("failed parsing log %q: %v\n", name, err)
 			syncs[i] = ""
 			continue
 		}
+		log := db.Log
+
+		remote := blobformat.Blobs{DB: db}
+		remote.DB.SetChainKey(paramsHistoryKey(params))
+		if err = checkHistory(name, remote); err != nil {
+			errColor.Printf("failed to check history of %q: %v\n", name, err)
+		}
 
 		if len(log) == len(u.store.DB.Log) &&
 			log[0].Time == u.store.DB.Log[0].Time &&
@@ -135,21 +142,44 @@ Syncs:
 	out, err := mergeBlobs(u, blobs)
 	if err != nil {
 		errColor.Println("aborting sync, failed to merge logs:", err)
+		notify("bpass sync", "sync failed: %v", err)
 		return nil
 	}
 
 	u.user, u.pass = out.User, out.Pass
 	u.key, u.salt = out.Key, out.Salt
 	u.master, u.ivm = out.Master, out.IVM
+	u.version = out.Version
+	u.tokens = out.Tokens
 
 	u.store.ResetSnapshot()
 	u.store.Log = out.Log
+	u.undo.Clear()
+	u.setHistoryKey()
+	u.store.Rechain()
 	if err = u.store.UpdateSnapshot(); err != nil {
 		errColor.Println("failed to rebuild snapshot, poisoned by sync:", err)
 		errColor.Println("exiting to avoid corrupting local file")
 		os.Exit(1)
 	}
 
+	// Remotes may not have been purged or archived, keep what's been removed
+	// from the log out of it
+	if _, err = u.store.ReapplyPurges(); err != nil {
+		return err
+	}
+	if u.store.Archived != 0 {
+		removed, err := u.store.Compact(u.store.Archived)
+		if err != nil {
+			return err
+		}
+		if len(removed) != 0 {
+			if err = u.appendArchive(removed); err != nil {
+				return err
+			}
+		}
+	}
+
 	if err = saveHosts(u.store.DB, hosts); err != nil {
 		return err
 	}
@@ -160,6 +190,7 @@ Syncs:
 
 	// Save & encrypt in memory
 	var pt, ct []byte
+	u.setHistoryKey()
 	if pt, err = u.store.Save(); err != nil {
 		return err
 	}
@@ -167,12 +198,13 @@ Syncs:
 	if err != nil {
 		return err
 	}
-	if ct, err = crypt.Encrypt(cryptVersion, params, pt); err != nil {
+	if ct, err = crypt.Encrypt(u.version, params, pt); err != nil {
 		return err
 	}
 
 	// Push back to other machines
 	hosts = make(map[string]string)
+	pushed, failed := 0, 0
 	for _, uuid := range syncs {
 		if len(uuid) == 0 {
 			// This is a signal that pulling did not work so don't attempt
@@ -188,6 +220,9 @@ Syncs:
 		hostentry, err := pushBlob(u, uuid, ct)
 		if err != nil {
 			errColor.Printf("error pushing to %q: %v\n", name, err)
+			failed++
+		} else {
+			pushed++
 		}
 
 		if len(hostentry) != 0 {
@@ -199,6 +234,12 @@ Syncs:
 		return err
 	}
 
+	if failed != 0 {
+		notify("bpass sync", "sync finished, failed to push to %d of %d remotes", failed, pushed+failed)
+	} else if pushed != 0 {
+		notify("bpass sync", "sync complete (%d remotes)", pushed)
+	}
+
 	return nil
 }
 
@@ -250,7 +291,7 @@ func collectSyncs(store blobformat.Blobs) ([]string, error) {
 		}
 
 		switch u.Scheme {
-		case syncSCP, syncFile:
+		case syncSCP, syncFile, syncHTTPS:
 			validSyncs = append(validSyncs, uuid)
 		default:
 			errColor.Printf("entry %q is a %q sync account, but this kind is unknown (old bpass version?)\n", name, u.Scheme)
@@ -278,6 +319,11 @@ func pullBlob(u *uiContext, uuid string) (ct []byte, hostentry string, err error
 		if os.IsNotExist(err) {
 			return nil, "", errNotFound
 		}
+	case syncHTTPS:
+		ct, err = httpPull(uuid, entry)
+		if err == errNotFound {
+			return nil, "", errNotFound
+		}
 	}
 
 	if err != nil {
@@ -298,6 +344,8 @@ func pushBlob(u *uiContext, uuid string, payload []byte) (hostentry string, err
 	case syncFile:
 		path := filepath.FromSlash(uri.Path)
 		err = ioutil.WriteFile(path, payload, 0600)
+	case syncHTTPS:
+		err = httpPush(u, uuid, entry, payload)
 	}
 
 	return hostentry, err
@@ -308,7 +356,7 @@ func decryptBlob(u *uiContext, name string, ct []byte) (params crypt.Params, cre
 	creds.Key, creds.Salt = u.key, u.salt
 	for {
 		// Decrypt payload with our loaded key
-		_, params, pt, err = crypt.Decrypt([]byte(creds.User), []byte(creds.Pass), creds.Key, creds.Salt, ct)
+		_, params, pt, err = crypt.Decrypt([]byte(creds.User), []byte(u.unlockPass(creds.Pass)), creds.Key, creds.Salt, ct)
 		if err == nil {
 			return params, creds, pt, err
 		}
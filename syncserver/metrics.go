@@ -0,0 +1,142 @@
+package syncserver
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// latencyBuckets are the upper bounds (in seconds) of the request duration
+// histogram
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5}
+
+// metrics are counters about the server's requests, they're exposed in the
+// prometheus text format by MetricsHandler.
+type metrics struct {
+	mut sync.Mutex
+
+	// requests by "method code"
+	requests     map[[2]string]uint64
+	authFailures uint64
+	conflicts    uint64
+	pushedBytes  uint64
+
+	// histogram of request durations by method
+	buckets map[string][]uint64
+	sums    map[string]float64
+	counts  map[string]uint64
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		requests: make(map[[2]string]uint64),
+		buckets:  make(map[string][]uint64),
+		sums:     make(map[string]float64),
+		counts:   make(map[string]uint64),
+	}
+}
+
+func (m *metrics) observe(method string, code int, took time.Duration) {
+	m.mut.Lock()
+	defer m.mut.Unlock()
+
+	m.requests[[2]string{method, strconv.Itoa(code)}]++
+	switch code {
+	case http.StatusUnauthorized:
+		m.authFailures++
+	case http.StatusConflict:
+		m.conflicts++
+	}
+
+	seconds := took.Seconds()
+	b, ok := m.buckets[method]
+	if !ok {
+		b = make([]uint64, len(latencyBuckets))
+		m.buckets[method] = b
+	}
+	for i, le := range latencyBuckets {
+		if seconds <= le {
+			b[i]++
+		}
+	}
+	m.sums[method] += seconds
+	m.counts[method]++
+}
+
+func (m *metrics) pushed(n int) {
+	m.mut.Lock()
+	m.pushedBytes += uint64(n)
+	m.mut.Unlock()
+}
+
+// MetricsHandler serves the server's metrics in the prometheus text format.
+// Nothing about the contents of files is known to the server so these are
+// only about requests.
+func (s *Server) MetricsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m := s.metrics
+		m.mut.Lock()
+		defer m.mut.Unlock()
+
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+
+		fmt.Fprintln(w, "# HELP bpass_requests_total Requests by method and status code.")
+		fmt.Fprintln(w, "# TYPE bpass_requests_total counter")
+		keys := make([][2]string, 0, len(m.requests))
+		for k := range m.requests {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			if keys[i][0] != keys[j][0] {
+				return keys[i][0] < keys[j][0]
+			}
+			return keys[i][1] < keys[j][1]
+		})
+		for _, k := range keys {
+			fmt.Fprintf(w, "bpass_requests_total{method=%q,code=%q} %d\n", k[0], k[1], m.requests[k])
+		}
+
+		fmt.Fprintln(w, "# HELP bpass_auth_failures_total Requests rejected for a missing or wrong token.")
+		fmt.Fprintln(w, "# TYPE bpass_auth_failures_total counter")
+		fmt.Fprintf(w, "bpass_auth_failures_total %d\n", m.authFailures)
+
+		fmt.Fprintln(w, "# HELP bpass_push_conflicts_total Pushes rejected because the client had not pulled the latest version.")
+		fmt.Fprintln(w, "# TYPE bpass_push_conflicts_total counter")
+		fmt.Fprintf(w, "bpass_push_conflicts_total %d\n", m.conflicts)
+
+		fmt.Fprintln(w, "# HELP bpass_pushed_bytes_total Bytes of files accepted by pushes.")
+		fmt.Fprintln(w, "# TYPE bpass_pushed_bytes_total counter")
+		fmt.Fprintf(w, "bpass_pushed_bytes_total %d\n", m.pushedBytes)
+
+		fmt.Fprintln(w, "# HELP bpass_request_duration_seconds Time taken to handle requests by method.")
+		fmt.Fprintln(w, "# TYPE bpass_request_duration_seconds histogram")
+		methods := make([]string, 0, len(m.counts))
+		for method := range m.counts {
+			methods = append(methods, method)
+		}
+		sort.Strings(methods)
+		for _, method := range methods {
+			for i, le := range latencyBuckets {
+				fmt.Fprintf(w, "bpass_request_duration_seconds_bucket{method=%q,le=%q} %d\n",
+					method, strconv.FormatFloat(le, 'g', -1, 64), m.buckets[method][i])
+			}
+			fmt.Fprintf(w, "bpass_request_duration_seconds_bucket{method=%q,le=\"+Inf\"} %d\n", method, m.counts[method])
+			fmt.Fprintf(w, "bpass_request_duration_seconds_sum{method=%q} %g\n", method, m.sums[method])
+			fmt.Fprintf(w, "bpass_request_duration_seconds_count{method=%q} %d\n", method, m.counts[method])
+		}
+	})
+}
+
+// statusWriter remembers the status code written
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (s *statusWriter) WriteHeader(code int) {
+	s.code = code
+	s.ResponseWriter.WriteHeader(code)
+}
@@ -0,0 +1,299 @@
+// Package syncserver is an http server that stores encrypted bpass files for
+// teams. It never sees the contents of the files, it only keeps versions of
+// them and refuses pushes from clients that haven't seen the latest version
+// (see Vector) so that changes are merged by clients instead of lost.
+//
+// Routes:
+//
+//	GET /vaults/<team>/<name>[?version=<n>] - Download the latest (or an older) version
+//	PUT /vaults/<team>/<name>               - Upload a new version
+//
+// Requests must have an Authorization: Bearer <token> header with a token
+// for the team.
+package syncserver
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MaxVaultSize is the largest file that can be pushed
+const MaxVaultSize = 64 * 1024 * 1024
+
+var rgxName = regexp.MustCompile(`^[a-zA-Z0-9._-]+$`)
+
+// Server stores vaults in a directory: <dir>/<team>/<name>/<version>
+type Server struct {
+	dir  string
+	keep int
+
+	// tokens maps the hex sha256 of a token to the team it's for
+	tokens map[string]string
+
+	mut     sync.Mutex
+	metrics *metrics
+}
+
+// meta is stored with each vault to know its latest version
+type meta struct {
+	Version int    `json:"version"`
+	Vector  Vector `json:"vector"`
+}
+
+// New creates a server storing files in dir, keep is how many versions of
+// each file are kept.
+func New(dir string, keep int, tokens map[string]string) *Server {
+	if keep < 1 {
+		keep = 1
+	}
+
+	return &Server{dir: dir, keep: keep, tokens: tokens, metrics: newMetrics()}
+}
+
+// ValidName checks that a team or vault name is allowed, . and .. aren't
+// since they'd name a directory outside of the team's
+func ValidName(name string) bool {
+	return rgxName.MatchString(name) && name != "." && name != ".."
+}
+
+// HashToken returns what's stored in a token file for a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// LoadTokens reads a token file, each line is: <team> <HashToken(token)>.
+// Blank lines and lines starting with # are ignored.
+func LoadTokens(filename string) (map[string]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if len(text) == 0 || text[0] == '#' {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		if len(fields) != 2 || !ValidName(fields[0]) {
+			return nil, fmt.Errorf("%s:%d: expected <team> <token hash>", filename, line)
+		}
+		tokens[fields[1]] = fields[0]
+	}
+
+	return tokens, scanner.Err()
+}
+
+// ServeHTTP implements http.Handler
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+	s.serve(sw, r)
+	s.metrics.observe(r.Method, sw.code, time.Since(start))
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+	if len(parts) != 3 || parts[0] != "vaults" || !ValidName(parts[1]) || !ValidName(parts[2]) {
+		http.NotFound(w, r)
+		return
+	}
+	team, name := parts[1], parts[2]
+	dir, ok := s.vaultDir(team, name)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !s.authorized(r, team) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		s.get(w, r, dir)
+	case http.MethodPut:
+		s.put(w, r, dir)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// vaultDir returns the directory a team's vault is kept in, ok is false if
+// it's anywhere but directly in the team's directory
+func (s *Server) vaultDir(team, name string) (dir string, ok bool) {
+	teamDir := filepath.Join(s.dir, team)
+	dir = filepath.Join(teamDir, name)
+	return dir, filepath.Dir(teamDir) == filepath.Clean(s.dir) && filepath.Dir(dir) == teamDir
+}
+
+func (s *Server) authorized(r *http.Request, team string) bool {
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") {
+		return false
+	}
+
+	hash := HashToken(strings.TrimPrefix(auth, "Bearer "))
+	for h, t := range s.tokens {
+		if subtle.ConstantTimeCompare([]byte(h), []byte(hash)) == 1 && t == team {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Server) get(w http.ResponseWriter, r *http.Request, dir string) {
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	m, err := readMeta(dir)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+	if m.Version == 0 {
+		http.NotFound(w, r)
+		return
+	}
+
+	version := m.Version
+	if v := r.URL.Query().Get("version"); len(v) != 0 {
+		if version, err = strconv.Atoi(v); err != nil {
+			http.Error(w, "bad version", http.StatusBadRequest)
+			return
+		}
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, strconv.Itoa(version)))
+	if os.IsNotExist(err) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	// Older versions can't be pushed on top of so they get no vector
+	if version == m.Version {
+		w.Header().Set(VersionHeader, m.Vector.String())
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	_, _ = w.Write(data)
+}
+
+func (s *Server) put(w http.ResponseWriter, r *http.Request, dir string) {
+	vector, err := ParseVector(r.Header.Get(VersionHeader))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(r.Body, MaxVaultSize+1))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if len(data) > MaxVaultSize {
+		http.Error(w, "file too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	s.mut.Lock()
+	defer s.mut.Unlock()
+
+	m, err := readMeta(dir)
+	if err != nil {
+		serverError(w, err)
+		return
+	}
+
+	if !vector.Descends(m.Vector) {
+		w.Header().Set(VersionHeader, m.Vector.String())
+		http.Error(w, "version is behind the server, pull and merge first", http.StatusConflict)
+		return
+	}
+
+	if err = os.MkdirAll(dir, 0700); err != nil {
+		serverError(w, err)
+		return
+	}
+
+	m.Version++
+	m.Vector = vector
+	if err = ioutil.WriteFile(filepath.Join(dir, strconv.Itoa(m.Version)), data, 0600); err != nil {
+		serverError(w, err)
+		return
+	}
+	if err = writeMeta(dir, m); err != nil {
+		serverError(w, err)
+		return
+	}
+
+	for v := m.Version - s.keep; v > 0; v-- {
+		err := os.Remove(filepath.Join(dir, strconv.Itoa(v)))
+		if os.IsNotExist(err) {
+			break
+		}
+	}
+
+	s.metrics.pushed(len(data))
+	w.Header().Set(VersionHeader, m.Vector.String())
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func readMeta(dir string) (m meta, err error) {
+	b, err := ioutil.ReadFile(filepath.Join(dir, "meta.json"))
+	if os.IsNotExist(err) {
+		return meta{Vector: make(Vector)}, nil
+	} else if err != nil {
+		return m, err
+	}
+
+	err = json.Unmarshal(b, &m)
+	if m.Vector == nil {
+		m.Vector = make(Vector)
+	}
+	return m, err
+}
+
+// writeMeta writes through a temporary file so a crash never leaves a
+// half written meta file
+func writeMeta(dir string, m meta) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	tmp := filepath.Join(dir, "meta.json.tmp")
+	if err = ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "meta.json"))
+}
+
+func serverError(w http.ResponseWriter, err error) {
+	fmt.Fprintln(os.Stderr, "error:", err)
+	http.Error(w, "internal server error", http.StatusInternalServerError)
+}
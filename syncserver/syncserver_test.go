@@ -0,0 +1,137 @@
+package syncserver
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestVector(t *testing.T) {
+	t.Parallel()
+
+	v, err := ParseVector("b=2,a=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := v.String(); s != "a=1,b=2" {
+		t.Error("string was wrong:", s)
+	}
+	if _, err = ParseVector("a=x"); err == nil {
+		t.Error("expected an error")
+	}
+
+	next := v.Next("a")
+	if !next.Descends(v) {
+		t.Error("next should descend")
+	}
+	if v.Descends(v) {
+		t.Error("a vector should not descend itself")
+	}
+
+	// Concurrent changes descend neither way
+	other := v.Next("b")
+	if next.Descends(other) || other.Descends(next) {
+		t.Error("concurrent vectors should not descend each other")
+	}
+
+	empty := make(Vector)
+	if !v.Descends(empty) {
+		t.Error("should descend the empty vector")
+	}
+}
+
+func TestServer(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "syncserver")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	if ValidName(".") || ValidName("..") || !ValidName("team.v2") {
+		t.Error("wrong names allowed")
+	}
+
+	server := New(dir, 2, map[string]string{HashToken("secret"): "team"})
+	srv := httptest.NewServer(server)
+	defer srv.Close()
+
+	do := func(method, path, token, vector string, body []byte) *http.Response {
+		t.Helper()
+		req, err := http.NewRequest(method, srv.URL+path, bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(token) != 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if len(vector) != 0 {
+			req.Header.Set(VersionHeader, vector)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+	status := func(resp *http.Response, want int) {
+		t.Helper()
+		resp.Body.Close()
+		if resp.StatusCode != want {
+			t.Errorf("status was %d, want %d", resp.StatusCode, want)
+		}
+	}
+
+	status(do("GET", "/vaults/team/vault", "", "", nil), http.StatusUnauthorized)
+	status(do("GET", "/vaults/other/vault", "secret", "", nil), http.StatusUnauthorized)
+	status(do("GET", "/vaults/team/vault", "secret", "", nil), http.StatusNotFound)
+	status(do("GET", "/vaults/team/..", "secret", "", nil), http.StatusNotFound)
+	status(do("PUT", "/vaults/team/..", "secret", "a=1", []byte("escape")), http.StatusNotFound)
+	status(do("PUT", "/vaults/team/.", "secret", "a=1", []byte("escape")), http.StatusNotFound)
+	if files, err := ioutil.ReadDir(dir); err != nil || len(files) != 0 {
+		t.Error("nothing should have been written outside of a vault:", files, err)
+	}
+
+	status(do("PUT", "/vaults/team/vault", "secret", "a=1", []byte("one")), http.StatusNoContent)
+
+	// b never saw a=1 so it can't push
+	status(do("PUT", "/vaults/team/vault", "secret", "b=1", []byte("lost")), http.StatusConflict)
+	status(do("PUT", "/vaults/team/vault", "secret", "a=1,b=1", []byte("two")), http.StatusNoContent)
+	status(do("PUT", "/vaults/team/vault", "secret", "a=2,b=1", []byte("three")), http.StatusNoContent)
+
+	resp := do("GET", "/vaults/team/vault", "secret", "", nil)
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "three" {
+		t.Errorf("body was wrong: %q", body)
+	}
+	if v := resp.Header.Get(VersionHeader); v != "a=2,b=1" {
+		t.Error("version was wrong:", v)
+	}
+
+	// Only two versions are kept
+	status(do("GET", "/vaults/team/vault?version=2", "secret", "", nil), http.StatusOK)
+	status(do("GET", "/vaults/team/vault?version=1", "secret", "", nil), http.StatusNotFound)
+
+	rec := httptest.NewRecorder()
+	server.MetricsHandler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	metrics := rec.Body.String()
+	for _, want := range []string{
+		`bpass_requests_total{method="PUT",code="204"} 3`,
+		"bpass_auth_failures_total 2",
+		"bpass_push_conflicts_total 1",
+		`bpass_request_duration_seconds_count{method="GET"} 7`,
+	} {
+		if !strings.Contains(metrics, want) {
+			t.Errorf("metrics did not contain %q:\n%s", want, metrics)
+		}
+	}
+}
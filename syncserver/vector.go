@@ -0,0 +1,83 @@
+package syncserver
+
+import (
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// VersionHeader is the http header version vectors are sent in
+const VersionHeader = "Bpass-Version"
+
+// Vector is a version vector, a counter for every device that has pushed a
+// vault. A push is only accepted if the pusher had seen every version the
+// server has, that way no one can overwrite changes they haven't merged.
+type Vector map[string]uint64
+
+// ParseVector parses the output of Vector.String, an empty string is an empty
+// vector.
+func ParseVector(s string) (Vector, error) {
+	v := make(Vector)
+	if len(s) == 0 {
+		return v, nil
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		kv := strings.SplitN(part, "=", 2)
+		if len(kv) != 2 || len(kv[0]) == 0 {
+			return nil, errors.New("malformed version vector")
+		}
+
+		n, err := strconv.ParseUint(kv[1], 10, 64)
+		if err != nil {
+			return nil, errors.New("malformed version vector")
+		}
+		v[kv[0]] = n
+	}
+
+	return v, nil
+}
+
+// String formats the vector as device=counter pairs sorted by device
+func (v Vector) String() string {
+	devices := make([]string, 0, len(v))
+	for d := range v {
+		devices = append(devices, d)
+	}
+	sort.Strings(devices)
+
+	parts := make([]string, len(devices))
+	for i, d := range devices {
+		parts[i] = d + "=" + strconv.FormatUint(v[d], 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+// Descends is true if v has seen everything in other (every counter is at
+// least as large) and something other hasn't.
+func (v Vector) Descends(other Vector) bool {
+	greater := false
+	for d, n := range other {
+		if v[d] < n {
+			return false
+		}
+	}
+	for d, n := range v {
+		if n > other[d] {
+			greater = true
+		}
+	}
+
+	return greater
+}
+
+// Next returns a copy of v with the device's counter incremented
+func (v Vector) Next(device string) Vector {
+	next := make(Vector, len(v)+1)
+	for d, n := range v {
+		next[d] = n
+	}
+	next[device]++
+	return next
+}
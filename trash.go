@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aarondl/bpass/blobformat"
+)
+
+func (u *uiContext) listTrash() error {
+	results, err := u.store.Trash()
+	if err != nil {
+		return err
+	}
+	if len(results) == 0 {
+		infoColor.Println("The trash is empty")
+		return nil
+	}
+
+	uuids := results.UUIDs()
+	sort.Slice(uuids, func(i, j int) bool { return results[uuids[i]] < results[uuids[j]] })
+	for _, uuid := range uuids {
+		blob, err := u.store.MustFind(uuid)
+		if err != nil {
+			return err
+		}
+
+		trashed, err := blob.Trashed()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%s %s\n", results[uuid], hideColor.Sprint(trashed.Format("2006-01-02")))
+	}
+	return nil
+}
+
+func (u *uiContext) restore(query string) error {
+	if !blobformat.IsTrashEntry(query) {
+		query = "trash/" + query
+	}
+
+	uuid, err := u.findOne(query)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		return nil
+	}
+
+	err = u.store.Restore(uuid)
+	switch err {
+	case nil:
+	case blobformat.ErrNameNotUnique:
+		errColor.Println("an entry with its original name exists, rename it (or this one with mv) first")
+		return nil
+	default:
+		return err
+	}
+
+	blob, err := u.store.MustFind(uuid)
+	if err != nil {
+		return err
+	}
+	infoColor.Printf("restored %q\n", blob.Name())
+	return nil
+}
+
+// listDeleted shows the permanently deleted entries that can still be
+// undeleted, most recent first
+func (u *uiContext) listDeleted() error {
+	deleted := u.store.DeletedEntries()
+	if len(deleted) == 0 {
+		infoColor.Println("No deleted entries")
+		return nil
+	}
+
+	for _, d := range deleted {
+		fmt.Printf("%s %s %s\n", keyColor.Sprint(d.Name), d.Deleted.Format("2006-01-02"), d.UUID)
+	}
+	return nil
+}
+
+// undelete brings back the most recently deleted entry with the given name
+// (or uuid)
+func (u *uiContext) undelete(query string) error {
+	var uuid string
+	for _, d := range u.store.DeletedEntries() {
+		if d.UUID == query || strings.EqualFold(d.Name, query) {
+			uuid = d.UUID
+			break
+		}
+	}
+	if len(uuid) == 0 {
+		errColor.Printf("no deleted entry named %q, see deleted\n", query)
+		return nil
+	}
+
+	newUUID, err := u.store.Undelete(uuid)
+	if err != nil {
+		return err
+	}
+
+	blob, err := u.store.MustFind(newUUID)
+	if err != nil {
+		return err
+	}
+	infoColor.Printf("undeleted %q\n", blob.Name())
+	return nil
+}
+
+// emptyTrash permanently deletes entries that have been in the trash for
+// longer than age, an empty age deletes everything in the trash.
+func (u *uiContext) emptyTrash(age string) error {
+	t := time.Now()
+	if len(age) != 0 {
+		var ok bool
+		if t, ok = parseAge(age, t); !ok {
+			errColor.Printf("could not understand age %q, use a duration (90d, 2w, 6m, 1y) or a date (2006-01-02)\n", age)
+			return nil
+		}
+	}
+
+	errColor.Println("WARNING: This will delete the entries in the trash including ALL history irrecoverably")
+	if ok, err := u.getYesNo("are you sure you wish to proceed?"); err != nil || !ok {
+		return err
+	}
+
+	deleted, err := u.store.EmptyTrash(t)
+	if err != nil {
+		return err
+	}
+	if len(deleted) == 0 {
+		infoColor.Println("Nothing to delete")
+		return nil
+	}
+
+	sort.Strings(deleted)
+	errColor.Printf("DELETED:\n  %s\n", strings.Join(deleted, "\n  "))
+	return nil
+}
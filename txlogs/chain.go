@@ -0,0 +1,146 @@
+package txlogs
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"sort"
+)
+
+// ErrNoChainKey is returned when verifying the chain without a key set
+var ErrNoChainKey = errors.New("no chain key set")
+
+// SetChainKey sets the key used to chain each entry's transactions together.
+// Every transaction made while a key is set gets a MAC over itself and the
+// MAC of the entry's previous transaction, so changing or removing one in the
+// middle of an entry's history breaks the chain (see VerifyChain).
+//
+// The log is rechained with the key if it's different from the one set
+// before, as happens when the passphrase is changed. A log that was never
+// chained is left as it is, every entry in it is broken until it's chained
+// with Rechain.
+func (s *DB) SetChainKey(key []byte) {
+	old := s.chainKey
+	s.chainKey = key
+	if len(key) == 0 {
+		return
+	}
+
+	if len(old) != 0 && !hmac.Equal(old, key) {
+		s.Rechain()
+	}
+}
+
+// HasChainKey returns true if a chain key has been set
+func (s *DB) HasChainKey() bool {
+	return len(s.chainKey) != 0
+}
+
+// Rechain recomputes the chain of the given entries (or every entry if none
+// are given) with the current key. This must be done whenever transactions
+// are legitimately changed or reordered outside of this package, after a
+// merge for example.
+func (s *DB) Rechain(uuids ...string) {
+	if len(s.chainKey) == 0 {
+		return
+	}
+
+	only := make(map[string]bool, len(uuids))
+	for _, uuid := range uuids {
+		only[uuid] = true
+	}
+
+	mac := hmac.New(sha256.New, s.chainKey)
+	prev := make(map[string]string)
+	for i, tx := range s.Log {
+		if len(only) != 0 && !only[tx.UUID] {
+			continue
+		}
+
+		s.Log[i].MAC = chainMAC(mac, prev[tx.UUID], tx)
+		prev[tx.UUID] = s.Log[i].MAC
+	}
+}
+
+// VerifyChain checks the chain of every entry against the current key and
+// returns the uuids of the entries whose chain is broken, sorted.
+func (s *DB) VerifyChain() (broken []string, err error) {
+	if len(s.chainKey) == 0 {
+		return nil, ErrNoChainKey
+	}
+
+	return VerifyChain(s.Log, s.chainKey), nil
+}
+
+// VerifyChain checks the chain of every entry in log against key and returns
+// the uuids of the entries whose chain is broken, sorted. A transaction
+// without a MAC breaks the chain like one with the wrong MAC. Only changes in
+// the middle of a chain are found, removing the latest transactions of an
+// entry or all of them can't be detected.
+func VerifyChain(log []Tx, key []byte) (broken []string) {
+	mac := hmac.New(sha256.New, key)
+	prev := make(map[string]string)
+	bad := make(map[string]bool)
+	for _, tx := range log {
+		if bad[tx.UUID] {
+			continue
+		}
+
+		want := chainMAC(mac, prev[tx.UUID], tx)
+		if !hmac.Equal([]byte(want), []byte(tx.MAC)) {
+			bad[tx.UUID] = true
+			broken = append(broken, tx.UUID)
+			continue
+		}
+		prev[tx.UUID] = tx.MAC
+	}
+
+	sort.Strings(broken)
+	return broken
+}
+
+// nextMAC returns the MAC for a transaction about to be appended to the log,
+// it's empty if there's no chain key
+func (s *DB) nextMAC(tx Tx) string {
+	if len(s.chainKey) == 0 {
+		return ""
+	}
+
+	var prev string
+	for i := len(s.Log) - 1; i >= 0; i-- {
+		if s.Log[i].UUID == tx.UUID {
+			prev = s.Log[i].MAC
+			break
+		}
+	}
+
+	return chainMAC(hmac.New(sha256.New, s.chainKey), prev, tx)
+}
+
+// chainMAC computes the MAC of a transaction that comes after prev. Every
+// field is length prefixed so that they can't be shifted into one another.
+func chainMAC(mac hash.Hash, prev string, tx Tx) string {
+	mac.Reset()
+
+	var buf [8]byte
+	write := func(s string) {
+		binary.BigEndian.PutUint64(buf[:], uint64(len(s)))
+		mac.Write(buf[:])
+		mac.Write([]byte(s))
+	}
+
+	write(prev)
+	binary.BigEndian.PutUint64(buf[:], uint64(tx.Time))
+	mac.Write(buf[:])
+	write(string(tx.Kind))
+	write(tx.Reason)
+	write(tx.Device)
+	write(tx.UUID)
+	write(tx.Key)
+	write(tx.Value)
+
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
@@ -19,6 +19,12 @@ type Tx struct {
 	// These fields are metadata about the change
 	Time int64  `msgpack:"time,omitempty" json:"time,omitempty"`
 	Kind TxKind `msgpack:"kind,omitempty" json:"kind,omitempty"`
+	// Reason is why the change was made, see DB.Because
+	Reason string `msgpack:"reason,omitempty" json:"reason,omitempty"`
+	// Device is where the change was made, see DB.SetDevice
+	Device string `msgpack:"device,omitempty" json:"device,omitempty"`
+	// MAC chains the change to the entry's previous one, see DB.SetChainKey
+	MAC string `msgpack:"mac,omitempty" json:"mac,omitempty"`
 
 	// The fields below relate to the object being changed
 	// UUID = The object's id
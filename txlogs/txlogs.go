@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"reflect"
 	"time"
 
 	uuidpkg "github.com/gofrs/uuid"
@@ -32,14 +33,24 @@ import (
 //     ]
 //   }
 type DB struct {
+	// Schema is the version of the layout of the data in the log, it's not
+	// used by this package but is saved and loaded with the rest of the data
+	// so users of the package can migrate older layouts.
+	Schema uint `msgpack:"schema,omitempty" json:"schema,omitempty"`
 	// Version of the snapshot
 	Version uint `msgpack:"version,omitempty" json:"version,omitempty"`
 	// Snapshot of the data at a specific version
 	Snapshot map[string]Entry `msgpack:"snapshot,omitempty" json:"snapshot,omitempty"`
 	// Log of all transactions.
 	Log []Tx `msgpack:"log,omitempty" json:"log,omitempty"`
-
-	txPoint int
+	// Archived is the time (unix nanos) before which transactions that no
+	// longer affect the snapshot have been removed from Log, see Compact.
+	Archived int64 `msgpack:"archived,omitempty" json:"archived,omitempty"`
+
+	txPoint  int
+	reason   string
+	device   string
+	chainKey []byte
 }
 
 // Entry is a cached entry in the store, it holds the values as currently
@@ -87,13 +98,15 @@ func (s *DB) Add() (uuid string, err error) {
 	}
 
 	// Does not use appendLog so ID/Time must be filled out by hand
-	s.Log = append(s.Log,
-		Tx{
-			Time: time.Now().UnixNano(),
-			Kind: TxAdd,
-			UUID: uuidObj.String(),
-		},
-	)
+	tx := Tx{
+		Time:   time.Now().UnixNano(),
+		Kind:   TxAdd,
+		UUID:   uuidObj.String(),
+		Reason: s.reason,
+		Device: s.device,
+	}
+	tx.MAC = s.nextMAC(tx)
+	s.Log = append(s.Log, tx)
 
 	return uuidObj.String(), nil
 }
@@ -134,9 +147,29 @@ func (s *DB) DeleteKey(uuid, key string) {
 // appendLog creates a new UUID for tx.ID and appends the log
 func (s *DB) appendLog(tx Tx) {
 	tx.Time = time.Now().UnixNano()
+	tx.Reason = s.reason
+	tx.Device = s.device
+	tx.MAC = s.nextMAC(tx)
 	s.Log = append(s.Log, tx)
 }
 
+// Because records reason on every transaction made while fn runs. When
+// calls are nested the innermost reason is used since it's the most
+// specific.
+func (s *DB) Because(reason string, fn func() error) error {
+	old := s.reason
+	s.reason = reason
+	err := fn()
+	s.reason = old
+	return err
+}
+
+// SetDevice records device on every transaction made from now on so changes
+// can be told apart when copies of the log are merged.
+func (s *DB) SetDevice(device string) {
+	s.device = device
+}
+
 // Begin a transaction, will panic if commit/rollback have not been issued
 // after a previous Begin.
 //
@@ -160,7 +193,7 @@ func (s *DB) Rollback() {
 		panic("rollback called before begin")
 	}
 
-	if s.Version > uint(s.txPoint) {
+	if s.Version >= uint(s.txPoint) {
 		s.ResetSnapshot()
 	}
 
@@ -294,6 +327,63 @@ func (s *DB) NVersions(uuid string) (versions int) {
 	return versions
 }
 
+// KeyHistory returns every transaction that set or deleted key on the entry
+// with uuid in the order they occurred.
+func (s *DB) KeyHistory(uuid, key string) (history []Tx) {
+	for _, tx := range s.Log {
+		if tx.UUID != uuid || tx.Key != key {
+			continue
+		}
+		if tx.Kind == TxSetKey || tx.Kind == TxDeleteKey {
+			history = append(history, tx)
+		}
+	}
+
+	return history
+}
+
+// Redact rewrites the values of the key in previous transactions with fn so
+// that old values are no longer kept in the log, while still recording when
+// they changed. The most recent set of the key is left alone unless the key
+// has since been deleted. Returns the number of transactions changed.
+//
+// Other copies of the log still have the old values until they are redacted
+// as well.
+func (s *DB) Redact(uuid, key string, fn func(value string) string) (n int) {
+	last := -1
+	for i := len(s.Log) - 1; i >= 0; i-- {
+		tx := s.Log[i]
+		if tx.UUID == uuid && tx.Key == key && (tx.Kind == TxSetKey || tx.Kind == TxDeleteKey) {
+			if tx.Kind == TxSetKey {
+				last = i
+			}
+			break
+		}
+	}
+
+	for i, tx := range s.Log {
+		if i == last || tx.Kind != TxSetKey || tx.UUID != uuid || tx.Key != key {
+			continue
+		}
+
+		if value := fn(tx.Value); value != tx.Value {
+			s.Log[i].Value = value
+			n++
+		}
+	}
+
+	if n != 0 {
+		s.Rechain(uuid)
+	}
+
+	// A snapshot from before the last change could hold a redacted value
+	if n != 0 && s.Version < uint(len(s.Log)) {
+		s.ResetSnapshot()
+	}
+
+	return n
+}
+
 // LastUpdated returns the unix nanosecond timestamp for when the entry was
 // updated last. Will be -1 if the entry is not found.
 func (s *DB) LastUpdated(uuid string) (last int64) {
@@ -309,6 +399,269 @@ func (s *DB) LastUpdated(uuid string) (last int64) {
 	return last
 }
 
+// Check the structure of the log and the snapshot. The log is replayed from
+// the beginning into a new snapshot and each transaction checked to be sane,
+// if a snapshot is present it's compared to the replayed one at the same
+// version. All problems found are returned, nil means the db is consistent.
+func (s *DB) Check() (problems []error) {
+	replay := make(map[string]Entry)
+
+	for i, tx := range s.Log {
+		switch tx.Kind {
+		case TxAdd, TxDelete:
+		case TxSetKey, TxDeleteKey:
+			if len(tx.Key) == 0 {
+				problems = append(problems, fmt.Errorf("tx %d (%s): key is empty", i, tx.Kind))
+			}
+		default:
+			problems = append(problems, fmt.Errorf("tx %d: unknown kind %q", i, tx.Kind))
+			continue
+		}
+
+		if len(tx.UUID) == 0 {
+			problems = append(problems, fmt.Errorf("tx %d (%s): uuid is empty", i, tx.Kind))
+		}
+		if tx.Time == 0 {
+			problems = append(problems, fmt.Errorf("tx %d (%s): time is not set", i, tx.Kind))
+		}
+
+		if err := applyTx(replay, tx); err != nil {
+			problems = append(problems, fmt.Errorf("tx %d (%s): %w", i, tx.Kind, err))
+		}
+
+		if s.Snapshot != nil && uint(i+1) == s.Version && !reflect.DeepEqual(replay, s.Snapshot) {
+			problems = append(problems, fmt.Errorf("snapshot at version %d does not match the log", s.Version))
+		}
+	}
+
+	if s.Version > uint(len(s.Log)) {
+		problems = append(problems, fmt.Errorf("snapshot version %d is past the end of the log (%d)", s.Version, len(s.Log)))
+	}
+
+	return problems
+}
+
+// Compact removes the transactions that happened before the given time (unix
+// nanos) that no longer have any effect on the snapshot: values that were
+// overwritten or deleted and entries that were deleted. What's left replays to
+// the same snapshot. The removed transactions are returned so they can be
+// archived.
+//
+// The first transaction is always kept so that the log still shares its root
+// with other copies of it when merging.
+func (s *DB) Compact(before int64) (removed []Tx, err error) {
+	if s.txPoint != 0 {
+		return nil, errors.New("refusing to compact while transaction active")
+	}
+
+	n := s.countBefore(before)
+	if n == 0 {
+		return nil, nil
+	}
+
+	removed = s.compact(n, "")
+	if before > s.Archived {
+		s.Archived = before
+	}
+	s.ResetSnapshot()
+	return removed, s.UpdateSnapshot()
+}
+
+// Purge removes the transactions for a single entry that happened before the
+// given time (unix nanos) and no longer have any effect on the snapshot, the
+// same way Compact does for the whole log. The removed transactions are
+// returned.
+func (s *DB) Purge(uuid string, before int64) (removed []Tx, err error) {
+	if s.txPoint != 0 {
+		return nil, errors.New("refusing to purge while transaction active")
+	}
+
+	n := s.countBefore(before)
+	if n == 0 {
+		return nil, nil
+	}
+
+	removed = s.compact(n, uuid)
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	s.ResetSnapshot()
+	return removed, s.UpdateSnapshot()
+}
+
+// Trim removes the oldest transactions of an entry that no longer have any
+// effect on the snapshot until the entry has at most max transactions, or
+// only ones that still have an effect are left. The removed transactions are
+// returned.
+func (s *DB) Trim(uuid string, max int) (removed []Tx, err error) {
+	if s.txPoint != 0 {
+		return nil, errors.New("refusing to trim while transaction active")
+	}
+
+	var txs []int
+	for i, tx := range s.Log {
+		if tx.UUID == uuid {
+			txs = append(txs, i)
+		}
+	}
+	extra := len(txs) - max
+	if extra <= 0 {
+		return nil, nil
+	}
+
+	// Walk backwards so a set is superseded if the key was touched again
+	// later
+	superseded := make(map[int]bool)
+	touched := make(map[string]bool)
+	for j := len(txs) - 1; j >= 0; j-- {
+		i := txs[j]
+		tx := s.Log[i]
+		switch tx.Kind {
+		case TxSetKey, TxDeleteKey:
+			if touched[tx.Key] || tx.Kind == TxDeleteKey {
+				superseded[i] = true
+			}
+			touched[tx.Key] = true
+		}
+	}
+
+	// The oldest superseded ones go first
+	drop := make(map[int]bool)
+	for _, i := range txs {
+		if len(drop) == extra {
+			break
+		}
+		if superseded[i] && i != 0 {
+			drop[i] = true
+		}
+	}
+	if len(drop) == 0 {
+		return nil, nil
+	}
+
+	log := make([]Tx, 0, len(s.Log)-len(drop))
+	for i, tx := range s.Log {
+		if drop[i] {
+			removed = append(removed, tx)
+		} else {
+			log = append(log, tx)
+		}
+	}
+
+	s.Log = log
+	s.Rechain(uuid)
+	s.ResetSnapshot()
+	return removed, s.UpdateSnapshot()
+}
+
+// countBefore returns how many transactions happened before the given time
+func (s *DB) countBefore(before int64) int {
+	n := 0
+	for n < len(s.Log) && s.Log[n].Time < before {
+		n++
+	}
+	return n
+}
+
+// compact removes the transactions in the first n that no longer have any
+// effect on the snapshot and returns them. If only is not empty just that
+// entry's transactions are removed.
+func (s *DB) compact(n int, only string) (removed []Tx) {
+	type effective struct {
+		add     int
+		deleted int
+		keys    map[string]int
+	}
+	entries := make(map[string]*effective)
+	for i, tx := range s.Log[:n] {
+		e := entries[tx.UUID]
+		if e == nil {
+			e = &effective{add: -1, deleted: -1, keys: make(map[string]int)}
+			entries[tx.UUID] = e
+		}
+
+		switch tx.Kind {
+		case TxAdd:
+			e.add = i
+		case TxDelete:
+			e.deleted = i
+		case TxSetKey:
+			e.keys[tx.Key] = i
+		case TxDeleteKey:
+			delete(e.keys, tx.Key)
+		}
+	}
+
+	keep := make([]bool, n)
+	keep[0] = true
+	for uuid, e := range entries {
+		if e.deleted >= 0 {
+			if uuid == s.Log[0].UUID {
+				keep[e.deleted] = true
+			}
+			continue
+		}
+
+		if e.add >= 0 {
+			keep[e.add] = true
+		}
+		for _, i := range e.keys {
+			keep[i] = true
+		}
+	}
+
+	log := make([]Tx, 0, len(s.Log))
+	for i, tx := range s.Log[:n] {
+		if keep[i] || (len(only) != 0 && tx.UUID != only) {
+			log = append(log, tx)
+		} else {
+			removed = append(removed, tx)
+		}
+	}
+	log = append(log, s.Log[n:]...)
+
+	s.Log = log
+	if len(removed) != 0 {
+		uuids := make([]string, 0, len(removed))
+		for _, tx := range removed {
+			uuids = append(uuids, tx.UUID)
+		}
+		s.Rechain(uuids...)
+	}
+	return removed
+}
+
+// Union combines two logs that are each ordered by time into one, leaving
+// out transactions that appear in both.
+func Union(a, b []Tx) []Tx {
+	c := make([]Tx, 0, len(a)+len(b))
+	i, j := 0, 0
+	for i < len(a) || j < len(b) {
+		var next Tx
+		switch {
+		case j >= len(b) || (i < len(a) && a[i].Time <= b[j].Time):
+			next = a[i]
+			i++
+		default:
+			next = b[j]
+			j++
+		}
+
+		duplicate := false
+		for k := len(c) - 1; k >= 0 && c[k].Time == next.Time; k-- {
+			if c[k] == next {
+				duplicate = true
+				break
+			}
+		}
+		if !duplicate {
+			c = append(c, next)
+		}
+	}
+
+	return c
+}
+
 // Merge logs together. The standard case for merging is that the logs proceed
 // in order with the same uuids.
 //
@@ -539,6 +539,21 @@ func TestTransactionsDo(t *testing.T) {
 	if len(store.Log) != 3 {
 		t.Error("should have 3 txs")
 	}
+
+	// A snapshot containing only the first tx of the transaction must be
+	// invalidated as well
+	must(t, store.UpdateSnapshot())
+	uuid := store.Log[0].UUID
+	_ = store.Do(func() error {
+		store.Set(uuid, "test1", "changed")
+		must(t, store.UpdateSnapshot())
+		return errors.New("fail")
+	})
+
+	must(t, store.UpdateSnapshot())
+	if got := store.Snapshot[uuid]["test1"]; got != "value" {
+		t.Error("the rollback didn't rollback the set, got:", got)
+	}
 }
 
 func TestRollbackN(t *testing.T) {
@@ -614,6 +629,47 @@ func TestNVersions(t *testing.T) {
 	}
 }
 
+func TestBecause(t *testing.T) {
+	t.Parallel()
+
+	store := new(DB)
+	uuid, err := store.Add()
+	must(t, err)
+
+	err = store.Because("outer", func() error {
+		store.Set(uuid, "user", "me")
+		return store.Because("inner", func() error {
+			store.Set(uuid, "pass", "one")
+			return nil
+		})
+	})
+	must(t, err)
+	store.Set(uuid, "pass", "two")
+
+	reasons := []string{"", "outer", "inner", ""}
+	for i, tx := range store.Log {
+		if tx.Reason != reasons[i] {
+			t.Errorf("%d) reason was wrong: %q", i, tx.Reason)
+		}
+	}
+}
+
+func TestSetDevice(t *testing.T) {
+	t.Parallel()
+
+	store := new(DB)
+	store.SetDevice("laptop")
+	uuid, err := store.Add()
+	must(t, err)
+	store.Set(uuid, "user", "me")
+
+	for i, tx := range store.Log {
+		if tx.Device != "laptop" {
+			t.Errorf("%d) device was wrong: %q", i, tx.Device)
+		}
+	}
+}
+
 func TestLastUpdated(t *testing.T) {
 	t.Parallel()
 
@@ -631,6 +687,96 @@ func TestLastUpdated(t *testing.T) {
 	}
 }
 
+func TestKeyHistory(t *testing.T) {
+	t.Parallel()
+
+	store := new(DB)
+	uuid, err := store.Add()
+	must(t, err)
+
+	store.Set(uuid, "pass", "one")
+	store.Set(uuid, "user", "me")
+	store.Set(uuid, "pass", "two")
+	store.DeleteKey(uuid, "pass")
+
+	history := store.KeyHistory(uuid, "pass")
+	if len(history) != 3 {
+		t.Fatal("wrong number of changes:", len(history))
+	}
+	if history[0].Value != "one" || history[1].Value != "two" || history[2].Kind != TxDeleteKey {
+		t.Error("history was wrong:", history)
+	}
+}
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+
+	store := new(DB)
+	uuid, err := store.Add()
+	must(t, err)
+
+	redact := func(string) string { return "x" }
+
+	store.Set(uuid, "answer", "one")
+	store.Set(uuid, "user", "me")
+	store.Set(uuid, "answer", "two")
+	if n := store.Redact(uuid, "answer", redact); n != 1 {
+		t.Error("wrong number redacted:", n)
+	}
+
+	history := store.KeyHistory(uuid, "answer")
+	if history[0].Value != "x" || history[1].Value != "two" {
+		t.Error("history was wrong:", history)
+	}
+	must(t, store.UpdateSnapshot())
+	if got := store.Snapshot[uuid]["answer"]; got != "two" {
+		t.Error("current value should be kept:", got)
+	}
+
+	// Once deleted there is no current value to keep
+	store.DeleteKey(uuid, "answer")
+	if n := store.Redact(uuid, "answer", redact); n != 1 {
+		t.Error("wrong number redacted:", n)
+	}
+	if n := store.Redact(uuid, "answer", redact); n != 0 {
+		t.Error("redacting again should do nothing:", n)
+	}
+	if problems := store.Check(); len(problems) != 0 {
+		t.Error(problems)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	t.Parallel()
+
+	store := new(DB)
+	uuid, err := store.Add()
+	must(t, err)
+	store.Set(uuid, "test1", "value")
+	must(t, store.UpdateSnapshot())
+
+	if problems := store.Check(); len(problems) != 0 {
+		t.Error("expected no problems:", problems)
+	}
+
+	store.Snapshot[uuid]["test1"] = "tampered"
+	if problems := store.Check(); len(problems) != 1 {
+		t.Error("expected snapshot mismatch:", problems)
+	}
+	store.ResetSnapshot()
+
+	store.Log = append(store.Log,
+		Tx{Time: 1, Kind: "what", UUID: uuid},
+		Tx{Time: 2, Kind: TxSetKey, UUID: "nope", Key: "test1"},
+		Tx{Kind: TxDeleteKey, UUID: uuid},
+	)
+
+	// unknown kind, set on missing uuid, delk no time and no key
+	if problems := store.Check(); len(problems) != 4 {
+		t.Error("expected 4 problems:", problems)
+	}
+}
+
 func randomStore() *DB {
 	s := new(DB)
 
@@ -710,3 +856,227 @@ func must(t *testing.T, err error) {
 		t.Fatal(err)
 	}
 }
+
+func TestCompact(t *testing.T) {
+	t.Parallel()
+
+	store := &DB{Log: []Tx{
+		{Time: 1, Kind: TxAdd, UUID: "gone"},
+		{Time: 2, Kind: TxSetKey, UUID: "gone", Key: "a", Value: "1"},
+		{Time: 3, Kind: TxAdd, UUID: "kept"},
+		{Time: 4, Kind: TxSetKey, UUID: "kept", Key: "a", Value: "1"},
+		{Time: 5, Kind: TxSetKey, UUID: "kept", Key: "a", Value: "2"},
+		{Time: 6, Kind: TxSetKey, UUID: "kept", Key: "b", Value: "1"},
+		{Time: 7, Kind: TxDeleteKey, UUID: "kept", Key: "b"},
+		{Time: 8, Kind: TxDelete, UUID: "gone"},
+		{Time: 9, Kind: TxSetKey, UUID: "kept", Key: "a", Value: "3"},
+	}}
+	must(t, store.UpdateSnapshot())
+	want := store.Snapshot
+
+	removed, err := store.Compact(9)
+	must(t, err)
+
+	var times []int64
+	for _, tx := range store.Log {
+		times = append(times, tx.Time)
+	}
+	if !reflect.DeepEqual(times, []int64{1, 3, 5, 8, 9}) {
+		t.Error("wrong transactions kept:", times)
+	}
+	if len(removed) != 4 {
+		t.Error("wrong transactions removed:", removed)
+	}
+	if store.Archived != 9 {
+		t.Error("archived time not set:", store.Archived)
+	}
+
+	if !reflect.DeepEqual(store.Snapshot, want) {
+		t.Errorf("snapshot changed:\n%#v\n%#v", store.Snapshot, want)
+	}
+
+	// Merging with the uncompacted log brings everything back
+	full := Union(store.Log, removed)
+	if len(full) != 9 {
+		t.Error("union should have every transaction:", len(full))
+	}
+	if full = Union(full, removed); len(full) != 9 {
+		t.Error("union should not duplicate:", len(full))
+	}
+}
+
+func TestPurge(t *testing.T) {
+	t.Parallel()
+
+	store := &DB{Log: []Tx{
+		{Time: 1, Kind: TxAdd, UUID: "other"},
+		{Time: 2, Kind: TxSetKey, UUID: "other", Key: "a", Value: "1"},
+		{Time: 3, Kind: TxAdd, UUID: "purged"},
+		{Time: 4, Kind: TxSetKey, UUID: "purged", Key: "a", Value: "1"},
+		{Time: 5, Kind: TxSetKey, UUID: "other", Key: "a", Value: "2"},
+		{Time: 6, Kind: TxSetKey, UUID: "purged", Key: "a", Value: "2"},
+		{Time: 7, Kind: TxSetKey, UUID: "purged", Key: "b", Value: "1"},
+		{Time: 8, Kind: TxDeleteKey, UUID: "purged", Key: "b"},
+		{Time: 9, Kind: TxSetKey, UUID: "purged", Key: "a", Value: "3"},
+	}}
+	must(t, store.UpdateSnapshot())
+	want := store.Snapshot
+
+	removed, err := store.Purge("purged", 9)
+	must(t, err)
+
+	var times []int64
+	for _, tx := range store.Log {
+		times = append(times, tx.Time)
+	}
+	if !reflect.DeepEqual(times, []int64{1, 2, 3, 5, 6, 9}) {
+		t.Error("wrong transactions kept:", times)
+	}
+	if len(removed) != 3 {
+		t.Error("wrong transactions removed:", removed)
+	}
+	if store.Archived != 0 {
+		t.Error("purging should not set archived:", store.Archived)
+	}
+
+	if !reflect.DeepEqual(store.Snapshot, want) {
+		t.Errorf("snapshot changed:\n%#v\n%#v", store.Snapshot, want)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	t.Parallel()
+
+	store := &DB{Log: []Tx{
+		{Time: 1, Kind: TxAdd, UUID: "other"},
+		{Time: 2, Kind: TxAdd, UUID: "trimmed"},
+		{Time: 3, Kind: TxSetKey, UUID: "trimmed", Key: "a", Value: "1"},
+		{Time: 4, Kind: TxSetKey, UUID: "other", Key: "a", Value: "1"},
+		{Time: 5, Kind: TxSetKey, UUID: "trimmed", Key: "b", Value: "1"},
+		{Time: 6, Kind: TxSetKey, UUID: "trimmed", Key: "a", Value: "2"},
+		{Time: 7, Kind: TxDeleteKey, UUID: "trimmed", Key: "b"},
+		{Time: 8, Kind: TxSetKey, UUID: "trimmed", Key: "a", Value: "3"},
+	}}
+	must(t, store.UpdateSnapshot())
+	want := store.Snapshot
+
+	removed, err := store.Trim("trimmed", 4)
+	must(t, err)
+
+	var times []int64
+	for _, tx := range store.Log {
+		times = append(times, tx.Time)
+	}
+	if !reflect.DeepEqual(times, []int64{1, 2, 4, 6, 7, 8}) {
+		t.Error("wrong transactions kept:", times)
+	}
+	if len(removed) != 2 {
+		t.Error("wrong transactions removed:", removed)
+	}
+	if !reflect.DeepEqual(store.Snapshot, want) {
+		t.Errorf("snapshot changed:\n%#v\n%#v", store.Snapshot, want)
+	}
+
+	// Only what still has an effect is left
+	_, err = store.Trim("trimmed", 1)
+	must(t, err)
+	if n := store.NVersions("trimmed"); n != 2 {
+		t.Error("wrong number of versions left:", n)
+	}
+	if !reflect.DeepEqual(store.Snapshot, want) {
+		t.Errorf("snapshot changed:\n%#v\n%#v", store.Snapshot, want)
+	}
+}
+
+func TestChain(t *testing.T) {
+	t.Parallel()
+
+	store := &DB{Log: []Tx{
+		{Time: 1, Kind: TxAdd, UUID: "a"},
+		{Time: 2, Kind: TxSetKey, UUID: "a", Key: "pass", Value: "1"},
+	}}
+	if _, err := store.VerifyChain(); err != ErrNoChainKey {
+		t.Error("expected no chain key error, got:", err)
+	}
+
+	// An unchained log isn't chained when the key is set, it's broken until
+	// it's rechained
+	store.SetChainKey([]byte("key"))
+	if !store.HasChainKey() {
+		t.Fatal("chain key was not set")
+	}
+	broken, err := store.VerifyChain()
+	must(t, err)
+	if !reflect.DeepEqual(broken, []string{"a"}) {
+		t.Error("unchained entry should be broken:", broken)
+	}
+	store.Rechain()
+
+	b, err := store.Add()
+	must(t, err)
+	store.Set(b, "pass", "1")
+	store.Set("a", "pass", "2")
+	store.Set(b, "pass", "2")
+
+	broken, err = store.VerifyChain()
+	must(t, err)
+	if len(broken) != 0 {
+		t.Error("chains should be intact:", broken)
+	}
+
+	// Changing the middle of a's history breaks only its chain
+	store.Log[1].Value = "changed"
+	broken, err = store.VerifyChain()
+	must(t, err)
+	if !reflect.DeepEqual(broken, []string{"a"}) {
+		t.Error("wrong entries broken:", broken)
+	}
+	store.Log[1].Value = "1"
+
+	// So does removing a change from the middle of b's
+	log := store.Log
+	store.Log = append(append([]Tx(nil), log[:3]...), log[4:]...)
+	broken, err = store.VerifyChain()
+	must(t, err)
+	if !reflect.DeepEqual(broken, []string{b}) {
+		t.Error("wrong entries broken:", broken)
+	}
+	store.Log = log
+
+	// And stripping the MACs of a's history and changing it
+	for i := range store.Log {
+		if store.Log[i].UUID == "a" {
+			store.Log[i].MAC = ""
+		}
+	}
+	store.Log[1].Value = "changed"
+	broken, err = store.VerifyChain()
+	must(t, err)
+	if !reflect.DeepEqual(broken, []string{"a"}) {
+		t.Error("wrong entries broken:", broken)
+	}
+	store.Log[1].Value = "1"
+	store.Rechain("a")
+
+	// Legitimately rewriting history keeps the chain intact
+	store.Redact("a", "pass", func(string) string { return "redacted" })
+	if _, err = store.Trim(b, 1); err != nil {
+		t.Fatal(err)
+	}
+	broken, err = store.VerifyChain()
+	must(t, err)
+	if len(broken) != 0 {
+		t.Error("chains should be intact:", broken)
+	}
+
+	// Changing the key rechains everything
+	store.SetChainKey([]byte("other"))
+	if broken = VerifyChain(store.Log, []byte("key")); len(broken) != 2 {
+		t.Error("old key should no longer verify:", broken)
+	}
+	broken, err = store.VerifyChain()
+	must(t, err)
+	if len(broken) != 0 {
+		t.Error("chains should be intact:", broken)
+	}
+}
@@ -22,26 +22,79 @@ type uiContext struct {
 
 	filename      string
 	shortFilename string
+	// disk is the file as we last loaded or saved it, to notice when
+	// something else changes it
+	disk diskState
 
 	// Decrypted and decoded storage
 	store blobformat.Blobs
+	// undo holds the changes made in this session that can be undone
+	undo blobformat.Undo
 
 	// save user & password for syncing later
 	user string
 	pass string
+	// keyfile is the hash of the keyfile the current user's key needs along
+	// with pass, see unlockPass
+	keyfile []byte
+	// identity is the age identity the file was opened with instead of a
+	// passphrase, user is its recipient
+	identity string
+	// tokenSecret is the secret from the current user's hardware token, it's
+	// needed along with (or instead of) pass, see unlockPass
+	tokenSecret []byte
+	// lockHeld is the lock we have on the file, see lock
+	lockHeld lockInfo
+	// vaults are the other files open along with this one by name, see
+	// openVault
+	vaults map[string]*uiContext
+	// keyCached is set when the file was opened with a key from the OS
+	// keychain, see decryptCached
+	keyCached bool
+
+	// entropy is user supplied entropy mixed into password generation
+	entropy []byte
 
 	// These encryption params that come out of decrypt()
 	// are saved. We need these to tell if we're a multi-user file
 	// as well as provide fast-path decryption for sync'd copies.
 	key, salt, master, ivm []byte
+	// version is the crypt version the keys above are for and the file is
+	// saved with
+	version int
+	// keyCost is what new keys for this file are derived with, it's the cost
+	// of the key the file was opened with so rekeys don't weaken it, see
+	// currentKeyCost
+	keyCost crypt.KeyCost
+	// tokens are the hardware tokens of the file's users, they're kept in
+	// the header instead of the store since they're needed to decrypt it
+	tokens []crypt.Token
+}
+
+// currentKeyCost is the file's key cost, or crypt.DefaultKeyCost for a file
+// that has none yet
+func (u *uiContext) currentKeyCost() crypt.KeyCost {
+	if u.keyCost == (crypt.KeyCost{}) {
+		return crypt.DefaultKeyCost
+	}
+	return u.keyCost
+}
+
+// deriveKey derives a key for this file with its key cost
+func (u *uiContext) deriveKey(version int, passphrase []byte) (key, salt []byte, err error) {
+	return crypt.DeriveKeyCost(version, passphrase, u.currentKeyCost())
 }
 
 func (u *uiContext) makeParams() (*crypt.Params, error) {
 	if len(u.master) == 0 {
-		return &crypt.Params{
+		p := &crypt.Params{
 			Keys:  [][]byte{u.key},
 			Salts: [][]byte{u.salt},
-		}, nil
+		}
+		if t, ok := crypt.FindToken(u.tokens, nil); ok {
+			p.Tokens = []crypt.Token{t}
+		}
+		return p, nil
 	}
 
 	var p crypt.Params
@@ -88,6 +141,9 @@ func (u *uiContext) makeParams() (*crypt.Params, error) {
 		p.Salts = append(p.Salts, salt)
 		p.IVs = append(p.IVs, iv)
 		p.MKeys = append(p.MKeys, mkey)
+		if t, ok := crypt.FindToken(u.tokens, []byte(name)); ok {
+			p.Tokens = append(p.Tokens, t)
+		}
 		p.NUsers++
 		index++
 	}
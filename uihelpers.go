@@ -2,10 +2,12 @@ package main
 
 import (
 	"fmt"
+	"io"
 	"sort"
 	"strconv"
 	"strings"
 
+	"github.com/aarondl/bpass/blobformat"
 	"github.com/aarondl/bpass/pinentry"
 
 	"github.com/aarondl/color"
@@ -68,35 +70,43 @@ func (u *uiContext) promptMultiline(prompt string) (string, error) {
 // findOne returns a uuid iff a single one could be found, else an error
 // message will have been printed to the user.
 func (u *uiContext) findOne(query string) (string, error) {
-	entries, err := u.store.Search(query)
+	// A uuid always refers to exactly one entry
+	if blob, err := u.store.Find(query); err != nil {
+		return "", err
+	} else if blob != nil {
+		infoColor.Printf("using: %s\n", blob.Name())
+		return query, nil
+	}
+
+	ranked, err := u.store.SearchRanked(query, 0)
 	if err != nil {
 		return "", err
 	}
 
-	switch len(entries) {
+	switch len(ranked) {
 	case 0:
 		errColor.Printf("No matches for query (%q)\n", query)
 		return "", nil
 	case 1:
-		ids := entries.UUIDs()
-		id := ids[0]
-		name := entries[id]
-		if query != name {
-			infoColor.Printf("using: %s\n", name)
+		if query != ranked[0].Name {
+			infoColor.Printf("using: %s\n", ranked[0].Name)
 		}
 
-		return id, nil
+		return ranked[0].UUID, nil
 	}
 
 	// If there's an exact match use that
-	for u, name := range entries {
-		if name == query {
-			return u, nil
+	for _, r := range ranked {
+		if r.Name == query {
+			return r.UUID, nil
 		}
 	}
 
-	names := entries.Names()
-	sort.Strings(names)
+	// Best matches first
+	names := make([]string, len(ranked))
+	for i, r := range ranked {
+		names[i] = r.Name
+	}
 	errColor.Printf("Multiple matches for query (%q):", query)
 	fmt.Print("\n  ")
 	fmt.Println(strings.Join(names, "\n  "))
@@ -104,6 +114,43 @@ func (u *uiContext) findOne(query string) (string, error) {
 	return "", nil
 }
 
+// findResolved is findOne but follows aliases to the entry they point at
+func (u *uiContext) findResolved(query string) (string, error) {
+	uuid, err := u.findOne(query)
+	if err != nil || len(uuid) == 0 {
+		return uuid, err
+	}
+
+	target, err := u.store.Resolve(uuid)
+	if err != nil {
+		errColor.Println(err)
+		return "", nil
+	}
+
+	if target != uuid {
+		infoColor.Printf("alias: %s -> %s\n", blobformat.Blob(u.store.Snapshot[uuid]).Name(), blobformat.Blob(u.store.Snapshot[target]).Name())
+	}
+
+	return target, nil
+}
+
+// withAliases returns the names of the entries sorted, aliases are shown
+// with the name of the entry they resolve to.
+func (u *uiContext) withAliases(entries blobformat.SearchResults) []string {
+	names := make([]string, 0, len(entries))
+	for uuid, name := range entries {
+		if target, err := u.store.Resolve(uuid); err != nil {
+			name += " -> (broken)"
+		} else if target != uuid {
+			name += " -> " + blobformat.Blob(u.store.Snapshot[target]).Name()
+		}
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	return names
+}
+
 func (u *uiContext) getYesNo(question string) (bool, error) {
 	for {
 		str, err := u.prompt(promptColor.Sprintf("%s (y/n): ", question))
@@ -233,16 +280,23 @@ func (u *uiContext) getPassword() (string, error) {
 		infoColor.Println("Enter a number to adjust length, a letter to toggle/use a feature\nor a letter followed by a number to ensure at least n of that type")
 		infoColor.Printf("  length: %-3d [u]pper: %-3s [l]ower: %-3s\n", length, showSetting(upper), showSetting(lower))
 		infoColor.Printf("[n]umber: %-3s [b]asic: %-3s [e]xtra: %-3s\n", showSetting(number), showSetting(basic), showSetting(extra))
-		infoColor.Println("[y] accept password, [m] manual password entry, [enter] to regen password, [?] help")
+		infoColor.Println("[y] accept password, [m] manual password entry, [x] mix in dice rolls/file entropy")
+		infoColor.Println("[enter] to regen password, [?] help")
 		fmt.Println()
 	}
 	help()
 
 	var err error
 	var choice, password string
+	var entropy io.Reader
 	for {
 		if choice != "?" {
-			password, err = genPassword(length, upper, lower, number, basic, extra)
+			entropy, err = u.passwordEntropy()
+			if err != nil {
+				return "", err
+			}
+
+			password, err = genPasswordFrom(entropy, length, upper, lower, number, basic, extra)
 			if err == errPasswordImpossible {
 				errColor.Println("Could not generate password with these requirements")
 			} else if err != nil {
@@ -254,7 +308,7 @@ func (u *uiContext) getPassword() (string, error) {
 			fmt.Fprintln(u.out, promptColor.Sprint("password:"), passColor.Sprint(password))
 		}
 
-		choice, err = u.prompt(promptColor.Sprint("u/l/n/b/e/y/m/enter/?> "))
+		choice, err = u.prompt(promptColor.Sprint("u/l/n/b/e/y/m/x/enter/?> "))
 		if err != nil {
 			return "", err
 		}
@@ -284,6 +338,10 @@ func (u *uiContext) getPassword() (string, error) {
 			return initial, err
 		case choice == "?":
 			help()
+		case choice == "x":
+			if err = u.promptEntropy(); err != nil {
+				return "", err
+			}
 		case splits[0] == "u":
 			setSetting("uppercase", splits, &upper)
 		case splits[0] == "l":
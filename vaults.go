@@ -0,0 +1,203 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// mainVault is the name of the file bpass was started with when other files
+// are open along with it
+const mainVault = "main"
+
+// vaultSeparator separates a vault's name from an entry: work:github
+const vaultSeparator = ":"
+
+// validVaultName checks a name can be used as a vault: prefix
+func validVaultName(name string) bool {
+	if len(name) == 0 {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z') && !(r >= 'A' && r <= 'Z') && !(r >= '0' && r <= '9') && r != '-' && r != '_' {
+			return false
+		}
+	}
+	return true
+}
+
+// openVault opens another file along with this one, its entries are named
+// name:entry in commands until it's closed.
+func (u *uiContext) openVault(name, filename string) error {
+	if !validVaultName(name) {
+		errColor.Println("vault names can only have letters, numbers, - and _")
+		return nil
+	}
+	if name == mainVault {
+		errColor.Printf("%s is the file bpass was started with\n", mainVault)
+		return nil
+	}
+	if _, ok := u.vaults[name]; ok {
+		errColor.Printf("%s is already open, closevault it first\n", name)
+		return nil
+	}
+
+	other, err := u.openOther(filename)
+	if err != nil {
+		return err
+	}
+	for n, v := range u.vaults {
+		if v.filename == other.filename {
+			other.unlock()
+			errColor.Printf("%s is already open as %s\n", other.shortFilename, n)
+			return nil
+		}
+	}
+
+	if u.vaults == nil {
+		u.vaults = make(map[string]*uiContext)
+	}
+	u.vaults[name] = other
+
+	infoColor.Printf("opened %s as %s, use %s%sentry to name its entries\n", other.shortFilename, name, name, vaultSeparator)
+	return nil
+}
+
+// openVaults opens the files in a list of name=file,name=file
+func (u *uiContext) openVaults(list string) error {
+	for _, v := range strings.Split(list, ",") {
+		v = strings.TrimSpace(v)
+		if len(v) == 0 {
+			continue
+		}
+
+		parts := strings.SplitN(v, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("vaults are name=file, got: %s", v)
+		}
+		if err := u.openVault(parts[0], parts[1]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// closeVault saves and closes a vault opened with openVault
+func (u *uiContext) closeVault(name string) error {
+	other, ok := u.vaults[name]
+	if !ok {
+		errColor.Printf("%s is not open\n", name)
+		return nil
+	}
+
+	if err := other.saveBlob(); err != nil {
+		return fmt.Errorf("failed to save %s: %w", other.shortFilename, err)
+	}
+	other.unlock()
+	delete(u.vaults, name)
+
+	infoColor.Println("closed", name)
+	return nil
+}
+
+// saveVaults saves all the open vaults, each is tried even if one fails
+func (u *uiContext) saveVaults() error {
+	var failed []string
+	for _, name := range u.vaultNames() {
+		other := u.vaults[name]
+		if err := other.saveBlob(); err != nil {
+			errColor.Printf("failed to save %s: %v\n", other.shortFilename, err)
+			failed = append(failed, name)
+		}
+	}
+
+	if len(failed) != 0 {
+		return fmt.Errorf("failed to save vaults: %s", strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// unlockVaults releases the locks of all the open vaults
+func (u *uiContext) unlockVaults() {
+	for _, other := range u.vaults {
+		other.unlock()
+	}
+}
+
+// vaultNames returns the names of the open vaults sorted
+func (u *uiContext) vaultNames() []string {
+	names := make([]string, 0, len(u.vaults))
+	for name := range u.vaults {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// listVaults shows the open vaults
+func (u *uiContext) listVaults() error {
+	fmt.Printf("%s %s\n", keyColor.Sprint(mainVault), u.shortFilename)
+	for _, name := range u.vaultNames() {
+		other := u.vaults[name]
+		fmt.Printf("%s %s\n", keyColor.Sprint(name), other.shortFilename)
+	}
+	return nil
+}
+
+// vault returns an open vault by name, main is this file
+func (u *uiContext) vault(name string) (*uiContext, bool) {
+	if name == mainVault {
+		return u, true
+	}
+	other, ok := u.vaults[name]
+	return other, ok
+}
+
+// splitVault splits vault:entry, ok is false if the prefix isn't an open
+// vault in which case it's all an entry (names can have colons).
+func (u *uiContext) splitVault(arg string) (vault *uiContext, entry string, ok bool) {
+	i := strings.Index(arg, vaultSeparator)
+	if i < 0 {
+		return u, arg, false
+	}
+
+	vault, ok = u.vault(arg[:i])
+	if !ok {
+		return u, arg, false
+	}
+	return vault, arg[i+len(vaultSeparator):], true
+}
+
+// transferToVault copies (or moves) an entry and its history from one open
+// vault to another, the entry is vault:entry or an entry in this file.
+func (u *uiContext) transferToVault(search, to string, move bool) error {
+	from, search, _ := u.splitVault(search)
+	other, ok := u.vault(strings.TrimSuffix(to, vaultSeparator))
+	if !ok {
+		errColor.Printf("%s is not open, see openvault\n", to)
+		return nil
+	}
+	if from == other {
+		errColor.Println("the entry is already in that vault")
+		return nil
+	}
+	if other.readOnly {
+		errColor.Println("cannot copy entries to a read-only vault")
+		return nil
+	}
+
+	uuid, err := from.findOne(search)
+	if err != nil {
+		return err
+	}
+	if len(uuid) == 0 {
+		errColor.Println("entry not found")
+		return nil
+	}
+
+	if err = from.transferEntry(uuid, other, move); err != nil {
+		errColor.Println(err)
+	}
+	return nil
+}
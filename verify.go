@@ -0,0 +1,206 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/chunkstore"
+	"github.com/aarondl/bpass/crypt"
+	"github.com/aarondl/bpass/txlogs"
+)
+
+var errVerifyFailed = errors.New("verification failed")
+
+// verifyFile checks a file for corruption. Without full only the parts that
+// don't require a passphrase are checked. With full the file is decrypted
+// (which checks the integrity hash) and the log and entries are checked
+// for structural problems.
+//
+// The user of a multi-user file is prompted for unless it's given and the
+// passphrase is read from passphraseFile if it's set so that this can be run
+// unattended.
+func (u *uiContext) verifyFile(filename string, full bool, user, passphraseFile string) error {
+	payload, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+
+	header, err := crypt.ReadHeader(payload)
+	if err != nil {
+		errColor.Println("header:", err)
+		return errVerifyFailed
+	}
+
+	about := "single user"
+	if header.NUsers != 0 {
+		about = fmt.Sprintf("%d users", header.NUsers)
+	}
+	for i := range header.Users {
+		for j := i + 1; j < len(header.Users); j++ {
+			if bytes.Equal(header.Users[i], header.Users[j]) {
+				errColor.Printf("header: user slots %d and %d are the same user\n", i, j)
+				return errVerifyFailed
+			}
+		}
+	}
+	if len(header.Tokens) != 0 {
+		about += fmt.Sprintf(", %d tokens", len(header.Tokens))
+	}
+	if header.Version >= 5 {
+		about += ", " + header.Descriptor.String()
+	}
+	infoColor.Printf("header: ok (version %d, %s, %d byte payload)\n", header.Version, about, header.PayloadLen)
+
+	if !full {
+		return nil
+	}
+
+	var pwd string
+	if header.NUsers == 0 {
+		user = ""
+	} else if len(user) == 0 {
+		user, err = u.prompt(promptColor.Sprintf("%s user: ", shortPath(filename)))
+		if err != nil {
+			return err
+		}
+	}
+
+	passphrase, err := u.unlockToken(header, user)
+	if err != nil {
+		return err
+	}
+
+	// Tokens can be all that's needed
+	if passphrase && len(passphraseFile) != 0 {
+		b, err := ioutil.ReadFile(passphraseFile)
+		if err != nil {
+			return err
+		}
+		pwd = strings.TrimRight(string(b), "\r\n")
+	} else if passphrase {
+		pwd, err = u.promptPassword(promptColor.Sprintf("%s passphrase: ", shortPath(filename)))
+		if err != nil {
+			return err
+		}
+	}
+
+	_, params, pt, err := crypt.Decrypt([]byte(user), []byte(u.unlockPass(pwd)), nil, nil, payload)
+	switch err {
+	case nil:
+	case crypt.ErrCorrupt:
+		errColor.Println("payload: the passphrase is right but the header or payload was changed or damaged")
+		return errVerifyFailed
+	case crypt.ErrWrongPassphrase:
+		if header.NUsers == 0 {
+			errColor.Println("payload: wrong passphrase, or the header or payload was changed or damaged")
+		} else {
+			errColor.Println("payload: wrong passphrase, or the user's slot in the header was changed or damaged")
+		}
+		return errVerifyFailed
+	default:
+		errColor.Println("payload:", err)
+		return errVerifyFailed
+	}
+	infoColor.Println("payload: ok (integrity hash matches)")
+
+	db, err := txlogs.New(pt)
+	if err != nil {
+		errColor.Println("log: failed to parse:", err)
+		return errVerifyFailed
+	}
+
+	problems := blobformat.Blobs{DB: db}.Check()
+	if len(problems) != 0 {
+		for _, p := range problems {
+			errColor.Println("log:", p)
+		}
+		return errVerifyFailed
+	}
+	infoColor.Printf("log: ok (%d transactions)\n", len(db.Log))
+
+	if err = verifyHistory(db, params); err != nil {
+		return err
+	}
+
+	return verifyBackups(filename, user, params)
+}
+
+// verifyHistory checks the hash chains of each entry's history, once a file
+// is chained an entry without them fails like one whose chain is broken
+func verifyHistory(db *txlogs.DB, params crypt.Params) error {
+	store := blobformat.Blobs{DB: db}
+	if !store.HistoryChained() {
+		infoColor.Println("history: not chained yet (saved by an older version)")
+		return nil
+	}
+	db.SetChainKey(paramsHistoryKey(params))
+	broken, err := store.VerifyHistory()
+	if err != nil {
+		return err
+	}
+	if len(broken) != 0 {
+		snapshot, err := db.SnapshotAt(0)
+		if err != nil {
+			return err
+		}
+		for _, uuid := range broken {
+			name := uuid
+			if entry, ok := snapshot[uuid]; ok {
+				name = blobformat.Blob(entry).Name()
+			}
+			errColor.Printf("history: %s was changed outside of bpass\n", name)
+		}
+		return errVerifyFailed
+	}
+	infoColor.Println("history: ok (chains intact)")
+
+	return nil
+}
+
+// verifyBackups checks every snapshot in the file's backups with the key
+// that opened the file, there not being any backups is fine.
+func verifyBackups(filename, user string, params crypt.Params) error {
+	dir := backupDir(filename)
+	ct, err := ioutil.ReadFile(filepath.Join(dir, "key"))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	_, _, key, err := crypt.Decrypt([]byte(user), nil, params.Keys[params.User], params.Salts[params.User], ct)
+	if err != nil {
+		errColor.Println("backups: failed to decrypt the key:", err)
+		return errVerifyFailed
+	}
+	store, err := chunkstore.Open(dir, key)
+	if err != nil {
+		errColor.Println("backups:", err)
+		return errVerifyFailed
+	}
+
+	problems, err := store.Verify()
+	if err != nil {
+		return err
+	}
+	if len(problems) != 0 {
+		for _, p := range problems {
+			errColor.Println("backups:", p)
+		}
+		return errVerifyFailed
+	}
+
+	snaps, err := store.List()
+	if err != nil {
+		return err
+	}
+	infoColor.Printf("backups: ok (%d snapshots)\n", len(snaps))
+
+	return nil
+}
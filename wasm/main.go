@@ -0,0 +1,142 @@
+// +build js,wasm
+
+// Command wasm exposes a read-only view of bpass files to javascript so that
+// a file can be opened entirely client-side in a browser.
+//
+// Build with:
+//   GOOS=js GOARCH=wasm go build -o bpass.wasm ./wasm
+//
+// And serve it alongside index.html and wasm_exec.js from
+// $(go env GOROOT)/misc/wasm.
+//
+// This sets a global bpass object with the following functions:
+//
+//   bpass.isMultiUser(data: Uint8Array): bool
+//   bpass.open(data: Uint8Array, user: string, passphrase: string): object
+//
+// open returns {error: string} on failure, otherwise {entries: object,
+// secrets: object} where entries maps uuid to an object of key/values and
+// secrets maps uuid to the keys of the entry that should be masked. User,
+// sync, template and trashed entries are left out as are keys hidden by
+// their field metadata. Notes are given as their text separated by blank
+// lines.
+package main
+
+import (
+	"strings"
+	"syscall/js"
+
+	"github.com/aarondl/bpass/blobformat"
+	"github.com/aarondl/bpass/crypt"
+	"github.com/aarondl/bpass/txlogs"
+)
+
+// secretKeys are always masked, other keys are when their field metadata
+// says they're sensitive
+var secretKeys = map[string]bool{
+	blobformat.KeyPass:          true,
+	blobformat.KeyTwoFactor:     true,
+	blobformat.KeyTwoFactors:    true,
+	blobformat.KeyPriv:          true,
+	blobformat.KeyToken:         true,
+	blobformat.KeyQuestions:     true,
+	blobformat.KeyRecoveryCodes: true,
+}
+
+func main() {
+	bpass := js.Global().Get("Object").New()
+	bpass.Set("isMultiUser", js.FuncOf(isMultiUser))
+	bpass.Set("open", js.FuncOf(open))
+	js.Global().Set("bpass", bpass)
+
+	// Keep the functions alive
+	select {}
+}
+
+func isMultiUser(this js.Value, args []js.Value) interface{} {
+	if len(args) != 1 {
+		return false
+	}
+
+	ok, err := crypt.IsMultiUser(bytesFromJS(args[0]))
+	return err == nil && ok
+}
+
+func open(this js.Value, args []js.Value) interface{} {
+	if len(args) != 3 {
+		return jsError("open(data, user, passphrase) requires 3 arguments")
+	}
+
+	data := bytesFromJS(args[0])
+	if _, err := crypt.ReadHeader(data); err != nil {
+		return jsError(err.Error())
+	}
+
+	_, _, pt, err := crypt.Decrypt([]byte(args[1].String()), []byte(args[2].String()), nil, nil, data)
+	if err != nil {
+		return jsError(err.Error())
+	}
+
+	db, err := txlogs.New(pt)
+	if err != nil {
+		return jsError(err.Error())
+	}
+	store := blobformat.Blobs{DB: db}
+	if err = store.UpdateSnapshot(); err != nil {
+		return jsError(err.Error())
+	}
+
+	entries := make(map[string]interface{})
+	secrets := make(map[string]interface{})
+	for uuid, entry := range store.Snapshot {
+		name := blobformat.Blob(entry).Name()
+		if blobformat.IsUserEntry(name) || blobformat.IsTemplateEntry(name) || blobformat.IsSearchEntry(name) || blobformat.IsSyncEntry(name) ||
+			blobformat.IsTrashEntry(name) {
+			continue
+		}
+
+		meta, err := blobformat.Blob(entry).AllFieldMeta()
+		if err != nil {
+			return jsError(err.Error())
+		}
+
+		obj := make(map[string]interface{}, len(entry))
+		var masked []interface{}
+		for k, v := range entry {
+			if k == blobformat.KeyFieldMeta || meta[k].Hidden {
+				continue
+			}
+			if secretKeys[k] || meta[k].Sensitive {
+				masked = append(masked, k)
+			}
+
+			// Numbers and bools go to js as themselves
+			if typed, err := blobformat.Blob(entry).Value(k); err == nil {
+				obj[k] = typed
+			} else {
+				obj[k] = v
+			}
+		}
+		if notes := blobformat.Blob(entry).Notes(); len(notes) != 0 {
+			texts := make([]string, len(notes))
+			for i, n := range notes {
+				texts[i] = n.Text
+			}
+			obj[blobformat.KeyNotes] = strings.Join(texts, "\n\n")
+		}
+		entries[uuid] = obj
+		secrets[uuid] = masked
+	}
+
+	return map[string]interface{}{"entries": entries, "secrets": secrets}
+}
+
+func bytesFromJS(v js.Value) []byte {
+	b := make([]byte, v.Get("length").Int())
+	js.CopyBytesToGo(b, v)
+	return b
+}
+
+func jsError(msg string) interface{} {
+	return map[string]interface{}{"error": msg}
+}
@@ -0,0 +1,36 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+var errNoYkman = errors.New("ykman is needed for two factor keys on a yubikey, install yubikey-manager")
+
+// ykmanCode asks a YubiKey for a code from one of its OATH accounts using
+// ykman from yubikey-manager. It's what blobformat.YubiKeyCode is set to.
+// ykman tells the user to touch the key on stderr for accounts that need it
+// so that's passed through.
+func ykmanCode(account string) (string, error) {
+	ykman, err := exec.LookPath("ykman")
+	if err != nil {
+		return "", errNoYkman
+	}
+
+	cmd := exec.Command(ykman, "oath", "accounts", "code", "--single", account)
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("ykman failed to generate a code for %s: %w", account, err)
+	}
+
+	code := string(bytes.TrimSpace(out))
+	if len(code) == 0 || strings.ContainsAny(code, " \n") {
+		return "", fmt.Errorf("ykman gave an unexpected code for %s: %q", account, code)
+	}
+	return code, nil
+}